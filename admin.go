@@ -0,0 +1,253 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"runtime"
+	"sync/atomic"
+)
+
+// Set by admin API, emitter drops all payloads while replay disabled
+var replayDisabled int32
+
+// AdminPluginStats is item of `inputs` and `outputs` lists of `GET /stats`
+type AdminPluginStats struct {
+	Name     string `json:"name"`
+	Payloads int64  `json:"payloads"`
+	Bytes    int64  `json:"bytes"`
+	Errors   int64  `json:"errors"`
+
+	QueueLength   int `json:"queue_length,omitempty"`
+	QueueCapacity int `json:"queue_capacity,omitempty"`
+	// Payloads dropped because queue was full
+	Dropped int64 `json:"dropped,omitempty"`
+	// Payloads queued or being sent
+	Pending int64 `json:"pending,omitempty"`
+}
+
+// AdminStats is response of `GET /stats`
+type AdminStats struct {
+	Disabled bool `json:"disabled"`
+	Stopping bool `json:"stopping"`
+
+	Goroutines      int   `json:"goroutines"`
+	HTTPConnections int64 `json:"http_connections"`
+
+	Inputs  []AdminPluginStats `json:"inputs"`
+	Outputs []AdminPluginStats `json:"outputs"`
+}
+
+// serveAdmin starts REST API for runtime control:
+//
+//	GET  /stats          counters of all inputs and outputs
+//	POST /disable        stop replaying, captured traffic is dropped, not buffered
+//	POST /enable         continue replaying
+//	GET  /options        options set in command line, config file or API
+//	PUT  /options        change options, e.g. {"output-http": ["staging.com|10%"]}
+//
+// Address without host bound to localhost. API allows to change replay targets, so it
+// can be bound to other interfaces only if token required.
+func serveAdmin(addr, token string) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		log.Fatal("[ADMIN] Invalid address: ", err)
+	}
+
+	if host == "" {
+		host = "127.0.0.1"
+	}
+
+	if ip := net.ParseIP(host); token == "" && host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		log.Fatal("[ADMIN] API bound to non-local address requires --http-admin-token")
+	}
+
+	addr = net.JoinHostPort(host, port)
+	log.Println("[ADMIN] Serving API on", addr)
+
+	if err := http.ListenAndServe(addr, newAdminHandler(token)); err != nil {
+		log.Fatal("[ADMIN] Can't start API server:", err)
+	}
+}
+
+// newAdminHandler returns API handler, which requires `Authorization: Bearer <token>` header if token given
+func newAdminHandler(token string) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		writeJSON(w, adminStats())
+	})
+
+	mux.HandleFunc("/disable", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		atomic.StoreInt32(&replayDisabled, 1)
+		log.Println("[ADMIN] Replay disabled, captured traffic dropped")
+
+		writeJSON(w, adminStats())
+	})
+
+	mux.HandleFunc("/enable", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		atomic.StoreInt32(&replayDisabled, 0)
+		log.Println("[ADMIN] Replay enabled")
+
+		writeJSON(w, adminStats())
+	})
+
+	mux.HandleFunc("/options", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+		case "PUT":
+			var options map[string]interface{}
+
+			// Numbers kept as they written, float64 would turn 1000000 into 1e+06
+			decoder := json.NewDecoder(r.Body)
+			decoder.UseNumber()
+
+			if err := decoder.Decode(&options); err != nil {
+				http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			if err := setOptions(options); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		reloadMu.RLock()
+		options := make(map[string]string)
+		settingsFlags.Visit(func(f *flag.Flag) {
+			options[f.Name] = f.Value.String()
+		})
+		reloadMu.RUnlock()
+
+		writeJSON(w, options)
+	})
+
+	if token == "" {
+		return mux
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// setOptions replaces values of given options and re-initializes plugins, same way as config reload.
+// Values can be strings, numbers, booleans, or lists for options which can be repeated.
+func setOptions(options map[string]interface{}) error {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+
+	values := make(map[string][]string)
+	for name, list := range apiOptions {
+		values[name] = list
+	}
+
+	for name, value := range options {
+		if list, ok := value.([]interface{}); ok {
+			values[name] = []string{}
+
+			for _, v := range list {
+				values[name] = append(values[name], fmt.Sprint(v))
+			}
+		} else {
+			values[name] = []string{fmt.Sprint(value)}
+		}
+	}
+
+	next, fs, err := buildSettings(settingsArgs, configOptions, values)
+	if err != nil {
+		return err
+	}
+
+	apiOptions = values
+
+	applySettings(next, fs)
+
+	log.Printf("[ADMIN] Options changed: %v", options)
+
+	return nil
+}
+
+func adminStats() (stats AdminStats) {
+	reloadMu.RLock()
+	defer reloadMu.RUnlock()
+
+	stats.Disabled = atomic.LoadInt32(&replayDisabled) == 1
+	stats.Stopping = atomic.LoadInt32(&stopping) == 1
+	stats.Goroutines = runtime.NumGoroutine()
+	stats.HTTPConnections = atomic.LoadInt64(&httpConnections)
+
+	for _, in := range Plugins.Inputs {
+		stats.Inputs = append(stats.Inputs, adminPluginStats(in))
+	}
+
+	for _, out := range Plugins.Outputs {
+		stats.Outputs = append(stats.Outputs, adminPluginStats(out))
+	}
+
+	return
+}
+
+func adminPluginStats(plugin interface{}) AdminPluginStats {
+	s := statsFor(plugin)
+
+	stats := AdminPluginStats{
+		Name:     fmt.Sprint(plugin),
+		Payloads: atomic.LoadInt64(&s.totalPayloads),
+		Bytes:    atomic.LoadInt64(&s.totalBytes),
+		Errors:   atomic.LoadInt64(&s.totalErrors),
+	}
+
+	// Limiter wraps actual plugin, which holds the queue and reports its own errors
+	if l, ok := plugin.(*Limiter); ok {
+		plugin = l.plugin
+		stats.Errors += atomic.LoadInt64(&statsFor(plugin).totalErrors)
+	}
+
+	if q, ok := plugin.(queuedPlugin); ok {
+		stats.QueueLength, stats.QueueCapacity = q.QueueLen()
+	}
+
+	if d, ok := plugin.(droppingPlugin); ok {
+		stats.Dropped = d.Dropped()
+	}
+
+	if p, ok := plugin.(pendingPlugin); ok {
+		stats.Pending = p.Pending()
+	}
+
+	return stats
+}
+
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(value)
+}
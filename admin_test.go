@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAdminAPI(t *testing.T) {
+	previousSettings, previousPlugins, previousArgs := Settings, Plugins, settingsArgs
+	defer func() {
+		Settings, Plugins, settingsArgs = previousSettings, previousPlugins, previousArgs
+		settingsFlags, apiOptions = flag.CommandLine, make(map[string][]string)
+		replayDisabled = 0
+	}()
+
+	Settings = AppSettings{}
+	Plugins = new(InOutPlugins)
+	settingsArgs = []string{"--split-output"}
+
+	server := httptest.NewServer(newAdminHandler(""))
+	defer server.Close()
+
+	req, _ := http.NewRequest("PUT", server.URL+"/options", strings.NewReader(`{"output-dummy": ["first", "second|10"]}`))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var options map[string]string
+	json.NewDecoder(resp.Body).Decode(&options)
+	resp.Body.Close()
+
+	if options["output-dummy"] != "[first second|10]" || options["split-output"] != "true" {
+		t.Error("Should return changed and command line options", options)
+	}
+
+	if len(Plugins.Outputs) != 2 {
+		t.Fatal("Should create outputs", Plugins.Outputs)
+	}
+
+	if _, ok := Plugins.Outputs[1].(*Limiter); !ok {
+		t.Error("Should apply limiter")
+	}
+
+	req, _ = http.NewRequest("PUT", server.URL+"/options", strings.NewReader(`{"output-htp": "staging.com"}`))
+	resp, _ = http.DefaultClient.Do(req)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Error("Should reject unknown option", resp.StatusCode)
+	}
+
+	// Numbers passed as written, and options changed before are kept
+	req, _ = http.NewRequest("PUT", server.URL+"/options", strings.NewReader(`{"output-file-max-size": 1000000}`))
+	resp, _ = http.DefaultClient.Do(req)
+	json.NewDecoder(resp.Body).Decode(&options)
+	resp.Body.Close()
+
+	if options["output-file-max-size"] != "1000000" || Settings.outputFileConfig.maxSize != 1000000 || len(Plugins.Outputs) != 2 {
+		t.Error("Should change number option", options, len(Plugins.Outputs))
+	}
+
+	resp, _ = http.Post(server.URL+"/disable", "", nil)
+	resp.Body.Close()
+
+	if replayDisabled != 1 {
+		t.Error("Should disable replay")
+	}
+
+	statsFor(Plugins.Outputs[0]).add(10, nil)
+
+	resp, _ = http.Get(server.URL + "/stats")
+
+	var stats AdminStats
+	json.NewDecoder(resp.Body).Decode(&stats)
+	resp.Body.Close()
+
+	if !stats.Disabled || len(stats.Outputs) != 2 {
+		t.Fatal("Wrong stats", stats)
+	}
+
+	if stats.Outputs[0].Payloads != 1 || stats.Outputs[0].Bytes != 10 {
+		t.Error("Should return plugin counters", stats.Outputs[0])
+	}
+
+	resp, _ = http.Post(server.URL+"/enable", "", nil)
+	resp.Body.Close()
+
+	if replayDisabled != 0 {
+		t.Error("Should enable replay")
+	}
+}
+
+func TestAdminAPIToken(t *testing.T) {
+	server := httptest.NewServer(newAdminHandler("secret"))
+	defer server.Close()
+
+	for header, status := range map[string]int{"": 401, "Bearer wrong": 401, "Bearer secret": 200} {
+		req, _ := http.NewRequest("GET", server.URL+"/stats", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != status {
+			t.Errorf("Expected status %d with header %q, got %d", status, header, resp.StatusCode)
+		}
+	}
+}
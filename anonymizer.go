@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/buger/gor/proto"
+)
+
+// AnonymizerConfig holds list of request parts containing personal data, and how to anonymize them
+type AnonymizerConfig struct {
+	headers MultiOption
+	cookies MultiOption
+	// URL query and form body params
+	params MultiOption
+	// JSON body fields, nested fields separated by dot: user.email, users.*.phone or $.users[*].phone
+	jsonFields MultiOption
+
+	// `hash` replaces value with keyed hash, so same values stay equal and sessions can be followed, `mask` replaces with ***
+	mode string
+	salt string
+}
+
+func (c *AnonymizerConfig) isEmpty() bool {
+	return len(c.headers) == 0 && len(c.cookies) == 0 && len(c.params) == 0 && len(c.jsonFields) == 0
+}
+
+// Anonymizer is a wrapper for output plugin, which hashes or masks personal data before payload written.
+// Used for outputs which store traffic or send it outside, like file or tcp output.
+type Anonymizer struct {
+	plugin io.Writer
+	config *AnonymizerConfig
+
+	jsonPaths [][]string
+}
+
+// NewAnonymizer constructor for Anonymizer, accepts plugin to wrap
+func NewAnonymizer(plugin io.Writer, config *AnonymizerConfig) *Anonymizer {
+	if config.mode != "hash" && config.mode != "mask" {
+		log.Fatal("[ANONYMIZER] Mode should be 'hash' or 'mask': ", config.mode)
+	}
+
+	// Hashes of known values computed by anyone without secret salt, so it generated when not given.
+	// Config shared by all outputs, so hashes stay equal between them.
+	if config.mode == "hash" && config.salt == "" {
+		salt := make([]byte, 16)
+		rand.Read(salt)
+		config.salt = hex.EncodeToString(salt)
+
+		log.Println("[ANONYMIZER] --anonymize-salt not set, random salt used: hashes differ from ones of other runs")
+	}
+
+	a := &Anonymizer{plugin: plugin, config: config}
+
+	for _, field := range config.jsonFields {
+		path, err := parseJSONPath(field)
+		if err != nil {
+			log.Fatal("[ANONYMIZER] ", err)
+		}
+
+		a.jsonPaths = append(a.jsonPaths, path)
+	}
+
+	return a
+}
+
+func (a *Anonymizer) Write(data []byte) (int, error) {
+	// Emitter passes same buffer to all outputs, so data should be copied
+	header := data[:payloadHeaderSize(data)]
+	payload := a.anonymize(append([]byte{}, payloadBody(data)...), isRequestPayload(data))
+
+	if _, err := a.plugin.Write(append(append([]byte{}, header...), payload...)); err != nil {
+		return 0, err
+	}
+
+	return len(data), nil
+}
+
+func (a *Anonymizer) anonymize(payload []byte, isRequest bool) []byte {
+	for _, name := range a.config.headers {
+		if value := proto.Header(payload, []byte(name)); len(value) > 0 {
+			payload = proto.SetHeader(payload, []byte(name), a.value(value))
+		}
+	}
+
+	if isRequest {
+		cookies := make(map[string]string)
+
+		for _, name := range a.config.cookies {
+			if value := proto.Cookie(payload, []byte(name)); len(value) > 0 {
+				cookies[name] = string(a.value(value))
+			}
+		}
+
+		if len(cookies) > 0 {
+			payload = setCookies(payload, cookies)
+		}
+
+		for _, name := range a.config.params {
+			if value, vs, _ := proto.PathParam(payload, []byte(name)); vs != -1 {
+				payload = proto.SetPathParam(payload, []byte(name), a.value(value))
+			}
+
+			if value, found := proto.BodyParam(payload, []byte(name)); found {
+				payload = proto.SetBodyParam(payload, []byte(name), a.value(value))
+			}
+		}
+	} else if len(a.config.cookies) > 0 {
+		payload = a.anonymizeSetCookies(payload)
+	}
+
+	if len(a.jsonPaths) > 0 {
+		payload = a.anonymizeJSON(payload)
+	}
+
+	return payload
+}
+
+// anonymizeSetCookies replaces values of configured cookies set by response, response can have many Set-Cookie headers
+func (a *Anonymizer) anonymizeSetCookies(payload []byte) []byte {
+	headersEnd := proto.MIMEHeadersEndPos(payload)
+	if headersEnd == -1 {
+		return payload
+	}
+
+	lines := bytes.Split(payload[:headersEnd], []byte("\r\n"))
+
+	for i, line := range lines[1:] {
+		colon := bytes.IndexByte(line, ':')
+		if colon == -1 || !bytes.EqualFold(line[:colon], []byte("Set-Cookie")) {
+			continue
+		}
+
+		value := bytes.TrimLeft(line[colon+1:], " ")
+		eq := bytes.IndexByte(value, '=')
+		if eq == -1 {
+			continue
+		}
+
+		name := string(bytes.TrimSpace(value[:eq]))
+		for _, cookie := range a.config.cookies {
+			if cookie != name {
+				continue
+			}
+
+			cookieValue := value[eq+1:]
+			var attributes []byte
+			if semicolon := bytes.IndexByte(cookieValue, ';'); semicolon != -1 {
+				cookieValue, attributes = cookieValue[:semicolon], cookieValue[semicolon:]
+			}
+
+			lines[i+1] = []byte("Set-Cookie: " + name + "=" + string(a.value(cookieValue)) + string(attributes))
+			break
+		}
+	}
+
+	return append(bytes.Join(lines, []byte("\r\n")), payload[headersEnd:]...)
+}
+
+// anonymizeJSON replaces configured fields of JSON body
+func (a *Anonymizer) anonymizeJSON(payload []byte) []byte {
+	return rewriteJSONBody(payload, func(doc interface{}) (interface{}, bool) {
+		changed := false
+
+		for _, path := range a.jsonPaths {
+			doc = rewriteJSONPath(doc, path, a.jsonValue, &changed)
+		}
+
+		return doc, changed
+	})
+}
+
+// jsonValue anonymizes strings and numbers, objects and other values kept as is
+func (a *Anonymizer) jsonValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return string(a.value([]byte(v)))
+	case json.Number:
+		return string(a.value([]byte(v)))
+	}
+
+	return value
+}
+
+// value returns anonymized value
+func (a *Anonymizer) value(value []byte) []byte {
+	if a.config.mode == "mask" {
+		return []byte("***")
+	}
+
+	mac := hmac.New(sha256.New, []byte(a.config.salt))
+	mac.Write(value)
+
+	hash := make([]byte, 16)
+	hex.Encode(hash, mac.Sum(nil)[:8])
+
+	return hash
+}
+
+func (a *Anonymizer) String() string {
+	return fmt.Sprint(a.plugin)
+}
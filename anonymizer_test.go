@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestAnonymizer(t *testing.T) {
+	var written []byte
+	a := NewAnonymizer(NewTestOutput(func(data []byte) { written = data }), &AnonymizerConfig{
+		headers:    MultiOption{"Authorization"},
+		cookies:    MultiOption{"session"},
+		params:     MultiOption{"email"},
+		jsonFields: MultiOption{"user.phone", "contacts.*.email"},
+		mode:       "hash",
+		salt:       "secret",
+	})
+
+	hash := string(a.value([]byte("john@example.com")))
+	if len(hash) != 16 || hash == string((&Anonymizer{config: &AnonymizerConfig{}}).value([]byte("john@example.com"))) {
+		t.Error("Hash should depend on salt:", hash)
+	}
+
+	payload := []byte("1 abc 1\nGET /?email=john@example.com&page=1 HTTP/1.1\r\nAuthorization: Bearer 123\r\nCookie: theme=dark; session=s1\r\n\r\n")
+	a.Write(payload)
+
+	expected := "1 abc 1\nGET /?email=" + hash + "&page=1 HTTP/1.1\r\nAuthorization: " + string(a.value([]byte("Bearer 123"))) + "\r\nCookie: theme=dark; session=" + string(a.value([]byte("s1"))) + "\r\n\r\n"
+	if string(written) != expected {
+		t.Errorf("Expected %q, got %q", expected, written)
+	}
+
+	if !bytes.HasPrefix(payload, []byte("1 abc 1\nGET /?email=john@example.com")) {
+		t.Error("Original payload should not be modified, other outputs use it")
+	}
+
+	body := `{"user":{"name":"John","phone":"555-1234"},"contacts":[{"email":"john@example.com"},{"email":"x@y.z"}]}`
+	a.Write([]byte("POST / HTTP/1.1\r\nContent-Type: application/json\r\nContent-Length: 100\r\n\r\n" + body))
+
+	for _, value := range []string{"555-1234", "john@example.com", "x@y.z"} {
+		if strings.Contains(string(written), value) {
+			t.Error("JSON field should be anonymized:", value, string(written))
+		}
+	}
+
+	if !strings.Contains(string(written), `"email":"`+hash+`"`) || !strings.Contains(string(written), `"name":"John"`) {
+		t.Error("Only configured fields should be anonymized:", string(written))
+	}
+
+	// Responses have personal data as well
+	a.Write([]byte("2 abc 1\nHTTP/1.1 200 OK\r\nAuthorization: Bearer 123\r\n\r\n"))
+
+	if strings.Contains(string(written), "Bearer 123") {
+		t.Error("Response headers should be anonymized:", string(written))
+	}
+
+	a.Write([]byte("2 abc 1\nHTTP/1.1 200 OK\r\nSet-Cookie: theme=dark\r\nset-cookie: session=s1; Path=/; HttpOnly\r\n\r\nsession=s1"))
+
+	expected = "2 abc 1\nHTTP/1.1 200 OK\r\nSet-Cookie: theme=dark\r\nSet-Cookie: session=" + string(a.value([]byte("s1"))) + "; Path=/; HttpOnly\r\n\r\nsession=s1"
+	if string(written) != expected {
+		t.Errorf("Cookies set by response should be anonymized:\n%q\n%q", written, expected)
+	}
+}
+
+func TestAnonymizerSalt(t *testing.T) {
+	config := &AnonymizerConfig{headers: MultiOption{"Authorization"}, mode: "hash"}
+	a := NewAnonymizer(NewTestOutput(func([]byte) {}), config)
+
+	if config.salt == "" || string(a.value([]byte("123"))) == string((&Anonymizer{config: &AnonymizerConfig{}}).value([]byte("123"))) {
+		t.Error("Random salt should be used when not set")
+	}
+
+	// Outputs share config, so hashes are equal
+	if b := NewAnonymizer(NewTestOutput(func([]byte) {}), config); string(b.value([]byte("123"))) != string(a.value([]byte("123"))) {
+		t.Error("All outputs should use the same salt")
+	}
+}
+
+func TestAnonymizerMask(t *testing.T) {
+	var written []byte
+	a := NewAnonymizer(NewTestOutput(func(data []byte) { written = data }), &AnonymizerConfig{
+		params: MultiOption{"card"},
+		mode:   "mask",
+	})
+
+	a.Write([]byte("POST / HTTP/1.1\r\nContent-Type: application/x-www-form-urlencoded\r\nContent-Length: 25\r\n\r\ncard=4111111111111111&a=1"))
+
+	expected := "POST / HTTP/1.1\r\nContent-Type: application/x-www-form-urlencoded\r\nContent-Length: 12\r\n\r\ncard=***&a=1"
+	if string(written) != expected {
+		t.Errorf("Expected %q, got %q", expected, written)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"io"
+	"math/bits"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// Payloads are copied on their way from input to outputs, and at high rates allocation of slice per payload keeps
+// garbage collector busy. Pooled buffers are grouped by capacity, which is power of two, so taken buffer fits
+// payload without wasting much memory, and it has some space left for headers added by rewrites.
+//
+// Buffer returned to pool should not be used anymore, so it should be done only by its last owner.
+const (
+	minPooledBufferBits = 9  // 512 bytes
+	maxPooledBufferBits = 22 // 4 MB, larger buffers are not pooled
+)
+
+var bufferPools [maxPooledBufferBits - minPooledBufferBits + 1]sync.Pool
+
+// bufferClass returns index of pool of buffers, which can hold size bytes
+func bufferClass(size int) int {
+	if size <= 1<<minPooledBufferBits {
+		return 0
+	}
+
+	return bits.Len(uint(size-1)) - minPooledBufferBits
+}
+
+// getBuffer returns buffer of given length, taken from pool if possible
+func getBuffer(size int) []byte {
+	class := bufferClass(size)
+
+	if class >= len(bufferPools) {
+		return make([]byte, size)
+	}
+
+	if b, ok := bufferPools[class].Get().(*[]byte); ok {
+		return (*b)[:size]
+	}
+
+	return make([]byte, size, 1<<uint(class+minPooledBufferBits))
+}
+
+// putBuffer returns buffer to pool. Buffers which were not taken from pool, or grown by append, are left to garbage collector.
+func putBuffer(buf []byte) {
+	class := bufferClass(cap(buf))
+
+	if class >= len(bufferPools) || cap(buf) != 1<<uint(class+minPooledBufferBits) {
+		return
+	}
+
+	buf = buf[:0]
+	bufferPools[class].Put(&buf)
+}
+
+// pooledPayload builds payload with meta line using pooled buffer
+func pooledPayload(payloadType byte, id []byte, timing int64, data []byte) []byte {
+	buf := getBuffer(len(id) + 24 + len(data))[:0]
+
+	buf = append(buf, payloadType, ' ')
+	buf = append(buf, id...)
+	buf = append(buf, ' ')
+	buf = strconv.AppendInt(buf, timing, 10)
+	buf = append(buf, payloadSeparator...)
+
+	return append(buf, data...)
+}
+
+// pooledConcat returns meta line followed by data using pooled buffer
+func pooledConcat(header []byte, data []byte) []byte {
+	buf := getBuffer(len(header) + len(data))
+	copy(buf[copy(buf, header):], data)
+
+	return buf
+}
+
+// pooledCopy returns copy of data using pooled buffer
+func pooledCopy(data []byte) []byte {
+	buf := getBuffer(len(data))
+	copy(buf, data)
+
+	return buf
+}
+
+// payloadBuffer is payload shared by input, emitter and outputs without copying. Each owner releases it once done,
+// and pooled buffer returned to pool after last release.
+type payloadBuffer struct {
+	refs int32
+
+	// Pooled buffer holding payload
+	buf []byte
+	// Payload itself. It is part of buf, unless payload grew by rewrites and moved to new slice.
+	data []byte
+}
+
+// newPayloadBuffer wraps pooled buffer. Caller becomes its only owner.
+func newPayloadBuffer(buf []byte) *payloadBuffer {
+	return &payloadBuffer{refs: 1, buf: buf, data: buf}
+}
+
+// retain adds owner of payload
+func (p *payloadBuffer) retain() *payloadBuffer {
+	atomic.AddInt32(&p.refs, 1)
+	return p
+}
+
+// release removes owner of payload, buffer returned to pool by last one
+func (p *payloadBuffer) release() {
+	if atomic.AddInt32(&p.refs, -1) == 0 {
+		putBuffer(p.buf)
+		p.buf, p.data = nil, nil
+	}
+}
+
+// prepend adds meta line before payload. Captured payloads have space reserved before them, otherwise payload copied.
+func (p *payloadBuffer) prepend(header []byte) {
+	full := p.buf[:cap(p.buf)]
+	offset := cap(p.buf) - cap(p.data)
+
+	if len(p.data) > 0 && offset >= len(header) && &full[offset] == &p.data[0] {
+		start := offset - len(header)
+		copy(full[start:], header)
+		p.data = full[start : offset+len(p.data)]
+
+		return
+	}
+
+	buf := getBuffer(len(header) + len(p.data))
+	copy(buf[copy(buf, header):], p.data)
+
+	putBuffer(p.buf)
+	p.buf, p.data = buf, buf
+}
+
+// payloadReader implemented by inputs which hand payloads over to emitter, instead of copying them to its buffer
+type payloadReader interface {
+	// ReadPayload returns payload owned by caller, or nil if there is nothing to emit
+	ReadPayload() (*payloadBuffer, error)
+}
+
+// payloadWriter implemented by outputs which keep payload after write returns, they retain it instead of copying
+type payloadWriter interface {
+	WritePayload(p *payloadBuffer) (int, error)
+}
+
+// readsPayloads checks if input, or input wrapped by limiter, hands payloads over
+func readsPayloads(src io.Reader) bool {
+	_, ok := unwrapPlugin(src).(payloadReader)
+	return ok
+}
+
+// writePayload passes payload to output, outputs which can't retain it copy payload data as usual
+func writePayload(dst io.Writer, p *payloadBuffer) (int, error) {
+	if w, ok := dst.(payloadWriter); ok {
+		return w.WritePayload(p)
+	}
+
+	return dst.Write(p.data)
+}
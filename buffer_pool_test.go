@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBufferPool(t *testing.T) {
+	buf := getBuffer(1000)
+
+	if len(buf) != 1000 || cap(buf) != 1024 {
+		t.Fatal("Buffer capacity should be power of two:", len(buf), cap(buf))
+	}
+
+	putBuffer(buf)
+
+	if small := getBuffer(10); cap(small) != 512 {
+		t.Error("Should use smallest buffers for small payloads:", cap(small))
+	}
+
+	if huge := getBuffer(10 << 20); cap(huge) != 10<<20 {
+		t.Error("Huge buffers should not be pooled:", cap(huge))
+	}
+
+	payload := pooledPayload(RequestPayload, []byte("8ab3d30a1ad8e7d8f1b8c2f3"), 1439818124373040000, []byte("GET / HTTP/1.1\r\n\r\n"))
+	expected := append(payloadHeader(RequestPayload, []byte("8ab3d30a1ad8e7d8f1b8c2f3"), 1439818124373040000), "GET / HTTP/1.1\r\n\r\n"...)
+
+	if !bytes.Equal(payload, expected) {
+		t.Errorf("Wrong payload: %q", payload)
+	}
+}
+
+func TestPayloadBufferPrepend(t *testing.T) {
+	// Captured message has space reserved for meta line
+	p := newPayloadBuffer(getBuffer(capturedHeaderSpace + 100))
+	p.data = append(p.buf[capturedHeaderSpace:capturedHeaderSpace], "GET / HTTP/1.1\r\n\r\n"...)
+
+	buf := p.buf
+	p.prepend(payloadHeader(RequestPayload, uuid(), 1))
+
+	if &p.buf[0] != &buf[0] || !isRequestPayload(p.data) || string(payloadBody(p.data)) != "GET / HTTP/1.1\r\n\r\n" {
+		t.Errorf("Should add meta line without copying: %q", p.data)
+	}
+
+	p = newPayloadBuffer([]byte("GET / HTTP/1.1\r\n\r\n"))
+	p.prepend(payloadHeader(RequestPayload, uuid(), 1))
+
+	if !isRequestPayload(p.data) || string(payloadBody(p.data)) != "GET / HTTP/1.1\r\n\r\n" {
+		t.Errorf("Should copy payload without reserved space: %q", p.data)
+	}
+
+	p.retain().release()
+	if p.data == nil {
+		t.Error("Should not release payload while it has owners")
+	}
+
+	p.release()
+	if p.data != nil {
+		t.Error("Should release payload after last owner")
+	}
+}
+
+// testPayloadInput hands payloads over, like raw input
+type testPayloadInput struct {
+	ch chan *payloadBuffer
+}
+
+func (i *testPayloadInput) Read(data []byte) (int, error) {
+	p := <-i.ch
+	defer p.release()
+
+	return copy(data, p.data), nil
+}
+
+func (i *testPayloadInput) ReadPayload() (*payloadBuffer, error) {
+	return <-i.ch, nil
+}
+
+// testPayloadOutput retains payloads, like http output
+type testPayloadOutput struct {
+	ch chan *payloadBuffer
+}
+
+func (o *testPayloadOutput) Write(data []byte) (int, error) {
+	return o.WritePayload(newPayloadBuffer(append([]byte{}, data...)))
+}
+
+func (o *testPayloadOutput) WritePayload(p *payloadBuffer) (int, error) {
+	o.ch <- p.retain()
+	return len(p.data), nil
+}
+
+func TestEmitterPayloads(t *testing.T) {
+	input := &testPayloadInput{ch: make(chan *payloadBuffer)}
+	retaining := &testPayloadOutput{ch: make(chan *payloadBuffer, 1)}
+
+	copied := make(chan []byte, 1)
+	output := NewTestOutput(func(data []byte) {
+		copied <- append([]byte{}, data...)
+	})
+
+	go CopyMulty(input, NewLimiter(retaining, "100%").(io.Writer), output)
+
+	sent := newPayloadBuffer(pooledPayload(RequestPayload, uuid(), 1, []byte("GET / HTTP/1.1\r\n\r\n")))
+	input.ch <- sent
+
+	if p := <-retaining.ch; p != sent {
+		t.Error("Output should get payload of input without copying")
+	}
+
+	if data := <-copied; !bytes.Equal(data, sent.data) {
+		t.Errorf("Other outputs should get payload data: %q", data)
+	}
+
+	// Emitter releases payload after passing it to outputs
+	for i := 0; atomic.LoadInt32(&sent.refs) != 1 && i < 100; i++ {
+		time.Sleep(time.Millisecond)
+	}
+
+	if refs := atomic.LoadInt32(&sent.refs); refs != 1 {
+		t.Error("Only output should own payload:", refs)
+	}
+}
+
+func BenchmarkBufferPool(b *testing.B) {
+	data := bytes.Repeat([]byte("a"), 16*1024)
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			putBuffer(pooledCopy(data))
+		}
+	})
+}
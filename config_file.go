@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Config file describes same options as command line, using flag names as keys.
+// Options which can be repeated, like inputs and outputs, are specified as lists.
+// Both YAML and TOML supported, but only flat key-value structure, without nested sections:
+//
+//	# gor.yml
+//	input-raw: ":80"
+//	output-http:
+//	  - "http://staging.com"
+//	http-allow-method: [GET, OPTIONS]
+//	output-http-workers: 10
+//
+//	# gor.toml
+//	input-raw = ":80"
+//	output-http = ["http://staging.com"]
+//	output-http-workers = 10
+
+// loadConfig reads config file and applies its options to command line flags.
+// Options explicitly set in command line take precedence over config.
+func loadConfig(path string) {
+	values, err := readConfig(path)
+	if err != nil {
+		log.Fatal("[CONFIG] ", err)
+	}
+
+	if err = applyConfig(flag.CommandLine, values); err != nil {
+		log.Fatal("[CONFIG] ", path, ": ", err)
+	}
+
+	configOptions = values
+}
+
+func readConfig(path string) (map[string][]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("can't read config file: %v", err)
+	}
+
+	values, err := parseConfig(path, data)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse %s: %v", path, err)
+	}
+
+	return values, nil
+}
+
+// parseConfig detects config format by file extension, YAML used by default
+func parseConfig(path string, data []byte) (map[string][]string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		return parseTOMLConfig(data)
+	default:
+		return parseYAMLConfig(data)
+	}
+}
+
+// applyConfig sets flag values, skipping flags already set in command line
+func applyConfig(fs *flag.FlagSet, values map[string][]string) error {
+	isSet := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		isSet[f.Name] = true
+	})
+
+	for name, list := range values {
+		if fs.Lookup(name) == nil {
+			return fmt.Errorf("unknown option %q", name)
+		}
+
+		if isSet[name] {
+			continue
+		}
+
+		for _, value := range list {
+			if err := fs.Set(name, value); err != nil {
+				return fmt.Errorf("invalid value %q for option %q: %v", value, name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func parseYAMLConfig(data []byte) (map[string][]string, error) {
+	values := make(map[string][]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+
+	// Key of the block list, which items are going to be parsed
+	listKey := ""
+
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimRight(stripConfigComment(scanner.Text()), " \t\r")
+		trimmed := strings.TrimSpace(line)
+
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+
+		isListItem := trimmed == "-" || strings.HasPrefix(trimmed, "- ")
+
+		// Indented lines allowed only as list items
+		if line[0] == ' ' || line[0] == '\t' || isListItem {
+			if listKey == "" || !isListItem {
+				return nil, fmt.Errorf("line %d: nested sections are not supported", lineNum)
+			}
+
+			value, err := parseConfigScalar(strings.TrimSpace(trimmed[1:]))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNum, err)
+			}
+
+			values[listKey] = append(values[listKey], value)
+			continue
+		}
+
+		listKey = ""
+
+		idx := strings.Index(line, ":")
+		if idx == -1 {
+			return nil, fmt.Errorf("line %d: expected 'key: value'", lineNum)
+		}
+
+		key := configKey(line[:idx])
+		value := strings.TrimSpace(line[idx+1:])
+
+		if value == "" {
+			listKey = key
+			continue
+		}
+
+		list, err := parseConfigValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNum, err)
+		}
+
+		values[key] = append(values[key], list...)
+	}
+
+	return values, scanner.Err()
+}
+
+func parseTOMLConfig(data []byte) (map[string][]string, error) {
+	values := make(map[string][]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(stripConfigComment(scanner.Text()))
+
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			return nil, fmt.Errorf("line %d: sections are not supported", lineNum)
+		}
+
+		idx := strings.Index(line, "=")
+		if idx == -1 {
+			return nil, fmt.Errorf("line %d: expected 'key = value'", lineNum)
+		}
+
+		key := configKey(line[:idx])
+		value := strings.TrimSpace(line[idx+1:])
+		startLine := lineNum
+
+		// Arrays can span multiple lines
+		for strings.HasPrefix(value, "[") && !strings.HasSuffix(value, "]") && scanner.Scan() {
+			lineNum++
+			value += " " + strings.TrimSpace(stripConfigComment(scanner.Text()))
+		}
+
+		list, err := parseConfigValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", startLine, err)
+		}
+
+		values[key] = append(values[key], list...)
+	}
+
+	return values, scanner.Err()
+}
+
+// configKey allows keys to be written same way as in command line, e.g. `--output-http`
+func configKey(key string) string {
+	return strings.TrimLeft(strings.Trim(strings.TrimSpace(key), `"'`), "-")
+}
+
+// parseConfigValue parses scalar or inline list `[a, "b"]`
+func parseConfigValue(value string) ([]string, error) {
+	if !strings.HasPrefix(value, "[") {
+		scalar, err := parseConfigScalar(value)
+		return []string{scalar}, err
+	}
+
+	if !strings.HasSuffix(value, "]") {
+		return nil, fmt.Errorf("unterminated list %s", value)
+	}
+
+	var list []string
+	for _, item := range splitConfigList(value[1 : len(value)-1]) {
+		item = strings.TrimSpace(item)
+
+		// Trailing comma
+		if item == "" {
+			continue
+		}
+
+		scalar, err := parseConfigScalar(item)
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, scalar)
+	}
+
+	return list, nil
+}
+
+func parseConfigScalar(value string) (string, error) {
+	if len(value) < 2 {
+		return value, nil
+	}
+
+	switch value[0] {
+	case '"':
+		return strconv.Unquote(value)
+	case '\'':
+		if value[len(value)-1] != '\'' {
+			return "", fmt.Errorf("unterminated string %s", value)
+		}
+
+		return strings.Replace(value[1:len(value)-1], "''", "'", -1), nil
+	}
+
+	return value, nil
+}
+
+// splitConfigList splits list items by comma, ignoring commas inside quotes
+func splitConfigList(list string) (items []string) {
+	var quote byte
+	start := 0
+
+	for i := 0; i < len(list); i++ {
+		c := list[i]
+
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			items = append(items, list[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(items, list[start:])
+}
+
+// stripConfigComment removes `#` comment, unless it is inside quotes
+func stripConfigComment(line string) string {
+	var quote byte
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+
+	return line
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"flag"
+	"reflect"
+	"testing"
+)
+
+func TestParseYAMLConfig(t *testing.T) {
+	config := `
+# Capture and replay
+input-raw: ":80" # production port
+output-http:
+  - "http://staging.com"
+  - http://dev.com|10%
+http-allow-method: [GET, 'OPTIONS']
+http-set-header: 'User-Agent: Gor''s replay'
+output-http-workers: 10
+`
+
+	values, err := parseConfig("gor.yml", []byte(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string][]string{
+		"input-raw":           {":80"},
+		"output-http":         {"http://staging.com", "http://dev.com|10%"},
+		"http-allow-method":   {"GET", "OPTIONS"},
+		"http-set-header":     {"User-Agent: Gor's replay"},
+		"output-http-workers": {"10"},
+	}
+
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected %v, got %v", expected, values)
+	}
+
+	if _, err := parseConfig("gor.yml", []byte("output-http:\n  url: staging.com")); err == nil {
+		t.Error("Should not allow nested sections")
+	}
+}
+
+func TestParseTOMLConfig(t *testing.T) {
+	config := `
+# Capture and replay
+input-raw = ":80"
+output-http = [
+  "http://staging.com", # main target
+  'http://dev.com|10%',
+]
+http-set-header = "User-Agent: Gor"
+output-http-workers = 10
+`
+
+	values, err := parseConfig("gor.toml", []byte(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string][]string{
+		"input-raw":           {":80"},
+		"output-http":         {"http://staging.com", "http://dev.com|10%"},
+		"http-set-header":     {"User-Agent: Gor"},
+		"output-http-workers": {"10"},
+	}
+
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected %v, got %v", expected, values)
+	}
+
+	if _, err := parseConfig("gor.toml", []byte("[output]\nhttp = 'staging.com'")); err == nil {
+		t.Error("Should not allow sections")
+	}
+}
+
+func TestApplyConfig(t *testing.T) {
+	fs := flag.NewFlagSet("gor", flag.ContinueOnError)
+
+	var outputs MultiOption
+	fs.Var(&outputs, "output-http", "")
+	workers := fs.Int("output-http-workers", 0, "")
+	stats := fs.Bool("stats", false, "")
+
+	fs.Parse([]string{"--output-http-workers", "5"})
+
+	err := applyConfig(fs, map[string][]string{
+		"output-http":         {"staging.com", "dev.com"},
+		"output-http-workers": {"10"},
+		"stats":               {"true"},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(outputs, MultiOption{"staging.com", "dev.com"}) {
+		t.Error("Should set all list values", outputs)
+	}
+
+	if *workers != 5 {
+		t.Error("Command line options should take precedence", *workers)
+	}
+
+	if !*stats {
+		t.Error("Should set bool option")
+	}
+
+	if err := applyConfig(fs, map[string][]string{"output-htp": {"staging.com"}}); err == nil {
+		t.Error("Should fail on unknown option")
+	}
+}
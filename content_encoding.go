@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/buger/gor/proto"
+)
+
+// decodeBody decompresses body of request or response with `Content-Encoding: gzip` or `deflate`, so body rewrites and
+// middleware work on plain data. Content-Encoding removed and Content-Length updated, returned encoding used by encodeBody
+// to compress body back. Chunked bodies, unknown encodings, invalid data and bodies which decompress to more than
+// `--http-decode-body-max-size` returned as is, with empty encoding.
+func decodeBody(payload []byte) ([]byte, string) {
+	encoding := string(bytes.ToLower(bytes.TrimSpace(proto.Header(payload, []byte("Content-Encoding")))))
+	if encoding != "gzip" && encoding != "deflate" {
+		return payload, ""
+	}
+
+	if len(proto.Header(payload, []byte("Transfer-Encoding"))) > 0 {
+		return payload, ""
+	}
+
+	bodyStart := proto.MIMEHeadersEndPos(payload)
+	if bodyStart == -1 {
+		return payload, ""
+	}
+	bodyStart += len(proto.EmptyLine)
+
+	var reader io.Reader
+	var err error
+
+	if encoding == "gzip" {
+		reader, err = gzip.NewReader(bytes.NewReader(payload[bodyStart:]))
+	} else {
+		// HTTP deflate is zlib format, but some servers send raw deflate data
+		if reader, err = zlib.NewReader(bytes.NewReader(payload[bodyStart:])); err != nil {
+			reader, err = flate.NewReader(bytes.NewReader(payload[bodyStart:])), nil
+		}
+	}
+
+	if err != nil {
+		return payload, ""
+	}
+
+	// Small compressed body can expand to gigabytes
+	maxSize := int64(Settings.decodeBodyMaxSize) << 20
+	if maxSize > 0 {
+		reader = io.LimitReader(reader, maxSize+1)
+	}
+
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return payload, ""
+	}
+
+	if maxSize > 0 && int64(len(body)) > maxSize {
+		Debug("[DECODE-BODY] Decompressed body exceeds size limit, passed as is")
+		return payload, ""
+	}
+
+	// Limit capacity, so append makes copy instead of overwriting original body
+	payload = append(payload[:bodyStart:bodyStart], body...)
+	payload = proto.DeleteHeader(payload, []byte("Content-Encoding"))
+
+	return proto.SetHeader(payload, []byte("Content-Length"), []byte(strconv.Itoa(len(body)))), encoding
+}
+
+// encodeBody compresses body back after decodeBody
+func encodeBody(payload []byte, encoding string) []byte {
+	if encoding == "" {
+		return payload
+	}
+
+	bodyStart := proto.MIMEHeadersEndPos(payload)
+	if bodyStart == -1 {
+		return payload
+	}
+	bodyStart += len(proto.EmptyLine)
+
+	var buf bytes.Buffer
+	var writer io.WriteCloser
+
+	if encoding == "gzip" {
+		writer = gzip.NewWriter(&buf)
+	} else {
+		writer = zlib.NewWriter(&buf)
+	}
+
+	writer.Write(payload[bodyStart:])
+	writer.Close()
+
+	payload = append(payload[:bodyStart:bodyStart], buf.Bytes()...)
+	payload = proto.SetHeader(payload, []byte("Content-Encoding"), []byte(encoding))
+
+	return proto.SetHeader(payload, []byte("Content-Length"), []byte(strconv.Itoa(buf.Len())))
+}
+
+// bodyEncodings remembers encodings of payloads decoded before sending to external middleware,
+// so they can be encoded back when middleware returns them
+type bodyEncodings struct {
+	sync.Mutex
+
+	encodings map[string]string
+	times     map[string]time.Time
+	lastClean time.Time
+}
+
+func newBodyEncodings() *bodyEncodings {
+	return &bodyEncodings{encodings: make(map[string]string), times: make(map[string]time.Time), lastClean: time.Now()}
+}
+
+// key identifies payload by type and id, because request and its responses share id
+func (e *bodyEncodings) key(payload []byte) string {
+	return string(payload[0]) + string(payloadID(payload))
+}
+
+func (e *bodyEncodings) add(payload []byte, encoding string) {
+	e.Lock()
+	defer e.Unlock()
+
+	key := e.key(payload)
+	e.encodings[key] = encoding
+	e.times[key] = time.Now()
+
+	// Middleware can drop payloads, so periodically remove stale ids
+	if time.Since(e.lastClean) > time.Minute {
+		for key, t := range e.times {
+			if time.Since(t) > time.Minute {
+				delete(e.encodings, key)
+				delete(e.times, key)
+			}
+		}
+
+		e.lastClean = time.Now()
+	}
+}
+
+func (e *bodyEncodings) take(payload []byte) string {
+	e.Lock()
+	defer e.Unlock()
+
+	key := e.key(payload)
+	encoding := e.encodings[key]
+	delete(e.encodings, key)
+	delete(e.times, key)
+
+	return encoding
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/buger/gor/proto"
+)
+
+func gzipRequest(body string) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write([]byte(body))
+	w.Close()
+
+	return append([]byte("POST / HTTP/1.1\r\nContent-Encoding: gzip\r\nContent-Length: "+strconv.Itoa(buf.Len())+"\r\n\r\n"), buf.Bytes()...)
+}
+
+func TestDecodeBody(t *testing.T) {
+	decoded, encoding := decodeBody(gzipRequest(`{"a":1}`))
+
+	if encoding != "gzip" || string(decoded) != "POST / HTTP/1.1\r\nContent-Length: 7\r\n\r\n{\"a\":1}" {
+		t.Fatal("Should decode gzip body:", encoding, string(decoded))
+	}
+
+	encoded := encodeBody(decoded, encoding)
+	if string(proto.Header(encoded, []byte("Content-Encoding"))) != "gzip" {
+		t.Error("Should set Content-Encoding:", string(encoded))
+	}
+
+	if again, _ := decodeBody(encoded); !bytes.Equal(again, decoded) {
+		t.Error("Should encode body back:", string(again))
+	}
+
+	// Raw deflate data, without zlib header
+	var buf bytes.Buffer
+	w, _ := flate.NewWriter(&buf, flate.DefaultCompression)
+	w.Write([]byte("a=1"))
+	w.Close()
+
+	payload := append([]byte("POST / HTTP/1.1\r\nContent-Encoding: deflate\r\n\r\n"), buf.Bytes()...)
+	if decoded, encoding := decodeBody(payload); encoding != "deflate" || !bytes.HasSuffix(decoded, []byte("\r\n\r\na=1")) {
+		t.Error("Should decode raw deflate body:", string(decoded))
+	}
+
+	for _, payload := range [][]byte{
+		[]byte("POST / HTTP/1.1\r\nContent-Encoding: br\r\n\r\nabc"),
+		[]byte("POST / HTTP/1.1\r\nContent-Encoding: gzip\r\n\r\nnot gzip"),
+		[]byte("POST / HTTP/1.1\r\nContent-Encoding: gzip\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n"),
+	} {
+		if decoded, encoding := decodeBody(payload); encoding != "" || !bytes.Equal(decoded, payload) {
+			t.Error("Should return payload as is:", string(payload))
+		}
+	}
+}
+
+func TestDecodeBodyMaxSize(t *testing.T) {
+	defer func(size int) { Settings.decodeBodyMaxSize = size }(Settings.decodeBodyMaxSize)
+	Settings.decodeBodyMaxSize = 1
+
+	// 2mb of zeros compress to few kilobytes
+	payload := gzipRequest(string(make([]byte, 2<<20)))
+
+	if decoded, encoding := decodeBody(payload); encoding != "" || !bytes.Equal(decoded, payload) {
+		t.Error("Should return body bigger than limit as is:", len(decoded))
+	}
+
+	payload = gzipRequest(string(make([]byte, 1<<20)))
+
+	if decoded, encoding := decodeBody(payload); encoding != "gzip" || len(decoded) < 1<<20 {
+		t.Error("Should decode body within limit:", len(decoded))
+	}
+}
+
+func TestEmitterDecodeBodyRules(t *testing.T) {
+	quit := make(chan int)
+	received := make(chan []byte, 1)
+
+	input := NewTestInput()
+	output := NewTestOutput(func(data []byte) {
+		received <- append([]byte{}, data...)
+	})
+
+	Plugins.Inputs = []io.Reader{input}
+	Plugins.Outputs = []io.Writer{output}
+
+	// Header rules do not need body, so it is not decompressed and compressed back
+	Settings.modifierConfig.headers.Set("X-Replayed: 1")
+	Settings.decodeBody = true
+	defer func() {
+		Settings.modifierConfig.headers = nil
+		Settings.decodeBody = false
+	}()
+
+	go Start(quit)
+
+	payload := gzipRequest("hello")
+	input.data <- append(payloadHeader(RequestPayload, uuid(), 1), payload...)
+
+	if data := <-received; !bytes.Contains(data, []byte("X-Replayed: 1")) || !bytes.HasSuffix(data, payload[bytes.Index(payload, []byte("\r\n")):]) {
+		t.Error("Should pass headers and body as is:", string(data))
+	}
+
+	close(quit)
+}
+
+func TestMiddlewareDecodeBody(t *testing.T) {
+	wg := new(sync.WaitGroup)
+	quit := make(chan int)
+
+	// Pass only requests containing plain "hello" in body, hex encoded as "68656c6c6f"
+	script := "/tmp/gor_test_middleware_decode.sh"
+	ioutil.WriteFile(script, []byte("#!/bin/sh\nwhile read line; do case $line in *68656c6c6f*) echo $line;; esac; done\n"), 0755)
+	defer os.Remove(script)
+
+	input := NewTestInput()
+	output := NewTestOutput(func(data []byte) {
+		if decoded, encoding := decodeBody(payloadBody(data)); encoding != "gzip" || !bytes.HasSuffix(decoded, []byte("hello")) {
+			t.Error("Should compress body back:", string(data))
+		}
+
+		wg.Done()
+	})
+
+	Plugins.Inputs = []io.Reader{input}
+	Plugins.Outputs = []io.Writer{output}
+
+	Settings.middleware = script
+	Settings.decodeBody = true
+	defer func() {
+		Settings.middleware = ""
+		Settings.decodeBody = false
+	}()
+
+	go Start(quit)
+
+	wg.Add(1)
+	input.data <- append(payloadHeader(RequestPayload, uuid(), 1), gzipRequest("hello")...)
+
+	wg.Wait()
+	close(quit)
+}
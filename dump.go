@@ -0,0 +1,27 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// watchDump writes snapshot of internal state to stderr on SIGUSR1, for debugging stuck instances:
+// queue sizes and counters of all plugins, number of goroutines and open HTTP connections.
+// Snapshot has the same format as `GET /stats` of admin API.
+func watchDump() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGUSR1)
+
+	for range c {
+		dumpState()
+	}
+}
+
+func dumpState() {
+	state, _ := json.MarshalIndent(adminStats(), "", "  ")
+
+	log.Printf("[DUMP] Internal state:\n%s", state)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDumpState(t *testing.T) {
+	listener := startHTTP(func(*http.Request) {})
+	defer listener.Close()
+
+	client := NewHTTPClient(listener.Addr().String(), &HTTPClientConfig{})
+	connections := atomic.LoadInt64(&httpConnections)
+
+	client.Connect()
+	if atomic.LoadInt64(&httpConnections) != connections+1 {
+		t.Error("Should count open connections")
+	}
+
+	client.Disconnect()
+	if atomic.LoadInt64(&httpConnections) != connections {
+		t.Error("Should count closed connections")
+	}
+
+	Plugins.Inputs = []io.Reader{NewTestInput()}
+	Plugins.Outputs = []io.Writer{NewNullOutput("")}
+
+	buf := new(bytes.Buffer)
+	log.SetOutput(buf)
+	defer log.SetOutput(os.Stderr)
+
+	dumpState()
+
+	dump := buf.String()
+	start := bytes.IndexByte(buf.Bytes(), '{')
+	if start == -1 {
+		t.Fatal("Should dump state:", dump)
+	}
+
+	var state AdminStats
+	if err := json.Unmarshal(buf.Bytes()[start:], &state); err != nil {
+		t.Fatal("Should dump state as JSON:", err, dump)
+	}
+
+	if state.Goroutines == 0 || len(state.Inputs) != 1 || len(state.Outputs) != 1 || state.Outputs[0].Name != "Null output" {
+		t.Error("Should dump stats of plugins:", dump)
+	}
+}
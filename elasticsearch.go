@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"github.com/buger/elastigo/api"
 	"github.com/buger/elastigo/core"
@@ -27,6 +28,7 @@ type ESPlugin struct {
 
 type ESRequestResponse struct {
 	ReqUrl               []byte `json:"Req_URL"`
+	ReqHost              []byte `json:"Req_Host,omitempty"`
 	ReqMethod            []byte `json:"Req_Method"`
 	ReqUserAgent         []byte `json:"Req_User-Agent"`
 	ReqAcceptLanguage    []byte `json:"Req_Accept-Language,omitempty"`
@@ -86,7 +88,9 @@ func (p *ESPlugin) Init(URI string) {
 
 	// Only start the ErrorHandler goroutine when in verbose mode
 	// no need to burn ressources otherwise
-	// go p.ErrorHandler()
+	if Settings.verbose {
+		go p.ErrorHandler()
+	}
 
 	log.Println("Initialized Elasticsearch Plugin")
 	return
@@ -104,11 +108,21 @@ func (p *ESPlugin) ErrorHandler() {
 	}
 }
 
+// RttDurationToMs converts round trip time to milliseconds
 func (p *ESPlugin) RttDurationToMs(d time.Duration) int64 {
-	sec := d / time.Second
-	nsec := d % time.Second
-	fl := float64(sec) + float64(nsec)*1e-6
-	return int64(fl)
+	return int64(d / time.Millisecond)
+}
+
+// statusLine returns response status code and reason phrase, e.g. "200 OK"
+func statusLine(resp []byte) []byte {
+	start := bytes.IndexByte(resp, ' ') + 1
+	end := bytes.Index(resp, proto.CLRF)
+
+	if start == 0 || end < start {
+		return nil
+	}
+
+	return resp[start:end]
 }
 
 func (p *ESPlugin) ResponseAnalyze(req, resp []byte, start, stop time.Time) {
@@ -121,6 +135,7 @@ func (p *ESPlugin) ResponseAnalyze(req, resp []byte, start, stop time.Time) {
 
 	esResp := ESRequestResponse{
 		ReqUrl:               proto.Path(req),
+		ReqHost:              proto.Header(req, []byte("Host")),
 		ReqMethod:            proto.Method(req),
 		ReqUserAgent:         proto.Header(req, []byte("User-Agent")),
 		ReqAcceptLanguage:    proto.Header(req, []byte("Accept-Language")),
@@ -129,7 +144,7 @@ func (p *ESPlugin) ResponseAnalyze(req, resp []byte, start, stop time.Time) {
 		ReqIfModifiedSince:   proto.Header(req, []byte("If-Modified-Since")),
 		ReqConnection:        proto.Header(req, []byte("Connection")),
 		ReqCookies:           proto.Header(req, []byte("Cookie")),
-		RespStatus:           proto.Status(resp),
+		RespStatus:           statusLine(resp),
 		RespStatusCode:       proto.Status(resp),
 		RespProto:            proto.Method(resp),
 		RespContentLength:    proto.Header(resp, []byte("Content-Length")),
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestESParseURI(t *testing.T) {
+	err, host, port, index := parseURI("localhost:9200/gor")
+
+	if err != nil || host != "localhost" || port != "9200" || index != "gor" {
+		t.Error("Wrong URI parsing:", host, port, index, err)
+	}
+
+	if err, _, _, _ = parseURI("localhost/gor"); err == nil {
+		t.Error("Should require port")
+	}
+}
+
+func TestESRttDurationToMs(t *testing.T) {
+	p := new(ESPlugin)
+
+	if ms := p.RttDurationToMs(1500 * time.Millisecond); ms != 1500 {
+		t.Error("Should convert to milliseconds:", ms)
+	}
+}
+
+func TestESStatusLine(t *testing.T) {
+	if s := statusLine([]byte("HTTP/1.1 404 Not Found\r\nContent-Length: 0\r\n\r\n")); string(s) != "404 Not Found" {
+		t.Error("Wrong status line:", string(s))
+	}
+}
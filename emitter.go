@@ -2,63 +2,319 @@ package main
 
 import (
 	"io"
+	"log"
+	"sync/atomic"
 	"time"
 )
 
+var (
+	// Number of requests passed to outputs, counted only if `--exit-after-requests` specified
+	emittedRequests int64
+	// Closed when `--exit-after-requests` limit reached
+	requestsLimitReached chan struct{}
+)
+
 // Start initialize loop for sending data from inputs to outputs
 func Start(stop chan int) {
-	for _, in := range Plugins.Inputs {
-		go CopyMulty(in, Plugins.Outputs...)
+	var middleware *Middleware
+
+	if Settings.middleware != "" {
+		middleware = NewMiddleware(Settings.middleware)
+
+		go copyMulty(middleware, currentOutputs)
+	}
+
+	// Inputs added on config reload should be started as well. Limiter wrappers are not compared,
+	// because input can't be read by multiple goroutines.
+	running := make(map[interface{}]bool)
+	startInputs := func() {
+		for _, in := range Plugins.Inputs {
+			plugin := interface{}(in)
+			if l, ok := in.(*Limiter); ok {
+				plugin = l.plugin
+			}
+
+			if running[plugin] {
+				continue
+			}
+			running[plugin] = true
+
+			if middleware != nil {
+				middleware.ReadFromPlugin(in)
+			} else {
+				go copyMulty(in, currentOutputs)
+			}
+		}
+	}
+
+	atomic.StoreInt64(&emittedRequests, 0)
+	requestsLimitReached = make(chan struct{})
+
+	var exitTimer <-chan time.Time
+	if Settings.exitAfter > 0 {
+		exitTimer = time.After(Settings.exitAfter)
+	}
+
+	startInputs()
+	version := atomic.LoadInt64(&reloadVersion)
+
+	if Settings.stats {
+		go reportPluginStats(Settings.statsInterval, stop)
 	}
 
 	for {
 		select {
 		case <-stop:
 			return
+		case <-exitTimer:
+			log.Println("[EXIT] Exiting after", Settings.exitAfter)
+			return
+		case <-requestsLimitReached:
+			log.Println("[EXIT] Exiting after", Settings.exitAfterRequests, "requests")
+			return
 		case <-time.After(1 * time.Second):
 		}
+
+		if v := atomic.LoadInt64(&reloadVersion); v != version {
+			version = v
+
+			reloadMu.RLock()
+			startInputs()
+			reloadMu.RUnlock()
+		}
 	}
 }
 
+// currentOutputs returns outputs of current configuration, which can change on reload
+func currentOutputs() []io.Writer {
+	return Plugins.Outputs
+}
+
 // CopyMulty copies from 1 reader to multiple writers
 func CopyMulty(src io.Reader, writers ...io.Writer) (err error) {
+	return copyMulty(src, func() []io.Writer { return writers })
+}
+
+// copyMulty copies from reader to outputs. Outputs, modifier and scripts re-created
+// after config reload, so new rules applied without restarting inputs.
+func copyMulty(src io.Reader, outputs func() []io.Writer) (err error) {
 	buf := make([]byte, 5*1024*1024)
 	wIndex := 0
-	modifier := NewHTTPModifier(&Settings.modifierConfig)
 
-	for {
-		nr, er := src.Read(buf)
-		if nr > 0 && len(buf) > nr {
-			payload := buf[0:nr]
+	var writers []io.Writer
+	var dstStats []*pluginStats
+	var modifier *HTTPModifier
+	var scripts []scriptRewriter
+	version := int64(-1)
+
+	srcStats := statsFor(src)
+
+	// Ids of requests dropped by modifier, so we can drop their responses as well
+	filteredRequests := make(map[string]time.Time)
+	filteredRequestsLastCleanTime := time.Now()
+
+	// Payload handed over by input is passed to outputs which retain it, instead of copying. Other outputs,
+	// and payloads read into buffer of emitter, copied as usual.
+	emit := func(payload []byte, p *payloadBuffer) {
+		// Inputs keep reading while replay disabled or stopping, otherwise capture buffers overflow
+		if atomic.LoadInt32(&replayDisabled) == 1 || atomic.LoadInt32(&stopping) == 1 {
+			return
+		}
+
+		// Settings and plugins should not be changed while payload processed
+		reloadMu.RLock()
+		defer reloadMu.RUnlock()
+
+		if v := atomic.LoadInt64(&reloadVersion); v != version {
+			version = v
+
+			writers = outputs()
+			modifier = NewHTTPModifier(&Settings.modifierConfig)
+			scripts = newScriptRewriters()
 
-			if modifier != nil {
-				payload = modifier.Rewrite(payload)
+			dstStats = make([]*pluginStats, len(writers))
+			for i, dst := range writers {
+				dstStats[i] = statsFor(dst)
+			}
+
+			wIndex = 0
+		}
+
+		if isRequestPayload(payload) {
+			statsd.Incr("input.requests", 1)
+		} else {
+			statsd.Incr("input.responses", 1)
+		}
+
+		if modifier != nil || len(scripts) > 0 {
+			if isRequestPayload(payload) {
+				headSize := payloadHeaderSize(payload)
+				body := payload[headSize:]
+
+				// Only rules and scripts which read body need it decoded
+				var encoding string
+				if Settings.decodeBody && (len(scripts) > 0 || modifier.readsBody()) {
+					body, encoding = decodeBody(body)
+				}
+
+				if modifier != nil {
+					body = modifier.Rewrite(body)
+				}
+
+				for _, script := range scripts {
+					if len(body) == 0 {
+						break
+					}
+
+					body = script.Rewrite(body)
+				}
+
+				if len(body) > 0 {
+					body = encodeBody(body, encoding)
+				}
 
 				// If modifier tells to skip request
+				if len(body) == 0 {
+					statsd.Incr("input.filtered", 1)
+
+					if headSize > 0 {
+						filteredRequests[string(payloadID(payload))] = time.Now()
+					}
+					return
+				}
+
+				payload = append(payload[:headSize], body...)
+			} else {
+				id := string(payloadID(payload))
+
+				if _, ok := filteredRequests[id]; ok {
+					delete(filteredRequests, id)
+					return
+				}
+
+				var encoding string
+				if Settings.decodeBody && len(scripts) > 0 {
+					headSize := payloadHeaderSize(payload)
+					body, e := decodeBody(payload[headSize:])
+
+					if encoding = e; encoding != "" {
+						payload = append(payload[:headSize:headSize], body...)
+					}
+				}
+
+				for _, script := range scripts {
+					if r, ok := script.(scriptResponseRewriter); ok && len(payload) > 0 {
+						payload = r.RewriteResponse(payload)
+					}
+				}
+
+				if encoding != "" && len(payload) > 0 {
+					headSize := payloadHeaderSize(payload)
+					payload = append(payload[:headSize:headSize], encodeBody(payload[headSize:], encoding)...)
+				}
+
+				// If script tells to skip response
 				if len(payload) == 0 {
-					continue
+					return
 				}
 			}
 
-			if Settings.debug {
-				Debug("[EMITTER] Sending payload, size:", len(payload), "First 500 bytes:", string(payload[0:500]))
+			// Responses for some requests can be lost, so periodically remove stale ids
+			if time.Since(filteredRequestsLastCleanTime) > time.Minute {
+				for id, t := range filteredRequests {
+					if time.Since(t) > time.Minute {
+						delete(filteredRequests, id)
+					}
+				}
+
+				filteredRequestsLastCleanTime = time.Now()
 			}
+		}
 
-			if Settings.splitOutput {
-				// Simple round robin
-				writers[wIndex].Write(payload)
+		if Settings.debug {
+			head := payload
+			if len(head) > 500 {
+				head = head[:500]
+			}
 
-				wIndex++
+			Debug("[EMITTER] Sending payload, size:", len(payload), "First 500 bytes:", string(head))
+		}
 
-				if wIndex >= len(writers) {
-					wIndex = 0
-				}
-			} else {
-				for _, dst := range writers {
-					dst.Write(payload)
-				}
+		if len(writers) == 0 {
+			return
+		}
+
+		if Settings.exitAfterRequests > 0 && isRequestPayload(payload) {
+			n := atomic.AddInt64(&emittedRequests, 1)
+
+			if n > Settings.exitAfterRequests {
+				return
+			}
+
+			// Exit signalled after last request written
+			if n == Settings.exitAfterRequests {
+				defer close(requestsLimitReached)
 			}
+		}
+
+		write := func(dst io.Writer) (int, error) {
+			if p == nil {
+				return dst.Write(payload)
+			}
+
+			return writePayload(dst, p)
+		}
+
+		// Payload could be rewritten
+		if p != nil {
+			p.data = payload
+		}
+
+		if Settings.splitOutput {
+			// Simple round robin
+			dstStats[wIndex].add(write(writers[wIndex]))
+
+			wIndex++
+
+			if wIndex >= len(writers) {
+				wIndex = 0
+			}
+		} else {
+			for i, dst := range writers {
+				dstStats[i].add(write(dst))
+			}
+		}
+	}
 
+	if r, ok := src.(payloadReader); ok && readsPayloads(src) {
+		for {
+			p, er := r.ReadPayload()
+
+			var nr int
+			if p != nil {
+				nr = len(p.data)
+			}
+			srcStats.add(nr, er)
+
+			if p != nil {
+				emit(p.data, p)
+				p.release()
+			}
+			if er == io.EOF {
+				return nil
+			}
+			if er != nil {
+				return er
+			}
+		}
+	}
+
+	for {
+		nr, er := src.Read(buf)
+		srcStats.add(nr, er)
+
+		if nr > 0 && len(buf) > nr {
+			emit(buf[0:nr], nil)
 		}
 		if er == io.EOF {
 			break
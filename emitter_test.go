@@ -1,10 +1,12 @@
 package main
 
 import (
+	"bytes"
 	"io"
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestEmitter(t *testing.T) {
@@ -72,6 +74,80 @@ func TestEmitterRoundRobin(t *testing.T) {
 	Settings.splitOutput = false
 }
 
+func TestEmitterFilteredResponses(t *testing.T) {
+	wg := new(sync.WaitGroup)
+	quit := make(chan int)
+
+	input := NewTestInput()
+
+	output := NewTestOutput(func(data []byte) {
+		if !bytes.Equal(payloadID(data), []byte("allowed")) {
+			t.Error("Filtered request and its response should be dropped:", string(data))
+		}
+
+		wg.Done()
+	})
+
+	Plugins.Inputs = []io.Reader{input}
+	Plugins.Outputs = []io.Writer{output}
+
+	methods := HTTPMethods{[]byte("GET")}
+	Settings.modifierConfig = HTTPModifierConfig{methods: methods}
+
+	go Start(quit)
+
+	wg.Add(2)
+	input.data <- append(payloadHeader(RequestPayload, []byte("filtered"), 1), []byte("POST / HTTP/1.1\r\n\r\n")...)
+	input.data <- append(payloadHeader(ResponsePayload, []byte("filtered"), 1), []byte("HTTP/1.1 200 OK\r\n\r\n")...)
+	input.data <- append(payloadHeader(RequestPayload, []byte("allowed"), 1), []byte("GET / HTTP/1.1\r\n\r\n")...)
+	input.data <- append(payloadHeader(ResponsePayload, []byte("allowed"), 1), []byte("HTTP/1.1 200 OK\r\n\r\n")...)
+
+	wg.Wait()
+
+	close(quit)
+
+	Settings.modifierConfig = HTTPModifierConfig{}
+}
+
+func TestEmitterReload(t *testing.T) {
+	wg := new(sync.WaitGroup)
+
+	input := NewTestInput()
+
+	var counter1, counter2 int32
+
+	output1 := NewTestOutput(func(data []byte) {
+		atomic.AddInt32(&counter1, 1)
+		wg.Done()
+	})
+
+	output2 := NewTestOutput(func(data []byte) {
+		atomic.AddInt32(&counter2, 1)
+		wg.Done()
+	})
+
+	outputs := []io.Writer{output1}
+
+	go copyMulty(input, func() []io.Writer { return outputs })
+
+	wg.Add(1)
+	input.EmitGET()
+	wg.Wait()
+
+	reloadMu.Lock()
+	outputs = []io.Writer{output2}
+	atomic.AddInt64(&reloadVersion, 1)
+	reloadMu.Unlock()
+
+	wg.Add(1)
+	input.EmitGET()
+	wg.Wait()
+
+	if counter1 != 1 || counter2 != 1 {
+		t.Errorf("Should switch to new outputs after reload: %d vs %d", counter1, counter2)
+	}
+}
+
 func BenchmarkEmitter(b *testing.B) {
 	wg := new(sync.WaitGroup)
 	quit := make(chan int)
@@ -97,3 +173,38 @@ func BenchmarkEmitter(b *testing.B) {
 	wg.Wait()
 	close(quit)
 }
+
+func TestEmitterExitAfterRequests(t *testing.T) {
+	input := NewTestInput()
+
+	var counter int32
+	output := NewTestOutput(func(data []byte) {
+		atomic.AddInt32(&counter, 1)
+	})
+
+	Plugins.Inputs = []io.Reader{input}
+	Plugins.Outputs = []io.Writer{output}
+
+	Settings.exitAfterRequests = 3
+	defer func() { Settings.exitAfterRequests = 0 }()
+
+	done := make(chan bool)
+	go func() {
+		Start(nil)
+		done <- true
+	}()
+
+	for i := 0; i < 5; i++ {
+		input.EmitGET()
+	}
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Should exit after given number of requests")
+	}
+
+	if c := atomic.LoadInt32(&counter); c != 3 {
+		t.Error("Should pass only given number of requests:", c)
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
+	httppprof "net/http/pprof"
 	"os"
 	"runtime"
 	"runtime/debug"
@@ -17,6 +19,8 @@ var (
 	mode       string
 	cpuprofile = flag.String("cpuprofile", "", "write cpu profile to file")
 	memprofile = flag.String("memprofile", "", "write memory profile to this file")
+	configFile = flag.String("config", "", "Read options from YAML or TOML file, using flag names as keys. Options set in command line take precedence:\n\tgor --config gor.yml")
+	pprofAddr  = flag.String("http-pprof", "", "Expose net/http/pprof endpoints on given address, to take CPU and heap profiles of running instance. Bind it to local interface only:\n\tgor --input-raw :80 --output-tcp replay.local:28020 --http-pprof 127.0.0.1:8181\n\tgo tool pprof http://127.0.0.1:8181/debug/pprof/heap")
 )
 
 func main() {
@@ -37,8 +41,23 @@ func main() {
 	fmt.Println("Version:", VERSION)
 
 	flag.Parse()
+
+	if *configFile != "" {
+		loadConfig(*configFile)
+	}
+
+	resolveDefaults(flag.CommandLine, &Settings)
+
 	InitPlugins()
 
+	if Settings.statsd != "" {
+		statsd = NewStatsdClient(Settings.statsd, &Settings.statsdConfig)
+	}
+
+	if Settings.otlpEndpoint != "" {
+		tracer = NewOTLPExporter(Settings.otlpEndpoint, &Settings.otlpConfig)
+	}
+
 	if len(Plugins.Inputs) == 0 || len(Plugins.Outputs) == 0 {
 		log.Fatal("Required at least 1 input and 1 output")
 	}
@@ -51,7 +70,26 @@ func main() {
 		profileCPU(*cpuprofile)
 	}
 
-	Start(nil)
+	if *pprofAddr != "" {
+		go servePprof(*pprofAddr)
+	}
+
+	if *configFile != "" {
+		go watchReload(*configFile)
+	}
+
+	if Settings.adminAPI != "" {
+		go serveAdmin(Settings.adminAPI, Settings.adminToken)
+	}
+
+	go watchDump()
+
+	stop := make(chan int)
+	go watchShutdown(stop)
+
+	Start(stop)
+
+	shutdown(Settings.shutdownTimeout)
 }
 
 func profileCPU(cpuprofile string) {
@@ -82,3 +120,20 @@ func profileMEM(memprofile string) {
 		})
 	}
 }
+
+// servePprof starts http server with profiling endpoints.
+// Own mux used, so endpoints not exposed by other http servers.
+func servePprof(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", httppprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", httppprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", httppprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", httppprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", httppprof.Trace)
+
+	log.Println("[PPROF] Serving profiles on", addr)
+
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Fatal("[PPROF] Can't start profiling server:", err)
+	}
+}
@@ -6,10 +6,6 @@ import (
 	"time"
 )
 
-const (
-	rate = 5
-)
-
 type GorStat struct {
 	statName string
 	latest   int
@@ -54,13 +50,13 @@ func (s *GorStat) Reset() {
 }
 
 func (s *GorStat) String() string {
-	return s.statName + ":" + strconv.Itoa(s.latest) + "," + strconv.Itoa(s.mean) + "," + strconv.Itoa(s.max) + "," + strconv.Itoa(s.count) + "," + strconv.Itoa(s.count/rate)
+	return s.statName + ":" + strconv.Itoa(s.latest) + "," + strconv.Itoa(s.mean) + "," + strconv.Itoa(s.max) + "," + strconv.Itoa(s.count) + "," + strconv.Itoa(int(float64(s.count)/Settings.statsInterval.Seconds()))
 }
 
 func (s *GorStat) reportStats() {
 	for {
 		log.Println(s)
 		s.Reset()
-		time.Sleep(rate * time.Second)
+		time.Sleep(Settings.statsInterval)
 	}
 }
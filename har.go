@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// HTTP Archive format, see http://www.softwareishard.com/blog/har-12-spec/
+
+// HAR is root object of HTTP Archive file
+type HAR struct {
+	Log HARLog `json:"log"`
+}
+
+// HARLog holds list of recorded requests
+type HARLog struct {
+	Version string      `json:"version"`
+	Creator HARCreator  `json:"creator"`
+	Entries []*HAREntry `json:"entries"`
+}
+
+// HARCreator describes application which created file
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// HAREntry holds request with its response. Response has zero status, and timings are zero, if it was not captured
+type HAREntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         HARRequest  `json:"request"`
+	Response        HARResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         HARTimings  `json:"timings"`
+}
+
+// HARRequest describes recorded request
+type HARRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	QueryString []HARNameValue `json:"queryString"`
+	PostData    *HARPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+// HARResponse describes recorded response
+type HARResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	Content     HARContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+// HARNameValue is header, cookie or query param
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// HARPostData holds request body
+type HARPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+// HARContent holds response body. Binary bodies are base64 encoded.
+type HARContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// HARTimings holds time spent on request phases in milliseconds
+type HARTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// newHAREntry converts captured request and optional response into HAR entry.
+// Timestamps are in nanoseconds, response timestamp is ignored if response is nil.
+func newHAREntry(request, response []byte, requestTime, responseTime int64) (*HAREntry, error) {
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(request)))
+	if err != nil {
+		return nil, err
+	}
+
+	body, _ := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+
+	host := req.Host
+	if host == "" {
+		host = "localhost"
+	} else {
+		// ReadRequest moves Host header out of header map
+		req.Header.Set("Host", host)
+	}
+
+	entry := &HAREntry{
+		StartedDateTime: time.Unix(0, requestTime),
+		Request: HARRequest{
+			Method:      req.Method,
+			URL:         "http://" + host + req.RequestURI,
+			HTTPVersion: req.Proto,
+			Cookies:     []HARNameValue{},
+			Headers:     harHeaders(req.Header),
+			QueryString: []HARNameValue{},
+			HeadersSize: harHeadersSize(request),
+			BodySize:    len(body),
+		},
+		Response: HARResponse{
+			Cookies: []HARNameValue{},
+			Headers: []HARNameValue{},
+		},
+	}
+
+	for _, c := range req.Cookies() {
+		entry.Request.Cookies = append(entry.Request.Cookies, HARNameValue{c.Name, c.Value})
+	}
+
+	entry.Request.QueryString = harHeaders(http.Header(req.URL.Query()))
+
+	if len(body) > 0 {
+		entry.Request.PostData = &HARPostData{MimeType: req.Header.Get("Content-Type"), Text: string(body)}
+	}
+
+	if response == nil {
+		return entry, nil
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(response)), req)
+	if err != nil {
+		return entry, nil
+	}
+
+	// Chunked encoding removed by ReadResponse, compressed bodies kept as is
+	body, _ = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	entry.Response = HARResponse{
+		Status:      resp.StatusCode,
+		StatusText:  strings.TrimSpace(strings.TrimPrefix(resp.Status, strconv.Itoa(resp.StatusCode))),
+		HTTPVersion: resp.Proto,
+		Cookies:     []HARNameValue{},
+		Headers:     harHeaders(resp.Header),
+		Content: HARContent{
+			Size:     len(body),
+			MimeType: resp.Header.Get("Content-Type"),
+		},
+		RedirectURL: resp.Header.Get("Location"),
+		HeadersSize: harHeadersSize(response),
+		BodySize:    len(body),
+	}
+
+	if utf8.Valid(body) {
+		entry.Response.Content.Text = string(body)
+	} else {
+		entry.Response.Content.Text = base64.StdEncoding.EncodeToString(body)
+		entry.Response.Content.Encoding = "base64"
+	}
+
+	for _, c := range resp.Cookies() {
+		entry.Response.Cookies = append(entry.Response.Cookies, HARNameValue{c.Name, c.Value})
+	}
+
+	// Only total time known: time between request and original response
+	if responseTime >= requestTime {
+		entry.Time = float64(responseTime-requestTime) / float64(time.Millisecond)
+		entry.Timings = HARTimings{Send: 0, Wait: entry.Time, Receive: 0}
+	}
+
+	return entry, nil
+}
+
+// harHeaders converts headers or query params to list sorted by name, so output is stable
+func harHeaders(header http.Header) []HARNameValue {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	headers := []HARNameValue{}
+
+	for _, name := range names {
+		for _, value := range header[name] {
+			headers = append(headers, HARNameValue{name, value})
+		}
+	}
+
+	return headers
+}
+
+// harHeadersSize returns size of start line and headers, including empty line after them
+func harHeadersSize(payload []byte) int {
+	if end := bytes.Index(payload, []byte("\r\n\r\n")); end != -1 {
+		return end + 4
+	}
+
+	return -1
+}
+
+// Headers which are recalculated when request or response converted back to HTTP/1.1
+var harSkipHeaders = map[string]bool{
+	"content-length":    true,
+	"transfer-encoding": true,
+	"connection":        true,
+}
+
+// RawRequest converts entry back to HTTP/1.1 request
+func (e *HAREntry) RawRequest() ([]byte, error) {
+	u, err := url.Parse(e.Request.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s %s HTTP/1.1\r\n", e.Request.Method, u.RequestURI())
+
+	hasHost := false
+	for _, h := range e.Request.Headers {
+		name := strings.ToLower(h.Name)
+
+		// HTTP/2 pseudo headers, like :authority, recorded by browsers
+		if strings.HasPrefix(name, ":") || harSkipHeaders[name] {
+			continue
+		}
+
+		if name == "host" {
+			hasHost = true
+		}
+
+		fmt.Fprintf(&buf, "%s: %s\r\n", h.Name, h.Value)
+	}
+
+	if !hasHost {
+		fmt.Fprintf(&buf, "Host: %s\r\n", u.Host)
+	}
+
+	var body string
+	if e.Request.PostData != nil {
+		body = e.Request.PostData.Text
+	}
+
+	if body != "" || e.Request.Method == "POST" || e.Request.Method == "PUT" || e.Request.Method == "PATCH" {
+		fmt.Fprintf(&buf, "Content-Length: %d\r\n", len(body))
+	}
+
+	buf.WriteString("\r\n")
+	buf.WriteString(body)
+
+	return buf.Bytes(), nil
+}
+
+// RawResponse converts recorded response to HTTP/1.1 response, returns nil if response was not recorded
+func (e *HAREntry) RawResponse() []byte {
+	if e.Response.Status == 0 {
+		return nil
+	}
+
+	body := []byte(e.Response.Content.Text)
+	if e.Response.Content.Encoding == "base64" {
+		body, _ = base64.StdEncoding.DecodeString(e.Response.Content.Text)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "HTTP/1.1 %d %s\r\n", e.Response.Status, e.Response.StatusText)
+
+	for _, h := range e.Response.Headers {
+		name := strings.ToLower(h.Name)
+
+		if strings.HasPrefix(name, ":") || harSkipHeaders[name] {
+			continue
+		}
+
+		// Browsers record decoded text bodies, while compressed bodies written by HAR output are base64 encoded
+		if name == "content-encoding" && e.Response.Content.Encoding != "base64" {
+			continue
+		}
+
+		fmt.Fprintf(&buf, "%s: %s\r\n", h.Name, h.Value)
+	}
+
+	fmt.Fprintf(&buf, "Content-Length: %d\r\n\r\n", len(body))
+	buf.Write(body)
+
+	return buf.Bytes()
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http2/hpack"
+)
+
+// HTTP/2 frame types and flags, see https://tools.ietf.org/html/rfc7540#section-6
+const (
+	http2FrameData         = 0x0
+	http2FrameHeaders      = 0x1
+	http2FrameContinuation = 0x9
+
+	http2FlagEndStream  = 0x1
+	http2FlagEndHeaders = 0x4
+	http2FlagPadded     = 0x8
+	http2FlagPriority   = 0x20
+
+	http2FrameHeaderSize = 9
+)
+
+var http2Preface = []byte("PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n")
+
+// http2Stream accumulates headers, body and trailers of single request or response
+type http2Stream struct {
+	id       uint32
+	start    time.Time
+	headers  []hpack.HeaderField
+	trailers []hpack.HeaderField
+	body     []byte
+
+	headersDone bool
+	endStream   bool
+}
+
+// http2Decoder decodes one direction of HTTP/2 connection: frames sent by client or by server.
+// Frames of different streams can be interleaved, so stream is returned only when it ends.
+//
+// Header compression state is shared by all streams of connection,
+// so only connections established after capture started can be decoded.
+type http2Decoder struct {
+	buf     []byte
+	hpack   *hpack.Decoder
+	streams map[uint32]*http2Stream
+
+	// Header block split into HEADERS and CONTINUATION frames
+	headerBlock  []byte
+	headerStream *http2Stream
+
+	// Set if connection started before capture, or sent something we can't decode
+	broken bool
+}
+
+func newHTTP2Decoder() *http2Decoder {
+	d := &http2Decoder{
+		hpack:   hpack.NewDecoder(4096, nil),
+		streams: make(map[uint32]*http2Stream),
+	}
+
+	// Table size limited by SETTINGS of other side, which we don't track
+	d.hpack.SetAllowedMaxDynamicTableSize(1 << 20)
+
+	return d
+}
+
+// Write parses frames from captured data and returns streams which ended, in order of their completion
+func (d *http2Decoder) Write(data []byte, start time.Time) (completed []*http2Stream) {
+	if d.broken {
+		return
+	}
+
+	d.buf = append(d.buf, data...)
+	d.buf = bytes.TrimPrefix(d.buf, http2Preface)
+
+	for len(d.buf) >= http2FrameHeaderSize {
+		length := int(d.buf[0])<<16 | int(d.buf[1])<<8 | int(d.buf[2])
+
+		if len(d.buf) < http2FrameHeaderSize+length {
+			break
+		}
+
+		frameType, flags := d.buf[3], d.buf[4]
+		streamID := binary.BigEndian.Uint32(d.buf[5:9]) & 0x7fffffff
+		payload := d.buf[http2FrameHeaderSize : http2FrameHeaderSize+length]
+		d.buf = d.buf[http2FrameHeaderSize+length:]
+
+		// Connection level frames, like SETTINGS or PING, are not part of any stream
+		if streamID == 0 {
+			continue
+		}
+
+		if stream := d.frame(frameType, flags, streamID, payload, start); stream != nil {
+			completed = append(completed, stream)
+		}
+
+		if d.broken {
+			return
+		}
+	}
+
+	return
+}
+
+func (d *http2Decoder) frame(frameType, flags byte, streamID uint32, payload []byte, start time.Time) *http2Stream {
+	switch frameType {
+	case http2FrameData:
+		stream, ok := d.streams[streamID]
+		if !ok {
+			return nil
+		}
+
+		stream.body = append(stream.body, http2Unpad(flags, payload)...)
+		stream.endStream = flags&http2FlagEndStream != 0
+	case http2FrameHeaders:
+		stream, ok := d.streams[streamID]
+		if !ok {
+			stream = &http2Stream{id: streamID, start: start}
+			d.streams[streamID] = stream
+		}
+
+		payload = http2Unpad(flags, payload)
+
+		// Stream dependency and weight
+		if flags&http2FlagPriority != 0 && len(payload) >= 5 {
+			payload = payload[5:]
+		}
+
+		d.headerStream = stream
+		d.headerBlock = append(d.headerBlock[:0], payload...)
+		stream.endStream = flags&http2FlagEndStream != 0
+	case http2FrameContinuation:
+		if d.headerStream == nil || d.headerStream.id != streamID {
+			return nil
+		}
+
+		d.headerBlock = append(d.headerBlock, payload...)
+	default:
+		return nil
+	}
+
+	if frameType != http2FrameData && flags&http2FlagEndHeaders != 0 {
+		d.decodeHeaders()
+	}
+
+	stream := d.streams[streamID]
+
+	// Stream can't end in the middle of header block
+	if stream == nil || !stream.endStream || d.headerStream == stream {
+		return nil
+	}
+
+	delete(d.streams, streamID)
+
+	return stream
+}
+
+func (d *http2Decoder) decodeHeaders() {
+	stream := d.headerStream
+	d.headerStream = nil
+
+	fields, err := d.hpack.DecodeFull(d.headerBlock)
+
+	if err != nil {
+		Debug("[HTTP2] Can't decode headers, connection started before capture?", err)
+		d.broken = true
+		return
+	}
+
+	// Second header block of the stream holds trailers
+	if stream.headersDone {
+		stream.trailers = append(stream.trailers, fields...)
+	} else {
+		stream.headers = fields
+		stream.headersDone = true
+	}
+}
+
+// http2Unpad removes padding of DATA and HEADERS frames
+func http2Unpad(flags byte, payload []byte) []byte {
+	if flags&http2FlagPadded == 0 || len(payload) == 0 {
+		return payload
+	}
+
+	padding := int(payload[0])
+	if padding >= len(payload) {
+		return nil
+	}
+
+	return payload[1 : len(payload)-padding]
+}
+
+// Request returns stream as HTTP/1.1 request, so it can be modified and replayed as any other request
+func (s *http2Stream) Request() []byte {
+	req := &http.Request{
+		Method:     "GET",
+		URL:        &url.URL{Path: "/"},
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+	}
+
+	for _, f := range s.headers {
+		switch f.Name {
+		case ":method":
+			req.Method = f.Value
+		case ":authority":
+			req.Host = f.Value
+		case ":path":
+			req.RequestURI = f.Value
+		case ":scheme":
+		default:
+			req.Header.Add(f.Name, f.Value)
+		}
+	}
+
+	// HTTP/2 doesn't require Content-Length, but HTTP/1.1 request without it has no body
+	req.Header.Del("Content-Length")
+	if len(s.body) > 0 {
+		req.Header.Set("Content-Length", strconv.Itoa(len(s.body)))
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(s.body))
+
+	data, _ := httputil.DumpRequest(req, true)
+
+	return data
+}
+
+// Response returns stream as HTTP/2.0 response, same format as responses received by HTTP/2 replay.
+// Trailers, like `grpc-status`, written after body using chunked encoding.
+func (s *http2Stream) Response() []byte {
+	resp := &http.Response{
+		ProtoMajor: 2,
+		Header:     make(http.Header),
+	}
+
+	for _, f := range s.headers {
+		if f.Name == ":status" {
+			resp.StatusCode, _ = strconv.Atoi(f.Value)
+		} else if !strings.HasPrefix(f.Name, ":") {
+			resp.Header.Add(f.Name, f.Value)
+		}
+	}
+
+	resp.Status = strconv.Itoa(resp.StatusCode) + " " + http.StatusText(resp.StatusCode)
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = int64(len(s.body))
+	resp.Body = ioutil.NopCloser(bytes.NewReader(s.body))
+
+	if len(s.trailers) > 0 {
+		resp.Trailer = make(http.Header)
+
+		for _, f := range s.trailers {
+			resp.Trailer.Add(f.Name, f.Value)
+		}
+	}
+
+	data, _ := dumpResponse(resp)
+
+	return data
+}
+
+// dumpResponse serializes response including trailers, which are available only after body is read
+func dumpResponse(resp *http.Response) ([]byte, error) {
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	if len(resp.Trailer) > 0 {
+		resp.TransferEncoding = []string{"chunked"}
+		resp.ContentLength = -1
+	}
+
+	return httputil.DumpResponse(resp, true)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingProxy forwards single connection to given address, and records bytes sent in both directions
+type recordingProxy struct {
+	net.Listener
+
+	mu       sync.Mutex
+	client   bytes.Buffer
+	server   bytes.Buffer
+	finished sync.WaitGroup
+}
+
+func newRecordingProxy(t *testing.T, address string) *recordingProxy {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &recordingProxy{Listener: listener}
+	p.finished.Add(1)
+
+	go func() {
+		defer p.finished.Done()
+
+		in, err := listener.Accept()
+		if err != nil {
+			return
+		}
+
+		out, err := net.Dial("tcp", address)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		go p.copy(out, in, &p.client)
+		p.copy(in, out, &p.server)
+	}()
+
+	return p
+}
+
+func (p *recordingProxy) copy(dst io.WriteCloser, src io.Reader, record *bytes.Buffer) {
+	buf := make([]byte, 4096)
+
+	for {
+		n, err := src.Read(buf)
+
+		if n > 0 {
+			p.mu.Lock()
+			record.Write(buf[:n])
+			p.mu.Unlock()
+
+			dst.Write(buf[:n])
+		}
+
+		if err != nil {
+			dst.Close()
+			return
+		}
+	}
+}
+
+func (p *recordingProxy) Recorded() (client, server []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]byte{}, p.client.Bytes()...), append([]byte{}, p.server.Bytes()...)
+}
+
+func TestHTTP2Decoder(t *testing.T) {
+	server := newGRPCServer(func(r *http.Request) {})
+	defer server.Close()
+
+	proxy := newRecordingProxy(t, server.Listener.Addr().String())
+	client := NewHTTPClient(proxy.Addr().String(), &HTTPClientConfig{GRPC: true})
+
+	for _, message := range []string{"first", "second"} {
+		body := grpcFrame(message)
+		client.Send([]byte("POST /helloworld.Greeter/SayHello HTTP/1.1\r\nContent-Type: application/grpc\r\nContent-Length: " + strconv.Itoa(len(body)) + "\r\n\r\n" + body))
+	}
+
+	client.Disconnect()
+	proxy.Close()
+	proxy.finished.Wait()
+
+	clientData, serverData := proxy.Recorded()
+	now := time.Now()
+
+	// Frames can be split between captured TCP messages
+	var requests []*http2Stream
+	decoder := newHTTP2Decoder()
+	for start := 0; start < len(clientData); start += 10 {
+		end := start + 10
+		if end > len(clientData) {
+			end = len(clientData)
+		}
+
+		requests = append(requests, decoder.Write(clientData[start:end], now)...)
+	}
+
+	responses := newHTTP2Decoder().Write(serverData, now)
+
+	if len(requests) != 2 || len(responses) != 2 {
+		t.Fatal("Should decode 2 requests and 2 responses:", len(requests), len(responses))
+	}
+
+	for i, message := range []string{"first", "second"} {
+		req := string(requests[i].Request())
+		expected := "POST /helloworld.Greeter/SayHello HTTP/1.1\r\nHost: " + proxy.Addr().String() + "\r\n"
+
+		if req[:len(expected)] != expected || !bytes.HasSuffix([]byte(req), []byte("\r\n\r\n"+grpcFrame(message))) {
+			t.Errorf("Wrong request %d: %q", i, req)
+		}
+
+		if !bytes.Contains([]byte(req), []byte("Content-Length: "+strconv.Itoa(len(grpcFrame(message)))+"\r\n")) {
+			t.Errorf("Request should have Content-Length: %q", req)
+		}
+
+		resp := responses[i].Response()
+
+		if !bytes.HasPrefix(resp, []byte("HTTP/2.0 200 OK\r\n")) || !bytes.Contains(resp, []byte(grpcFrame(message))) {
+			t.Errorf("Wrong response %d: %q", i, resp)
+		}
+
+		if !bytes.Contains(resp, []byte("\r\nGrpc-Status: 0\r\n")) || !bytes.Contains(resp, []byte("\r\nGrpc-Message: OK\r\n")) {
+			t.Errorf("Response should contain trailers: %q", resp)
+		}
+	}
+}
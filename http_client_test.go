@@ -1,14 +1,24 @@
 package main
 
 import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/http/httputil"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
-	_ "time"
+	"time"
 )
 
 func TestHTTPClientURLPort(t *testing.T) {
@@ -31,6 +41,30 @@ func TestHTTPClientURLPort(t *testing.T) {
 	if c4.baseURL != "http://example.com:80" {
 		t.Error("Sould add default protocol:", c4.baseURL)
 	}
+
+	c5 := NewHTTPClient("http://[::1]", &HTTPClientConfig{})
+	if c5.baseURL != "http://[::1]:80" || c5.host != "[::1]:80" {
+		t.Error("Sould add port to IPv6 address:", c5.baseURL, c5.host)
+	}
+}
+
+func TestHTTPClientIPv6(t *testing.T) {
+	listener, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skip("IPv6 is not available:", err)
+	}
+
+	go http.Serve(listener, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host))
+	}))
+	defer listener.Close()
+
+	client := NewHTTPClient(listener.Addr().String(), &HTTPClientConfig{})
+
+	resp, err := client.Send([]byte("GET / HTTP/1.1\r\n\r\n"))
+	if err != nil || !bytes.HasSuffix(resp, []byte(listener.Addr().String())) {
+		t.Error("Should send request to IPv6 address:", err, string(resp))
+	}
 }
 
 func TestHTTPClientSend(t *testing.T) {
@@ -118,7 +152,7 @@ func TestHTTPClientHTTPSSend(t *testing.T) {
 		wg.Done()
 	}))
 
-	client := NewHTTPClient(server.URL, &HTTPClientConfig{})
+	client := NewHTTPClient(server.URL, &HTTPClientConfig{InsecureSkipVerify: true})
 
 	wg.Add(4)
 	client.Send(payload("POST"))
@@ -129,6 +163,421 @@ func TestHTTPClientHTTPSSend(t *testing.T) {
 	wg.Wait()
 }
 
+// startHTTP3 serves handler over QUIC on given UDP address. Servers share stateless reset key, so server started on
+// the same address resets connections of previous one, like restarted or failed over server does.
+func startHTTP3(t *testing.T, addr string, handler http.Handler) (string, func()) {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert := httptest.NewTLSServer(nil)
+	defer cert.Close()
+
+	key := quic.StatelessResetKey{1}
+	tr := &quic.Transport{Conn: conn, StatelessResetKey: &key}
+
+	listener, err := tr.ListenEarly(http3.ConfigureTLSConfig(&tls.Config{Certificates: cert.TLS.Certificates}), &quic.Config{Allow0RTT: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &http3.Server{Handler: handler}
+	go server.ServeListener(listener)
+
+	return conn.LocalAddr().String(), func() {
+		server.Close()
+		listener.Close()
+		conn.Close()
+	}
+}
+
+func TestHTTPClientHTTP3(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 3 {
+			t.Error("Should use HTTP/3:", r.Proto)
+		}
+
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc"})
+			http.Redirect(w, r, "/home", 302)
+			return
+		}
+
+		w.Write([]byte(r.URL.Path + ": " + r.Header.Get("Cookie")))
+	})
+
+	addr, stop := startHTTP3(t, "127.0.0.1:0", handler)
+
+	client := NewHTTPClient("https://"+addr, &HTTPClientConfig{HTTP3: true, InsecureSkipVerify: true, FollowRedirects: 1})
+
+	resp, err := client.Send([]byte("GET /login HTTP/1.1\r\n\r\n"))
+	if err != nil || !bytes.HasSuffix(resp, []byte("/home: session=abc")) {
+		t.Error("Should follow redirect of HTTP/3 response:", string(resp), err)
+	}
+
+	// Server replaced, so connection of the client is lost
+	stop()
+	_, stop = startHTTP3(t, addr, handler)
+
+	resp, err = client.Send([]byte("GET /after HTTP/1.1\r\n\r\n"))
+	if err != nil || !bytes.HasSuffix(resp, []byte("/after: ")) {
+		t.Error("Should reconnect when connection lost:", string(resp), err)
+	}
+
+	// Connection lost again, and request which is not safe to repeat is not retried
+	stop()
+	_, stop = startHTTP3(t, addr, handler)
+	defer stop()
+
+	if resp, err = client.Send([]byte("POST /post HTTP/1.1\r\nContent-Length: 1\r\n\r\na")); err == nil {
+		t.Error("Should not resend non-idempotent request:", string(resp))
+	}
+
+	if resp, err = client.Send([]byte("POST /post HTTP/1.1\r\nContent-Length: 1\r\n\r\na")); err != nil {
+		t.Error("Should send request over new connection:", err)
+	}
+}
+
+func TestHTTPClientHTTP2Send(t *testing.T) {
+	wg := new(sync.WaitGroup)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 {
+			t.Error("Should use HTTP/2:", r.Proto)
+		}
+
+		if r.Method == "POST" {
+			defer r.Body.Close()
+			body, _ := ioutil.ReadAll(r.Body)
+
+			if string(body) != "a=1&b=2" {
+				t.Error("Wrong POST body:", string(body))
+			}
+		}
+
+		w.Write([]byte("ok"))
+
+		wg.Done()
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	client := NewHTTPClient(server.URL, &HTTPClientConfig{InsecureSkipVerify: true})
+
+	wg.Add(2)
+	resp, err := client.Send([]byte("GET / HTTP/1.1\r\n\r\n"))
+	if err != nil || !bytes.HasPrefix(resp, []byte("HTTP/2.0 200")) {
+		t.Error("Should receive HTTP/2 response:", string(resp), err)
+	}
+
+	client.Send([]byte("POST /post HTTP/1.1\r\nContent-Length: 7\r\nHost: www.w3.org\r\n\r\na=1&b=2"))
+
+	wg.Wait()
+}
+
+// newGRPCServer starts plain HTTP server which accepts HTTP/2 with prior knowledge, and responds like gRPC service
+func newGRPCServer(handler func(r *http.Request)) *httptest.Server {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		handler(r)
+
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Write(body)
+		w.Header().Set(http.TrailerPrefix+"Grpc-Status", "0")
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", "OK")
+	}))
+
+	server.Config.Protocols = new(http.Protocols)
+	server.Config.Protocols.SetHTTP1(true)
+	server.Config.Protocols.SetUnencryptedHTTP2(true)
+	server.Start()
+
+	return server
+}
+
+// grpcFrame returns gRPC message prefixed with compression flag and length
+func grpcFrame(message string) string {
+	return "\x00\x00\x00\x00" + string(rune(len(message))) + message
+}
+
+func TestHTTPClientGRPC(t *testing.T) {
+	wg := new(sync.WaitGroup)
+
+	server := newGRPCServer(func(r *http.Request) {
+		if r.ProtoMajor != 2 {
+			t.Error("Should use HTTP/2:", r.Proto)
+		}
+
+		if r.URL.Path != "/helloworld.Greeter/SayHello" {
+			t.Error("Wrong path:", r.URL.Path)
+		}
+
+		wg.Done()
+	})
+	defer server.Close()
+
+	client := NewHTTPClient(server.URL, &HTTPClientConfig{GRPC: true})
+
+	body := grpcFrame("\x0a\x03gor")
+	request := "POST /helloworld.Greeter/SayHello HTTP/1.1\r\nContent-Type: application/grpc\r\nTe: trailers\r\nContent-Length: " + strconv.Itoa(len(body)) + "\r\n\r\n" + body
+
+	wg.Add(2)
+	for n := 0; n < 2; n++ {
+		resp, err := client.Send([]byte(request))
+
+		if err != nil || !bytes.HasPrefix(resp, []byte("HTTP/2.0 200")) {
+			t.Error("Should receive HTTP/2 response:", string(resp), err)
+		}
+
+		if !bytes.Contains(resp, []byte(body)) || !bytes.Contains(resp, []byte("\r\nGrpc-Status: 0\r\n")) {
+			t.Error("Response should contain body and trailers:", string(resp))
+		}
+	}
+
+	wg.Wait()
+}
+
+// writeServerCert saves certificate of test server to PEM files, so it can be used as client certificate or CA
+func writeServerCert(server *httptest.Server) (certFile, keyFile string) {
+	cert := server.TLS.Certificates[0]
+	key, _ := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+
+	certFile, keyFile = "/tmp/gor_test_client.crt", "/tmp/gor_test_client.key"
+	ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0600)
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key}), 0600)
+
+	return
+}
+
+func TestHTTPClientClientCert(t *testing.T) {
+	wg := new(sync.WaitGroup)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 {
+			t.Error("Should present client certificate")
+		}
+
+		wg.Done()
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	certFile, keyFile := writeServerCert(server)
+
+	client := NewHTTPClient(server.URL, &HTTPClientConfig{ClientCertFile: certFile, ClientKeyFile: keyFile, InsecureSkipVerify: true})
+
+	wg.Add(1)
+	if _, err := client.Get("/"); err != nil {
+		t.Error("Should pass client certificate check:", err)
+	}
+
+	wg.Wait()
+}
+
+func TestHTTPClientCAFile(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	client := NewHTTPClient(server.URL, &HTTPClientConfig{})
+	if _, err := client.Get("/"); err == nil {
+		t.Error("Should not trust self-signed certificate")
+	}
+
+	caFile, _ := writeServerCert(server)
+
+	client = NewHTTPClient(server.URL, &HTTPClientConfig{CAFile: caFile})
+	if _, err := client.Get("/"); err != nil {
+		t.Error("Should trust certificate signed by provided CA:", err)
+	}
+}
+
+// startProxy starts forward proxy which handles CONNECT tunnels, and replies itself to plain HTTP requests
+func startProxy(t *testing.T, requests chan *http.Request) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Proxy-Authorization") != "Basic dXNlcjpwYXNz" {
+			t.Error("Should pass proxy credentials:", r.Header)
+		}
+
+		requests <- r
+
+		if r.Method != "CONNECT" {
+			return
+		}
+
+		target, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+
+		go io.Copy(target, conn)
+		io.Copy(conn, target)
+	}))
+}
+
+func TestHTTPClientProxy(t *testing.T) {
+	requests := make(chan *http.Request, 1)
+	proxy := startProxy(t, requests)
+	defer proxy.Close()
+
+	client := NewHTTPClient("http://staging.local", &HTTPClientConfig{Proxy: "http://user:pass@" + proxy.Listener.Addr().String()})
+	client.Send([]byte("GET /test HTTP/1.1\r\n\r\n"))
+
+	if r := <-requests; r.RequestURI != "http://staging.local:80/test" {
+		t.Error("Should send request in absolute form:", r.RequestURI)
+	}
+}
+
+func TestHTTPClientProxyConnect(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	requests := make(chan *http.Request, 1)
+	proxy := startProxy(t, requests)
+	defer proxy.Close()
+
+	client := NewHTTPClient(server.URL, &HTTPClientConfig{Proxy: "http://user:pass@" + proxy.Listener.Addr().String(), InsecureSkipVerify: true})
+
+	if resp, err := client.Get("/"); err != nil || !bytes.Contains(resp, []byte(" 200 ")) {
+		t.Error("Should tunnel https request through proxy:", string(resp), err)
+	}
+
+	if r := <-requests; r.Method != "CONNECT" || r.Host != server.Listener.Addr().String() {
+		t.Error("Should open CONNECT tunnel to target:", r.Method, r.Host)
+	}
+}
+
+// startSOCKS5 starts SOCKS5 proxy which requires username/password auth and reports requested targets
+func startSOCKS5(t *testing.T, targets chan string) net.Listener {
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				buf := make([]byte, 512)
+
+				// Greeting: choose username/password auth
+				conn.Read(buf)
+				conn.Write([]byte{5, 2})
+
+				// Auth: VER ULEN USER PLEN PASS
+				n, _ := conn.Read(buf)
+				if string(buf[2:n]) != "user\x04pass" {
+					t.Error("Should pass SOCKS5 credentials:", buf[:n])
+				}
+				conn.Write([]byte{1, 0})
+
+				// Connect request: VER CMD RSV ATYP ADDR PORT
+				n, _ = conn.Read(buf)
+				host := net.IP(buf[4 : n-2]).String()
+				if buf[3] == 3 { // Domain name prefixed with its length
+					host = string(buf[5 : n-2])
+				}
+				port := int(buf[n-2])<<8 | int(buf[n-1])
+				target, _ := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+				targets <- host
+				conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+
+				go io.Copy(target, conn)
+				io.Copy(conn, target)
+			}()
+		}
+	}()
+
+	return listener
+}
+
+func TestHTTPClientSOCKS5(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	targets := make(chan string, 1)
+	socks := startSOCKS5(t, targets)
+	defer socks.Close()
+
+	client := NewHTTPClient(server.URL, &HTTPClientConfig{SOCKS5: "user:pass@" + socks.Addr().String()})
+
+	if resp, err := client.Get("/"); err != nil || !bytes.Contains(resp, []byte(" 200 ")) {
+		t.Error("Should send request through SOCKS5 proxy:", string(resp), err)
+	}
+
+	if host := <-targets; host != "127.0.0.1" {
+		t.Error("Should connect to target via proxy:", host)
+	}
+}
+
+func TestHTTPClientOriginalHost(t *testing.T) {
+	hosts := make(chan string, 2)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hosts <- r.Host
+	}))
+	defer server.Close()
+
+	payload := []byte("GET / HTTP/1.1\r\nHost: www.w3.org\r\n\r\n")
+
+	client := NewHTTPClient(server.URL, &HTTPClientConfig{})
+	client.Send(payload)
+
+	if host := <-hosts; host != server.Listener.Addr().String() {
+		t.Error("Should replace Host header with target host:", host)
+	}
+
+	client = NewHTTPClient(server.URL, &HTTPClientConfig{OriginalHost: true})
+	client.Send(payload)
+
+	if host := <-hosts; host != "www.w3.org" {
+		t.Error("Should keep original Host header:", host)
+	}
+}
+
+func TestHTTPClientBasicAuth(t *testing.T) {
+	type credentials struct{ user, pass string }
+	auths := make(chan credentials, 2)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ := r.BasicAuth()
+		auths <- credentials{user, pass}
+	}))
+	defer server.Close()
+
+	payload := []byte("GET / HTTP/1.1\r\nAuthorization: Bearer original\r\n\r\n")
+
+	client := NewHTTPClient("http://user:p%40ss@"+server.Listener.Addr().String(), &HTTPClientConfig{})
+	client.Send(payload)
+
+	if auth := <-auths; auth.user != "user" || auth.pass != "p@ss" {
+		t.Error("Should use credentials from URL:", auth)
+	}
+
+	if strings.Contains(client.baseURL, "user") {
+		t.Error("Should remove credentials from base URL:", client.baseURL)
+	}
+
+	client = NewHTTPClient(server.URL, &HTTPClientConfig{BasicAuth: "admin:secret"})
+	client.Send(payload)
+
+	if auth := <-auths; auth.user != "admin" || auth.pass != "secret" {
+		t.Error("Should use credentials from config:", auth)
+	}
+
+	// Retries send the same payload
+	if string(payload) != "GET / HTTP/1.1\r\nAuthorization: Bearer original\r\n\r\n" {
+		t.Errorf("Should not modify payload: %q", payload)
+	}
+}
+
 func TestHTTPClientServerInstantDisconnect(t *testing.T) {
 	wg := new(sync.WaitGroup)
 
@@ -192,6 +641,128 @@ func TestHTTPClientServerNoKeepAlive(t *testing.T) {
 	wg.Wait()
 }
 
+func TestHTTPClientInterimResponses(t *testing.T) {
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer listener.Close()
+
+	requests := make(chan string, 10)
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		buf := make([]byte, 4096)
+
+		n, _ := conn.Read(buf)
+		requests <- string(buf[:n])
+		// Final response sent separately, after body is received
+		conn.Write([]byte("HTTP/1.1 100 Continue\r\n\r\n"))
+		time.Sleep(10 * time.Millisecond)
+		conn.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nOK"))
+
+		n, _ = conn.Read(buf)
+		requests <- string(buf[:n])
+		conn.Write([]byte("HTTP/1.1 103 Early Hints\r\nLink: </style.css>\r\n\r\nHTTP/1.1 201 Created\r\nContent-Length: 0\r\n\r\n"))
+	}()
+
+	client := NewHTTPClient(listener.Addr().String(), &HTTPClientConfig{})
+
+	resp, err := client.Send([]byte("POST /upload HTTP/1.1\r\nExpect: 100-continue\r\nContent-Length: 4\r\n\r\nbody"))
+	if err != nil || string(resp) != "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nOK" {
+		t.Error("Should skip 100 Continue response:", err, string(resp))
+	}
+
+	if req := <-requests; strings.Contains(req, "Expect") || !strings.HasSuffix(req, "\r\n\r\nbody") {
+		t.Error("Should send body without Expect header:", req)
+	}
+
+	resp, err = client.Send([]byte("GET / HTTP/1.1\r\n\r\n"))
+	if err != nil || !bytes.HasPrefix(resp, []byte("HTTP/1.1 201")) {
+		t.Error("Should skip 103 Early Hints response:", err, string(resp))
+	}
+
+	if req := <-requests; !strings.HasPrefix(req, "GET / ") {
+		t.Error("Should send second request over same connection:", req)
+	}
+}
+
+func TestHTTPClientTimeout(t *testing.T) {
+	// Server accepts connections, but never responds
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	client := NewHTTPClient(listener.Addr().String(), &HTTPClientConfig{Timeout: 50 * time.Millisecond})
+
+	start := time.Now()
+	if _, err := client.Send([]byte("GET / HTTP/1.1\r\n\r\n")); err == nil || time.Since(start) > time.Second {
+		t.Error("Should fail after request timeout:", err, time.Since(start))
+	}
+
+	client = NewHTTPClient("https://"+listener.Addr().String(), &HTTPClientConfig{TLSHandshakeTimeout: 50 * time.Millisecond})
+
+	start = time.Now()
+	if err := client.Connect(); err == nil || time.Since(start) > time.Second {
+		t.Error("Should fail after TLS handshake timeout:", err, time.Since(start))
+	}
+}
+
+func TestHTTPClientKeepAlive(t *testing.T) {
+	var conns int32
+	var closeHeaders int32
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Close {
+			atomic.AddInt32(&closeHeaders, 1)
+		}
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	send := func(config *HTTPClientConfig, wait time.Duration) (int32, int32) {
+		atomic.StoreInt32(&conns, 0)
+		atomic.StoreInt32(&closeHeaders, 0)
+
+		client := NewHTTPClient(server.URL, config)
+		for i := 0; i < 3; i++ {
+			client.Send([]byte("GET / HTTP/1.1\r\n\r\n"))
+			time.Sleep(wait)
+		}
+		client.Disconnect()
+
+		return atomic.LoadInt32(&conns), atomic.LoadInt32(&closeHeaders)
+	}
+
+	if conns, closeHeaders := send(&HTTPClientConfig{}, 0); conns != 1 || closeHeaders != 0 {
+		t.Error("Should reuse connection:", conns, closeHeaders)
+	}
+
+	if conns, closeHeaders := send(&HTTPClientConfig{DisableKeepAlive: true}, 0); conns != 3 || closeHeaders != 3 {
+		t.Error("Should open connection for each request:", conns, closeHeaders)
+	}
+
+	if conns, _ := send(&HTTPClientConfig{IdleTimeout: 10 * time.Millisecond}, 20*time.Millisecond); conns != 3 {
+		t.Error("Should reconnect after idle timeout:", conns)
+	}
+}
+
 func TestHTTPClientRedirect(t *testing.T) {
 	wg := new(sync.WaitGroup)
 
@@ -246,6 +817,136 @@ func TestHTTPClientRedirectLimit(t *testing.T) {
 	wg.Wait()
 }
 
+func TestHTTPClientRedirectHosts(t *testing.T) {
+	var origin *httptest.Server
+	cdnHosts := make(chan string, 10)
+
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cdnHosts <- r.Host
+		http.Redirect(w, r, origin.URL+"/final", 302)
+	}))
+	defer cdn.Close()
+
+	origin = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			http.Redirect(w, r, cdn.URL+"/asset", 302)
+		case "/final":
+			w.Write([]byte("final"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer origin.Close()
+
+	GETPayload := []byte("GET / HTTP/1.1\r\n\r\n")
+
+	client := NewHTTPClient(origin.URL, &HTTPClientConfig{FollowRedirects: 3, RedirectHosts: []string{"127.0.0.1"}, Host: "staging.com"})
+
+	if resp, _ := client.Send(GETPayload); !bytes.HasSuffix(resp, []byte("final")) {
+		t.Errorf("Should follow redirects to other host and back: %q", resp)
+	}
+
+	if host := <-cdnHosts; host != cdn.Listener.Addr().String() {
+		t.Error("Should send Host header of redirect target:", host)
+	}
+
+	// Second request starts counting from zero, limit reached on other host
+	client.config.FollowRedirects = 1
+
+	if resp, _ := client.Send(GETPayload); !bytes.HasPrefix(resp, []byte("HTTP/1.1 302")) || len(cdnHosts) != 1 {
+		t.Errorf("Should stop following redirects after limit: %q", resp)
+	}
+	<-cdnHosts
+
+	client = NewHTTPClient(origin.URL, &HTTPClientConfig{FollowRedirects: 3, RedirectHosts: []string{"*.example.com"}})
+
+	if resp, _ := client.Send(GETPayload); bytes.HasSuffix(resp, []byte("final")) || len(cdnHosts) != 0 {
+		t.Errorf("Redirects to other hosts should be sent to target: %q", resp)
+	}
+
+	if !redirectHostAllowed([]string{"*.example.com"}, "auth.EXAMPLE.com") || redirectHostAllowed([]string{"*.example.com"}, "example.com") {
+		t.Error("Wildcard should match subdomains only")
+	}
+
+	client.Disconnect()
+}
+
+func TestHTTPClientRedirectCookies(t *testing.T) {
+	var origin *httptest.Server
+	cookies := make(chan string, 10)
+
+	auth := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cookies <- "auth: " + r.Header.Get("Cookie")
+		http.SetCookie(w, &http.Cookie{Name: "token", Value: "1"})
+		http.Redirect(w, r, origin.URL+"/done", 302)
+	}))
+	defer auth.Close()
+
+	origin = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc", Path: "/"})
+			http.Redirect(w, r, "/home", 302)
+		case "/sso":
+			// Cookies are not isolated by port, so other host name used
+			http.Redirect(w, r, strings.Replace(auth.URL, "127.0.0.1", "localhost", 1)+"/auth", 302)
+		default:
+			cookies <- r.URL.Path + ": " + r.Header.Get("Cookie")
+		}
+	}))
+	defer origin.Close()
+
+	client := NewHTTPClient(origin.URL, &HTTPClientConfig{FollowRedirects: 3, RedirectHosts: []string{"localhost"}})
+
+	client.Send([]byte("GET /login HTTP/1.1\r\nCookie: theme=dark\r\n\r\n"))
+	if c := <-cookies; c != "/home: theme=dark; session=abc" {
+		t.Error("Should send cookies of original request and redirect response:", c)
+	}
+
+	// Cookies sent only to hosts they belong to
+	client.Send([]byte("GET /sso HTTP/1.1\r\nCookie: theme=dark\r\n\r\n"))
+	if c := <-cookies; c != "auth: " {
+		t.Error("Should not send cookies to other host:", c)
+	}
+	if c := <-cookies; c != "/done: theme=dark" {
+		t.Error("Should not send cookies of other host:", c)
+	}
+
+	// Cookies of previous redirects are forgotten
+	client.Send([]byte("GET /home HTTP/1.1\r\n\r\n"))
+	if c := <-cookies; c != "/home: " {
+		t.Error("Should not keep cookies after redirects followed:", c)
+	}
+}
+
+func TestHTTPClientRedirectCookiesVirtualHost(t *testing.T) {
+	cookies := make(chan string, 10)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc", Domain: "example.com"})
+			http.Redirect(w, r, "/home", 302)
+			return
+		}
+
+		cookies <- r.Host + ": " + r.Header.Get("Cookie")
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(server.URL, &HTTPClientConfig{FollowRedirects: 1, Host: "app.example.com"})
+	client.Send([]byte("GET /login HTTP/1.1\r\n\r\n"))
+	if c := <-cookies; c != "app.example.com: session=abc" {
+		t.Error("Should accept cookie of configured host domain:", c)
+	}
+
+	client = NewHTTPClient(server.URL, &HTTPClientConfig{FollowRedirects: 1, OriginalHost: true})
+	client.Send([]byte("GET /login HTTP/1.1\r\nHost: www.example.com\r\n\r\n"))
+	if c := <-cookies; c != "www.example.com: session=abc" {
+		t.Error("Should keep original host and accept its domain cookie:", c)
+	}
+}
+
 func TestHTTPClientHandleHTTP10(t *testing.T) {
 	wg := new(sync.WaitGroup)
 
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// httpConn is connection to replay target. HTTP/2 connection multiplexes requests, so it can be used by multiple workers at once.
+type httpConn struct {
+	conn   net.Conn
+	h2conn *http2.ClientConn
+
+	lastUsed time.Time
+
+	// Number of requests sent over HTTP/2 connection at the moment
+	streams int
+}
+
+func (c *httpConn) Close() {
+	if c.h2conn != nil {
+		c.h2conn.Close()
+	}
+
+	c.conn.Close()
+	atomic.AddInt64(&httpConnections, -1)
+}
+
+// isAlive checks that server did not close idle connection
+func (c *httpConn) isAlive() bool {
+	one := make([]byte, 1)
+
+	c.conn.SetReadDeadline(time.Now().Add(time.Millisecond))
+	if _, err := c.conn.Read(one); err == io.EOF {
+		return false
+	}
+
+	return true
+}
+
+// httpConnPool holds persistent connections to replay target, shared by workers of http output, so workers started
+// by dynamic scaling reuse connections instead of opening new ones. HTTP/2 connection shared by all workers.
+//
+// Number of connections can be limited, then workers wait for free connection. Idle connections checked before use,
+// and closed after idle timeout, or if there are more of them than allowed.
+type httpConnPool struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	// Idle HTTP/1.1 connections, most recently used last
+	idle []*httpConn
+	// HTTP/2 connection which takes new requests
+	shared *httpConn
+	open   int
+	closed bool
+
+	maxConns    int
+	maxIdle     int
+	idleTimeout time.Duration
+
+	// TLS sessions resumed by new connections, so they skip full handshake
+	sessions tls.ClientSessionCache
+}
+
+// newHTTPConnPool constructor for httpConnPool. Zero limits mean unlimited.
+func newHTTPConnPool(maxConns, maxIdle int, idleTimeout time.Duration) *httpConnPool {
+	p := &httpConnPool{
+		maxConns:    maxConns,
+		maxIdle:     maxIdle,
+		idleTimeout: idleTimeout,
+		sessions:    tls.NewLRUClientSessionCache(64),
+	}
+	p.cond = sync.NewCond(&p.mu)
+
+	return p
+}
+
+// get returns shared HTTP/2 connection or idle connection, or opens new one using dial if limit allows.
+// Connection should be returned to pool using put.
+func (p *httpConnPool) get(dial func() (*httpConn, error)) (*httpConn, error) {
+	p.mu.Lock()
+
+	for {
+		if c := p.shared; c != nil {
+			if c.h2conn.CanTakeNewRequest() {
+				c.streams++
+				p.mu.Unlock()
+
+				return c, nil
+			}
+
+			p.retire(c)
+		}
+
+		p.evict()
+
+		if n := len(p.idle); n > 0 {
+			c := p.idle[n-1]
+			p.idle = p.idle[:n-1]
+			p.mu.Unlock()
+
+			// Server can close idle connection at any moment
+			if c.isAlive() {
+				return c, nil
+			}
+
+			Debug("[HTTPClient] Closing connection closed by server")
+
+			p.mu.Lock()
+			p.close(c)
+
+			continue
+		}
+
+		// Shared HTTP/2 connection checked first on wake up, so waiting workers use it once opened
+		if p.maxConns > 0 && p.open >= p.maxConns {
+			p.cond.Wait()
+			continue
+		}
+
+		p.open++
+		p.mu.Unlock()
+
+		c, err := dial()
+
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		if err != nil {
+			p.open--
+			p.cond.Signal()
+
+			return nil, err
+		}
+
+		if c.h2conn != nil {
+			c.streams++
+
+			// Other worker could open HTTP/2 connection at the same time, then this one closed after request
+			if p.shared == nil {
+				p.shared = c
+				p.cond.Broadcast()
+			}
+		}
+
+		return c, nil
+	}
+}
+
+// put returns connection to pool after request. Broken connection closed.
+func (p *httpConnPool) put(c *httpConn, broken bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	c.lastUsed = time.Now()
+
+	if c.h2conn != nil {
+		c.streams--
+
+		if (broken || p.closed) && p.shared == c {
+			p.retire(c)
+		} else if p.shared != c && c.streams == 0 {
+			p.close(c)
+		}
+
+		p.cond.Signal()
+
+		return
+	}
+
+	if broken || p.closed || (p.maxIdle > 0 && len(p.idle) >= p.maxIdle) {
+		p.close(c)
+		return
+	}
+
+	p.idle = append(p.idle, c)
+	p.cond.Signal()
+}
+
+// retire stops sending new requests over HTTP/2 connection, it closed once its requests completed. Called with lock held.
+func (p *httpConnPool) retire(c *httpConn) {
+	p.shared = nil
+
+	if c.streams == 0 {
+		p.close(c)
+	}
+
+	// Workers waiting for shared connection open new one
+	p.cond.Broadcast()
+}
+
+// evict closes connections idle longer than idle timeout. Called with lock held.
+func (p *httpConnPool) evict() {
+	if p.idleTimeout <= 0 {
+		return
+	}
+
+	n := 0
+	for n < len(p.idle) && time.Since(p.idle[n].lastUsed) > p.idleTimeout {
+		Debug("[HTTPClient] Closing idle connection")
+		p.close(p.idle[n])
+		n++
+	}
+
+	p.idle = p.idle[n:]
+}
+
+// close closes connection, and wakes up worker waiting for free connection. Called with lock held.
+func (p *httpConnPool) close(c *httpConn) {
+	c.Close()
+	p.open--
+	p.cond.Signal()
+}
+
+// Close closes idle connections, connections in use closed when returned to pool
+func (p *httpConnPool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+
+	for _, c := range p.idle {
+		p.close(c)
+	}
+	p.idle = nil
+
+	if p.shared != nil {
+		p.retire(p.shared)
+	}
+
+	return nil
+}
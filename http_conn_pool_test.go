@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// pipeDialer opens in-memory connections, and keeps server sides of them
+type pipeDialer struct {
+	servers []net.Conn
+}
+
+func (d *pipeDialer) dial() (*httpConn, error) {
+	client, server := net.Pipe()
+	d.servers = append(d.servers, server)
+	atomic.AddInt64(&httpConnections, 1)
+
+	return &httpConn{conn: client}, nil
+}
+
+func TestHTTPConnPoolReuse(t *testing.T) {
+	d := new(pipeDialer)
+	pool := newHTTPConnPool(0, 0, 0)
+
+	c1, _ := pool.get(d.dial)
+	pool.put(c1, false)
+
+	if c2, _ := pool.get(d.dial); c2 != c1 || len(d.servers) != 1 {
+		t.Error("Should reuse idle connection")
+	}
+
+	// Server closed idle connection
+	pool.put(c1, false)
+	d.servers[0].Close()
+
+	if c3, _ := pool.get(d.dial); c3 == c1 || len(d.servers) != 2 {
+		t.Error("Should open new connection instead of closed one")
+	} else {
+		pool.put(c3, true)
+	}
+
+	if pool.open != 0 || len(pool.idle) != 0 {
+		t.Error("Broken connection should be closed", pool.open, len(pool.idle))
+	}
+}
+
+func TestHTTPConnPoolLimits(t *testing.T) {
+	d := new(pipeDialer)
+	pool := newHTTPConnPool(1, 0, 10*time.Millisecond)
+
+	c1, _ := pool.get(d.dial)
+
+	got := make(chan *httpConn)
+	go func() {
+		c, _ := pool.get(d.dial)
+		got <- c
+	}()
+
+	select {
+	case <-got:
+		t.Fatal("Should wait for free connection when limit reached")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	pool.put(c1, false)
+
+	if c := <-got; c != c1 {
+		t.Error("Should get connection returned to pool")
+	}
+
+	pool.put(c1, false)
+	time.Sleep(20 * time.Millisecond)
+
+	if c, _ := pool.get(d.dial); c == c1 || len(d.servers) != 2 {
+		t.Error("Should close connection idle longer than idle timeout")
+	}
+}
+
+func TestHTTPOutputConnPool(t *testing.T) {
+	var conns, resumed int64
+	wg := new(sync.WaitGroup)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS.DidResume {
+			atomic.AddInt64(&resumed, 1)
+		}
+		wg.Done()
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt64(&conns, 1)
+		}
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	output := NewHTTPOutput(server.URL, &HTTPOutputConfig{workers: 10, maxConns: 2, tlsSkipVerify: true}).(*HTTPOutput)
+
+	wg.Add(50)
+	for i := 0; i < 50; i++ {
+		output.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+	}
+	wg.Wait()
+
+	if n := atomic.LoadInt64(&conns); n == 0 || n > 2 {
+		t.Error("Workers should share limited number of connections:", n)
+	}
+
+	// New connections resume TLS session of previous ones
+	output.pool.Close()
+	output.config.disableKeepAlive = true
+
+	wg.Add(2)
+	output.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+	output.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+	wg.Wait()
+
+	if atomic.LoadInt64(&resumed) == 0 {
+		t.Error("Should resume TLS sessions")
+	}
+
+	// Connections closed by workers after response
+	for output.Pending() > 0 {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestHTTPConnPoolHTTP2Error(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(500 * time.Millisecond)
+		} else {
+			time.Sleep(100 * time.Millisecond)
+		}
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	connections := atomic.LoadInt64(&httpConnections)
+
+	pool := newHTTPConnPool(0, 0, 0)
+	config := &HTTPClientConfig{Pool: pool, InsecureSkipVerify: true, Timeout: 200 * time.Millisecond}
+
+	done := make(chan error)
+	go func() {
+		_, err := NewHTTPClient(server.URL, config).Send([]byte("GET /slow HTTP/1.1\r\n\r\n"))
+		done <- err
+	}()
+	time.Sleep(150 * time.Millisecond)
+
+	// Request of other worker shares the same connection, and should not be affected by timeout of the first one
+	resp, err := NewHTTPClient(server.URL, config).Send([]byte("GET /fast HTTP/1.1\r\n\r\n"))
+	if err != nil || !bytes.HasPrefix(resp, []byte("HTTP/2.0 200")) {
+		t.Error("Should complete request sent over the same connection:", err, string(resp))
+	}
+
+	if err := <-done; err == nil {
+		t.Error("Should time out")
+	}
+
+	pool.Close()
+
+	if n := atomic.LoadInt64(&httpConnections); n != connections {
+		t.Error("Should close connection once:", n-connections)
+	}
+}
+
+func TestHTTPConnPoolSessionCache(t *testing.T) {
+	pool := newHTTPConnPool(0, 0, 0)
+	client := NewHTTPClient("https://127.0.0.1:443", &HTTPClientConfig{Pool: pool})
+
+	if client.tlsConfig.ClientSessionCache != tls.ClientSessionCache(pool.sessions) {
+		t.Error("Clients of pool should share TLS session cache")
+	}
+}
+
+func TestHTTPOutputConnPoolHTTP2(t *testing.T) {
+	var active, maxActive int64
+	wg := new(sync.WaitGroup)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt64(&active, 1)
+		for {
+			if m := atomic.LoadInt64(&maxActive); n <= m || atomic.CompareAndSwapInt64(&maxActive, m, n) {
+				break
+			}
+		}
+
+		time.Sleep(100 * time.Millisecond)
+		atomic.AddInt64(&active, -1)
+		wg.Done()
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	output := NewHTTPOutput(server.URL, &HTTPOutputConfig{workers: 5, maxConns: 1, tlsSkipVerify: true}).(*HTTPOutput)
+	defer output.Close()
+
+	wg.Add(10)
+	for i := 0; i < 10; i++ {
+		output.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Workers waiting for connection should share HTTP/2 connection")
+	}
+
+	if n := atomic.LoadInt64(&maxActive); n < 2 {
+		t.Error("Workers should send requests over HTTP/2 connection concurrently:", n)
+	}
+}
@@ -20,15 +20,23 @@ func NewHTTPModifier(config *HTTPModifierConfig) *HTTPModifier {
 		len(config.headerNegativeFilters) == 0 &&
 		len(config.headerHashFilters) == 0 &&
 		len(config.paramHashFilters) == 0 &&
+		len(config.cookieHashFilters) == 0 &&
 		len(config.params) == 0 &&
+		len(config.stripParams) == 0 &&
 		len(config.headers) == 0 &&
-		len(config.methods) == 0 {
+		len(config.methods) == 0 &&
+		len(config.jsonRewrites) == 0 {
 		return nil
 	}
 
 	return &HTTPModifier{config: config}
 }
 
+// readsBody checks if there are rules which rewrite request body
+func (m *HTTPModifier) readsBody() bool {
+	return m != nil && (len(m.config.jsonRewrites) > 0 || len(m.config.stripParams) > 0)
+}
+
 func (m *HTTPModifier) Rewrite(payload []byte) (response []byte) {
 	if len(m.config.methods) > 0 {
 		method := proto.Method(payload)
@@ -59,6 +67,25 @@ func (m *HTTPModifier) Rewrite(payload []byte) (response []byte) {
 		}
 	}
 
+	if len(m.config.stripParams) > 0 {
+		for _, name := range m.config.stripParams {
+			payload = proto.DeletePathParam(payload, name)
+			payload = proto.DeleteBodyParam(payload, name)
+		}
+	}
+
+	if len(m.config.jsonRewrites) > 0 {
+		payload = rewriteJSONBody(payload, func(doc interface{}) (interface{}, bool) {
+			changed := false
+
+			for _, r := range m.config.jsonRewrites {
+				doc = rewriteJSONPath(doc, r.path, func(interface{}) interface{} { return r.value }, &changed)
+			}
+
+			return doc, changed
+		})
+	}
+
 	if len(m.config.urlRegexp) > 0 {
 		path := proto.Path(payload)
 
@@ -90,7 +117,7 @@ func (m *HTTPModifier) Rewrite(payload []byte) (response []byte) {
 		for _, f := range m.config.headerFilters {
 			value := proto.Header(payload, f.name)
 
-			if len(value) > 0 && !f.regexp.Match(value) {
+			if !f.regexp.Match(value) {
 				return
 			}
 		}
@@ -136,6 +163,21 @@ func (m *HTTPModifier) Rewrite(payload []byte) (response []byte) {
 		}
 	}
 
+	if len(m.config.cookieHashFilters) > 0 {
+		for _, f := range m.config.cookieHashFilters {
+			value := proto.Cookie(payload, f.name)
+
+			if len(value) > 0 {
+				hasher := fnv.New32a()
+				hasher.Write(value)
+
+				if (hasher.Sum32() % 100) >= f.percent {
+					return
+				}
+			}
+		}
+	}
+
 	if len(m.config.urlRewrite) > 0 {
 		path := proto.Path(payload)
 
@@ -17,10 +17,14 @@ type HTTPModifierConfig struct {
 	headerNegativeFilters HTTPHeaderFilters
 	headerHashFilters     HTTPHashFilters
 	paramHashFilters      HTTPHashFilters
+	cookieHashFilters     HTTPHashFilters
 
-	params  HTTPParams
-	headers HTTPHeaders
-	methods HTTPMethods
+	params      HTTPParams
+	stripParams HTTPParamNames
+	headers     HTTPHeaders
+	methods     HTTPMethods
+
+	jsonRewrites HTTPJSONRewrites
 }
 
 //
@@ -43,18 +47,18 @@ func (h *HTTPHeaderFilters) Set(value string) error {
 	if len(valArr) < 2 {
 		return errors.New("need both header and value, colon-delimited (ex. user_id:^169$).")
 	}
-	r, err := regexp.Compile(valArr[1])
+	r, err := regexp.Compile(strings.TrimSpace(valArr[1]))
 	if err != nil {
 		return err
 	}
 
-	*h = append(*h, headerFilter{name: []byte(valArr[0]), regexp: r})
+	*h = append(*h, headerFilter{name: []byte(strings.TrimSpace(valArr[0])), regexp: r})
 
 	return nil
 }
 
 //
-// Handling of --http-allow-header-hash and --http-allow-param-hash options
+// Handling of --http-header-limiter, --http-param-limiter and --http-cookie-limiter options
 //
 type hashFilter struct {
 	name    []byte
@@ -152,6 +156,20 @@ func (h *HTTPParams) Set(value string) error {
 	return nil
 }
 
+//
+// Handling of --http-strip-param option
+//
+type HTTPParamNames [][]byte
+
+func (h *HTTPParamNames) String() string {
+	return fmt.Sprint(*h)
+}
+
+func (h *HTTPParamNames) Set(value string) error {
+	*h = append(*h, []byte(strings.TrimSpace(value)))
+	return nil
+}
+
 //
 // Handling of --http-allow-method option
 //
@@ -180,16 +198,24 @@ func (r *UrlRewriteMap) String() string {
 	return fmt.Sprint(*r)
 }
 
+// Set accepts "src -> target" mapping, or "src:target" for backward compatibility.
+// Arrow syntax allows to use ':' inside regexp.
 func (r *UrlRewriteMap) Set(value string) error {
-	valArr := strings.SplitN(value, ":", 2)
+	var valArr []string
+	if strings.Contains(value, "->") {
+		valArr = strings.SplitN(value, "->", 2)
+	} else {
+		valArr = strings.SplitN(value, ":", 2)
+	}
+
 	if len(valArr) < 2 {
-		return errors.New("need both src and target, colon-delimited (ex. /a:/b)")
+		return errors.New("need both src and target, arrow-delimited (ex. /v1/(.*) -> /v2/$1)")
 	}
-	regexp, err := regexp.Compile(valArr[0])
+	regexp, err := regexp.Compile(strings.TrimSpace(valArr[0]))
 	if err != nil {
 		return err
 	}
-	*r = append(*r, urlRewrite{src: regexp, target: []byte(valArr[1])})
+	*r = append(*r, urlRewrite{src: regexp, target: []byte(strings.TrimSpace(valArr[1]))})
 	return nil
 }
 
@@ -213,3 +239,40 @@ func (r *HTTPUrlRegexp) Set(value string) error {
 
 	return err
 }
+
+//
+// Handling of --http-rewrite-json option
+//
+type jsonRewrite struct {
+	path  []string
+	value interface{}
+}
+
+// HTTPJSONRewrites holds list of JSON body fields and their new values
+type HTTPJSONRewrites []jsonRewrite
+
+func (r *HTTPJSONRewrites) String() string {
+	return fmt.Sprint(*r)
+}
+
+// Set parses `$.path=value` rule. Value is JSON literal, like 42, null or {"a": 1}, otherwise used as string.
+func (r *HTTPJSONRewrites) Set(value string) error {
+	valArr := strings.SplitN(value, "=", 2)
+	if len(valArr) < 2 {
+		return errors.New("need both JSON path and value, '='-delimited (ex. $.user.email=test@example.com)")
+	}
+
+	path, err := parseJSONPath(strings.TrimSpace(valArr[0]))
+	if err != nil {
+		return err
+	}
+
+	v, err := decodeJSON([]byte(valArr[1]))
+	if err != nil {
+		v = valArr[1]
+	}
+
+	*r = append(*r, jsonRewrite{path: path, value: v})
+
+	return nil
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"testing"
 )
 
@@ -62,4 +63,38 @@ func TestUrlRewriteMap(t *testing.T) {
 	if err = rewrites.Set("/v1/user/([^\\/]+)/ping"); err == nil {
 		t.Error("Should not set mapping without :")
 	}
+
+	if err = rewrites.Set("/v1/(.*) -> /v2/$1"); err != nil {
+		t.Error("Should set mapping with arrow", err)
+	}
+
+	if rewrites[1].src.String() != "/v1/(.*)" || string(rewrites[1].target) != "/v2/$1" {
+		t.Error("Should trim spaces around arrow", rewrites[1].src, string(rewrites[1].target))
+	}
+
+	if err = rewrites.Set("/a:b/(.*)->/c:d/$1"); err != nil || string(rewrites[2].target) != "/c:d/$1" {
+		t.Error("Should allow colons in arrow mapping", err)
+	}
+}
+
+func TestHTTPJSONRewrites(t *testing.T) {
+	rewrites := HTTPJSONRewrites{}
+
+	if err := rewrites.Set("$.user.age=42"); err != nil || rewrites[0].value != json.Number("42") || len(rewrites[0].path) != 2 {
+		t.Error("Should parse JSON value", err, rewrites)
+	}
+
+	if err := rewrites.Set("$.items[0].tags[*]=test"); err != nil || rewrites[1].value != "test" {
+		t.Error("Should use value as string if it is not JSON", err, rewrites)
+	}
+
+	if got := rewrites[1].path; len(got) != 4 || got[0] != "items" || got[1] != "0" || got[2] != "tags" || got[3] != "*" {
+		t.Error("Should parse array indexes", got)
+	}
+
+	for _, value := range []string{"$.user", "$=1", "$.items[0=1"} {
+		if err := rewrites.Set(value); err == nil {
+			t.Error("Should reject invalid rule", value)
+		}
+	}
 }
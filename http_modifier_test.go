@@ -3,6 +3,7 @@ package main
 import (
 	"bytes"
 	"github.com/buger/gor/proto"
+	"strconv"
 	"testing"
 )
 
@@ -37,6 +38,17 @@ func TestHTTPModifierHeaderFilters(t *testing.T) {
 	if len(modifier.Rewrite(payload)) != 0 {
 		t.Error("Request should not pass filters")
 	}
+
+	filters = HTTPHeaderFilters{}
+	filters.Set("Api-Version: ^1")
+
+	modifier = NewHTTPModifier(&HTTPModifierConfig{
+		headerFilters: filters,
+	})
+
+	if len(modifier.Rewrite(payload)) != 0 {
+		t.Error("Request without header should not pass filters")
+	}
 }
 
 func TestHTTPModifierHeaderNegativeFilters(t *testing.T) {
@@ -64,6 +76,19 @@ func TestHTTPModifierHeaderNegativeFilters(t *testing.T) {
 	if len(modifier.Rewrite(payload)) != 0 {
 		t.Error("Request should not pass filters")
 	}
+
+	filters = HTTPHeaderFilters{}
+	filters.Set("Authorization: ^Bearer internal-")
+
+	modifier = NewHTTPModifier(&HTTPModifierConfig{
+		headerNegativeFilters: filters,
+	})
+
+	payload = []byte("GET / HTTP/1.1\r\nAuthorization: Bearer internal-123\r\n\r\n")
+
+	if len(modifier.Rewrite(payload)) != 0 {
+		t.Error("Request with internal token should not pass filters")
+	}
 }
 
 func TestHTTPModifierURLRewrite(t *testing.T) {
@@ -145,6 +170,99 @@ func TestHTTPModifierParamHashFilters(t *testing.T) {
 	}
 }
 
+func TestHTTPModifierCookieHashFilters(t *testing.T) {
+	filters := HTTPHashFilters{}
+	filters.Set("session_id:50%")
+
+	modifier := NewHTTPModifier(&HTTPModifierConfig{
+		cookieHashFilters: filters,
+	})
+
+	payload := func(cookie []byte) []byte {
+		return []byte("POST / HTTP/1.1\r\n" + string(cookie) + "Content-Length: 7\r\nHost: www.w3.org\r\n\r\na=1&b=2")
+	}
+
+	if p := modifier.Rewrite(payload([]byte("Cookie: user=3\r\n"))); len(p) == 0 {
+		t.Error("Request should pass filters if cookie does not exist")
+	}
+
+	if p := modifier.Rewrite(payload([]byte("Cookie: user=1; session_id=3\r\n"))); len(p) > 0 {
+		t.Error("Request should not pass filters, session_id hash too high")
+	}
+
+	if p := modifier.Rewrite(payload([]byte("Cookie: session_id=1\r\n"))); len(p) == 0 {
+		t.Error("Request should pass filters")
+	}
+}
+
+func TestHTTPModifierStripParams(t *testing.T) {
+	params := HTTPParamNames{}
+	params.Set("utm_source")
+
+	modifier := NewHTTPModifier(&HTTPModifierConfig{
+		stripParams: params,
+	})
+
+	payload := []byte("POST /post?utm_source=mail&id=1 HTTP/1.1\r\nContent-Type: application/x-www-form-urlencoded\r\nContent-Length: 18\r\n\r\nutm_source=mail&a=1")
+
+	payload = modifier.Rewrite(payload)
+
+	if !bytes.Equal(proto.Path(payload), []byte("/post?id=1")) {
+		t.Error("Should strip query param", string(payload))
+	}
+
+	if !bytes.Equal(proto.Header(payload, []byte("Content-Length")), []byte("3")) {
+		t.Error("Should strip body param and update Content-Length", string(payload))
+	}
+}
+
+func TestHTTPModifierRewriteJSON(t *testing.T) {
+	rewrites := HTTPJSONRewrites{}
+	rewrites.Set("$.user.email=test@example.com")
+	rewrites.Set("$.items[*].price=0")
+	rewrites.Set("$.missing=1")
+
+	modifier := NewHTTPModifier(&HTTPModifierConfig{
+		jsonRewrites: rewrites,
+	})
+
+	payload := []byte("POST /order HTTP/1.1\r\nContent-Type: application/json\r\nContent-Length: 84\r\n\r\n" +
+		`{"user": {"email": "john@gmail.com", "name": "John"}, "items": [{"price": 10}, {"price": 20}]}`)
+
+	payload = modifier.Rewrite(payload)
+	body := `{"user":{"email":"test@example.com","name":"John"},"items":[{"price":0},{"price":0}]}`
+
+	if !bytes.HasSuffix(payload, []byte("\r\n\r\n"+body)) {
+		t.Error("Should rewrite JSON fields", string(payload))
+	}
+
+	if !bytes.Equal(proto.Header(payload, []byte("Content-Length")), []byte(strconv.Itoa(len(body)))) {
+		t.Error("Should update Content-Length", string(payload))
+	}
+
+	// Other values kept as is
+	payload = []byte("POST /order HTTP/1.1\r\nContent-Type: application/json\r\nContent-Length: 79\r\n\r\n" +
+		`{"id": 9007199254740993, "note": "<b>&</b>", "items": [{"price": 1.50}]}`)
+	body = `{"id":9007199254740993,"note":"<b>&</b>","items":[{"price":0}]}`
+
+	if payload = modifier.Rewrite(payload); !bytes.HasSuffix(payload, []byte("\r\n\r\n"+body)) {
+		t.Error("Should keep numbers and not escape HTML", string(payload))
+	}
+
+	payload = []byte("POST /order HTTP/1.1\r\nContent-Type: application/json\r\nContent-Length: 36\r\n\r\n" +
+		`{"b": 1, "a": 9007199254740993.0}`)
+
+	if !bytes.Equal(modifier.Rewrite(payload), payload) {
+		t.Error("Should not touch body without matched fields", string(payload))
+	}
+
+	payload = []byte("POST /order HTTP/1.1\r\nContent-Type: application/x-www-form-urlencoded\r\nContent-Length: 5\r\n\r\nuser=")
+
+	if !bytes.Equal(modifier.Rewrite(payload), payload) {
+		t.Error("Should ignore non-JSON bodies", string(payload))
+	}
+}
+
 func TestHTTPModifierHeaders(t *testing.T) {
 	headers := HTTPHeaders{}
 	headers.Set("Header1:1")
@@ -1,24 +1,107 @@
 package main
 
 import (
+	"bytes"
+	"log"
+	"math/rand"
+	"strconv"
+	"strings"
 	"time"
 )
 
-// DummyInput used for debugging. It generate 1 "GET /"" request per second.
+// Placeholders of dummy input URL templates, replaced with random values in each request
+const (
+	dummyPlaceholderInt  = "{int}"
+	dummyPlaceholderUUID = "{uuid}"
+)
+
+// DummyInputConfig input-dummy options
+type DummyInputConfig struct {
+	// Requests per second
+	rate int
+	// Request templates in "[METHOD] /path" format, random one used for each request
+	urls MultiOption
+	// Body size in bytes, "size" or "min-max" for uniform distribution
+	bodySize string
+}
+
+// DummyInput used for debugging and load testing outputs without capture source.
+// By default it generate 1 "GET /" request per second, rate, URLs and bodies are configurable.
 type DummyInput struct {
-	data chan []byte
+	data   chan []byte
+	config *DummyInputConfig
+
+	templates   []dummyTemplate
+	minBodySize int
+	maxBodySize int
+}
+
+type dummyTemplate struct {
+	method string
+	path   string
 }
 
 // NewDummyInput constructor for DummyInput
-func NewDummyInput(options string) (di *DummyInput) {
+func NewDummyInput(options string, config *DummyInputConfig) (di *DummyInput) {
 	di = new(DummyInput)
 	di.data = make(chan []byte)
+	di.config = config
+
+	for _, url := range config.urls {
+		di.templates = append(di.templates, parseDummyTemplate(url))
+	}
+
+	if len(di.templates) == 0 {
+		di.templates = []dummyTemplate{{"GET", "/"}}
+	}
+
+	var err error
+	if di.minBodySize, di.maxBodySize, err = parseSizeRange(config.bodySize); err != nil {
+		log.Fatal("Invalid dummy input body size: ", config.bodySize)
+	}
 
 	go di.emit()
 
 	return
 }
 
+// parseDummyTemplate parses "[METHOD] /path" template, method is GET if not specified
+func parseDummyTemplate(url string) dummyTemplate {
+	url = strings.TrimSpace(url)
+
+	if i := strings.IndexByte(url, ' '); i != -1 {
+		return dummyTemplate{strings.ToUpper(url[:i]), strings.TrimSpace(url[i+1:])}
+	}
+
+	return dummyTemplate{"GET", url}
+}
+
+// parseSizeRange parses "size" or "min-max" value, empty value is 0
+func parseSizeRange(value string) (min, max int, err error) {
+	if value == "" {
+		return 0, 0, nil
+	}
+
+	parts := strings.SplitN(value, "-", 2)
+
+	if min, err = strconv.Atoi(strings.TrimSpace(parts[0])); err != nil {
+		return
+	}
+
+	max = min
+	if len(parts) == 2 {
+		if max, err = strconv.Atoi(strings.TrimSpace(parts[1])); err != nil {
+			return
+		}
+	}
+
+	if min < 0 || max < min {
+		err = strconv.ErrRange
+	}
+
+	return
+}
+
 func (i *DummyInput) Read(data []byte) (int, error) {
 	buf := <-i.data
 	copy(data, buf)
@@ -27,16 +110,57 @@ func (i *DummyInput) Read(data []byte) (int, error) {
 }
 
 func (i *DummyInput) emit() {
-	ticker := time.NewTicker(time.Second)
+	rate := i.config.rate
+	if rate <= 0 {
+		rate = 1
+	}
+
+	interval := time.Second / time.Duration(rate)
+	if interval <= 0 {
+		interval = time.Nanosecond
+	}
+
+	ticker := time.NewTicker(interval)
 
 	for {
 		select {
 		case <-ticker.C:
-			i.data <- []byte("GET / HTTP/1.1\r\n\r\n")
+			i.data <- i.request()
 		}
 	}
 }
 
+// request generates request from random template
+func (i *DummyInput) request() []byte {
+	t := i.templates[rand.Intn(len(i.templates))]
+
+	path := t.path
+	for strings.Contains(path, dummyPlaceholderInt) {
+		path = strings.Replace(path, dummyPlaceholderInt, strconv.Itoa(rand.Intn(1000000)), 1)
+	}
+	for strings.Contains(path, dummyPlaceholderUUID) {
+		path = strings.Replace(path, dummyPlaceholderUUID, string(uuid()), 1)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(t.method + " " + path + " HTTP/1.1\r\n")
+
+	size := i.minBodySize
+	if i.maxBodySize > i.minBodySize {
+		size += rand.Intn(i.maxBodySize - i.minBodySize + 1)
+	}
+
+	// GET and HEAD requests sent without body
+	if size > 0 && t.method != "GET" && t.method != "HEAD" {
+		buf.WriteString("Content-Length: " + strconv.Itoa(size) + "\r\n\r\n")
+		buf.Write(bytes.Repeat([]byte("a"), size))
+	} else {
+		buf.WriteString("\r\n")
+	}
+
+	return buf.Bytes()
+}
+
 func (i *DummyInput) String() string {
 	return "Dummy Input"
 }
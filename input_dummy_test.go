@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/buger/gor/proto"
+)
+
+func TestDummyInputTemplates(t *testing.T) {
+	input := NewDummyInput("", &DummyInputConfig{rate: 1000, urls: MultiOption{"/users/{int}", "post /orders/{uuid}"}, bodySize: "10-20"})
+
+	var gets, posts int
+	for n := 0; n < 20; n++ {
+		data := <-input.data
+
+		switch string(proto.Method(data)) {
+		case "GET":
+			gets++
+			if !bytes.HasPrefix(data, []byte("GET /users/")) || bytes.Contains(data, []byte("{int}")) || !bytes.HasSuffix(data, []byte(" HTTP/1.1\r\n\r\n")) {
+				t.Errorf("Should render GET template without body: %q", data)
+			}
+		case "POST":
+			posts++
+			size := len(data) - proto.MIMEHeadersEndPos(data) - len(proto.EmptyLine)
+			if size < 10 || size > 20 || bytes.Contains(data, []byte("{uuid}")) {
+				t.Errorf("Should render POST template with body: %q", data)
+			}
+		default:
+			t.Errorf("Unexpected request: %q", data)
+		}
+	}
+
+	if gets == 0 || posts == 0 {
+		t.Error("Should use all templates:", gets, posts)
+	}
+}
+
+func TestParseSizeRange(t *testing.T) {
+	cases := []struct {
+		value    string
+		min, max int
+		valid    bool
+	}{
+		{"", 0, 0, true},
+		{"100", 100, 100, true},
+		{"100-200", 100, 200, true},
+		{"200-100", 0, 0, false},
+		{"abc", 0, 0, false},
+	}
+
+	for _, c := range cases {
+		min, max, err := parseSizeRange(c.value)
+		if (err == nil) != c.valid || (c.valid && (min != c.min || max != c.max)) {
+			t.Error("Wrong size range:", c.value, min, max, err)
+		}
+	}
+}
@@ -1,33 +1,195 @@
 package main
 
 import (
+	"bufio"
+	"compress/gzip"
 	"encoding/gob"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 )
 
+// FileInputConfig holds configuration for file input
+type FileInputConfig struct {
+	// Number of times file should be replayed, -1 means forever
+	loop int
+	// Time when replay starts, requests emitted at their original offset from it instead of relative delays
+	startAt string
+	// Read all matching files at once, ordered by recorded time, instead of one after another
+	merge bool
+
+	// Benchmark mode: recorded pacing ignored, requests emitted at fixed rate per second
+	rate float64
+	// "open" workload emits requests at fixed rate, "closed" keeps fixed number of requests in flight
+	workload    string
+	concurrency int
+}
+
+// Workload models of benchmark mode
+const (
+	workloadOpen   = "open"
+	workloadClosed = "closed"
+)
+
+// requestDecoder reads RawRequest values, implemented by gob.Decoder and fileMerger
+type requestDecoder interface {
+	Decode(e interface{}) error
+}
+
 // FileInput can read requests generated by FileOutput
 type FileInput struct {
 	data        chan []byte
 	path        string
-	decoder     *gob.Decoder
+	files       []string
+	fileIndex   int
+	file        *os.File
+	decoder     requestDecoder
 	speedFactor float64
+	config      *FileInputConfig
+
+	// Only requests recorded within this window replayed, in nanoseconds. 0 means unbounded
+	from int64
+	to   int64
+
+	startAt time.Time
 }
 
+// Formats of time window bounds, without zone they are in local time
+var timeWindowLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02"}
+
 // NewFileInput constructor for FileInput. Accepts file path as argument.
-func NewFileInput(path string) (i *FileInput) {
+// Path can be glob pattern, in this case all matching files replayed one after another, sorted by name,
+// or merged by recorded time if `merge` enabled.
+func NewFileInput(path string, config *FileInputConfig) (i *FileInput) {
 	i = new(FileInput)
 	i.data = make(chan []byte)
+	path, i.from, i.to = parseTimeWindow(path)
 	i.path = path
 	i.speedFactor = 1
-	i.init(path)
+	i.config = config
+
+	if config.startAt != "" {
+		if i.startAt = parseTime(config.startAt); i.startAt.Before(time.Now()) {
+			log.Fatal("[FILE-INPUT] Replay start time is in the past: ", config.startAt)
+		}
+	}
+
+	switch config.workload {
+	case "", workloadOpen:
+	case workloadClosed:
+		if config.concurrency <= 0 {
+			log.Fatal("[FILE-INPUT] Closed workload requires --input-file-concurrency")
+		}
+	default:
+		log.Fatal("[FILE-INPUT] Workload should be 'open' or 'closed': ", config.workload)
+	}
+
+	if config.rate < 0 {
+		log.Fatal("[FILE-INPUT] Rate should be positive: ", config.rate)
+	}
+
+	var err error
+	if i.files, err = filepath.Glob(path); err != nil {
+		log.Fatal(i, "Wrong file pattern %q. Error: %s", path, err)
+	}
+
+	if len(i.files) == 0 {
+		log.Fatal(i, "No files match pattern: ", path)
+	}
+
+	// Rotated files have index or timestamp in name, so sorting by name gives proper order
+	sort.Strings(i.files)
+
+	i.rewind()
 
 	go i.emit()
 
 	return
 }
 
+// parseTimeWindow extracts `from` and `to` options from path, e.g. "requests.gor|from=2024-05-01T10:00,to=2024-05-01T11:00".
+// Returns path without options, and window bounds in nanoseconds.
+func parseTimeWindow(path string) (string, int64, int64) {
+	split := strings.SplitN(path, "|", 2)
+	if len(split) == 1 {
+		return path, 0, 0
+	}
+
+	var from, to int64
+
+	for _, option := range strings.Split(split[1], ",") {
+		kv := strings.SplitN(option, "=", 2)
+		if len(kv) != 2 || (kv[0] != "from" && kv[0] != "to") {
+			log.Fatal("[FILE-INPUT] Unknown option, expected from=<time> or to=<time>: ", option)
+		}
+
+		t := parseTime(kv[1])
+
+		if kv[0] == "from" {
+			from = t.UnixNano()
+		} else {
+			to = t.UnixNano()
+		}
+	}
+
+	if from != 0 && to != 0 && to <= from {
+		log.Fatal("[FILE-INPUT] End of time window should be after its start: ", split[1])
+	}
+
+	return split[0], from, to
+}
+
+// parseTime parses time in one of timeWindowLayouts
+func parseTime(value string) time.Time {
+	for _, layout := range timeWindowLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t
+		}
+	}
+
+	log.Fatal("[FILE-INPUT] Invalid time, should be like 2024-05-01T10:00: ", value)
+
+	return time.Time{}
+}
+
+// rewind starts reading from the first file, or from all files if they merged
+func (i *FileInput) rewind() {
+	if !i.config.merge {
+		i.fileIndex = 0
+		i.init(i.files[0])
+
+		return
+	}
+
+	if m, ok := i.decoder.(*fileMerger); ok {
+		m.Close()
+	}
+
+	m := &fileMerger{next: make([]*RawRequest, len(i.files))}
+
+	for idx, path := range i.files {
+		file, err := os.Open(path)
+		if err != nil {
+			log.Fatal(i, "Cannot open file %q. Error: %s", path, err)
+		}
+
+		decoder, err := newRequestDecoder(file)
+		if err != nil {
+			log.Fatal(i, "Cannot read gzip file %q. Error: %s", path, err)
+		}
+
+		m.files = append(m.files, file)
+		m.decoders = append(m.decoders, decoder)
+		m.next[idx] = m.read(idx)
+	}
+
+	i.decoder = m
+}
+
 func (i *FileInput) init(path string) {
 	file, err := os.Open(path)
 
@@ -35,7 +197,79 @@ func (i *FileInput) init(path string) {
 		log.Fatal(i, "Cannot open file %q. Error: %s", path, err)
 	}
 
-	i.decoder = gob.NewDecoder(file)
+	if i.file != nil {
+		i.file.Close()
+	}
+	i.file = file
+
+	if i.decoder, err = newRequestDecoder(file); err != nil {
+		log.Fatal(i, "Cannot read gzip file %q. Error: %s", path, err)
+	}
+}
+
+// newRequestDecoder returns decoder for requests written by FileOutput, gzip compressed data detected automatically
+func newRequestDecoder(r io.Reader) (*gob.Decoder, error) {
+	reader := bufio.NewReader(r)
+
+	// Detect gzip compressed files by magic number
+	if magic, _ := reader.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gzReader, err := gzip.NewReader(reader)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return gob.NewDecoder(gzReader), nil
+	}
+
+	return gob.NewDecoder(reader), nil
+}
+
+// fileMerger reads requests from multiple files at once, and returns them ordered by recorded time.
+// Each file should be ordered by time, like files written by FileOutput.
+type fileMerger struct {
+	files    []*os.File
+	decoders []*gob.Decoder
+	// Next request of each file, nil if file exhausted
+	next []*RawRequest
+}
+
+func (m *fileMerger) read(idx int) *RawRequest {
+	raw := new(RawRequest)
+
+	if err := m.decoders[idx].Decode(raw); err != nil {
+		m.files[idx].Close()
+		return nil
+	}
+
+	return raw
+}
+
+// Decode returns the earliest of next requests of all files, io.EOF if all files exhausted
+func (m *fileMerger) Decode(e interface{}) error {
+	earliest := -1
+
+	for idx, raw := range m.next {
+		if raw != nil && (earliest == -1 || raw.Timestamp < m.next[earliest].Timestamp) {
+			earliest = idx
+		}
+	}
+
+	if earliest == -1 {
+		return io.EOF
+	}
+
+	*e.(*RawRequest) = *m.next[earliest]
+	m.next[earliest] = m.read(earliest)
+
+	return nil
+}
+
+// Close closes all files
+func (m *fileMerger) Close() {
+	for _, file := range m.files {
+		file.Close()
+	}
 }
 
 func (i *FileInput) Read(data []byte) (int, error) {
@@ -49,18 +283,105 @@ func (i *FileInput) String() string {
 	return "File input: " + i.path
 }
 
+// isBenchmark checks if requests emitted at fixed rate or concurrency, instead of recorded pacing
+func (i *FileInput) isBenchmark() bool {
+	return i.config.rate > 0 || i.config.workload == workloadClosed
+}
+
+// pace blocks until next request can be emitted in benchmark mode. Open workload emits requests at fixed rate,
+// even if target slows down. Closed workload waits until number of requests in flight drops below concurrency.
+func (i *FileInput) pace(next *time.Time) {
+	if i.config.workload == workloadClosed {
+		for pendingPayloads(Plugins.Outputs) >= int64(i.config.concurrency) {
+			time.Sleep(time.Millisecond)
+		}
+
+		// Time spent waiting for target is not made up later
+		if now := time.Now(); next.Before(now) {
+			*next = now
+		}
+	}
+
+	if i.config.rate > 0 {
+		time.Sleep(time.Until(*next))
+		*next = next.Add(time.Duration(float64(time.Second) / i.config.rate))
+	}
+}
+
 func (i *FileInput) emit() {
 	var lastTime int64
 
+	// Scheduled replay: recording time which corresponds to start time
+	start := i.startAt
+	var base int64
+
+	// Benchmark mode: time of next request, loops keep the same rate
+	next := i.startAt
+	if next.IsZero() {
+		next = time.Now()
+	}
+
+	iteration := 1
+	// Requests emitted during current iteration
+	emitted := 0
+
 	for {
 		raw := new(RawRequest)
 		err := i.decoder.Decode(raw)
 
 		if err != nil {
+			// Continue with next file, keeping lastTime so timing between files preserved
+			if !i.config.merge && i.fileIndex < len(i.files)-1 {
+				i.fileIndex++
+				i.init(i.files[i.fileIndex])
+
+				continue
+			}
+
+			// All files exhausted, start from beginning if looping enabled
+			if i.config.loop == -1 || iteration < i.config.loop {
+				// Files without requests, or time window without them, would make loop spin
+				if emitted == 0 {
+					log.Println("[FILE-INPUT] No requests replayed, stop looping:", i.path)
+					return
+				}
+
+				iteration++
+				emitted = 0
+				lastTime = 0
+
+				if !start.IsZero() {
+					start = time.Now()
+					base = 0
+				}
+
+				i.rewind()
+
+				Debug("[FILE-INPUT] Replaying file again, iteration:", iteration)
+				continue
+			}
+
 			return
 		}
 
-		if lastTime != 0 {
+		if (i.from != 0 && raw.Timestamp < i.from) || (i.to != 0 && raw.Timestamp >= i.to) {
+			continue
+		}
+
+		if i.isBenchmark() {
+			i.pace(&next)
+		} else if !start.IsZero() {
+			// Time window start keeps offset of first request within the window
+			if base == 0 {
+				if base = raw.Timestamp; i.from != 0 {
+					base = i.from
+				}
+			}
+
+			// Sleeping until absolute time, delays do not accumulate
+			offset := time.Duration(float64(raw.Timestamp-base) / i.speedFactor)
+			time.Sleep(time.Until(start.Add(offset)))
+		} else if lastTime != 0 {
 			timeDiff := raw.Timestamp - lastTime
 
 			// We can speedup or slowdown execution based on speedFactor
@@ -72,6 +393,7 @@ func (i *FileInput) emit() {
 		}
 
 		lastTime = raw.Timestamp
+		emitted++
 
 		i.data <- raw.Request
 	}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"sort"
+	"time"
+)
+
+// HARInput replays requests from HTTP Archive file, e.g. recorded in browser devtools, preserving time differences between them.
+// Recorded responses emitted as original responses, so they can be compared with replayed ones.
+type HARInput struct {
+	data        chan []byte
+	path        string
+	entries     []*HAREntry
+	speedFactor float64
+}
+
+// NewHARInput constructor for HARInput, accepts path of HAR file
+func NewHARInput(path string) (i *HARInput) {
+	i = new(HARInput)
+	i.data = make(chan []byte)
+	i.path = path
+	i.speedFactor = 1
+
+	file, err := os.Open(path)
+	if err != nil {
+		log.Fatal("[HAR] Can't open file: ", err)
+	}
+	defer file.Close()
+
+	var har HAR
+	if err = json.NewDecoder(file).Decode(&har); err != nil {
+		log.Fatal("[HAR] Can't parse file: ", err)
+	}
+
+	// Browsers write entries in order of completion, replay them in order of start
+	i.entries = har.Log.Entries
+	sort.SliceStable(i.entries, func(a, b int) bool {
+		return i.entries[a].StartedDateTime.Before(i.entries[b].StartedDateTime)
+	})
+
+	go i.emit()
+
+	return
+}
+
+func (i *HARInput) Read(data []byte) (int, error) {
+	buf := <-i.data
+	copy(data, buf)
+
+	return len(buf), nil
+}
+
+func (i *HARInput) String() string {
+	return "HAR input: " + i.path
+}
+
+func (i *HARInput) emit() {
+	var lastTime int64
+
+	for _, entry := range i.entries {
+		request, err := entry.RawRequest()
+		if err != nil {
+			log.Println("[HAR] Skipping entry with invalid URL:", entry.Request.URL)
+			continue
+		}
+
+		timestamp := entry.StartedDateTime.UnixNano()
+
+		if lastTime != 0 && timestamp > lastTime {
+			time.Sleep(time.Duration(float64(timestamp-lastTime) / i.speedFactor))
+		}
+
+		lastTime = timestamp
+
+		id := uuid()
+		i.data <- append(payloadHeader(RequestPayload, id, timestamp), request...)
+
+		if response := entry.RawResponse(); response != nil {
+			responseTime := timestamp + int64(entry.Time*float64(time.Millisecond))
+			i.data <- append(payloadHeader(ResponsePayload, id, responseTime), response...)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestHARInput(t *testing.T) {
+	path := "/tmp/gor_test_input.har"
+	defer os.Remove(path)
+
+	// Entries recorded by browser: HTTP/2 pseudo headers, decoded bodies and entries in order of completion
+	ioutil.WriteFile(path, []byte(`{"log": {"version": "1.2", "entries": [
+		{"startedDateTime": "2016-01-01T00:00:00.100Z", "time": 5,
+		 "request": {"method": "POST", "url": "https://example.com/login?next=%2F", "httpVersion": "h2",
+			"headers": [{"name": ":authority", "value": "example.com"}, {"name": "content-type", "value": "application/x-www-form-urlencoded"}, {"name": "content-length", "value": "100"}],
+			"postData": {"mimeType": "application/x-www-form-urlencoded", "text": "user=1"}},
+		 "response": {"status": 302, "statusText": "Found", "httpVersion": "h2",
+			"headers": [{"name": "location", "value": "/"}, {"name": "content-encoding", "value": "gzip"}],
+			"content": {"size": 2, "mimeType": "text/plain", "text": "ok"}}},
+		{"startedDateTime": "2016-01-01T00:00:00.000Z", "time": 0,
+		 "request": {"method": "GET", "url": "https://example.com/", "httpVersion": "h2", "headers": []},
+		 "response": {"status": 0, "headers": [], "content": {"size": 0}}}
+	]}}`), 0660)
+
+	input := NewHARInput(path)
+	buf := make([]byte, 1000)
+
+	read := func() []byte {
+		n, _ := input.Read(buf)
+		return append([]byte{}, buf[:n]...)
+	}
+
+	start := time.Now()
+
+	if data := read(); !isRequestPayload(data) || string(payloadBody(data)) != "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n" {
+		t.Error("Should replay entries in order of start:", string(data))
+	}
+
+	login := read()
+	if !isRequestPayload(login) || string(payloadBody(login)) != "POST /login?next=%2F HTTP/1.1\r\ncontent-type: application/x-www-form-urlencoded\r\nHost: example.com\r\nContent-Length: 6\r\n\r\nuser=1" {
+		t.Error("Should convert request to HTTP/1.1:", string(login))
+	}
+
+	if time.Since(start) < 100*time.Millisecond {
+		t.Error("Should preserve time difference between requests")
+	}
+
+	response := read()
+	if response[0] != ResponsePayload || !bytes.Equal(payloadID(response), payloadID(login)) {
+		t.Error("Should emit recorded response with request id:", string(response))
+	}
+
+	if string(payloadBody(response)) != "HTTP/1.1 302 Found\r\nlocation: /\r\nContent-Length: 2\r\n\r\nok" {
+		t.Error("Should convert response to HTTP/1.1:", string(payloadBody(response)))
+	}
+}
+
+func TestHARRoundTrip(t *testing.T) {
+	path := "/tmp/gor_test_roundtrip.har"
+	defer os.Remove(path)
+
+	request := "GET /image.png HTTP/1.1\r\nHost: example.com\r\n\r\n"
+	response := "HTTP/1.1 200 OK\r\nContent-Encoding: gzip\r\nContent-Length: 4\r\n\r\n\x1f\x8b\x00\xff"
+
+	output := NewHAROutput(path)
+	id := uuid()
+	output.Write(append(payloadHeader(RequestPayload, id, 1), request...))
+	output.Write(append(payloadHeader(ResponsePayload, id, 2), response...))
+	output.Close()
+
+	input := NewHARInput(path)
+	buf := make([]byte, 1000)
+
+	if n, _ := input.Read(buf); string(payloadBody(buf[:n])) != request {
+		t.Error("Should replay written request:", string(buf[:n]))
+	}
+
+	if n, _ := input.Read(buf); string(payloadBody(buf[:n])) != response {
+		t.Error("Should replay written binary response:", string(buf[:n]))
+	}
+}
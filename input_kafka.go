@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// Delay before consuming again after consumer error, doubled while errors repeat, e.g. when brokers unavailable
+const (
+	kafkaMinBackoff = 100 * time.Millisecond
+	kafkaMaxBackoff = 30 * time.Second
+)
+
+// KafkaInputConfig holds configuration for Kafka input
+type KafkaInputConfig struct {
+	group string
+	// oldest or newest
+	offset string
+}
+
+// KafkaInput consumes payloads published by KafkaOutput.
+// It joins consumer group, so multiple Gor instances can share the load of one topic.
+type KafkaInput struct {
+	data     chan []byte
+	address  string
+	topic    string
+	consumer sarama.ConsumerGroup
+	config   *KafkaInputConfig
+}
+
+// NewKafkaInput constructor for KafkaInput, accepts address in `broker1:9092,broker2:9092/topic` format
+func NewKafkaInput(address string, config *KafkaInputConfig) (i *KafkaInput) {
+	i = new(KafkaInput)
+	i.data = make(chan []byte)
+	i.address = address
+	i.config = config
+
+	brokers, topic, err := parseKafkaAddress(address)
+	if err != nil {
+		log.Fatal("[KAFKA-INPUT] ", err)
+	}
+	i.topic = topic
+
+	c := sarama.NewConfig()
+	c.ClientID = "gor"
+	c.Consumer.Return.Errors = true
+
+	switch config.offset {
+	case "", "newest":
+		c.Consumer.Offsets.Initial = sarama.OffsetNewest
+	case "oldest":
+		c.Consumer.Offsets.Initial = sarama.OffsetOldest
+	default:
+		log.Fatal("[KAFKA-INPUT] Unknown offset: ", config.offset)
+	}
+
+	group := config.group
+	if group == "" {
+		group = "gor"
+	}
+
+	if i.consumer, err = sarama.NewConsumerGroup(brokers, group, c); err != nil {
+		log.Fatal("[KAFKA-INPUT] Can't connect to Kafka: ", err)
+	}
+
+	go i.handleErrors()
+	go i.consume()
+
+	return
+}
+
+func (i *KafkaInput) Read(data []byte) (int, error) {
+	buf := <-i.data
+	copy(data, buf)
+
+	return len(buf), nil
+}
+
+func (i *KafkaInput) consume() {
+	var delay time.Duration
+
+	// Consume returns on each group rebalance, so it should be called in loop
+	for {
+		err := i.consumer.Consume(context.Background(), []string{i.topic}, i)
+
+		switch err {
+		case nil:
+			delay = 0
+		case sarama.ErrClosedConsumerGroup:
+			return
+		default:
+			delay = kafkaBackoff(delay)
+			log.Println("[KAFKA-INPUT] Consumer error:", err, "retrying in", delay)
+			time.Sleep(delay)
+		}
+	}
+}
+
+// kafkaBackoff returns delay after consumer error, given delay after previous one
+func kafkaBackoff(delay time.Duration) time.Duration {
+	if delay *= 2; delay < kafkaMinBackoff {
+		return kafkaMinBackoff
+	}
+
+	if delay > kafkaMaxBackoff {
+		return kafkaMaxBackoff
+	}
+
+	return delay
+}
+
+func (i *KafkaInput) handleErrors() {
+	for err := range i.consumer.Errors() {
+		log.Println("[KAFKA-INPUT] Consumer error:", err)
+	}
+}
+
+// Setup implements sarama.ConsumerGroupHandler
+func (i *KafkaInput) Setup(sarama.ConsumerGroupSession) error { return nil }
+
+// Cleanup implements sarama.ConsumerGroupHandler
+func (i *KafkaInput) Cleanup(sarama.ConsumerGroupSession) error { return nil }
+
+// ConsumeClaim implements sarama.ConsumerGroupHandler, it emits each message of assigned partition
+func (i *KafkaInput) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for msg := range claim.Messages() {
+		i.data <- msg.Value
+		session.MarkMessage(msg, "")
+	}
+
+	return nil
+}
+
+func (i *KafkaInput) String() string {
+	return "Kafka input: " + i.address
+}
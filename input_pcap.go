@@ -0,0 +1,100 @@
+package main
+
+import (
+	"io"
+	"log"
+	"time"
+
+	raw "github.com/buger/gor/raw_socket_listener"
+)
+
+// PcapInputConfig holds configuration for pcap file input
+type PcapInputConfig struct {
+	// Server port, which traffic should be replayed
+	port      int
+	bpfFilter string
+}
+
+// PcapInput replays requests from capture files written by tcpdump or wireshark, preserving time differences between them.
+// Captured responses emitted as original responses, so they can be compared with replayed ones.
+type PcapInput struct {
+	data        chan *payloadBuffer
+	path        string
+	file        *raw.PcapFile
+	speedFactor float64
+}
+
+// NewPcapInput constructor for PcapInput, accepts path of capture file
+func NewPcapInput(path string, config *PcapInputConfig) (i *PcapInput) {
+	i = new(PcapInput)
+	i.data = make(chan *payloadBuffer)
+	i.path = path
+	i.speedFactor = 1
+
+	if config.port == 0 {
+		log.Fatal("[PCAP] Specify server port using --input-pcap-port")
+	}
+
+	var err error
+	if i.file, err = raw.OpenPcapFile(path, config.port, config.bpfFilter); err != nil {
+		log.Fatal("[PCAP] Can't open file: ", err)
+	}
+
+	go i.emit()
+
+	return
+}
+
+func (i *PcapInput) Read(data []byte) (int, error) {
+	p := <-i.data
+	copy(data, p.data)
+
+	n := len(p.data)
+	p.release()
+
+	return n, nil
+}
+
+// ReadPayload hands payload over to emitter without copying
+func (i *PcapInput) ReadPayload() (*payloadBuffer, error) {
+	return <-i.data, nil
+}
+
+func (i *PcapInput) String() string {
+	return "Pcap input: " + i.path
+}
+
+func (i *PcapInput) emit() {
+	defer i.file.Close()
+
+	var lastTime time.Time
+
+	for {
+		m, err := i.file.Next()
+
+		if err == io.EOF {
+			return
+		}
+
+		if err != nil {
+			log.Println("[PCAP] Can't read file:", err)
+			return
+		}
+
+		if !lastTime.IsZero() && m.Start.After(lastTime) {
+			time.Sleep(time.Duration(float64(m.Start.Sub(lastTime)) / i.speedFactor))
+		}
+
+		lastTime = m.Start
+
+		var payloadType byte = ResponsePayload
+		if m.IsIncoming {
+			payloadType = RequestPayload
+		}
+
+		p := capturePayload(m)
+		p.prepend(payloadHeader(payloadType, m.UUID(), m.Start.UnixNano()))
+
+		i.data <- p
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Size of buffer between proxy and emitter. Proxied clients never wait for Gor, payloads dropped when it is full.
+const proxyInputBufferSize = 1000
+
+// Default size limit of recorded response body
+const proxyMaxBodySize = 10 * 1024 * 1024
+
+// Clients which don't send request or keep idle connection longer are disconnected, so they don't hold proxy resources
+const (
+	proxyReadHeaderTimeout = 10 * time.Second
+	proxyIdleTimeout       = 2 * time.Minute
+)
+
+// ProxyInputConfig input-proxy options
+type ProxyInputConfig struct {
+	// URL of real backend, e.g. http://10.0.0.1:8080
+	backend string
+
+	// PEM encoded certificate and key, enable TLS termination
+	tlsCert string
+	tlsKey  string
+
+	trackResponse bool
+	// Recorded response body is truncated to this size, proxied body is not changed
+	maxBodySize int
+}
+
+// ProxyInput is reverse proxy placed in front of real backend, which records proxied requests and responses.
+// It terminates TLS using provided certificate, so HTTPS traffic captured decrypted.
+type ProxyInput struct {
+	// Keep this as first element of struct because it guarantees 64bit alignment, see HTTPOutput
+	dropped int64
+
+	data     chan []byte
+	address  string
+	config   *ProxyInputConfig
+	listener net.Listener
+	proxy    *httputil.ReverseProxy
+}
+
+type proxyRequestKey struct{}
+
+// proxyRequest identifies proxied request, so its response gets same id
+type proxyRequest struct {
+	id    []byte
+	start time.Time
+}
+
+// NewProxyInput constructor for ProxyInput. Accepts address with port which it listens on.
+func NewProxyInput(address string, config *ProxyInputConfig) (i *ProxyInput) {
+	if config.backend == "" {
+		log.Fatal("[PROXY] Backend is not specified, use --input-proxy-backend")
+	}
+
+	backend := config.backend
+	if !strings.HasPrefix(backend, "http") {
+		backend = "http://" + backend
+	}
+
+	u, err := url.Parse(backend)
+	if err != nil {
+		log.Fatal("[PROXY] Invalid backend: ", err)
+	}
+
+	i = &ProxyInput{
+		data:    make(chan []byte, proxyInputBufferSize),
+		address: address,
+		config:  config,
+		proxy:   httputil.NewSingleHostReverseProxy(u),
+	}
+
+	if config.trackResponse {
+		if config.maxBodySize <= 0 {
+			config.maxBodySize = proxyMaxBodySize
+		}
+
+		i.proxy.ModifyResponse = i.recordResponse
+	}
+
+	i.listen(address)
+
+	return
+}
+
+func (i *ProxyInput) Read(data []byte) (int, error) {
+	buf := <-i.data
+	copy(data, buf)
+
+	return len(buf), nil
+}
+
+// Dropped returns number of payloads dropped because emitter could not keep up with proxied traffic
+func (i *ProxyInput) Dropped() int64 {
+	return atomic.LoadInt64(&i.dropped)
+}
+
+func (i *ProxyInput) emit(payload []byte) {
+	select {
+	case i.data <- payload:
+	default:
+		atomic.AddInt64(&i.dropped, 1)
+	}
+}
+
+func (i *ProxyInput) handler(w http.ResponseWriter, r *http.Request) {
+	// DumpRequest reads body, and replaces it with copy, so it still proxied
+	buf, err := httputil.DumpRequest(r, true)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	if i.config.trackResponse {
+		req := &proxyRequest{id: uuid(), start: time.Now()}
+		r = r.WithContext(context.WithValue(r.Context(), proxyRequestKey{}, req))
+
+		ip, _, _ := net.SplitHostPort(r.RemoteAddr)
+		buf = append(payloadHeaderIP(RequestPayload, req.id, req.start.UnixNano(), []byte(ip)), buf...)
+	}
+
+	i.emit(buf)
+
+	i.proxy.ServeHTTP(w, r)
+}
+
+// recordResponse records backend response while its body streamed to client, and emits it with id of
+// its request once body read. Body is not buffered before sending to client.
+func (i *ProxyInput) recordResponse(resp *http.Response) error {
+	req, ok := resp.Request.Context().Value(proxyRequestKey{}).(*proxyRequest)
+	if !ok {
+		return nil
+	}
+
+	// Proxy removes hop-by-hop headers before response passed here, and does not change it later
+	header := *resp
+	header.Header = resp.Header.Clone()
+	header.Header.Del("Content-Length")
+	header.TransferEncoding = nil
+	header.Trailer = nil
+
+	resp.Body = &proxyBody{ReadCloser: resp.Body, limit: i.config.maxBodySize, done: func(body []byte) {
+		// Body recorded decoded and maybe truncated, so it sent with Content-Length of recorded part
+		header.ContentLength = int64(len(body))
+		header.Body = nil
+
+		buf, err := httputil.DumpResponse(&header, false)
+		if err != nil {
+			Debug("[PROXY] Can't record response:", err)
+			return
+		}
+
+		i.emit(append(append(payloadHeader(ResponsePayload, req.id, req.start.UnixNano()), buf...), body...))
+	}}
+
+	return nil
+}
+
+// proxyBody copies body of proxied response while it read, up to size limit
+type proxyBody struct {
+	io.ReadCloser
+
+	buf   []byte
+	limit int
+	done  func(body []byte)
+	once  sync.Once
+}
+
+func (b *proxyBody) Read(data []byte) (int, error) {
+	n, err := b.ReadCloser.Read(data)
+
+	if keep := b.limit - len(b.buf); keep > 0 {
+		if keep > n {
+			keep = n
+		}
+
+		b.buf = append(b.buf, data[:keep]...)
+	}
+
+	if err == io.EOF {
+		b.once.Do(func() { b.done(b.buf) })
+	}
+
+	return n, err
+}
+
+// Close records body read so far, if client gone before response finished
+func (b *proxyBody) Close() error {
+	b.once.Do(func() { b.done(b.buf) })
+
+	return b.ReadCloser.Close()
+}
+
+func (i *ProxyInput) listen(address string) {
+	var err error
+
+	i.listener, err = net.Listen("tcp", address)
+	if err != nil {
+		log.Fatal("[PROXY] Listener failure: ", err)
+	}
+
+	if i.config.tlsCert != "" || i.config.tlsKey != "" {
+		cert, err := tls.LoadX509KeyPair(i.config.tlsCert, i.config.tlsKey)
+		if err != nil {
+			log.Fatal("[PROXY] Can't load TLS certificate: ", err)
+		}
+
+		// HTTP/2 is not negotiated, so recorded requests can be replayed as HTTP/1.1
+		i.listener = tls.NewListener(i.listener, &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			NextProtos:   []string{"http/1.1"},
+		})
+	}
+
+	server := &http.Server{
+		Handler:           http.HandlerFunc(i.handler),
+		ReadHeaderTimeout: proxyReadHeaderTimeout,
+		IdleTimeout:       proxyIdleTimeout,
+	}
+
+	go func() {
+		if err := server.Serve(i.listener); err != nil {
+			log.Fatal("[PROXY] Serve failure: ", err)
+		}
+	}()
+}
+
+func (i *ProxyInput) String() string {
+	return "Proxy input: " + i.address + " -> " + i.config.backend
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestProxyInput(t *testing.T) {
+	wg := new(sync.WaitGroup)
+	quit := make(chan int)
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write(append([]byte("echo:"), body...))
+	}))
+	defer backend.Close()
+
+	// Reuse certificate of test server, it is valid for 127.0.0.1
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Close()
+	certFile, keyFile := writeServerCert(server)
+
+	input := NewProxyInput("127.0.0.1:0", &ProxyInputConfig{backend: backend.URL, tlsCert: certFile, tlsKey: keyFile, trackResponse: true})
+
+	payloads := make(map[string][]string)
+	mu := new(sync.Mutex)
+
+	output := NewTestOutput(func(data []byte) {
+		mu.Lock()
+		id := string(payloadID(data))
+		payloads[id] = append(payloads[id], string(data[0])+" "+string(payloadBody(data)))
+		mu.Unlock()
+
+		wg.Done()
+	})
+
+	Plugins.Inputs = []io.Reader{input}
+	Plugins.Outputs = []io.Writer{output}
+
+	go Start(quit)
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+
+	wg.Add(2)
+	resp, err := client.Post("https://"+input.listener.Addr().String()+"/upload", "text/plain", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if string(body) != "echo:hello" {
+		t.Error("Request should be proxied to backend:", string(body))
+	}
+
+	wg.Wait()
+
+	if len(payloads) != 1 {
+		t.Fatal("Request and response should share id:", payloads)
+	}
+
+	for _, p := range payloads {
+		if !strings.HasPrefix(p[0], "1 POST /upload HTTP/1.1\r\n") || !strings.HasSuffix(p[0], "\r\n\r\nhello") {
+			t.Errorf("Wrong request: %q", p[0])
+		}
+
+		if !strings.HasPrefix(p[1], "2 HTTP/1.1 200 OK\r\n") || !strings.HasSuffix(p[1], "echo:hello") {
+			t.Errorf("Wrong response: %q", p[1])
+		}
+	}
+
+	close(quit)
+}
+
+func TestProxyInputStreamResponse(t *testing.T) {
+	wg := new(sync.WaitGroup)
+	quit := make(chan int)
+
+	chunk := strings.Repeat("a", 1000)
+	firstRead := make(chan bool)
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(chunk))
+		w.(http.Flusher).Flush()
+
+		// Response body is not buffered by proxy, client gets it while backend still sends it
+		<-firstRead
+
+		w.Write([]byte(chunk))
+	}))
+	defer backend.Close()
+
+	input := NewProxyInput("127.0.0.1:0", &ProxyInputConfig{backend: backend.URL, trackResponse: true, maxBodySize: 1500})
+
+	var response []byte
+	output := NewTestOutput(func(data []byte) {
+		if isRequestPayload(data) {
+			return
+		}
+
+		response = append([]byte{}, payloadBody(data)...)
+		wg.Done()
+	})
+
+	Plugins.Inputs = []io.Reader{input}
+	Plugins.Outputs = []io.Writer{output}
+
+	go Start(quit)
+
+	wg.Add(1)
+	resp, err := http.Get("http://" + input.listener.Addr().String() + "/download")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := make([]byte, len(chunk))
+	io.ReadFull(resp.Body, first)
+	close(firstRead)
+
+	rest, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if len(first)+len(rest) != 2*len(chunk) {
+		t.Error("Client should get whole body:", len(first)+len(rest))
+	}
+
+	wg.Wait()
+
+	if !strings.HasPrefix(string(response), "HTTP/1.1 200 OK\r\n") || !strings.Contains(string(response), "\r\nContent-Length: 1500\r\n") ||
+		strings.Contains(string(response), "Transfer-Encoding") || !strings.HasSuffix(string(response), "\r\n\r\n"+strings.Repeat("a", 1500)) {
+		t.Errorf("Recorded body should be truncated: %q", response)
+	}
+
+	close(quit)
+}
@@ -1,55 +1,774 @@
 package main
 
 import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"github.com/buger/gor/proto"
 	raw "github.com/buger/gor/raw_socket_listener"
 	"log"
 	"net"
+	"strconv"
 	"strings"
+	"time"
+)
+
+// RAWInputConfig holds configuration for RAW input capture engine
+type RAWInputConfig struct {
+	engine      string
+	protocol    string
+	snapLength  int
+	promiscuous bool
+	bpfFilter   string
+	iface       string
+	decapsulate bool
+
+	trackResponse bool
+
+	// Record source IP of captured requests in payload meta, so outputs can pass it to replayed server
+	realIP bool
+
+	// Path to SSLKEYLOGFILE of captured service, enables decryption of HTTPS traffic
+	tlsKeyLog string
+
+	// Requests and responses with bigger body dropped or truncated, depending on policy. 0 means unlimited
+	maxBodySize    int
+	bodySizePolicy string
+}
+
+// Policies applied to messages with body bigger than `--input-raw-max-body-size`
+const (
+	bodySizePolicyDrop     = "drop"
+	bodySizePolicyTruncate = "truncate"
+)
+
+// Headers are not limited by max body size, so captured messages can be bigger by this value
+const maxHeadersSize = 64 * 1024
+
+// Protocols captured on top of TCP
+const (
+	// Captured HTTP/2 connections are decoded into HTTP/1.1 requests and responses
+	protocolHTTP2 = "http2"
+	// Any TCP based protocol, payloads emitted as is, with id of client connection
+	protocolRawTCP = "tcp-raw"
 )
 
 // RAWInput used for intercepting traffic for given address
 type RAWInput struct {
-	data    chan []byte
+	data    chan *payloadBuffer
 	address string
+	config  *RAWInputConfig
 }
 
-// NewRAWInput constructor for RAWInput. Accepts address with port as argument.
-func NewRAWInput(address string) (i *RAWInput) {
+// NewRAWInput constructor for RAWInput. Accepts address with port as argument, or comma separated list of ports and port ranges.
+func NewRAWInput(address string, config *RAWInputConfig) (i *RAWInput) {
 	i = new(RAWInput)
-	i.data = make(chan []byte)
+	i.data = make(chan *payloadBuffer)
 	i.address = address
+	i.config = config
+
+	switch i.config.bodySizePolicy {
+	case "":
+		i.config.bodySizePolicy = bodySizePolicyDrop
+	case bodySizePolicyDrop, bodySizePolicyTruncate:
+	default:
+		log.Fatal("input-raw: body size policy should be 'drop' or 'truncate': ", i.config.bodySizePolicy)
+	}
 
 	go i.listen(address)
 
 	return
 }
 
+// splitRAWAddress splits address with list of ports, like ":80,:8080,:3000-3010", into host and ports.
+// All addresses should have the same host, port can be specified without host.
+func splitRAWAddress(address string) (host, ports string, err error) {
+	var list []string
+
+	for n, part := range strings.Split(address, ",") {
+		h, port := "", part
+
+		if strings.Contains(part, ":") {
+			if h, port, err = net.SplitHostPort(part); err != nil {
+				return
+			}
+		}
+
+		if n == 0 {
+			host = h
+		} else if h != "" && h != host {
+			return "", "", fmt.Errorf("all addresses should have the same host: %s", address)
+		}
+
+		list = append(list, port)
+	}
+
+	ports = strings.Join(list, ",")
+	_, err = raw.ParsePorts(ports)
+
+	return
+}
+
 func (i *RAWInput) Read(data []byte) (int, error) {
-	buf := <-i.data
-	copy(data, buf)
+	p := <-i.data
+	copy(data, p.data)
+
+	n := len(p.data)
+	p.release()
 
-	return len(buf), nil
+	return n, nil
 }
 
-func (i *RAWInput) listen(address string) {
-	address = strings.Replace(address, "[::]", "127.0.0.1", -1)
+// ReadPayload hands captured payload over to emitter without copying
+func (i *RAWInput) ReadPayload() (*payloadBuffer, error) {
+	return <-i.data, nil
+}
+
+// capturedHeaderSpace is space reserved before captured message for meta line with 24 characters id
+const capturedHeaderSpace = 48
 
-	host, port, err := net.SplitHostPort(address)
+// capturePayload reads message into pooled buffer, so meta line added and payload emitted without copying message
+func capturePayload(m *raw.TCPMessage) *payloadBuffer {
+	p := newPayloadBuffer(getBuffer(capturedHeaderSpace + m.Size()))
+	p.data = m.AppendBytes(p.buf[capturedHeaderSpace:capturedHeaderSpace])
+
+	return p
+}
+
+func (i *RAWInput) listen(address string) {
+	host, port, err := splitRAWAddress(address)
 
 	if err != nil {
 		log.Fatal("input-raw: error while parsing address", err)
 	}
 
-	listener := raw.NewListener(host, port)
+	listener := raw.NewListener(host, port, i.listenerConfig())
+
+	if i.config.protocol == raw.ProtocolUDP {
+		for {
+			i.data <- newPayloadBuffer(pooledCopy(listener.ReceiveDatagram().Data))
+		}
+	}
+
+	if i.config.protocol == protocolHTTP2 {
+		i.listenHTTP2(listener)
+	}
+
+	if i.config.tlsKeyLog != "" {
+		i.listenTLS(listener)
+	}
 
 	for {
 		// Receiving TCPMessage object
 		m := listener.Receive()
+		p := capturePayload(m)
+
+		// Connection id allows replaying payloads over separate connections, in original order
+		if i.config.protocol == protocolRawTCP {
+			p.prepend(payloadHeader(RequestPayload, m.ConnectionID(), m.Start.UnixNano()))
+			i.data <- p
+			continue
+		}
+
+		messages := splitPipelined(p.data)
+
+		for n, data := range messages {
+			if i.config.maxBodySize > 0 {
+				// Only last message can be cut by capture limit
+				if data = i.limitBodySize(data, m.Truncated && n == len(messages)-1); data == nil {
+					continue
+				}
+			}
+
+			// Pipelined messages share captured buffer, so each of them copied
+			var payload *payloadBuffer
+			if len(messages) > 1 {
+				payload = newPayloadBuffer(pooledCopy(data))
+			} else {
+				p.data = data
+				payload = p.retain()
+			}
+
+			if i.config.trackResponse || (i.config.realIP && m.IsIncoming) {
+				var payloadType byte = ResponsePayload
+				if m.IsIncoming {
+					payloadType = RequestPayload
+				}
+
+				id := m.UUID()
+				if n > 0 {
+					id = pipelinedID(id, n)
+				}
+
+				payload.prepend(i.payloadHeader(payloadType, id, m.Start, m))
+			}
+
+			i.data <- payload
+		}
+
+		p.release()
+	}
+}
+
+// payloadHeader builds meta line of captured message. Requests get IP of client, if `--input-raw-realip` enabled.
+func (i *RAWInput) payloadHeader(payloadType byte, id []byte, start time.Time, m *raw.TCPMessage) []byte {
+	var ip []byte
+	if i.config.realIP && payloadType == RequestPayload {
+		if addr := m.SourceIP(); addr != nil {
+			ip = []byte(addr.String())
+		}
+	}
+
+	return payloadHeaderIP(payloadType, id, start.UnixNano(), ip)
+}
+
+// splitPipelined splits TCP message into HTTP messages. Clients can send multiple requests without waiting
+// for responses, and server responses for them are sent together too.
+func splitPipelined(data []byte) (messages [][]byte) {
+	for {
+		n := proto.MessageLength(data)
 
-		i.data <- m.Bytes()
+		if n <= 0 || n >= len(data) || !isHTTPMessageStart(data[n:]) {
+			return append(messages, data)
+		}
+
+		messages = append(messages, data[:n])
+		data = data[n:]
+	}
+}
+
+// isHTTPMessageStart checks if data starts with HTTP/1.x request or status line
+func isHTTPMessageStart(data []byte) bool {
+	if bytes.HasPrefix(data, []byte("HTTP/1.")) {
+		return true
+	}
+
+	lineEnd := bytes.Index(data, proto.CLRF)
+	if lineEnd == -1 {
+		return false
+	}
+
+	line := data[:lineEnd]
+
+	return bytes.IndexByte(line, ' ') > 0 && (bytes.HasSuffix(line, []byte(" HTTP/1.1")) || bytes.HasSuffix(line, []byte(" HTTP/1.0")))
+}
+
+// pipelinedID returns id of n-th pipelined message. Responses come in order of requests,
+// so request and its response get the same id.
+func pipelinedID(id []byte, n int) []byte {
+	sum := sha1.Sum([]byte(string(id) + ":" + strconv.Itoa(n)))
+	pid := make([]byte, 24)
+	hex.Encode(pid, sum[:12])
+
+	return pid
+}
+
+// limitBodySize drops or truncates message with body bigger than max body size, depending on policy.
+// Truncated body gets updated Content-Length, so replayed server does not wait for the rest of it.
+// Returns nil if message dropped.
+func (i *RAWInput) limitBodySize(data []byte, truncated bool) []byte {
+	bodyStart := proto.MIMEHeadersEndPos(data)
+
+	// Headers bigger than allowed by capture limit
+	if bodyStart == -1 {
+		if truncated {
+			statsd.Incr("input.oversized", 1)
+			return nil
+		}
+
+		return data
+	}
+	bodyStart += len(proto.EmptyLine)
+
+	if !truncated && len(data)-bodyStart <= i.config.maxBodySize {
+		return data
+	}
+
+	statsd.Incr("input.oversized", 1)
+
+	if i.config.bodySizePolicy == bodySizePolicyDrop {
+		Debug("[INPUT-RAW] Dropped message with body bigger than", i.config.maxBodySize, "bytes:", string(data[:bodyStart]))
+		return nil
+	}
+
+	if len(data)-bodyStart > i.config.maxBodySize {
+		data = data[:bodyStart+i.config.maxBodySize]
+	}
+
+	// Chunked body can't be truncated, because Content-Length and Transfer-Encoding should not be used together
+	if len(proto.Header(data, []byte("Transfer-Encoding"))) > 0 {
+		return nil
+	}
+
+	return proto.SetHeader(data, []byte("Content-Length"), []byte(strconv.Itoa(len(data)-bodyStart)))
+}
+
+// Connections without messages during this period are forgotten
+const capturedConnTTL = time.Minute
+
+// Responses acknowledge client data sent recently, sequence numbers of other connections are far away
+const capturedConnWindow = 1 << 24
+
+// capturedConn holds state of captured client connection, used by listeners which decode whole connection
+type capturedConn struct {
+	// Client address and port, empty until first request of connection received
+	key  string
+	port uint16
+	// Sequence number following the last data sent by client
+	clientSeq uint32
+	lastSeen  time.Time
+
+	state interface{}
+}
+
+// capturedConns finds connections of captured messages. Requests identified by client address and port, since
+// clients on different hosts can use the same port. Raw socket does not tell destination address of responses, so
+// response belongs to connection of its client port, which sent data acknowledged by response.
+type capturedConns struct {
+	conns     map[string]*capturedConn
+	ports     map[uint16][]*capturedConn
+	lastClean time.Time
+}
+
+func newCapturedConns() *capturedConns {
+	return &capturedConns{
+		conns:     make(map[string]*capturedConn),
+		ports:     make(map[uint16][]*capturedConn),
+		lastClean: time.Now(),
 	}
 }
 
+// get returns connection of message, or creates new one. Messages can be received out of order, so response
+// of unknown client creates connection, which is assigned to client of request acknowledged by response.
+func (c *capturedConns) get(m *raw.TCPMessage) *capturedConn {
+	port := m.ClientPort()
+
+	if m.IsIncoming {
+		key := m.SourceIP().String() + ":" + strconv.Itoa(int(port))
+		conn := c.conns[key]
+
+		// Response of new connection on reused port can be received before request
+		if conn == nil || seqDistance(conn.clientSeq, m.Seq()) > capturedConnWindow {
+			for _, unknown := range c.ports[port] {
+				if unknown.key == "" && unknown.clientSeq-m.Seq() <= uint32(m.Size()) {
+					c.remove(conn)
+					conn = unknown
+					break
+				}
+			}
+		}
+
+		if conn == nil {
+			conn = &capturedConn{port: port, clientSeq: m.Seq()}
+			c.ports[port] = append(c.ports[port], conn)
+		}
+
+		if conn.key == "" {
+			conn.key = key
+			c.conns[key] = conn
+		}
+
+		if end := m.Seq() + uint32(m.Size()); int32(end-conn.clientSeq) > 0 {
+			conn.clientSeq = end
+		}
+		conn.lastSeen = time.Now()
+
+		return conn
+	}
+
+	var best *capturedConn
+
+	for _, conn := range c.ports[port] {
+		if seqDistance(conn.clientSeq, m.Ack) > capturedConnWindow {
+			continue
+		}
+
+		if best == nil || seqDistance(conn.clientSeq, m.Ack) < seqDistance(best.clientSeq, m.Ack) {
+			best = conn
+		}
+	}
+
+	if best == nil {
+		best = &capturedConn{port: port, clientSeq: m.Ack}
+		c.ports[port] = append(c.ports[port], best)
+	}
+	best.lastSeen = time.Now()
+
+	return best
+}
+
+// remove forgets connection replaced by new one
+func (c *capturedConns) remove(conn *capturedConn) {
+	if conn == nil {
+		return
+	}
+
+	delete(c.conns, conn.key)
+
+	conns := c.ports[conn.port]
+	for i, other := range conns {
+		if other == conn {
+			c.ports[conn.port] = append(conns[:i], conns[i+1:]...)
+			break
+		}
+	}
+}
+
+// seqDistance returns distance between sequence numbers, which wrap around
+func seqDistance(a, b uint32) uint32 {
+	if int32(a-b) < 0 {
+		return b - a
+	}
+
+	return a - b
+}
+
+// cleanup forgets connections which ended or were lost
+func (c *capturedConns) cleanup() {
+	if time.Since(c.lastClean) < capturedConnTTL {
+		return
+	}
+
+	for key, conn := range c.conns {
+		if time.Since(conn.lastSeen) > capturedConnTTL {
+			delete(c.conns, key)
+		}
+	}
+
+	for port, conns := range c.ports {
+		alive := conns[:0]
+		for _, conn := range conns {
+			if time.Since(conn.lastSeen) <= capturedConnTTL {
+				alive = append(alive, conn)
+			}
+		}
+
+		if len(alive) == 0 {
+			delete(c.ports, port)
+		} else {
+			c.ports[port] = alive
+		}
+	}
+
+	c.lastClean = time.Now()
+}
+
+// http2Connection holds decoders of both directions of captured HTTP/2 connection
+type http2Connection struct {
+	requests  *http2Decoder
+	responses *http2Decoder
+
+	// Payload ids of requests waiting for response
+	ids map[uint32][]byte
+}
+
+// listenHTTP2 emits each HTTP/2 stream as separate payload, once stream ended.
+// Streams multiplexed over the same connection are emitted in order of their completion.
+func (i *RAWInput) listenHTTP2(listener *raw.Listener) {
+	conns := newCapturedConns()
+
+	for {
+		m := listener.Receive()
+		data := m.Bytes()
+
+		conns.cleanup()
+
+		captured := conns.get(m)
+		conn, _ := captured.state.(*http2Connection)
+
+		// Client port can be reused by next connection, which starts with preface
+		if conn == nil || (m.IsIncoming && bytes.HasPrefix(data, http2Preface)) {
+			conn = &http2Connection{
+				requests:  newHTTP2Decoder(),
+				responses: newHTTP2Decoder(),
+				ids:       make(map[uint32][]byte),
+			}
+			captured.state = conn
+		}
+
+		if m.IsIncoming {
+			for _, stream := range conn.requests.Write(data, m.Start) {
+				if !i.config.trackResponse && !i.config.realIP {
+					i.data <- newPayloadBuffer(pooledCopy(stream.Request()))
+					continue
+				}
+
+				id := uuid()
+				if i.config.trackResponse {
+					conn.ids[stream.id] = id
+				}
+
+				i.data <- newPayloadBuffer(pooledConcat(i.payloadHeader(RequestPayload, id, stream.start, m), stream.Request()))
+			}
+
+			continue
+		}
+
+		for _, stream := range conn.responses.Write(data, m.Start) {
+			id, ok := conn.ids[stream.id]
+			if !ok {
+				continue
+			}
+
+			delete(conn.ids, stream.id)
+
+			i.data <- newPayloadBuffer(pooledPayload(ResponsePayload, id, stream.start.UnixNano(), stream.Response()))
+		}
+	}
+}
+
+// Captured messages of TLS connection wait for previous ones, connection dropped if there are more of them
+const tlsMaxPendingMessages = 100
+
+// tlsStream holds decrypted data of captured HTTPS connection
+type tlsStream struct {
+	conn *tlsConnection
+
+	// Messages are received out of order, and decrypted only in order of sequence numbers
+	pending   []*raw.TCPMessage
+	clientSeq uint32
+	serverSeq uint32
+	started   bool
+
+	// Payload ids of requests waiting for response, in order of requests
+	ids [][]byte
+
+	requestStart  time.Time
+	responseStart time.Time
+}
+
+// listenTLS decrypts captured HTTPS connections using secrets from key log, and emits HTTP messages found in them
+func (i *RAWInput) listenTLS(listener *raw.Listener) {
+	keyLog := newTLSKeyLog(i.config.tlsKeyLog)
+	conns := newCapturedConns()
+
+	for {
+		m := listener.Receive()
+		data := m.Bytes()
+
+		conns.cleanup()
+
+		conn := conns.get(m)
+		if conn.state == nil {
+			conn.state = &tlsStream{conn: newTLSConnection(keyLog)}
+		}
+		stream := conn.state.(*tlsStream)
+
+		// Client port can be reused by next connection, which starts with ClientHello.
+		// Acknowledgment number of ClientHello is sequence number of first server data.
+		if m.IsIncoming && isTLSClientHello(data) {
+			stream.conn = newTLSConnection(keyLog)
+			stream.ids = nil
+			stream.started = true
+			stream.clientSeq = m.Seq()
+			stream.serverSeq = m.Ack
+		}
+
+		if stream.conn.broken {
+			continue
+		}
+
+		stream.pending = append(stream.pending, m)
+
+		for stream.started && i.processTLSPending(stream) {
+		}
+
+		if len(stream.pending) > tlsMaxPendingMessages {
+			stream.pending = nil
+			stream.conn.fail("connection started before capture, or packets lost")
+		}
+	}
+}
+
+// processTLSPending decrypts next message of connection if it was received, returns false if there is no such message
+func (i *RAWInput) processTLSPending(stream *tlsStream) bool {
+	for n, m := range stream.pending {
+		next, other := &stream.serverSeq, stream.clientSeq
+		if m.IsIncoming {
+			next, other = &stream.clientSeq, stream.serverSeq
+		}
+
+		// Response should not be processed before its request, so data acknowledged by message should be processed first
+		diff := int32(m.Seq() - *next)
+		if diff > 0 || int32(m.Ack-other) > 0 {
+			continue
+		}
+
+		stream.pending = append(stream.pending[:n], stream.pending[n+1:]...)
+
+		// Retransmitted data or previous connection which used the same client port
+		data := m.Bytes()
+		if diff < 0 {
+			continue
+		}
+
+		*next += uint32(len(data))
+		i.processTLSMessage(stream, m, data)
+
+		return true
+	}
+
+	return false
+}
+
+// processTLSMessage decrypts captured data, and emits HTTP messages completed by it
+func (i *RAWInput) processTLSMessage(stream *tlsStream, m *raw.TCPMessage, data []byte) {
+	half, start := &stream.conn.server, &stream.responseStart
+	if m.IsIncoming {
+		half, start = &stream.conn.client, &stream.requestStart
+	}
+
+	// Message starts in first TCP message with its data
+	if len(half.plain) == 0 {
+		*start = m.Start
+	}
+
+	stream.conn.Write(data, m.IsIncoming)
+
+	for _, message := range i.tlsMessages(half) {
+		timestamp := *start
+		*start = m.Start
+
+		if !i.config.trackResponse {
+			if !m.IsIncoming {
+				continue
+			}
+
+			if i.config.realIP {
+				i.data <- newPayloadBuffer(pooledConcat(i.payloadHeader(RequestPayload, uuid(), timestamp, m), message))
+			} else {
+				i.data <- newPayloadBuffer(pooledCopy(message))
+			}
+			continue
+		}
+
+		if m.IsIncoming {
+			id := uuid()
+			stream.ids = append(stream.ids, id)
+
+			i.data <- newPayloadBuffer(pooledConcat(i.payloadHeader(RequestPayload, id, timestamp, m), message))
+			continue
+		}
+
+		// Responses come in order of requests
+		if len(stream.ids) > 0 {
+			i.data <- newPayloadBuffer(pooledPayload(ResponsePayload, stream.ids[0], timestamp.UnixNano(), message))
+			stream.ids = stream.ids[1:]
+		}
+	}
+}
+
+// tlsMessages cuts complete HTTP messages from decrypted data of one side of connection
+func (i *RAWInput) tlsMessages(half *tlsHalf) (messages [][]byte) {
+	for len(half.plain) > 0 {
+		// Data which is not HTTP can't be framed, so it is skipped
+		if !isHTTPMessageStart(half.plain) {
+			half.plain = nil
+			return
+		}
+
+		n := proto.MessageLength(half.plain)
+		if n <= 0 || n > len(half.plain) {
+			return
+		}
+
+		data := half.plain[:n:n]
+		half.plain = half.plain[n:]
+
+		if i.config.maxBodySize > 0 {
+			if data = i.limitBodySize(data, false); data == nil {
+				continue
+			}
+		}
+
+		messages = append(messages, data)
+	}
+
+	return
+}
+
+func (i *RAWInput) listenerConfig() *raw.ListenerConfig {
+	config := &raw.ListenerConfig{
+		SnapLength:  i.config.snapLength,
+		Promiscuous: i.config.promiscuous,
+		BPFFilter:   i.config.bpfFilter,
+		Interface:   i.config.iface,
+		Decapsulate: i.config.decapsulate,
+
+		TrackResponse: i.config.trackResponse,
+	}
+
+	switch i.config.protocol {
+	case "", raw.ProtocolTCP:
+		config.Protocol = raw.ProtocolTCP
+
+		if i.config.maxBodySize > 0 {
+			config.MaxMessageSize = i.config.maxBodySize + maxHeadersSize
+		}
+	case protocolHTTP2:
+		config.Protocol = raw.ProtocolTCP
+	case protocolRawTCP:
+		config.Protocol = raw.ProtocolTCP
+		config.RawPayloads = true
+
+		// Payload ids identify connections, not requests
+		if config.TrackResponse {
+			log.Fatal("input-raw: response tracking is not supported for tcp-raw protocol")
+		}
+	case raw.ProtocolUDP:
+		config.Protocol = raw.ProtocolUDP
+
+		// Datagrams have no ids, so responses can't be matched with requests
+		if config.TrackResponse {
+			log.Fatal("input-raw: response tracking is not supported for UDP")
+		}
+	default:
+		log.Fatal("input-raw: unknown protocol:", i.config.protocol)
+	}
+
+	switch i.config.engine {
+	case "", "raw_socket":
+		config.Engine = raw.EngineRawSocket
+	case "libpcap", "pcap":
+		config.Engine = raw.EnginePcap
+	case "af_packet":
+		config.Engine = raw.EngineAFPacket
+	case "pf_ring":
+		config.Engine = raw.EnginePFRing
+	default:
+		log.Fatal("input-raw: unknown capture engine:", i.config.engine)
+	}
+
+	if config.BPFFilter != "" && config.Engine == raw.EngineRawSocket {
+		log.Fatal("input-raw: BPF filters supported only by `libpcap`, `af_packet` and `pf_ring` engines")
+	}
+
+	// RAW sockets receive packets of captured protocol only, VLAN tags already removed by kernel
+	if config.Decapsulate && config.Engine != raw.EnginePcap && config.Engine != raw.EngineAFPacket {
+		log.Fatal("input-raw: decapsulation of tunneled packets supported only by `libpcap` and `af_packet` engines")
+	}
+
+	// Encrypted records can't be decrypted if TCP messages are split or merged by HTTP specific processing
+	if i.config.tlsKeyLog != "" {
+		if i.config.protocol != "" && i.config.protocol != raw.ProtocolTCP {
+			log.Fatal("input-raw: TLS decryption is supported only for HTTP protocol")
+		}
+
+		config.RawPayloads = true
+		// Each side of connection is needed to decrypt another one
+		config.TrackResponse = true
+		config.MaxMessageSize = 0
+	}
+
+	// Only HTTP outputs use recorded IP, and payload ids of other protocols mean connections
+	if i.config.realIP && (i.config.protocol == protocolRawTCP || config.Protocol == raw.ProtocolUDP) {
+		log.Fatal("input-raw: real IP is supported only for HTTP protocols")
+	}
+
+	return config
+}
+
 func (i *RAWInput) String() string {
 	return "RAW Socket input: " + i.address
 }
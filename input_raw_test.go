@@ -1,10 +1,14 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"github.com/buger/gor/proto"
+	raw "github.com/buger/gor/raw_socket_listener"
 	"io"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/http/httputil"
@@ -22,7 +26,7 @@ func TestRAWInput(t *testing.T) {
 
 	listener := startHTTP(func(req *http.Request) {})
 
-	input := NewRAWInput(listener.Addr().String())
+	input := NewRAWInput(listener.Addr().String(), &RAWInputConfig{})
 	output := NewTestOutput(func(data []byte) {
 		wg.Done()
 	})
@@ -48,6 +52,102 @@ func TestRAWInput(t *testing.T) {
 	close(quit)
 }
 
+func TestRAWInputDebug(t *testing.T) {
+	wg := new(sync.WaitGroup)
+	quit := make(chan int)
+
+	Settings.debug = true
+	defer func() { Settings.debug = false }()
+
+	listener := startHTTP(func(req *http.Request) {})
+
+	input := NewRAWInput(listener.Addr().String(), &RAWInputConfig{})
+	output := NewTestOutput(func(data []byte) {
+		wg.Done()
+	})
+
+	Plugins.Inputs = []io.Reader{input}
+	Plugins.Outputs = []io.Writer{output}
+
+	address := strings.Replace(listener.Addr().String(), "[::]", "127.0.0.1", -1)
+
+	client := NewHTTPClient(address, &HTTPClientConfig{})
+
+	time.Sleep(time.Millisecond)
+
+	go Start(quit)
+
+	// Captured payloads shorter than 500 bytes logged as is
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		client.Get("/")
+	}
+
+	wg.Wait()
+
+	close(quit)
+}
+
+func TestRAWInputTrackResponse(t *testing.T) {
+	wg := new(sync.WaitGroup)
+	quit := make(chan int)
+
+	listener := startHTTP(func(req *http.Request) {})
+
+	input := NewRAWInput(listener.Addr().String(), &RAWInputConfig{trackResponse: true})
+
+	var respCounter, reqCounter int64
+	ids := make(map[string]int)
+	mu := new(sync.Mutex)
+
+	output := NewTestOutput(func(data []byte) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if data[0] == RequestPayload {
+			reqCounter++
+		} else if data[0] == ResponsePayload {
+			respCounter++
+		} else {
+			t.Error("Payload should be typed:", string(data))
+		}
+
+		ids[string(payloadID(data))]++
+
+		wg.Done()
+	})
+
+	Plugins.Inputs = []io.Reader{input}
+	Plugins.Outputs = []io.Writer{output}
+
+	address := strings.Replace(listener.Addr().String(), "[::]", "127.0.0.1", -1)
+
+	client := NewHTTPClient(address, &HTTPClientConfig{})
+
+	time.Sleep(time.Millisecond)
+
+	go Start(quit)
+
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		client.Get("/")
+	}
+
+	wg.Wait()
+
+	if reqCounter != respCounter {
+		t.Error("Should receive response for each request:", reqCounter, respCounter)
+	}
+
+	for id, count := range ids {
+		if count != 2 {
+			t.Error("Request and response should share id:", id, count)
+		}
+	}
+
+	close(quit)
+}
+
 func TestInputRAW100Expect(t *testing.T) {
 	wg := new(sync.WaitGroup)
 	quit := make(chan int)
@@ -64,7 +164,7 @@ func TestInputRAW100Expect(t *testing.T) {
 
 	originAddr := strings.Replace(origin.Addr().String(), "[::]", "127.0.0.1", -1)
 
-	input := NewRAWInput(originAddr)
+	input := NewRAWInput(originAddr, &RAWInputConfig{})
 
 	// We will use it to get content of raw HTTP request
 	testOutput := NewTestOutput(func(data []byte) {
@@ -121,7 +221,7 @@ func TestInputRAWChunkedEncoding(t *testing.T) {
 
 	originAddr := strings.Replace(origin.Addr().String(), "[::]", "127.0.0.1", -1)
 
-	input := NewRAWInput(originAddr)
+	input := NewRAWInput(originAddr, &RAWInputConfig{})
 
 	listener := startHTTP(func(req *http.Request) {
 		defer req.Body.Close()
@@ -180,7 +280,7 @@ func TestInputRAWLargePayload(t *testing.T) {
 	})
 	originAddr := strings.Replace(origin.Addr().String(), "[::]", "127.0.0.1", -1)
 
-	input := NewRAWInput(originAddr)
+	input := NewRAWInput(originAddr, &RAWInputConfig{})
 
 	replay := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 		req.Body = http.MaxBytesReader(w, req.Body, 1*1024*1024)
@@ -213,3 +313,261 @@ func TestInputRAWLargePayload(t *testing.T) {
 	wg.Wait()
 	close(quit)
 }
+
+func TestRAWInputLimitBodySize(t *testing.T) {
+	i := &RAWInput{config: &RAWInputConfig{maxBodySize: 3, bodySizePolicy: bodySizePolicyTruncate}}
+
+	small := []byte("POST / HTTP/1.1\r\nContent-Length: 3\r\n\r\nabc")
+	if data := i.limitBodySize(small, false); string(data) != string(small) {
+		t.Error("Should pass small body as is:", string(data))
+	}
+
+	if data := i.limitBodySize([]byte("POST / HTTP/1.1\r\nContent-Length: 6\r\n\r\nabcdef"), false); string(data) != "POST / HTTP/1.1\r\nContent-Length: 3\r\n\r\nabc" {
+		t.Error("Should truncate body:", string(data))
+	}
+
+	if data := i.limitBodySize([]byte("POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n6\r\nabcdef\r\n0\r\n\r\n"), false); data != nil {
+		t.Error("Should drop chunked body:", string(data))
+	}
+
+	if data := i.limitBodySize([]byte("POST / HTTP/1.1\r\nCookie: very long"), true); data != nil {
+		t.Error("Should drop message with incomplete headers:", string(data))
+	}
+
+	i.config.bodySizePolicy = bodySizePolicyDrop
+	if data := i.limitBodySize([]byte("POST / HTTP/1.1\r\nContent-Length: 6\r\n\r\nabc"), true); data != nil {
+		t.Error("Should drop truncated message:", string(data))
+	}
+}
+
+func TestRAWInputRealIP(t *testing.T) {
+	wg := new(sync.WaitGroup)
+	quit := make(chan int)
+
+	listener := startHTTP(func(req *http.Request) {})
+
+	input := NewRAWInput(listener.Addr().String(), &RAWInputConfig{realIP: true})
+	output := NewTestOutput(func(data []byte) {
+		if ip := string(payloadIP(data)); ip != "127.0.0.1" {
+			t.Error("Should record client IP in meta:", string(data))
+		}
+
+		if !bytes.Equal(proto.Header(payloadBody(data), []byte("X-Forwarded-For")), nil) {
+			t.Error("Should not modify captured request:", string(data))
+		}
+
+		wg.Done()
+	})
+
+	Plugins.Inputs = []io.Reader{input}
+	Plugins.Outputs = []io.Writer{output}
+
+	address := strings.Replace(listener.Addr().String(), "[::]", "127.0.0.1", -1)
+
+	client := NewHTTPClient(address, &HTTPClientConfig{})
+
+	time.Sleep(time.Millisecond)
+
+	go Start(quit)
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		client.Get("/")
+	}
+
+	wg.Wait()
+
+	close(quit)
+}
+
+func TestSplitPipelined(t *testing.T) {
+	data := "GET /a HTTP/1.1\r\n\r\nPOST /b HTTP/1.1\r\nContent-Length: 3\r\n\r\nabcGET /c HTTP/1.1\r\n\r\n"
+	messages := splitPipelined([]byte(data))
+
+	if len(messages) != 3 || string(messages[1]) != "POST /b HTTP/1.1\r\nContent-Length: 3\r\n\r\nabc" || string(messages[2]) != "GET /c HTTP/1.1\r\n\r\n" {
+		t.Errorf("Should split pipelined requests: %q", messages)
+	}
+
+	// Body longer than Content-Length is not a pipelined request
+	data = "POST /b HTTP/1.1\r\nContent-Length: 3\r\n\r\nabcdef"
+	if messages = splitPipelined([]byte(data)); len(messages) != 1 || string(messages[0]) != data {
+		t.Errorf("Should not split: %q", messages)
+	}
+
+	data = "HTTP/1.1 200 OK\r\nContent-Length: 1\r\n\r\naHTTP/1.1 404 Not Found\r\nContent-Length: 0\r\n\r\n"
+	if messages = splitPipelined([]byte(data)); len(messages) != 2 {
+		t.Errorf("Should split pipelined responses: %q", messages)
+	}
+}
+
+func TestCapturedConns(t *testing.T) {
+	message := func(incoming bool, ip string, port uint16, seq, ack uint32) *raw.TCPMessage {
+		m := &raw.TCPMessage{Ack: ack, IsIncoming: incoming}
+		packet := &raw.TCPPacket{Seq: seq, Ack: ack, Data: []byte("0123456789"), Addr: &net.IPAddr{IP: net.ParseIP(ip)}}
+
+		if incoming {
+			packet.SrcPort = port
+		} else {
+			packet.DestPort = port
+		}
+		m.AddPacket(packet)
+
+		return m
+	}
+
+	conns := newCapturedConns()
+
+	// Clients on different hosts use the same port
+	a := conns.get(message(true, "10.0.0.1", 5000, 1000, 1))
+	b := conns.get(message(true, "10.0.0.2", 5000, 100000000, 1))
+
+	if a == b || conns.get(message(true, "10.0.0.1", 5000, 1010, 1)) != a {
+		t.Error("Requests should belong to connection of client address and port")
+	}
+
+	if conns.get(message(false, "10.0.0.10", 5000, 1, 1020)) != a || conns.get(message(false, "10.0.0.10", 5000, 1, 100000010)) != b {
+		t.Error("Responses should belong to connection of acknowledged request")
+	}
+
+	// Response received before request
+	c := conns.get(message(false, "10.0.0.10", 6000, 1, 510))
+	if conns.get(message(true, "10.0.0.3", 6000, 500, 1)) != c || conns.conns["10.0.0.3:6000"] != c {
+		t.Error("Request should take connection of its response")
+	}
+
+	for _, conn := range []*capturedConn{a, b} {
+		conn.lastSeen = time.Now().Add(-2 * capturedConnTTL)
+	}
+	conns.lastClean = time.Now().Add(-2 * capturedConnTTL)
+	conns.cleanup()
+
+	if len(conns.conns) != 1 || len(conns.ports) != 1 || conns.ports[6000][0] != c {
+		t.Error("Idle connections should be forgotten:", conns.conns, conns.ports)
+	}
+}
+
+func TestRAWInputPipelining(t *testing.T) {
+	wg := new(sync.WaitGroup)
+	quit := make(chan int)
+
+	listener := startHTTP(func(req *http.Request) {})
+
+	input := NewRAWInput(listener.Addr().String(), &RAWInputConfig{trackResponse: true})
+
+	paths := make(map[string]string)
+	ids := make(map[string]int)
+	mu := new(sync.Mutex)
+
+	output := NewTestOutput(func(data []byte) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		id := string(payloadID(data))
+		ids[id]++
+
+		if data[0] == RequestPayload {
+			paths[id] = string(proto.Path(payloadBody(data)))
+		}
+
+		wg.Done()
+	})
+
+	Plugins.Inputs = []io.Reader{input}
+	Plugins.Outputs = []io.Writer{output}
+
+	address := strings.Replace(listener.Addr().String(), "[::]", "127.0.0.1", -1)
+
+	time.Sleep(time.Millisecond)
+
+	go Start(quit)
+
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	wg.Add(4)
+	// Both requests sent in one packet, before reading responses
+	conn.Write([]byte("GET /a HTTP/1.1\r\nHost: a\r\n\r\nGET /b HTTP/1.1\r\nHost: a\r\n\r\n"))
+
+	reader := bufio.NewReader(conn)
+	for n := 0; n < 2; n++ {
+		resp, err := http.ReadResponse(reader, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	wg.Wait()
+
+	if len(paths) != 2 || len(ids) != 2 {
+		t.Error("Should emit each pipelined request separately:", paths)
+	}
+
+	for id, count := range ids {
+		if count != 2 {
+			t.Error("Request and response should share id:", paths[id], count)
+		}
+	}
+
+	close(quit)
+}
+
+func TestSplitRAWAddress(t *testing.T) {
+	cases := []struct {
+		address, host, ports string
+		valid                bool
+	}{
+		{":80", "", "80", true},
+		{"127.0.0.1:80", "127.0.0.1", "80", true},
+		{":80,:8080,:3000-3010", "", "80,8080,3000-3010", true},
+		{"127.0.0.1:80,8080", "127.0.0.1", "80,8080", true},
+		{"127.0.0.1:80,10.0.0.1:8080", "", "", false},
+		{":80,:abc", "", "", false},
+	}
+
+	for _, c := range cases {
+		host, ports, err := splitRAWAddress(c.address)
+
+		if (err == nil) != c.valid || (c.valid && (host != c.host || ports != c.ports)) {
+			t.Error("Wrong split:", c.address, host, ports, err)
+		}
+	}
+}
+
+func TestRAWInputIPv6(t *testing.T) {
+	wg := new(sync.WaitGroup)
+	quit := make(chan int)
+
+	listener, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skip("IPv6 is not available:", err)
+	}
+	go http.Serve(listener, http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer listener.Close()
+
+	input := NewRAWInput(listener.Addr().String(), &RAWInputConfig{})
+	output := NewTestOutput(func(data []byte) {
+		wg.Done()
+	})
+
+	Plugins.Inputs = []io.Reader{input}
+	Plugins.Outputs = []io.Writer{output}
+
+	client := NewHTTPClient(listener.Addr().String(), &HTTPClientConfig{})
+
+	time.Sleep(time.Millisecond)
+
+	go Start(quit)
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		client.Get("/")
+	}
+
+	wg.Wait()
+
+	close(quit)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"log"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// S3InputConfig holds configuration for S3 input
+type S3InputConfig struct {
+	region string
+	// Glob pattern matched against object name, e.g. *.gor.gz
+	pattern string
+}
+
+// s3Client is part of S3 API used by input, replaced by fake one in tests
+type s3Client interface {
+	ListObjectsPages(input *s3.ListObjectsInput, fn func(*s3.ListObjectsOutput, bool) bool) error
+	GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error)
+}
+
+// S3Input replays requests from objects uploaded by S3Output (or any files recorded by FileOutput).
+// Address should look like: s3://bucket/path/prefix
+// Objects streamed one after another sorted by key, without downloading them to disk.
+type S3Input struct {
+	data    chan []byte
+	address string
+	bucket  string
+	prefix  string
+
+	client s3Client
+	config *S3InputConfig
+}
+
+// NewS3Input constructor for S3Input, accepts s3 address
+func NewS3Input(address string, config *S3InputConfig) *S3Input {
+	sess, err := awsSession(config.region)
+	if err != nil {
+		log.Fatal("[S3-INPUT] Can't create AWS session: ", err)
+	}
+
+	return newS3Input(address, config, s3.New(sess))
+}
+
+// newS3Input starts replaying objects using given client
+func newS3Input(address string, config *S3InputConfig, client s3Client) (i *S3Input) {
+	var err error
+
+	i = new(S3Input)
+	i.data = make(chan []byte)
+	i.address = address
+	i.config = config
+	i.client = client
+
+	if i.bucket, i.prefix, err = parseS3Url(address); err != nil {
+		log.Fatal("[S3-INPUT] ", err)
+	}
+
+	go i.emit()
+
+	return
+}
+
+func (i *S3Input) Read(data []byte) (int, error) {
+	buf := <-i.data
+	copy(data, buf)
+
+	return len(buf), nil
+}
+
+// keys returns sorted list of objects matching prefix and pattern
+func (i *S3Input) keys() (keys []string, err error) {
+	err = i.client.ListObjectsPages(&s3.ListObjectsInput{
+		Bucket: aws.String(i.bucket),
+		Prefix: aws.String(i.prefix),
+	}, func(page *s3.ListObjectsOutput, lastPage bool) bool {
+		for _, obj := range page.Contents {
+			key := aws.StringValue(obj.Key)
+
+			if i.config.pattern != "" {
+				if matched, _ := path.Match(i.config.pattern, path.Base(key)); !matched {
+					continue
+				}
+			}
+
+			keys = append(keys, key)
+		}
+
+		return true
+	})
+
+	// Chunks have index and start time in name, so sorting by key gives proper order
+	sort.Strings(keys)
+
+	return
+}
+
+func (i *S3Input) emit() {
+	keys, err := i.keys()
+
+	if err != nil {
+		log.Fatal("[S3-INPUT] Can't list objects: ", err)
+	}
+
+	if len(keys) == 0 {
+		log.Println("[S3-INPUT] No objects match:", i.address, i.config.pattern)
+		return
+	}
+
+	var lastTime int64
+
+	for _, key := range keys {
+		Debug("[S3-INPUT] Replaying object:", key)
+
+		obj, err := i.client.GetObject(&s3.GetObjectInput{
+			Bucket: aws.String(i.bucket),
+			Key:    aws.String(key),
+		})
+
+		if err != nil {
+			log.Println("[S3-INPUT] Can't get object:", key, err)
+			continue
+		}
+
+		decoder, err := newRequestDecoder(obj.Body)
+		if err != nil {
+			log.Println("[S3-INPUT] Can't read object:", key, err)
+			obj.Body.Close()
+			continue
+		}
+
+		for {
+			raw := new(RawRequest)
+
+			if err := decoder.Decode(raw); err != nil {
+				break
+			}
+
+			// Preserve original time differences between requests, including across objects
+			if lastTime != 0 {
+				time.Sleep(time.Duration(raw.Timestamp - lastTime))
+			}
+			lastTime = raw.Timestamp
+
+			i.data <- raw.Request
+		}
+
+		obj.Body.Close()
+	}
+}
+
+func (i *S3Input) String() string {
+	return "S3 input: " + i.address
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/gob"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// fakeS3 keeps objects in memory, and lists them one object per page in given order
+type fakeS3 struct {
+	keys    []string
+	objects map[string][]byte
+}
+
+func (c *fakeS3) ListObjectsPages(input *s3.ListObjectsInput, fn func(*s3.ListObjectsOutput, bool) bool) error {
+	for n, key := range c.keys {
+		if !strings.HasPrefix(key, aws.StringValue(input.Prefix)) {
+			continue
+		}
+
+		page := &s3.ListObjectsOutput{Contents: []*s3.Object{{Key: aws.String(key)}}}
+		if !fn(page, n == len(c.keys)-1) {
+			break
+		}
+	}
+
+	return nil
+}
+
+func (c *fakeS3) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	data, ok := c.objects[aws.StringValue(input.Key)]
+	if !ok {
+		return nil, errors.New("NoSuchKey")
+	}
+
+	return &s3.GetObjectOutput{Body: ioutil.NopCloser(bytes.NewReader(data))}, nil
+}
+
+// recordedObject encodes requests same way as FileOutput does
+func recordedObject(compress bool, requests ...string) []byte {
+	var buf bytes.Buffer
+	var w io.Writer = &buf
+
+	gz := gzip.NewWriter(&buf)
+	if compress {
+		w = gz
+	}
+
+	encoder := gob.NewEncoder(w)
+	for _, r := range requests {
+		encoder.Encode(RawRequest{1, []byte(r)})
+	}
+
+	if compress {
+		gz.Close()
+	}
+
+	return buf.Bytes()
+}
+
+func TestS3Input(t *testing.T) {
+	client := &fakeS3{
+		keys: []string{"path/requests_0002.gor.gz", "path/requests_0001.gor", "path/requests.log", "other/requests_0001.gor"},
+		objects: map[string][]byte{
+			"path/requests_0001.gor":    recordedObject(false, "GET /1 HTTP/1.1\r\n\r\n", "GET /2 HTTP/1.1\r\n\r\n"),
+			"path/requests_0002.gor.gz": recordedObject(true, "GET /3 HTTP/1.1\r\n\r\n"),
+			"path/requests.log":         []byte("not recorded by gor"),
+			"other/requests_0001.gor":   recordedObject(false, "GET /other HTTP/1.1\r\n\r\n"),
+		},
+	}
+
+	input := newS3Input("s3://bucket/path/", &S3InputConfig{pattern: "*.gor*"}, client)
+
+	read := make(chan string)
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, _ := input.Read(buf)
+			read <- string(buf[:n])
+		}
+	}()
+
+	// Objects replayed sorted by key, compressed ones detected by content
+	for _, expected := range []string{"GET /1 HTTP/1.1\r\n\r\n", "GET /2 HTTP/1.1\r\n\r\n", "GET /3 HTTP/1.1\r\n\r\n"} {
+		select {
+		case r := <-read:
+			if r != expected {
+				t.Errorf("Expected %q, got %q", expected, r)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Should replay request:", expected)
+		}
+	}
+
+	select {
+	case r := <-read:
+		t.Errorf("Should skip objects not matching prefix and pattern: %q", r)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestS3InputKeys(t *testing.T) {
+	client := &fakeS3{keys: []string{"requests_0003.gor", "requests_0001.gor", "archive/requests_0002.gor", "requests.txt"}}
+	input := &S3Input{client: client, bucket: "bucket", config: &S3InputConfig{pattern: "requests_*.gor"}}
+
+	keys, err := input.keys()
+	if err != nil || strings.Join(keys, ",") != "archive/requests_0002.gor,requests_0001.gor,requests_0003.gor" {
+		t.Error("Should list matching objects of all pages sorted by key:", keys, err)
+	}
+}
+
+func TestNewRequestDecoder(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		decoder, err := newRequestDecoder(bytes.NewReader(recordedObject(compress, "GET / HTTP/1.1\r\n\r\n")))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		raw := new(RawRequest)
+		if err := decoder.Decode(raw); err != nil || string(raw.Request) != "GET / HTTP/1.1\r\n\r\n" {
+			t.Error("Should decode request, compressed:", compress, err)
+		}
+	}
+
+	if _, err := newRequestDecoder(bytes.NewReader([]byte{0x1f, 0x8b, 0})); err == nil {
+		t.Error("Should fail on broken gzip header")
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Formats of stdin input
+const (
+	stdinFormatGor  = "gor"
+	stdinFormatJSON = "json"
+)
+
+// StdinInputConfig input-stdin options
+type StdinInputConfig struct {
+	format string
+}
+
+// StdinInput reads payloads from standard input, so requests can be generated or filtered by other tools and piped into Gor.
+// Supports files written by FileOutput (optionally gzip compressed), and JSON lines in format of stdout output.
+// Time differences between payloads are preserved, same as with file input.
+type StdinInput struct {
+	data   chan []byte
+	config *StdinInputConfig
+	reader io.Reader
+}
+
+// NewStdinInput constructor for StdinInput
+func NewStdinInput(options string, config *StdinInputConfig) (i *StdinInput) {
+	if config.format != stdinFormatGor && config.format != stdinFormatJSON {
+		log.Fatal("Unknown stdin format: ", config.format)
+	}
+
+	i = &StdinInput{data: make(chan []byte), config: config, reader: os.Stdin}
+
+	go i.emit()
+
+	return
+}
+
+func (i *StdinInput) Read(data []byte) (int, error) {
+	buf := <-i.data
+	copy(data, buf)
+
+	return len(buf), nil
+}
+
+func (i *StdinInput) String() string {
+	return "Stdin input"
+}
+
+func (i *StdinInput) emit() {
+	var next func() (*RawRequest, error)
+
+	if i.config.format == stdinFormatJSON {
+		next = i.jsonReader()
+	} else {
+		decoder, err := newRequestDecoder(i.reader)
+		if err != nil {
+			log.Println("[STDIN] Can't read input: ", err)
+			return
+		}
+
+		next = func() (*RawRequest, error) {
+			raw := new(RawRequest)
+			return raw, decoder.Decode(raw)
+		}
+	}
+
+	var lastTime int64
+
+	for {
+		raw, err := next()
+		if err == io.EOF {
+			Debug("[STDIN] End of input")
+			return
+		}
+
+		if err != nil {
+			log.Println("[STDIN] Can't read input: ", err)
+			return
+		}
+
+		if lastTime != 0 && raw.Timestamp > lastTime {
+			time.Sleep(time.Duration(raw.Timestamp - lastTime))
+		}
+
+		if raw.Timestamp != 0 {
+			lastTime = raw.Timestamp
+		}
+
+		i.data <- raw.Request
+	}
+}
+
+// jsonReader returns function reading next JSON line, invalid lines skipped
+func (i *StdinInput) jsonReader() func() (*RawRequest, error) {
+	scanner := bufio.NewScanner(i.reader)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+
+	return func() (*RawRequest, error) {
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+
+			msg := new(StdoutMessage)
+			if err := json.Unmarshal(line, msg); err != nil {
+				log.Println("[STDIN] Skipping invalid JSON line: ", err)
+				continue
+			}
+
+			payload, err := msg.payload()
+			if err != nil {
+				log.Println("[STDIN] Skipping invalid message: ", err)
+				continue
+			}
+
+			var ts int64
+			if msg.Timestamp != nil {
+				ts = msg.Timestamp.UnixNano()
+			}
+
+			return &RawRequest{ts, payload}, nil
+		}
+
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+
+		return nil, io.EOF
+	}
+}
+
+// payload converts message back to HTTP/1.1 payload. Meta line added to responses, and to requests with id or timestamp.
+// Missing id generated, so requests written by other tools can be matched with replayed responses.
+func (m *StdoutMessage) payload() ([]byte, error) {
+	body := []byte(m.Body)
+	if m.BodyEncoding == "base64" {
+		var err error
+		if body, err = base64.StdEncoding.DecodeString(m.Body); err != nil {
+			return nil, err
+		}
+	}
+
+	var buf bytes.Buffer
+	var payloadType byte = RequestPayload
+
+	switch m.Type {
+	case "", "request":
+		if m.Method == "" {
+			return nil, fmt.Errorf("request without method")
+		}
+
+		u, err := url.Parse(m.URL)
+		if err != nil {
+			return nil, err
+		}
+
+		fmt.Fprintf(&buf, "%s %s HTTP/1.1\r\n", m.Method, u.RequestURI())
+
+		if m.Headers.Get("Host") == "" && u.Host != "" {
+			fmt.Fprintf(&buf, "Host: %s\r\n", u.Host)
+		}
+	case "response", "replayed_response":
+		if m.Status == 0 {
+			return nil, fmt.Errorf("response without status")
+		}
+
+		if payloadType = ResponsePayload; m.Type == "replayed_response" {
+			payloadType = ReplayedResponsePayload
+		}
+
+		fmt.Fprintf(&buf, "HTTP/1.1 %d %s\r\n", m.Status, http.StatusText(m.Status))
+	default:
+		return nil, fmt.Errorf("unknown message type: %s", m.Type)
+	}
+
+	// Sorted, so output is stable
+	names := make([]string, 0, len(m.Headers))
+	for name := range m.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if harSkipHeaders[strings.ToLower(name)] {
+			continue
+		}
+
+		for _, value := range m.Headers[name] {
+			fmt.Fprintf(&buf, "%s: %s\r\n", name, value)
+		}
+	}
+
+	if len(body) > 0 || payloadType != RequestPayload {
+		fmt.Fprintf(&buf, "Content-Length: %d\r\n", len(body))
+	}
+
+	buf.WriteString("\r\n")
+	buf.Write(body)
+
+	if payloadType == RequestPayload && m.ID == "" && m.Timestamp == nil {
+		return buf.Bytes(), nil
+	}
+
+	id := []byte(m.ID)
+	if len(id) == 0 {
+		id = uuid()
+	}
+
+	ts := time.Now().UnixNano()
+	if m.Timestamp != nil {
+		ts = m.Timestamp.UnixNano()
+	}
+
+	return append(payloadHeader(payloadType, id, ts), buf.Bytes()...), nil
+}
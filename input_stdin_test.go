@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"strings"
+	"testing"
+)
+
+func TestStdinInputGor(t *testing.T) {
+	buf := new(bytes.Buffer)
+	encoder := gob.NewEncoder(buf)
+	encoder.Encode(RawRequest{1, []byte("GET /1 HTTP/1.1\r\n\r\n")})
+	encoder.Encode(RawRequest{2, []byte("GET /2 HTTP/1.1\r\n\r\n")})
+
+	input := &StdinInput{data: make(chan []byte), config: &StdinInputConfig{format: "gor"}, reader: buf}
+	go input.emit()
+
+	for _, expected := range []string{"GET /1 HTTP/1.1\r\n\r\n", "GET /2 HTTP/1.1\r\n\r\n"} {
+		if data := <-input.data; string(data) != expected {
+			t.Errorf("Expected %q, got %q", expected, data)
+		}
+	}
+}
+
+func TestStdinInputJSON(t *testing.T) {
+	lines := `{"method": "POST", "url": "http://example.com/api?q=1", "headers": {"Content-Type": ["text/plain"], "Content-Length": ["100"]}, "body": "body"}
+invalid line
+{"type": "response", "id": "a", "status": 404, "body": "//4=", "body_encoding": "base64"}
+`
+	input := &StdinInput{data: make(chan []byte), config: &StdinInputConfig{format: "json"}, reader: strings.NewReader(lines)}
+	go input.emit()
+
+	expected := "POST /api?q=1 HTTP/1.1\r\nHost: example.com\r\nContent-Type: text/plain\r\nContent-Length: 4\r\n\r\nbody"
+	if data := <-input.data; string(data) != expected {
+		t.Errorf("Expected %q, got %q", expected, data)
+	}
+
+	data := <-input.data
+	if !bytes.HasPrefix(data, []byte("2 a ")) || !bytes.HasSuffix(data, []byte("HTTP/1.1 404 Not Found\r\nContent-Length: 2\r\n\r\n\xff\xfe")) {
+		t.Errorf("Should convert response with meta line, got %q", data)
+	}
+}
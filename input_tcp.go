@@ -2,26 +2,53 @@ package main
 
 import (
 	"bufio"
+	"crypto/subtle"
+	"crypto/tls"
 	"encoding/hex"
 	"fmt"
 	"log"
 	"net"
 	"os"
+	"strings"
+	"time"
 )
 
+// Handshake used if tcp input requires secret. Payloads are hex encoded, so it can't be confused with them.
+const (
+	tcpAuthPrefix  = "GOR-AUTH "
+	tcpAuthOK      = "OK\n"
+	tcpAuthTimeout = 10 * time.Second
+)
+
+// TCPInputConfig struct for holding tcp input configuration
+type TCPInputConfig struct {
+	secure bool
+
+	tlsCert string
+	tlsKey  string
+
+	// If specified, only clients with certificate signed by this CA accepted
+	tlsCA string
+
+	// If specified, clients should send it before payloads, see `tcpAuthenticate`
+	secret string
+}
+
 // TCPInput used for internal communication
 // It expected hex encoded data
 type TCPInput struct {
 	data     chan []byte
 	address  string
 	listener net.Listener
+	config   *TCPInputConfig
 }
 
 // NewTCPInput constructor for TCPInput, accepts address with port
-func NewTCPInput(address string) (i *TCPInput) {
+func NewTCPInput(address string, config *TCPInputConfig) (i *TCPInput) {
 	i = new(TCPInput)
 	i.data = make(chan []byte)
 	i.address = address
+	i.config = config
 
 	i.listen(address)
 
@@ -37,12 +64,17 @@ func (i *TCPInput) Read(data []byte) (int, error) {
 
 func (i *TCPInput) listen(address string) {
 	listener, err := net.Listen("tcp", address)
-	i.listener = listener
 
 	if err != nil {
 		log.Fatal("Can't start:", err)
 	}
 
+	if i.config.secure {
+		listener = tls.NewListener(listener, i.tlsConfig())
+	}
+
+	i.listener = listener
+
 	go func() {
 		for {
 			conn, err := listener.Accept()
@@ -57,10 +89,33 @@ func (i *TCPInput) listen(address string) {
 	}()
 }
 
+func (i *TCPInput) tlsConfig() *tls.Config {
+	cert, err := tls.LoadX509KeyPair(i.config.tlsCert, i.config.tlsKey)
+
+	if err != nil {
+		log.Fatal("[TCP] Can't load certificate: ", err)
+	}
+
+	config := &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	if i.config.tlsCA != "" {
+		config.ClientCAs = loadCertPool(i.config.tlsCA)
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return config
+}
+
 func (i *TCPInput) handleConnection(conn net.Conn) {
 	defer conn.Close()
 
 	reader := bufio.NewReader(conn)
+
+	if i.config.secret != "" && !i.authenticate(conn, reader) {
+		log.Println("[TCP] Rejected connection with wrong secret from", conn.RemoteAddr())
+		return
+	}
+
 	scanner := bufio.NewScanner(reader)
 
 	for scanner.Scan() {
@@ -76,6 +131,27 @@ func (i *TCPInput) handleConnection(conn net.Conn) {
 	}
 }
 
+// authenticate checks handshake line `GOR-AUTH <secret>`, and confirms it with `OK` line
+func (i *TCPInput) authenticate(conn net.Conn, reader *bufio.Reader) bool {
+	conn.SetReadDeadline(time.Now().Add(tcpAuthTimeout))
+	line, err := reader.ReadString('\n')
+	conn.SetReadDeadline(time.Time{})
+
+	if err != nil || !strings.HasPrefix(line, tcpAuthPrefix) {
+		return false
+	}
+
+	secret := strings.TrimSuffix(line[len(tcpAuthPrefix):], "\n")
+
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(i.config.secret)) != 1 {
+		return false
+	}
+
+	_, err = conn.Write([]byte(tcpAuthOK))
+
+	return err == nil
+}
+
 func (i *TCPInput) String() string {
 	return "TCP input: " + i.address
 }
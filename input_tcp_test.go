@@ -5,6 +5,8 @@ import (
 	"io"
 	"log"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"sync"
 	"testing"
 )
@@ -13,7 +15,7 @@ func TestTCPInput(t *testing.T) {
 	wg := new(sync.WaitGroup)
 	quit := make(chan int)
 
-	input := NewTCPInput(":0")
+	input := NewTCPInput(":0", &TCPInputConfig{})
 	output := NewTestOutput(func(data []byte) {
 		wg.Done()
 	})
@@ -50,11 +52,78 @@ func TestTCPInput(t *testing.T) {
 	close(quit)
 }
 
+func TestTCPInputTLS(t *testing.T) {
+	wg := new(sync.WaitGroup)
+
+	// Reuse certificate of test server, it is valid for 127.0.0.1
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Close()
+	certFile, keyFile := writeServerCert(server)
+
+	input := NewTCPInput("127.0.0.1:0", &TCPInputConfig{secure: true, tlsCert: certFile, tlsKey: keyFile})
+	output := NewTestOutput(func(data []byte) {
+		if string(data) != "GET / HTTP/1.1\r\n\r\n" {
+			t.Error("Wrong payload:", string(data))
+		}
+		wg.Done()
+	})
+
+	go CopyMulty(input, output)
+
+	// Plain text connections should be rejected
+	if conn, err := net.Dial("tcp", input.listener.Addr().String()); err == nil {
+		conn.Write([]byte("474554202f20485454502f312e310d0a0d0a\n"))
+		conn.Close()
+	}
+
+	secure := NewTCPOutput(input.listener.Addr().String(), &TCPOutputConfig{secure: true, tlsCA: certFile})
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		secure.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+	}
+
+	wg.Wait()
+}
+
+func TestTCPInputSecret(t *testing.T) {
+	wg := new(sync.WaitGroup)
+
+	input := NewTCPInput("127.0.0.1:0", &TCPInputConfig{secret: "secret"})
+	output := NewTestOutput(func(data []byte) {
+		wg.Done()
+	})
+
+	go CopyMulty(input, output)
+
+	address := input.listener.Addr().String()
+
+	wrong := &TCPOutput{address: address, config: &TCPOutputConfig{secret: "wrong"}}
+	if _, err := wrong.connect(address); err == nil {
+		t.Error("Should reject wrong secret")
+	}
+
+	// Without handshake payload line treated as wrong secret
+	if conn, err := net.Dial("tcp", address); err == nil {
+		conn.Write([]byte("474554202f20485454502f312e310d0a0d0a\n"))
+		conn.Close()
+	}
+
+	authorized := NewTCPOutput(address, &TCPOutputConfig{secret: "secret"})
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		authorized.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+	}
+
+	wg.Wait()
+}
+
 func BenchmarkTCPInput(b *testing.B) {
 	wg := new(sync.WaitGroup)
 	quit := make(chan int)
 
-	input := NewTCPInput(":0")
+	input := NewTCPInput(":0", &TCPInputConfig{})
 	output := NewTestOutput(func(data []byte) {
 		wg.Done()
 	})
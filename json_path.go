@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/buger/gor/proto"
+)
+
+// parseJSONPath splits simplified JSONPath into keys: `$.users[*].email` or `users.*.email`.
+// `*` matches all array items or object fields, numbers match array items.
+func parseJSONPath(path string) ([]string, error) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+
+	if path == "" {
+		return nil, fmt.Errorf("empty JSON path")
+	}
+
+	var keys []string
+
+	for _, segment := range strings.Split(path, ".") {
+		key := segment
+		var indexes []string
+
+		if i := strings.IndexByte(segment, '['); i != -1 {
+			key = segment[:i]
+
+			for _, index := range strings.Split(segment[i+1:], "[") {
+				if !strings.HasSuffix(index, "]") {
+					return nil, fmt.Errorf("invalid JSON path %q", path)
+				}
+
+				indexes = append(indexes, strings.Trim(strings.TrimSuffix(index, "]"), `'"`))
+			}
+		}
+
+		if key != "" {
+			keys = append(keys, key)
+		} else if len(indexes) == 0 {
+			return nil, fmt.Errorf("invalid JSON path %q", path)
+		}
+
+		keys = append(keys, indexes...)
+	}
+
+	return keys, nil
+}
+
+// jsonObject is decoded JSON object, which keeps order of keys, so rewritten body differs from original only by changed values
+type jsonObject struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+// decodeJSON decodes JSON document. Objects decoded as *jsonObject, and numbers as json.Number,
+// so big integer ids keep their precision.
+func decodeJSON(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	doc, err := decodeJSONValue(dec)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after JSON document")
+	}
+
+	return doc, nil
+}
+
+func decodeJSONValue(dec *json.Decoder) (interface{}, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token {
+	case json.Delim('{'):
+		obj := &jsonObject{values: make(map[string]interface{})}
+
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+
+			value, err := decodeJSONValue(dec)
+			if err != nil {
+				return nil, err
+			}
+
+			if _, ok := obj.values[key.(string)]; !ok {
+				obj.keys = append(obj.keys, key.(string))
+			}
+			obj.values[key.(string)] = value
+		}
+
+		_, err = dec.Token()
+
+		return obj, err
+	case json.Delim('['):
+		arr := []interface{}{}
+
+		for dec.More() {
+			value, err := decodeJSONValue(dec)
+			if err != nil {
+				return nil, err
+			}
+
+			arr = append(arr, value)
+		}
+
+		_, err = dec.Token()
+
+		return arr, err
+	}
+
+	return token, nil
+}
+
+// encodeJSON encodes document decoded by decodeJSON. Unlike json.Marshal, `<`, `>` and `&` are not escaped.
+func encodeJSON(buf *bytes.Buffer, doc interface{}) error {
+	switch v := doc.(type) {
+	case *jsonObject:
+		buf.WriteByte('{')
+
+		for i, key := range v.keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+
+			if err := encodeJSON(buf, key); err != nil {
+				return err
+			}
+			buf.WriteByte(':')
+
+			if err := encodeJSON(buf, v.values[key]); err != nil {
+				return err
+			}
+		}
+
+		buf.WriteByte('}')
+	case []interface{}:
+		buf.WriteByte('[')
+
+		for i, item := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+
+			if err := encodeJSON(buf, item); err != nil {
+				return err
+			}
+		}
+
+		buf.WriteByte(']')
+	default:
+		enc := json.NewEncoder(buf)
+		enc.SetEscapeHTML(false)
+
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+
+		// Encoder adds new line after value
+		buf.Truncate(buf.Len() - 1)
+	}
+
+	return nil
+}
+
+// rewriteJSONPath replaces values found by path with result of fn. Missing fields are not created.
+func rewriteJSONPath(node interface{}, path []string, fn func(interface{}) interface{}, changed *bool) interface{} {
+	if len(path) == 0 {
+		*changed = true
+		return fn(node)
+	}
+
+	key := path[0]
+
+	switch n := node.(type) {
+	case *jsonObject:
+		for _, k := range n.keys {
+			if key == "*" || key == k {
+				n.values[k] = rewriteJSONPath(n.values[k], path[1:], fn, changed)
+			}
+		}
+	case []interface{}:
+		for i, v := range n {
+			if key == "*" || key == strconv.Itoa(i) {
+				n[i] = rewriteJSONPath(v, path[1:], fn, changed)
+			}
+		}
+	}
+
+	return node
+}
+
+// rewriteJSONBody decodes JSON body of request or response, passes it to fn, and encodes back if fn changed it.
+// Body left untouched if nothing changed. Content-Length updated, chunked bodies are not supported.
+func rewriteJSONBody(payload []byte, fn func(doc interface{}) (interface{}, bool)) []byte {
+	if !bytes.Contains(proto.Header(payload, []byte("Content-Type")), []byte("json")) {
+		return payload
+	}
+
+	if len(proto.Header(payload, []byte("Transfer-Encoding"))) > 0 {
+		return payload
+	}
+
+	bodyStart := proto.MIMEHeadersEndPos(payload)
+	if bodyStart == -1 {
+		return payload
+	}
+	bodyStart += len(proto.EmptyLine)
+
+	doc, err := decodeJSON(payload[bodyStart:])
+	if err != nil {
+		return payload
+	}
+
+	doc, changed := fn(doc)
+	if !changed {
+		return payload
+	}
+
+	var body bytes.Buffer
+	if err := encodeJSON(&body, doc); err != nil {
+		return payload
+	}
+
+	// Limit capacity, so append makes copy instead of overwriting original body
+	payload = append(payload[:bodyStart:bodyStart], body.Bytes()...)
+
+	return proto.SetHeader(payload, []byte("Content-Length"), []byte(strconv.Itoa(body.Len())))
+}
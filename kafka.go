@@ -0,0 +1,29 @@
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+// parseKafkaAddress splits `broker1:9092,broker2:9092/topic` address into list of brokers and topic
+func parseKafkaAddress(address string) (brokers []string, topic string, err error) {
+	idx := strings.LastIndex(address, "/")
+
+	if idx == -1 || idx == len(address)-1 {
+		return nil, "", errors.New("Kafka address should contain topic: broker1:9092,broker2:9092/topic")
+	}
+
+	topic = address[idx+1:]
+
+	for _, broker := range strings.Split(address[:idx], ",") {
+		if broker = strings.TrimSpace(broker); broker != "" {
+			brokers = append(brokers, broker)
+		}
+	}
+
+	if len(brokers) == 0 {
+		return nil, "", errors.New("Kafka address should contain at least one broker")
+	}
+
+	return
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseKafkaAddress(t *testing.T) {
+	brokers, topic, err := parseKafkaAddress("localhost:9092,localhost:9093/requests")
+
+	if err != nil || topic != "requests" || len(brokers) != 2 || brokers[1] != "localhost:9093" {
+		t.Error("Wrong parsing:", brokers, topic, err)
+	}
+
+	if _, _, err = parseKafkaAddress("localhost:9092"); err == nil {
+		t.Error("Should require topic")
+	}
+
+	if _, _, err = parseKafkaAddress("/requests"); err == nil {
+		t.Error("Should require brokers")
+	}
+}
+
+func TestKafkaBackoff(t *testing.T) {
+	var delays []time.Duration
+
+	var delay time.Duration
+	for i := 0; i < 12; i++ {
+		delay = kafkaBackoff(delay)
+		delays = append(delays, delay)
+	}
+
+	if delays[0] != kafkaMinBackoff || delays[1] != 2*kafkaMinBackoff || delays[11] != kafkaMaxBackoff {
+		t.Error("Delay should double up to limit:", delays)
+	}
+}
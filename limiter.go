@@ -2,10 +2,13 @@ package main
 
 import (
 	"fmt"
+	"hash/fnv"
 	"io"
+	"log"
 	"math/rand"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -14,18 +17,60 @@ type Limiter struct {
 	plugin    interface{}
 	limit     int
 	isPercent bool
+	isQPS     bool
 
 	currentRPS  int
 	currentTime int64
+
+	// Token bucket state for "qps" limiter
+	mu         sync.Mutex
+	tokens     float64
+	lastRefill time.Time
+
+	// Ramp-up: limit grows linearly from rampFrom to limit during rampDuration after start
+	rampFrom     int
+	rampDuration time.Duration
+	start        time.Time
 }
 
-func parseLimitOptions(options string) (limit int, isPercent bool) {
+// parseLimitOptions parses limit like "10", "10%" or "10qps". Zero limit drops everything, but "qps" limit
+// should be positive, otherwise interval between requests can't be computed.
+func parseLimitOptions(options string) (limit int, isPercent bool, isQPS bool, err error) {
+	value := options
+
 	if strings.Contains(options, "%") {
-		limit, _ = strconv.Atoi(strings.Split(options, "%")[0])
+		value = strings.Split(options, "%")[0]
 		isPercent = true
-	} else {
-		limit, _ = strconv.Atoi(options)
-		isPercent = false
+	} else if strings.HasSuffix(options, "qps") {
+		value = strings.TrimSuffix(options, "qps")
+		isQPS = true
+	}
+
+	if limit, err = strconv.Atoi(value); err != nil || limit < 0 || (isQPS && limit == 0) {
+		return 0, false, false, fmt.Errorf("limit should be positive number: %s", options)
+	}
+
+	return
+}
+
+// parseRampOptions splits ramp-up limit like "10%-100%/30m" into initial limit, final limit and duration.
+// Initial limit without unit gets unit of final one, e.g. "10-100qps/5m".
+func parseRampOptions(options string) (from, to string, duration time.Duration, err error) {
+	split := strings.SplitN(options, "/", 2)
+	limits := strings.SplitN(split[0], "-", 2)
+
+	if len(split) != 2 || len(limits) != 2 {
+		return "", "", 0, fmt.Errorf("ramp-up limit should look like '10%%-100%%/30m': %s", options)
+	}
+
+	if duration, err = time.ParseDuration(split[1]); err != nil {
+		return
+	}
+
+	from, to = limits[0], limits[1]
+
+	if _, err := strconv.Atoi(from); err == nil {
+		from += strings.TrimLeft(to, "0123456789")
 	}
 
 	return
@@ -35,26 +80,95 @@ func parseLimitOptions(options string) (limit int, isPercent bool) {
 // `options` allow to sprcify relatve or absolute limiting
 func NewLimiter(plugin interface{}, options string) io.ReadWriter {
 	l := new(Limiter)
-	l.limit, l.isPercent = parseLimitOptions(options)
+
+	if strings.Contains(options, "/") {
+		from, to, duration, err := parseRampOptions(options)
+		if err != nil {
+			log.Fatal("[LIMITER] Invalid ramp-up: ", err)
+		}
+
+		var isPercent, isQPS bool
+		if l.rampFrom, isPercent, isQPS, err = parseLimitOptions(from); err != nil {
+			log.Fatal("[LIMITER] Invalid ramp-up: ", err)
+		}
+		l.rampDuration = duration
+		options = to
+
+		if _, toPercent, toQPS, _ := parseLimitOptions(to); isPercent != toPercent || isQPS != toQPS {
+			log.Fatal("[LIMITER] Ramp-up limits should have the same unit: ", from, " ", to)
+		}
+	}
+
+	var err error
+	if l.limit, l.isPercent, l.isQPS, err = parseLimitOptions(options); err != nil {
+		log.Fatal("[LIMITER] Invalid limit: ", err)
+	}
 	l.plugin = plugin
 	l.currentTime = time.Now().UnixNano()
+	l.lastRefill = time.Now()
+	l.start = time.Now()
+	l.tokens = 1
 
 	// FileInput have its own rate limiting. Unlike other inputs we not just dropping requests, we can slow down or speed up request emittion.
+	if l.rampDuration > 0 && l.isPercent {
+		switch l.plugin.(type) {
+		case *FileInput, *HARInput, *PcapInput:
+			log.Fatal("[LIMITER] Ramp-up is not supported by replay speed limiter of file inputs")
+		}
+	}
+
 	if fi, ok := l.plugin.(*FileInput); ok && l.isPercent {
 		fi.speedFactor = float64(l.limit) / float64(100)
 	}
 
+	if hi, ok := l.plugin.(*HARInput); ok && l.isPercent {
+		hi.speedFactor = float64(l.limit) / float64(100)
+	}
+
+	if pi, ok := l.plugin.(*PcapInput); ok && l.isPercent {
+		pi.speedFactor = float64(l.limit) / float64(100)
+	}
+
 	return l
 }
 
-func (l *Limiter) isLimited() bool {
+// currentLimit returns limit, which grows linearly during ramp-up
+func (l *Limiter) currentLimit() int {
+	elapsed := time.Since(l.start)
+
+	if elapsed >= l.rampDuration {
+		return l.limit
+	}
+
+	return l.rampFrom + int(float64(l.limit-l.rampFrom)*float64(elapsed)/float64(l.rampDuration))
+}
+
+func (l *Limiter) isLimited(payload []byte) bool {
 	// File input have its own limiting algorithm
 	if _, ok := l.plugin.(*FileInput); ok && l.isPercent {
 		return false
 	}
 
+	if _, ok := l.plugin.(*HARInput); ok && l.isPercent {
+		return false
+	}
+
+	if _, ok := l.plugin.(*PcapInput); ok && l.isPercent {
+		return false
+	}
+
+	limit := l.currentLimit()
+
 	if l.isPercent {
-		return l.limit <= rand.Intn(100)
+		// Request and its responses share same id, so make same decision for all of them
+		if id := payloadID(payload); id != nil {
+			hasher := fnv.New32a()
+			hasher.Write(id)
+
+			return uint32(limit) <= hasher.Sum32()%100
+		}
+
+		return limit <= rand.Intn(100)
 	}
 
 	if (time.Now().UnixNano() - l.currentTime) > time.Second.Nanoseconds() {
@@ -62,7 +176,7 @@ func (l *Limiter) isLimited() bool {
 		l.currentRPS = 0
 	}
 
-	if l.currentRPS >= l.limit {
+	if l.currentRPS >= limit {
 		return true
 	}
 
@@ -71,8 +185,37 @@ func (l *Limiter) isLimited() bool {
 	return false
 }
 
+// throttle blocks until token bucket allows to emit next request.
+// Tokens refilled at `limit` per second, and bucket holds at most 1 second worth of tokens.
+// Each caller reserves token upfront (bucket may go negative), so concurrent callers queue fairly.
+func (l *Limiter) throttle() {
+	l.mu.Lock()
+
+	// "qps" limits are positive, so is limit during ramp-up
+	limit := float64(l.currentLimit())
+
+	now := time.Now()
+	l.tokens += now.Sub(l.lastRefill).Seconds() * limit
+	l.lastRefill = now
+
+	if l.tokens > limit {
+		l.tokens = limit
+	}
+
+	l.tokens--
+	wait := time.Duration(-l.tokens / limit * float64(time.Second))
+
+	l.mu.Unlock()
+
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+}
+
 func (l *Limiter) Write(data []byte) (n int, err error) {
-	if l.isLimited() {
+	if l.isQPS {
+		l.throttle()
+	} else if l.isLimited(data) {
 		return 0, nil
 	}
 
@@ -84,13 +227,48 @@ func (l *Limiter) Write(data []byte) (n int, err error) {
 func (l *Limiter) Read(data []byte) (n int, err error) {
 	n, err = l.plugin.(io.Reader).Read(data)
 
-	if l.isLimited() {
+	if l.isQPS {
+		l.throttle()
+	} else if l.isLimited(data[:n]) {
 		return 0, nil
 	}
 
 	return
 }
 
+// ReadPayload limits payloads handed over by wrapped input, dropped payloads released
+func (l *Limiter) ReadPayload() (*payloadBuffer, error) {
+	p, err := l.plugin.(payloadReader).ReadPayload()
+
+	if p == nil {
+		return nil, err
+	}
+
+	if l.isQPS {
+		l.throttle()
+	} else if l.isLimited(p.data) {
+		p.release()
+		return nil, err
+	}
+
+	return p, err
+}
+
+// WritePayload limits payloads passed to wrapped output, without copying them
+func (l *Limiter) WritePayload(p *payloadBuffer) (int, error) {
+	if l.isQPS {
+		l.throttle()
+	} else if l.isLimited(p.data) {
+		return 0, nil
+	}
+
+	return writePayload(l.plugin.(io.Writer), p)
+}
+
 func (l *Limiter) String() string {
-	return fmt.Sprintf("Limiting %s to: %d (isPercent: %b)", l.plugin, l.limit, l.isPercent)
+	if l.rampDuration > 0 {
+		return fmt.Sprintf("Limiting %s to: %d, ramp-up from %d during %s (isPercent: %t, isQPS: %t)", l.plugin, l.limit, l.rampFrom, l.rampDuration, l.isPercent, l.isQPS)
+	}
+
+	return fmt.Sprintf("Limiting %s to: %d (isPercent: %t, isQPS: %t)", l.plugin, l.limit, l.isPercent, l.isQPS)
 }
@@ -6,6 +6,7 @@ import (
 	"io"
 	"sync"
 	"testing"
+	"time"
 )
 
 func TestOutputLimiter(t *testing.T) {
@@ -104,3 +105,124 @@ func TestPercentLimiter2(t *testing.T) {
 
 	close(quit)
 }
+
+// Should delay requests instead of dropping them
+func TestQPSLimiter(t *testing.T) {
+	wg := new(sync.WaitGroup)
+	quit := make(chan int)
+
+	input := NewTestInput()
+	output := NewLimiter(NewTestOutput(func(data []byte) {
+		wg.Done()
+	}), "20qps")
+	wg.Add(10)
+
+	Plugins.Inputs = []io.Reader{input}
+	Plugins.Outputs = []io.Writer{output}
+
+	go Start(quit)
+
+	start := time.Now()
+
+	for i := 0; i < 10; i++ {
+		input.EmitGET()
+	}
+
+	wg.Wait()
+
+	// First request passes instantly, rest spaced by 50ms
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond || elapsed > time.Second {
+		t.Error("Should emit 10 requests at 20 qps rate:", elapsed)
+	}
+
+	close(quit)
+}
+
+// Should sample request and its response together
+func TestPercentInputLimiterConsistent(t *testing.T) {
+	mu := new(sync.Mutex)
+	quit := make(chan int)
+	received := make(map[string]int)
+
+	input := NewLimiter(NewTestInput(), "50%")
+	output := NewTestOutput(func(data []byte) {
+		mu.Lock()
+		received[string(payloadID(data))]++
+		mu.Unlock()
+	})
+
+	Plugins.Inputs = []io.Reader{input}
+	Plugins.Outputs = []io.Writer{output}
+
+	go Start(quit)
+
+	testInput := input.(*Limiter).plugin.(*TestInput)
+	for i := 0; i < 50; i++ {
+		id := uuid()
+		testInput.data <- append(payloadHeader(RequestPayload, id, 1), "GET / HTTP/1.1\r\n\r\n"...)
+		testInput.data <- append(payloadHeader(ResponsePayload, id, 2), "HTTP/1.1 200 OK\r\n\r\n"...)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(received) == 0 || len(received) == 50 {
+		t.Error("Should sample part of requests:", len(received))
+	}
+
+	for id, count := range received {
+		if count != 2 {
+			t.Error("Should pass both request and response:", id, count)
+		}
+	}
+
+	close(quit)
+}
+
+func TestRampLimiter(t *testing.T) {
+	if from, to, duration, err := parseRampOptions("10-100qps/30m"); err != nil || from != "10qps" || to != "100qps" || duration != 30*time.Minute {
+		t.Error("Should parse ramp-up:", from, to, duration, err)
+	}
+
+	if _, _, _, err := parseRampOptions("10%/30m"); err == nil {
+		t.Error("Should require initial and final limits")
+	}
+
+	l := NewLimiter(NewTestOutput(func(data []byte) {}), "10%-100%/10m").(*Limiter)
+
+	if !l.isPercent || l.rampFrom != 10 || l.limit != 100 {
+		t.Fatal("Should parse percent ramp-up:", l)
+	}
+
+	if limit := l.currentLimit(); limit != 10 {
+		t.Error("Ramp-up should start from initial limit:", limit)
+	}
+
+	l.start = time.Now().Add(-5 * time.Minute)
+	if limit := l.currentLimit(); limit < 54 || limit > 56 {
+		t.Error("Limit should grow linearly:", limit)
+	}
+
+	l.start = time.Now().Add(-time.Hour)
+	if limit := l.currentLimit(); limit != 100 {
+		t.Error("Limit should stay at final value after ramp-up:", limit)
+	}
+}
+
+func TestParseLimitOptions(t *testing.T) {
+	if limit, isPercent, isQPS, err := parseLimitOptions("10qps"); err != nil || limit != 10 || isPercent || !isQPS {
+		t.Error("Should parse qps limit:", limit, isPercent, isQPS, err)
+	}
+
+	if limit, isPercent, _, err := parseLimitOptions("0%"); err != nil || limit != 0 || !isPercent {
+		t.Error("Should allow dropping everything:", limit, err)
+	}
+
+	for _, options := range []string{"0qps", "-5%", "-5", "qps", "ten"} {
+		if _, _, _, err := parseLimitOptions(options); err == nil {
+			t.Error("Should reject limit:", options)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Middleware runs external program and streams all traffic through its STDIN and STDOUT.
+//
+// Each message is hex encoded typed payload (see payloadHeader) followed by new line.
+// Program can modify, delay or drop messages: only messages written back to STDOUT are passed to outputs.
+type Middleware struct {
+	command string
+
+	data chan []byte
+
+	Stdin  io.Writer
+	Stdout io.Reader
+
+	// Encodings of bodies decoded before sending to middleware, see `--http-decode-body`
+	encodings *bodyEncodings
+
+	mu sync.Mutex
+}
+
+// NewMiddleware starts middleware program. Command may include arguments separated by spaces.
+func NewMiddleware(command string) *Middleware {
+	m := new(Middleware)
+	m.command = command
+	m.data = make(chan []byte, 1000)
+
+	if Settings.decodeBody {
+		m.encodings = newBodyEncodings()
+	}
+
+	commands := strings.Fields(command)
+	cmd := exec.Command(commands[0], commands[1:]...)
+
+	m.Stdout, _ = cmd.StdoutPipe()
+	m.Stdin, _ = cmd.StdinPipe()
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Start(); err != nil {
+		log.Fatal("[MIDDLEWARE] Can't start middleware: ", err)
+	}
+
+	go m.read(m.Stdout)
+
+	go func() {
+		err := cmd.Wait()
+		log.Fatal("[MIDDLEWARE] Middleware exited: ", err)
+	}()
+
+	return m
+}
+
+// ReadFromPlugin starts streaming data from given plugin to middleware
+func (m *Middleware) ReadFromPlugin(plugin io.Reader) {
+	Debug("[MIDDLEWARE] Reading from:", plugin)
+
+	go m.copy(m.Stdin, plugin)
+}
+
+func (m *Middleware) copy(to io.Writer, from io.Reader) {
+	buf := make([]byte, 5*1024*1024)
+	dst := make([]byte, len(buf)*2)
+	stats := statsFor(from)
+
+	for {
+		nr, er := from.Read(buf)
+		stats.add(nr, er)
+
+		if nr > 0 && len(buf) > nr {
+			payload := buf[:nr]
+
+			// Middleware needs payload type and id, so plain requests get them as well
+			if !hasPayloadHeader(payload) {
+				payload = append(payloadHeader(RequestPayload, uuid(), time.Now().UnixNano()), payload...)
+			}
+
+			// Encoding remembered before payload sent, so it is known when middleware returns payload
+			if m.encodings != nil {
+				headSize := payloadHeaderSize(payload)
+
+				if body, encoding := decodeBody(payload[headSize:]); encoding != "" {
+					payload = append(payload[:headSize:headSize], body...)
+					m.encodings.add(payload, encoding)
+				}
+			}
+
+			if len(dst) < len(payload)*2+1 {
+				dst = make([]byte, len(payload)*2+1)
+			}
+
+			hex.Encode(dst, payload)
+			dst[len(payload)*2] = '\n'
+
+			m.mu.Lock()
+			to.Write(dst[0 : len(payload)*2+1])
+			m.mu.Unlock()
+
+			if Settings.debug {
+				Debug("[MIDDLEWARE] Sending:", string(payload))
+			}
+		}
+
+		if er == io.EOF {
+			break
+		}
+
+		if er != nil {
+			log.Println("[MIDDLEWARE] Input read error:", er)
+			break
+		}
+	}
+}
+
+func (m *Middleware) read(from io.Reader) {
+	scanner := bufio.NewScanner(from)
+	// Hex encoded payloads are twice bigger than raw ones
+	scanner.Buffer(make([]byte, 64*1024), 2*5*1024*1024+1)
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+
+		buf := make([]byte, len(line)/2)
+		if _, err := hex.Decode(buf, line); err != nil {
+			log.Println("[MIDDLEWARE] Failed to decode message:", err, string(line))
+			continue
+		}
+
+		if Settings.debug {
+			Debug("[MIDDLEWARE] Received:", string(buf))
+		}
+
+		if m.encodings != nil && hasPayloadHeader(buf) {
+			if encoding := m.encodings.take(buf); encoding != "" {
+				headSize := payloadHeaderSize(buf)
+				buf = append(buf[:headSize:headSize], encodeBody(buf[headSize:], encoding)...)
+			}
+		}
+
+		m.data <- buf
+	}
+
+	if err := scanner.Err(); err != nil {
+		log.Println("[MIDDLEWARE] Output read error:", err)
+	}
+}
+
+func (m *Middleware) Read(data []byte) (int, error) {
+	buf := <-m.data
+	n := copy(data, buf)
+
+	return n, nil
+}
+
+func (m *Middleware) String() string {
+	return fmt.Sprintf("Modifying traffic using '%s' command", m.command)
+}
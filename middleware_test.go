@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestMiddlewareEcho(t *testing.T) {
+	wg := new(sync.WaitGroup)
+	quit := make(chan int)
+
+	input := NewTestInput()
+	output := NewTestOutput(func(data []byte) {
+		if !isRequestPayload(data) || len(payloadID(data)) == 0 {
+			t.Error("Should add payload header:", string(data))
+		}
+
+		if !bytes.Equal(payloadBody(data), []byte("GET / HTTP/1.1\r\n\r\n")) {
+			t.Error("Should pass request as is:", string(data))
+		}
+
+		wg.Done()
+	})
+
+	Plugins.Inputs = []io.Reader{input}
+	Plugins.Outputs = []io.Writer{output}
+
+	Settings.middleware = "cat"
+	defer func() { Settings.middleware = "" }()
+
+	go Start(quit)
+
+	wg.Add(2)
+	input.EmitGET()
+	input.EmitGET()
+
+	wg.Wait()
+	close(quit)
+}
+
+func TestMiddlewareFilter(t *testing.T) {
+	wg := new(sync.WaitGroup)
+	quit := make(chan int)
+
+	// Pass only requests: hex encoded payload type '1' is "31"
+	script := "/tmp/gor_test_middleware.sh"
+	ioutil.WriteFile(script, []byte("#!/bin/sh\nwhile read line; do case $line in 31*) echo $line;; esac; done\n"), 0755)
+	defer os.Remove(script)
+
+	input := NewTestInput()
+	output := NewTestOutput(func(data []byte) {
+		if !isRequestPayload(data) {
+			t.Error("Should drop responses:", string(data))
+		}
+
+		wg.Done()
+	})
+
+	Plugins.Inputs = []io.Reader{input}
+	Plugins.Outputs = []io.Writer{output}
+
+	Settings.middleware = script
+	defer func() { Settings.middleware = "" }()
+
+	go Start(quit)
+
+	id := uuid()
+	input.data <- append(payloadHeader(ResponsePayload, id, 2), "HTTP/1.1 200 OK\r\n\r\n"...)
+	input.data <- append(payloadHeader(RequestPayload, id, 1), "GET / HTTP/1.1\r\n\r\n"...)
+
+	wg.Add(1)
+	wg.Wait()
+	close(quit)
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Spans sent in batches of this size, or every flush interval
+const otlpBatchSize = 512
+
+// Spans dropped if collector can't keep up, so they do not pile up in memory
+const otlpMaxQueued = 8 * otlpBatchSize
+
+// Span kind of outgoing requests, see OpenTelemetry protocol
+const spanKindClient = 3
+
+// OTLPConfig struct for holding OpenTelemetry exporter configuration
+type OTLPConfig struct {
+	serviceName   string
+	flushInterval time.Duration
+
+	// Report stages of replay pipeline as well: capture, queue, send and response
+	pipelineSpans bool
+}
+
+// Span is single timed operation of a trace
+type Span struct {
+	trace    traceContext
+	parentID [8]byte
+
+	name  string
+	kind  int
+	start time.Time
+	end   time.Time
+
+	attributes map[string]interface{}
+	// Not empty if operation failed
+	err string
+}
+
+// OTLPExporter sends spans to OpenTelemetry collector, using OTLP/HTTP protocol with JSON encoding.
+// Spans buffered and sent in batches, either when batch is full or every flush interval.
+//
+// All methods are safe to call on nil exporter, so spans can be reported unconditionally.
+type OTLPExporter struct {
+	sync.Mutex
+
+	endpoint string
+	config   *OTLPConfig
+	client   *http.Client
+
+	spans   []*Span
+	dropped int
+}
+
+// tracer is global spans sink, initialized if `--otlp-endpoint` specified
+var tracer *OTLPExporter
+
+// NewOTLPExporter constructor for OTLPExporter. Endpoint is collector URL, `/v1/traces` path added if it has no path.
+func NewOTLPExporter(endpoint string, config *OTLPConfig) *OTLPExporter {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		log.Fatal("[OTLP] Invalid collector endpoint, should be URL like http://localhost:4318: ", endpoint)
+	}
+
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/v1/traces"
+	}
+
+	if config.serviceName == "" {
+		config.serviceName = "gor"
+	}
+
+	if config.flushInterval == 0 {
+		config.flushInterval = 5 * time.Second
+	}
+
+	e := &OTLPExporter{endpoint: u.String(), config: config, client: &http.Client{Timeout: 10 * time.Second}}
+
+	go e.flushLoop()
+
+	return e
+}
+
+// Export adds span to the next batch
+func (e *OTLPExporter) Export(span *Span) {
+	if e == nil {
+		return
+	}
+
+	e.Lock()
+	defer e.Unlock()
+
+	if len(e.spans) >= otlpMaxQueued {
+		e.dropped++
+		return
+	}
+
+	e.spans = append(e.spans, span)
+
+	if len(e.spans) == otlpBatchSize {
+		go e.Flush()
+	}
+}
+
+// Flush sends buffered spans immediately
+func (e *OTLPExporter) Flush() {
+	if e == nil {
+		return
+	}
+
+	e.Lock()
+	spans, dropped := e.spans, e.dropped
+	e.spans, e.dropped = nil, 0
+	e.Unlock()
+
+	if dropped > 0 {
+		Debug("[OTLP] Dropped spans, collector can't keep up:", dropped)
+	}
+
+	for len(spans) > 0 {
+		batch := spans
+		if len(batch) > otlpBatchSize {
+			batch = batch[:otlpBatchSize]
+		}
+		spans = spans[len(batch):]
+
+		if err := e.send(batch); err != nil {
+			Debug("[OTLP] Failed to send spans:", err)
+		}
+	}
+}
+
+func (e *OTLPExporter) send(spans []*Span) error {
+	body, err := json.Marshal(otlpRequest(e.config.serviceName, spans))
+	if err != nil {
+		return err
+	}
+
+	resp, err := e.client.Post(e.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return &otlpError{resp.Status}
+	}
+
+	return nil
+}
+
+func (e *OTLPExporter) flushLoop() {
+	for {
+		time.Sleep(e.config.flushInterval)
+		e.Flush()
+	}
+}
+
+func (e *OTLPExporter) String() string {
+	return "OpenTelemetry exporter: " + e.endpoint
+}
+
+type otlpError struct {
+	status string
+}
+
+func (e *otlpError) Error() string {
+	return "collector responded with " + e.status
+}
+
+// otlpRequest builds body of export request, in JSON mapping of OTLP protobuf messages
+func otlpRequest(serviceName string, spans []*Span) map[string]interface{} {
+	encoded := make([]map[string]interface{}, len(spans))
+
+	for i, s := range spans {
+		span := map[string]interface{}{
+			"traceId":           hex.EncodeToString(s.trace.traceID[:]),
+			"spanId":            hex.EncodeToString(s.trace.spanID[:]),
+			"name":              s.name,
+			"kind":              s.kind,
+			"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(s.end.UnixNano(), 10),
+			"attributes":        otlpAttributes(s.attributes),
+		}
+
+		if s.parentID != [8]byte{} {
+			span["parentSpanId"] = hex.EncodeToString(s.parentID[:])
+		}
+
+		// Status code 2 is error, unset status means success
+		if s.err != "" {
+			span["status"] = map[string]interface{}{"code": 2, "message": s.err}
+		}
+
+		encoded[i] = span
+	}
+
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": otlpAttributes(map[string]interface{}{"service.name": serviceName}),
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]interface{}{"name": "gor", "version": VERSION},
+						"spans": encoded,
+					},
+				},
+			},
+		},
+	}
+}
+
+// otlpAttributes converts attributes to list of key values, sorted by key. Only string and int values supported.
+func otlpAttributes(attributes map[string]interface{}) []interface{} {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	list := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		var value map[string]interface{}
+
+		switch v := attributes[key].(type) {
+		case int:
+			// 64 bit integers encoded as strings in JSON
+			value = map[string]interface{}{"intValue": strconv.Itoa(v)}
+		default:
+			value = map[string]interface{}{"stringValue": v}
+		}
+
+		list = append(list, map[string]interface{}{"key": key, "value": value})
+	}
+
+	return list
+}
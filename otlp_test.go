@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestOTLPExporter(t *testing.T) {
+	requests := make(chan []byte, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+			t.Error("Should send spans to traces endpoint:", r.URL.Path)
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		requests <- body
+	}))
+	defer server.Close()
+
+	exporter := NewOTLPExporter(server.URL, &OTLPConfig{serviceName: "replay"})
+
+	tc, _ := parseTraceparent([]byte("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"))
+	output := &HTTPOutput{address: "http://staging.com"}
+
+	exporter.Export(output.replaySpan(tc, [8]byte{1}, []byte("GET /users/1?a=b HTTP/1.1\r\n\r\n"), []byte("HTTP/1.1 503 Service Unavailable\r\n\r\n"), nil, time.Unix(1, 0), time.Unix(2, 0)))
+	exporter.Export(output.replaySpan(tc, [8]byte{}, []byte("GET / HTTP/1.1\r\n\r\n"), nil, errors.New("timeout"), time.Unix(1, 0), time.Unix(2, 0)))
+	exporter.Flush()
+
+	var body struct {
+		ResourceSpans []struct {
+			Resource struct {
+				Attributes []map[string]interface{}
+			}
+			ScopeSpans []struct {
+				Spans []map[string]interface{}
+			}
+		}
+	}
+
+	if err := json.Unmarshal(<-requests, &body); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(body.ResourceSpans) != 1 || len(body.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatal("Should send spans in single resource:", body)
+	}
+
+	if service := body.ResourceSpans[0].Resource.Attributes[0]; service["key"] != "service.name" || service["value"].(map[string]interface{})["stringValue"] != "replay" {
+		t.Error("Should set service name:", service)
+	}
+
+	spans := body.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatal("Should send both spans:", spans)
+	}
+
+	span := spans[0]
+	if span["traceId"] != "4bf92f3577b34da6a3ce929d0e0e4736" || span["parentSpanId"] != "0100000000000000" || span["name"] != "GET /users/:id" || span["startTimeUnixNano"] != "1000000000" {
+		t.Error("Should encode span:", span)
+	}
+
+	attributes, _ := json.Marshal(span["attributes"])
+	if string(attributes) != `[{"key":"http.request.method","value":{"stringValue":"GET"}},{"key":"http.response.status_code","value":{"intValue":"503"}},{"key":"url.full","value":{"stringValue":"http://staging.com/users/1?a=b"}}]` {
+		t.Error("Should encode attributes:", string(attributes))
+	}
+
+	if status, _ := span["status"].(map[string]interface{}); status["code"] != float64(2) {
+		t.Error("Server errors should be reported as failed spans:", span["status"])
+	}
+
+	if _, ok := spans[1]["parentSpanId"]; ok || spans[1]["status"].(map[string]interface{})["message"] != "timeout" {
+		t.Error("Should report request error:", spans[1])
+	}
+}
+
+func TestOTLPExporterNil(t *testing.T) {
+	var exporter *OTLPExporter
+
+	// Should not panic
+	exporter.Export(&Span{})
+	exporter.Flush()
+}
+
+func TestPipelineSpans(t *testing.T) {
+	trace, parentID := newTraceContext(), [8]byte{1}
+	captured := time.Now().Add(-30 * time.Millisecond)
+	payload := append(payloadHeader(RequestPayload, []byte("abc"), captured.UnixNano()), "GET / HTTP/1.1\r\n\r\n"...)
+
+	pipeline := newPipelineTrace(trace, parentID, payload, captured.Add(10*time.Millisecond))
+
+	request := &Span{trace: trace, parentID: parentID, name: "GET /", start: pipeline.dequeued, end: pipeline.dequeued.Add(time.Millisecond)}
+	pipeline.emitted = request.end.Add(time.Millisecond)
+
+	spans := pipeline.spans(request)
+	if len(spans) != 5 {
+		t.Fatal("Should report root, capture, queue, response and request spans:", len(spans))
+	}
+
+	root := spans[0]
+	if root.trace.traceID != trace.traceID || root.parentID != parentID || !root.start.Equal(time.Unix(0, captured.UnixNano())) || !root.end.Equal(pipeline.emitted) {
+		t.Error("Root span should cover whole pipeline:", root)
+	}
+
+	for i, name := range []string{"capture", "queue", "response", "GET /"} {
+		if s := spans[i+1]; s.name != name || s.parentID != root.trace.spanID || s.trace.traceID != trace.traceID || s.end.Before(s.start) {
+			t.Error("Wrong stage span:", i, s)
+		}
+	}
+
+	// Replayed from file, capture stage unknown
+	old := append(payloadHeader(RequestPayload, []byte("abc"), 1), "GET / HTTP/1.1\r\n\r\n"...)
+	if spans := newPipelineTrace(trace, parentID, old, time.Time{}).spans(request); len(spans) != 2 {
+		t.Error("Should report only known stages:", len(spans))
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/buger/gor/proto"
+)
+
+// DiffOutputConfig holds options of response comparison
+type DiffOutputConfig struct {
+	// Headers which should be same in original and replayed responses
+	headers    MultiOption
+	ignoreBody bool
+}
+
+// DiffReport describes mismatch between original and replayed responses, written as single JSON line
+type DiffReport struct {
+	ID      string               `json:"id"`
+	Request string               `json:"request"`
+	Status  []string             `json:"status,omitempty"`
+	Headers map[string][2]string `json:"headers,omitempty"`
+	Body    *BodyDiff            `json:"body,omitempty"`
+}
+
+// BodyDiff holds length of original and replayed bodies, and offset of first different byte
+type BodyDiff struct {
+	Length [2]int `json:"length"`
+	Offset int    `json:"offset"`
+}
+
+// DiffOutput compares responses captured from origin with responses of replayed server, and reports mismatches.
+// Requires both `--input-raw-track-response` and `--output-http-track-response`.
+type DiffOutput struct {
+	sync.Mutex
+
+	path   string
+	config *DiffOutputConfig
+	writer io.Writer
+
+	matcher *responseMatcher
+}
+
+// NewDiffOutput constructor for DiffOutput. Reports written to file at given path, or to stdout if path is "-"
+func NewDiffOutput(path string, config *DiffOutputConfig) *DiffOutput {
+	o := new(DiffOutput)
+	o.path = path
+	o.config = config
+	o.matcher = newResponseMatcher()
+
+	var err error
+	if o.writer, err = openReport(path); err != nil {
+		log.Fatal("[DIFF] Can't open report file: ", err)
+	}
+
+	return o
+}
+
+func (o *DiffOutput) Write(data []byte) (int, error) {
+	o.Lock()
+	defer o.Unlock()
+
+	if record := o.matcher.add(data); record != nil {
+		if report := o.compare(string(payloadID(data)), record); report != nil {
+			o.writeReport(report)
+		}
+	}
+
+	return len(data), nil
+}
+
+// compare returns nil if responses match
+func (o *DiffOutput) compare(id string, record *matchedResponses) *DiffReport {
+	report := &DiffReport{ID: id, Request: requestLine(record.request)}
+	mismatch := false
+
+	original, replayed := proto.Status(record.original), proto.Status(record.replayed)
+	if !bytes.Equal(original, replayed) {
+		report.Status = []string{string(original), string(replayed)}
+		mismatch = true
+	}
+
+	for _, name := range o.config.headers {
+		original, replayed := proto.Header(record.original, []byte(name)), proto.Header(record.replayed, []byte(name))
+
+		if !bytes.Equal(original, replayed) {
+			if report.Headers == nil {
+				report.Headers = make(map[string][2]string)
+			}
+			report.Headers[name] = [2]string{string(original), string(replayed)}
+			mismatch = true
+		}
+	}
+
+	if !o.config.ignoreBody {
+		if diff := diffBodies(responseBody(record.original), responseBody(record.replayed)); diff != nil {
+			report.Body = diff
+			mismatch = true
+		}
+	}
+
+	if !mismatch {
+		return nil
+	}
+
+	return report
+}
+
+func (o *DiffOutput) writeReport(report *DiffReport) {
+	line, _ := json.Marshal(report)
+
+	if _, err := o.writer.Write(append(line, '\n')); err != nil {
+		log.Println("[DIFF] Can't write report:", err)
+	}
+}
+
+func (o *DiffOutput) String() string {
+	return "Diff output: " + o.path
+}
+
+// openReport opens file for appending reports, or returns stdout if path is "-"
+func openReport(path string) (io.Writer, error) {
+	if path == "-" || path == "" {
+		return os.Stdout, nil
+	}
+
+	return os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0660)
+}
+
+func requestLine(payload []byte) string {
+	if end := bytes.IndexByte(payload, '\r'); end != -1 {
+		return string(payload[:end])
+	}
+
+	return ""
+}
+
+func responseBody(payload []byte) []byte {
+	end := proto.MIMEHeadersEndPos(payload)
+	if end == -1 {
+		return nil
+	}
+
+	return payload[end+len(proto.EmptyLine):]
+}
+
+// diffBodies returns nil if bodies are equal
+func diffBodies(original, replayed []byte) *BodyDiff {
+	if bytes.Equal(original, replayed) {
+		return nil
+	}
+
+	offset := 0
+	for offset < len(original) && offset < len(replayed) && original[offset] == replayed[offset] {
+		offset++
+	}
+
+	return &BodyDiff{Length: [2]int{len(original), len(replayed)}, Offset: offset}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestDiffOutput(t *testing.T) {
+	path := "/tmp/gor_test_diff.log"
+	os.Remove(path)
+	defer os.Remove(path)
+
+	output := NewDiffOutput(path, &DiffOutputConfig{headers: MultiOption{"Content-Type"}})
+
+	emit := func(payloadType byte, id []byte, payload string) {
+		output.Write(append(payloadHeader(payloadType, id, 1), payload...))
+	}
+
+	same := uuid()
+	emit(RequestPayload, same, "GET /same HTTP/1.1\r\n\r\n")
+	emit(ResponsePayload, same, "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\n\r\nok")
+	emit(ReplayedResponsePayload, same, "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\n\r\nok")
+
+	different := uuid()
+	emit(RequestPayload, different, "GET /different HTTP/1.1\r\n\r\n")
+	emit(ReplayedResponsePayload, different, "HTTP/1.1 500 Internal Server Error\r\nContent-Type: text/html\r\n\r\nerror")
+	emit(ResponsePayload, different, "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\n\r\nok")
+
+	data, _ := ioutil.ReadFile(path)
+	lines := bytes.Split(bytes.TrimSpace(data), []byte("\n"))
+
+	if len(lines) != 1 {
+		t.Fatal("Should report only mismatched responses:", string(data))
+	}
+
+	var report DiffReport
+	json.Unmarshal(lines[0], &report)
+
+	if report.ID != string(different) || report.Request != "GET /different HTTP/1.1" {
+		t.Error("Should report request:", report)
+	}
+
+	if len(report.Status) != 2 || report.Status[0] != "200" || report.Status[1] != "500" {
+		t.Error("Should report status codes:", report.Status)
+	}
+
+	if report.Headers["Content-Type"] != [2]string{"text/plain", "text/html"} {
+		t.Error("Should report headers:", report.Headers)
+	}
+
+	if report.Body == nil || report.Body.Length != [2]int{2, 5} || report.Body.Offset != 0 {
+		t.Error("Should report body difference:", report.Body)
+	}
+
+	if len(output.matcher.pending) != 0 {
+		t.Error("Should remove compared records:", len(output.matcher.pending))
+	}
+}
@@ -1,10 +1,18 @@
 package main
 
 import (
+	"compress/gzip"
 	"encoding/gob"
+	"fmt"
 	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -14,43 +22,372 @@ type RawRequest struct {
 	Request   []byte
 }
 
+// FileOutputConfig holds configuration for file output
+type FileOutputConfig struct {
+	compress bool
+	// Maximum size of file in megabytes, after which new file will be created
+	maxSize int
+	// Interval after which new file will be created, file name includes start time of interval
+	rotateInterval time.Duration
+	// Maximum size of all rotated files in megabytes, oldest files deleted when exceeded
+	maxTotalSize int
+
+	// Called in background each time file is closed, e.g. after rotation. Used by outputs built on top of file output.
+	// Close waits until all calls finish. Empty files are deleted instead.
+	onClose func(path string)
+}
+
+// sizeWriter counts number of bytes written to underlying writer
+type sizeWriter struct {
+	io.Writer
+	size int64
+}
+
+func (w *sizeWriter) Write(data []byte) (n int, err error) {
+	n, err = w.Writer.Write(data)
+	w.size += int64(n)
+
+	return
+}
+
 // FileOutput output plugin
 type FileOutput struct {
+	sync.Mutex
+
 	path    string
 	encoder *gob.Encoder
 	file    *os.File
+	counter *sizeWriter
+	writer  *gzip.Writer
+	config  *FileOutputConfig
+
+	// Index of current file, used only when rotation by size enabled
+	index int
+	// Start of current rotation interval
+	periodStart time.Time
+
+	// Number of payloads written to current file
+	records int
+	// onClose calls running in background
+	closing sync.WaitGroup
+
+	// Rotated files which are closed and handed over, candidates for pruning
+	closedFiles []string
 }
 
+// NewFileOutput constructor for FileOutput, accepts path.
+// If path contains placeholders like `%method%`, requests split into multiple files, see SplitFileOutput.
+func NewFileOutput(path string, config *FileOutputConfig) io.Writer {
+	if isFileTemplate(path) {
+		return NewSplitFileOutput(path, config)
+	}
 
-// NewFileOutput constructor for FileOutput, accepts path
-func NewFileOutput(path string) io.Writer {
 	o := new(FileOutput)
 	o.path = path
-	o.init(path)
+	o.config = config
+
+	if o.config.rotateInterval > 0 {
+		o.periodStart = time.Now().Truncate(o.config.rotateInterval)
+	}
+
+	if o.config.maxTotalSize > 0 && !o.isRotated() {
+		log.Fatal("[FILE-OUTPUT] Total size limit requires file rotation, set max file size or rotation interval")
+	}
+
+	o.closedFiles = o.previousFiles()
+
+	// Numbering continued after files of previous run, so they are not overwritten
+	if o.config.maxSize > 0 {
+		o.index = o.lastIndex()
+	}
+
+	o.init(o.filename())
+	o.prune()
+
+	if o.isCompressed() {
+		go o.flushLoop()
+	}
 
 	return o
 }
 
+func (o *FileOutput) isCompressed() bool {
+	return o.config.compress || strings.HasSuffix(o.path, ".gz")
+}
+
+func (o *FileOutput) isRotated() bool {
+	return o.config.maxSize > 0 || o.config.rotateInterval > 0
+}
+
+// filename returns name of current file. When rotation by time enabled, interval start time appended to the name,
+// and when rotation by size enabled, file index appended as well:
+// requests.gor -> requests_2015-08-17_14-00-00.gor, requests_2015-08-17_14-00-00_0001.gor and etc.
+func (o *FileOutput) filename() string {
+	if !o.isRotated() {
+		return o.path
+	}
+
+	dir, name, ext := o.splitPath()
+
+	if o.config.rotateInterval > 0 {
+		name += "_" + o.periodStart.Format("2006-01-02_15-04-05")
+	}
+
+	if o.config.maxSize > 0 {
+		name += fmt.Sprintf("_%04d", o.index+1)
+	}
+
+	return dir + name + ext
+}
+
+// splitPath splits path to directory, name and extensions, e.g. "requests.gor.gz" to "", "requests" and ".gor.gz"
+func (o *FileOutput) splitPath() (dir, name, ext string) {
+	dir, name = filepath.Split(o.path)
+
+	if idx := strings.Index(name, "."); idx != -1 {
+		name, ext = name[:idx], name[idx:]
+	}
+
+	return
+}
+
+// previousFiles returns rotated files left by previous runs. Only names produced by filename are matched,
+// so files of other outputs with the same prefix, like requests_api.gor for requests.gor, are not touched.
+func (o *FileOutput) previousFiles() []string {
+	if o.config.maxTotalSize <= 0 || !o.isRotated() {
+		return nil
+	}
+
+	dir, name, ext := o.splitPath()
+
+	pattern := "^" + regexp.QuoteMeta(name)
+	if o.config.rotateInterval > 0 {
+		pattern += `_\d{4}-\d{2}-\d{2}_\d{2}-\d{2}-\d{2}`
+	}
+	if o.config.maxSize > 0 {
+		pattern += `_\d{4,}`
+	}
+	re := regexp.MustCompile(pattern + regexp.QuoteMeta(ext) + "$")
+
+	files, _ := filepath.Glob(dir + name + "_*" + ext)
+
+	var previous []string
+	for _, path := range files {
+		if re.MatchString(filepath.Base(path)) {
+			previous = append(previous, path)
+		}
+	}
+
+	return previous
+}
+
+// lastIndex returns highest index of existing files of current rotation interval, 0 if there are none
+func (o *FileOutput) lastIndex() (last int) {
+	dir, name, ext := o.splitPath()
+
+	if o.config.rotateInterval > 0 {
+		name += "_" + o.periodStart.Format("2006-01-02_15-04-05")
+	}
+
+	re := regexp.MustCompile("^" + regexp.QuoteMeta(name) + `_(\d{4,})` + regexp.QuoteMeta(ext) + "$")
+
+	files, _ := filepath.Glob(dir + name + "_*" + ext)
+
+	for _, path := range files {
+		if m := re.FindStringSubmatch(filepath.Base(path)); m != nil {
+			if index, _ := strconv.Atoi(m[1]); index > last {
+				last = index
+			}
+		}
+	}
+
+	return
+}
+
+// prune deletes oldest closed files, until total size of files is below limit. Current file, and files which are
+// still handed over, e.g. uploaded to S3, are not counted and never deleted.
+func (o *FileOutput) prune() {
+	if o.config.maxTotalSize <= 0 {
+		return
+	}
+
+	var infos []os.FileInfo
+	var paths []string
+	var total int64
+
+	for _, path := range o.closedFiles {
+		if info, err := os.Stat(path); err == nil {
+			infos = append(infos, info)
+			paths = append(paths, path)
+			total += info.Size()
+		}
+	}
+
+	// Oldest files first
+	sort.Sort(byModTime{paths, infos})
+
+	limit := int64(o.config.maxTotalSize) * 1024 * 1024
+
+	idx := 0
+	for ; idx < len(paths) && total > limit; idx++ {
+		if err := os.Remove(paths[idx]); err != nil {
+			log.Println("[FILE-OUTPUT] Can't delete old file:", err)
+			continue
+		}
+
+		Debug("[FILE-OUTPUT] Deleted old file to fit total size limit:", paths[idx])
+		total -= infos[idx].Size()
+	}
+
+	// Deleted files, and files removed by others, are not tracked anymore
+	o.closedFiles = paths[idx:]
+}
+
+// byModTime sorts paths by modification time of files, and by name if it is the same
+type byModTime struct {
+	paths []string
+	infos []os.FileInfo
+}
+
+func (s byModTime) Len() int { return len(s.paths) }
+func (s byModTime) Swap(i, j int) {
+	s.paths[i], s.paths[j] = s.paths[j], s.paths[i]
+	s.infos[i], s.infos[j] = s.infos[j], s.infos[i]
+}
+func (s byModTime) Less(i, j int) bool {
+	if ti, tj := s.infos[i].ModTime(), s.infos[j].ModTime(); !ti.Equal(tj) {
+		return ti.Before(tj)
+	}
+
+	return s.paths[i] < s.paths[j]
+}
+
 func (o *FileOutput) init(path string) {
 	var err error
 
+	// File of previous run can be reopened when rotation interval not changed, it is current file now, not closed one
+	for i, closed := range o.closedFiles {
+		if closed == path {
+			o.closedFiles = append(o.closedFiles[:i], o.closedFiles[i+1:]...)
+			break
+		}
+	}
+
 	o.file, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0660)
 
 	if err != nil {
 		log.Fatal(o, "Cannot open file %q. Error: %s", path, err)
 	}
 
-	o.encoder = gob.NewEncoder(o.file)
+	o.counter = &sizeWriter{Writer: o.file}
+
+	if o.isCompressed() {
+		o.writer = gzip.NewWriter(o.counter)
+		o.encoder = gob.NewEncoder(o.writer)
+	} else {
+		o.encoder = gob.NewEncoder(o.counter)
+	}
 }
 
 func (o *FileOutput) Write(data []byte) (n int, err error) {
 	raw := RawRequest{time.Now().UnixNano(), data}
 
+	o.Lock()
+	defer o.Unlock()
+
+	if o.config.rotateInterval > 0 {
+		if period := time.Now().Truncate(o.config.rotateInterval); period != o.periodStart {
+			o.periodStart = period
+			o.index = 0
+			if o.config.maxSize > 0 {
+				o.index = o.lastIndex()
+			}
+			o.rotate()
+		}
+	}
+
 	o.encoder.Encode(raw)
+	o.records++
+
+	if o.config.maxSize > 0 && o.counter.size >= int64(o.config.maxSize)*1024*1024 {
+		o.index++
+		o.rotate()
+	}
 
 	return len(data), nil
 }
 
+// rotate closes current file and opens next one. Should be called with lock held.
+func (o *FileOutput) rotate() {
+	o.close()
+	o.init(o.filename())
+	o.prune()
+
+	Debug("[FILE-OUTPUT] Rotated to", o.file.Name())
+}
+
+// Gzip writer buffers data, so it should be periodically flushed to not lose data on crash
+func (o *FileOutput) flushLoop() {
+	for {
+		time.Sleep(time.Second)
+
+		o.Lock()
+		if o.file == nil {
+			o.Unlock()
+			return
+		}
+		o.writer.Flush()
+		o.Unlock()
+	}
+}
+
+func (o *FileOutput) close() (err error) {
+	if o.file == nil {
+		return
+	}
+
+	if o.writer != nil {
+		o.writer.Close()
+	}
+
+	name := o.file.Name()
+	err = o.file.Close()
+	o.file = nil
+
+	if o.config.onClose != nil {
+		if o.records == 0 {
+			os.Remove(name)
+		} else {
+			o.closing.Add(1)
+			go func() {
+				defer o.closing.Done()
+				o.config.onClose(name)
+
+				o.Lock()
+				o.closedFiles = append(o.closedFiles, name)
+				o.Unlock()
+			}()
+		}
+	} else if o.isRotated() {
+		o.closedFiles = append(o.closedFiles, name)
+	}
+
+	o.records = 0
+
+	return
+}
+
+// Close flushes buffered data and closes file, and waits until closed files handed over, e.g. uploaded to S3
+func (o *FileOutput) Close() error {
+	o.Lock()
+	err := o.close()
+	o.Unlock()
+
+	o.closing.Wait()
+
+	return err
+}
+
 func (o *FileOutput) String() string {
 	return "File output: " + o.path
 }
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/buger/gor/proto"
+)
+
+// Placeholders of output file name, replaced with request attributes
+const (
+	fileTemplateMethod = "%method%"
+	// First segment of request path
+	fileTemplatePath = "%path%"
+)
+
+// Requests with new attribute values written to "other" file when this number of files reached,
+// so arbitrary paths do not create unlimited number of files
+const maxSplitFiles = 100
+
+// isFileTemplate returns true if output file name contains placeholders
+func isFileTemplate(path string) bool {
+	return strings.Contains(path, fileTemplateMethod) || strings.Contains(path, fileTemplatePath)
+}
+
+// SplitFileOutput writes requests into separate files, name of file rendered from template using request attributes:
+// requests_%method%.gor -> requests_GET.gor, requests_POST.gor and etc.
+// Responses written to the same file as their requests.
+type SplitFileOutput struct {
+	sync.Mutex
+
+	path   string
+	config *FileOutputConfig
+
+	outputs map[string]*FileOutput
+
+	// Files of requests waiting for responses, by payload id
+	pending   map[string]string
+	times     map[string]time.Time
+	lastClean time.Time
+}
+
+// NewSplitFileOutput constructor for SplitFileOutput, accepts path template
+func NewSplitFileOutput(path string, config *FileOutputConfig) *SplitFileOutput {
+	return &SplitFileOutput{
+		path:      path,
+		config:    config,
+		outputs:   make(map[string]*FileOutput),
+		pending:   make(map[string]string),
+		times:     make(map[string]time.Time),
+		lastClean: time.Now(),
+	}
+}
+
+func (o *SplitFileOutput) Write(data []byte) (int, error) {
+	o.Lock()
+	defer o.Unlock()
+
+	var path string
+
+	if isRequestPayload(data) {
+		path = o.render(requestAttributes(payloadBody(data)))
+
+		if id := payloadID(data); len(id) > 0 {
+			o.pending[string(id)] = path
+			o.times[string(id)] = time.Now()
+		}
+	} else {
+		id := string(payloadID(data))
+
+		var ok bool
+		if path, ok = o.pending[id]; ok {
+			// Both original and replayed responses can be written, so request is kept until cleanup
+			o.times[id] = time.Now()
+		} else {
+			path = o.render("unknown", "unknown")
+		}
+	}
+
+	o.clean()
+
+	output, ok := o.outputs[path]
+	if !ok {
+		if len(o.outputs) >= maxSplitFiles {
+			path = o.render("other", "other")
+			output = o.outputs[path]
+		}
+
+		if output == nil {
+			output = NewFileOutput(path, o.config).(*FileOutput)
+			o.outputs[path] = output
+		}
+	}
+
+	return output.Write(data)
+}
+
+// render returns file name for given attributes, values sanitized so they can't change directory
+func (o *SplitFileOutput) render(method, path string) string {
+	return strings.NewReplacer(fileTemplateMethod, sanitizeFileName(method), fileTemplatePath, sanitizeFileName(path)).Replace(o.path)
+}
+
+// Responses for some requests can be lost, so periodically remove stale ids
+func (o *SplitFileOutput) clean() {
+	if time.Since(o.lastClean) < time.Minute {
+		return
+	}
+
+	for id, t := range o.times {
+		if time.Since(t) > time.Minute {
+			delete(o.pending, id)
+			delete(o.times, id)
+		}
+	}
+
+	o.lastClean = time.Now()
+}
+
+// Close closes all files
+func (o *SplitFileOutput) Close() error {
+	o.Lock()
+	defer o.Unlock()
+
+	for _, output := range o.outputs {
+		output.Close()
+	}
+
+	return nil
+}
+
+func (o *SplitFileOutput) String() string {
+	return "File output: " + o.path
+}
+
+// requestAttributes returns method and first segment of request path, "root" for requests to "/".
+// Payloads which are not HTTP requests, e.g. captured using `tcp-raw` protocol, get "unknown" values.
+func requestAttributes(request []byte) (method, segment string) {
+	lineEnd := bytes.IndexByte(request, '\n')
+	if lineEnd == -1 || bytes.Count(request[:lineEnd], []byte(" ")) < 2 {
+		return "unknown", "unknown"
+	}
+
+	path := proto.Path(request)
+
+	if i := bytes.IndexAny(path, "?#"); i != -1 {
+		path = path[:i]
+	}
+
+	segments := bytes.SplitN(bytes.TrimPrefix(path, []byte("/")), []byte("/"), 2)
+	if len(segments[0]) == 0 {
+		return string(proto.Method(request)), "root"
+	}
+
+	return string(proto.Method(request)), string(segments[0])
+}
+
+// sanitizeFileName replaces all characters except letters, digits, '-' and '_' with '_'
+func sanitizeFileName(value string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-' || r == '_' {
+			return r
+		}
+
+		return '_'
+	}, value)
+}
@@ -1,9 +1,13 @@
 package main
 
 import (
+	"encoding/gob"
 	"io"
+	"os"
+	"path/filepath"
 	"sync"
 	"testing"
+	"time"
 )
 
 func TestFileOutput(t *testing.T) {
@@ -11,7 +15,7 @@ func TestFileOutput(t *testing.T) {
 	quit := make(chan int)
 
 	input := NewTestInput()
-	output := NewFileOutput("/tmp/test_requests.gor")
+	output := NewFileOutput("/tmp/test_requests.gor", &FileOutputConfig{})
 
 	Plugins.Inputs = []io.Reader{input}
 	Plugins.Outputs = []io.Writer{output}
@@ -27,7 +31,7 @@ func TestFileOutput(t *testing.T) {
 
 	quit = make(chan int)
 
-	input2 := NewFileInput("/tmp/test_requests.gor")
+	input2 := NewFileInput("/tmp/test_requests.gor", &FileInputConfig{})
 	output2 := NewTestOutput(func(data []byte) {
 		wg.Done()
 	})
@@ -40,3 +44,553 @@ func TestFileOutput(t *testing.T) {
 	wg.Wait()
 	close(quit)
 }
+
+func TestFileOutputCompression(t *testing.T) {
+	wg := new(sync.WaitGroup)
+	quit := make(chan int)
+
+	output := NewFileOutput("/tmp/test_requests.gor.gz", &FileOutputConfig{})
+
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		output.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+	}
+
+	output.(*FileOutput).Close()
+
+	input := NewFileInput("/tmp/test_requests.gor.gz", &FileInputConfig{})
+	output2 := NewTestOutput(func(data []byte) {
+		wg.Done()
+	})
+
+	Plugins.Inputs = []io.Reader{input}
+	Plugins.Outputs = []io.Writer{output2}
+
+	go Start(quit)
+
+	wg.Wait()
+	close(quit)
+}
+
+func TestFileOutputMaxSize(t *testing.T) {
+	os.Remove("/tmp/test_rotation_0001.gor")
+	os.Remove("/tmp/test_rotation_0002.gor")
+
+	output := NewFileOutput("/tmp/test_rotation.gor", &FileOutputConfig{maxSize: 1})
+
+	// Each request is 100kb, so 1mb file should be rotated after 11 requests
+	payload := make([]byte, 100*1024)
+	for i := 0; i < 15; i++ {
+		output.Write(payload)
+	}
+
+	output.(*FileOutput).Close()
+
+	if _, err := os.Stat("/tmp/test_rotation_0001.gor"); err != nil {
+		t.Error("Should create first file", err)
+	}
+
+	if _, err := os.Stat("/tmp/test_rotation_0002.gor"); err != nil {
+		t.Error("Should rotate file", err)
+	}
+}
+
+func TestFileOutputMaxTotalSize(t *testing.T) {
+	files, _ := filepath.Glob("/tmp/test_total_*.gor")
+	for _, f := range files {
+		os.Remove(f)
+	}
+
+	// Files of other output with same prefix, and of previous run
+	other, _ := os.Create("/tmp/test_total_api_0001.gor")
+	other.Write(make([]byte, 3*1024*1024))
+	other.Close()
+	defer os.Remove("/tmp/test_total_api_0001.gor")
+
+	previous, _ := os.Create("/tmp/test_total_0009.gor")
+	previous.Close()
+	os.Chtimes("/tmp/test_total_0009.gor", time.Now().Add(-time.Hour), time.Now().Add(-time.Hour))
+
+	output := NewFileOutput("/tmp/test_total.gor", &FileOutputConfig{maxSize: 1, maxTotalSize: 2})
+
+	// Each file holds 11 requests of 100kb, so 50 requests create 5 files
+	payload := make([]byte, 100*1024)
+	for i := 0; i < 50; i++ {
+		output.Write(payload)
+	}
+
+	output.(*FileOutput).Close()
+
+	files, _ = filepath.Glob("/tmp/test_total_[0-9]*.gor")
+	defer func() {
+		for _, f := range files {
+			os.Remove(f)
+		}
+	}()
+
+	// Numbering continues after file of previous run
+	if len(files) != 2 || files[0] != "/tmp/test_total_0013.gor" || files[1] != "/tmp/test_total_0014.gor" {
+		t.Error("Should delete oldest files:", files)
+	}
+
+	if _, err := os.Stat("/tmp/test_total_api_0001.gor"); err != nil {
+		t.Error("Should not delete files of other outputs:", err)
+	}
+}
+
+func TestFileOutputRestart(t *testing.T) {
+	files, _ := filepath.Glob("/tmp/test_restart_*.gor")
+	for _, f := range files {
+		os.Remove(f)
+	}
+	defer func() {
+		files, _ := filepath.Glob("/tmp/test_restart_*.gor")
+		for _, f := range files {
+			os.Remove(f)
+		}
+	}()
+
+	config := &FileOutputConfig{maxSize: 1, maxTotalSize: 10}
+	payload := make([]byte, 100*1024)
+
+	output := NewFileOutput("/tmp/test_restart.gor", config).(*FileOutput)
+	for i := 0; i < 15; i++ {
+		output.Write(payload)
+	}
+	output.Close()
+
+	first, _ := os.Stat("/tmp/test_restart_0001.gor")
+
+	// Second run continues numbering, instead of truncating files of the first one
+	output = NewFileOutput("/tmp/test_restart.gor", config).(*FileOutput)
+	defer output.Close()
+
+	if name := output.file.Name(); name != "/tmp/test_restart_0003.gor" {
+		t.Error("Should open file after files of previous run:", name)
+	}
+
+	if info, err := os.Stat("/tmp/test_restart_0001.gor"); err != nil || info.Size() != first.Size() {
+		t.Error("Should not truncate file of previous run:", err)
+	}
+
+	for i := 0; i < 15; i++ {
+		output.Write(payload)
+	}
+
+	tracked := make(map[string]bool)
+	for _, path := range output.closedFiles {
+		if tracked[path] || path == output.file.Name() {
+			t.Error("File tracked twice, or current file tracked as closed:", path)
+		}
+		tracked[path] = true
+	}
+
+	if len(tracked) != 3 {
+		t.Error("Should track closed files of both runs:", output.closedFiles)
+	}
+}
+
+func TestFileOutputOnClose(t *testing.T) {
+	files, _ := filepath.Glob("/tmp/test_on_close_*.gor")
+	for _, f := range files {
+		os.Remove(f)
+	}
+
+	var mu sync.Mutex
+	var closed []string
+
+	output := NewFileOutput("/tmp/test_on_close.gor", &FileOutputConfig{maxSize: 1, onClose: func(path string) {
+		// Slow upload
+		time.Sleep(50 * time.Millisecond)
+
+		mu.Lock()
+		closed = append(closed, path)
+		mu.Unlock()
+
+		os.Remove(path)
+	}})
+
+	// Second file filled exactly, so third one is empty on close
+	payload := make([]byte, 512*1024)
+	for i := 0; i < 4; i++ {
+		output.Write(payload)
+	}
+
+	output.(*FileOutput).Close()
+
+	if len(closed) != 2 {
+		t.Error("Should wait for closed files handed over:", closed)
+	}
+
+	if files, _ := filepath.Glob("/tmp/test_on_close_*.gor"); len(files) != 0 {
+		t.Error("Should delete empty file:", files)
+	}
+}
+
+func TestFileOutputSplit(t *testing.T) {
+	output := NewFileOutput("/tmp/test_split_%method%_%path%.gor", &FileOutputConfig{})
+
+	output.Write([]byte("1 1 1\nGET / HTTP/1.1\r\n\r\n"))
+	output.Write([]byte("1 2 1\nPOST /api/users?id=1 HTTP/1.1\r\n\r\n"))
+	output.Write([]byte("2 2 1\nHTTP/1.1 200 OK\r\n\r\n"))
+	output.Write([]byte("1 3 1\nbinary"))
+
+	output.(*SplitFileOutput).Close()
+
+	files, _ := filepath.Glob("/tmp/test_split_*.gor")
+	defer func() {
+		for _, f := range files {
+			os.Remove(f)
+		}
+	}()
+
+	expected := []string{"/tmp/test_split_GET_root.gor", "/tmp/test_split_POST_api.gor", "/tmp/test_split_unknown_unknown.gor"}
+	if len(files) != len(expected) {
+		t.Fatal("Should write file per method and path:", files)
+	}
+
+	for i, f := range expected {
+		if files[i] != f {
+			t.Error("Should write file per method and path:", files)
+		}
+	}
+}
+
+func TestFileOutputRotateInterval(t *testing.T) {
+	files, _ := filepath.Glob("/tmp/test_interval_*.gor")
+	for _, f := range files {
+		os.Remove(f)
+	}
+
+	output := NewFileOutput("/tmp/test_interval.gor", &FileOutputConfig{rotateInterval: time.Second})
+
+	output.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+	time.Sleep(time.Second)
+	output.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+
+	output.(*FileOutput).Close()
+
+	files, _ = filepath.Glob("/tmp/test_interval_*.gor")
+	if len(files) != 2 {
+		t.Error("Should create file for each interval", files)
+	}
+}
+
+func TestFileInputLoop(t *testing.T) {
+	wg := new(sync.WaitGroup)
+	quit := make(chan int)
+
+	output := NewFileOutput("/tmp/test_loop.gor", &FileOutputConfig{})
+
+	for i := 0; i < 10; i++ {
+		output.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+	}
+
+	output.(*FileOutput).Close()
+
+	// Replay file 3 times
+	wg.Add(30)
+
+	input := NewFileInput("/tmp/test_loop.gor", &FileInputConfig{loop: 3})
+	output2 := NewTestOutput(func(data []byte) {
+		wg.Done()
+	})
+
+	Plugins.Inputs = []io.Reader{input}
+	Plugins.Outputs = []io.Writer{output2}
+
+	go Start(quit)
+
+	wg.Wait()
+	close(quit)
+}
+
+func TestFileInputLoopEmpty(t *testing.T) {
+	path := "/tmp/test_loop_empty.gor"
+	file, _ := os.Create(path)
+	file.Close()
+	defer os.Remove(path)
+
+	input := &FileInput{data: make(chan []byte), path: path, files: []string{path}, speedFactor: 1, config: &FileInputConfig{loop: -1}}
+	input.rewind()
+
+	done := make(chan bool)
+	go func() {
+		input.emit()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("Should stop looping file without requests")
+	}
+}
+
+func TestFileInputGlob(t *testing.T) {
+	wg := new(sync.WaitGroup)
+	quit := make(chan int)
+
+	files, _ := filepath.Glob("/tmp/test_glob_*.gor")
+	for _, f := range files {
+		os.Remove(f)
+	}
+
+	output := NewFileOutput("/tmp/test_glob.gor", &FileOutputConfig{maxSize: 1})
+
+	// Each request is 100kb, so it should create 2 files
+	payload := make([]byte, 100*1024)
+	for i := 0; i < 15; i++ {
+		wg.Add(1)
+		output.Write(payload)
+	}
+
+	output.(*FileOutput).Close()
+
+	input := NewFileInput("/tmp/test_glob_*.gor", &FileInputConfig{})
+	output2 := NewTestOutput(func(data []byte) {
+		wg.Done()
+	})
+
+	if len(input.files) != 2 {
+		t.Error("Should match 2 files", input.files)
+	}
+
+	Plugins.Inputs = []io.Reader{input}
+	Plugins.Outputs = []io.Writer{output2}
+
+	go Start(quit)
+
+	wg.Wait()
+	close(quit)
+}
+
+func TestFileInputTimeWindow(t *testing.T) {
+	wg := new(sync.WaitGroup)
+	quit := make(chan int)
+
+	path := "/tmp/test_window.gor"
+	defer os.Remove(path)
+
+	file, _ := os.Create(path)
+	encoder := gob.NewEncoder(file)
+
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.Local)
+	for _, offset := range []time.Duration{-time.Second, 0, 10 * time.Millisecond, time.Hour} {
+		encoder.Encode(RawRequest{start.Add(offset).UnixNano(), []byte("GET /" + offset.String() + " HTTP/1.1\r\n\r\n")})
+	}
+	file.Close()
+
+	input := NewFileInput(path+"|from=2024-05-01T10:00,to=2024-05-01T11:00", &FileInputConfig{})
+
+	if input.path != path {
+		t.Error("Should remove options from path:", input.path)
+	}
+
+	var requests []string
+	output := NewTestOutput(func(data []byte) {
+		requests = append(requests, string(data))
+		wg.Done()
+	})
+
+	Plugins.Inputs = []io.Reader{input}
+	Plugins.Outputs = []io.Writer{output}
+
+	wg.Add(2)
+	go Start(quit)
+
+	wg.Wait()
+	close(quit)
+
+	if requests[0] != "GET /0s HTTP/1.1\r\n\r\n" || requests[1] != "GET /10ms HTTP/1.1\r\n\r\n" {
+		t.Error("Should replay only requests recorded within time window:", requests)
+	}
+}
+
+func TestFileInputStartAt(t *testing.T) {
+	wg := new(sync.WaitGroup)
+	quit := make(chan int)
+
+	path := "/tmp/test_start_at.gor"
+	defer os.Remove(path)
+
+	file, _ := os.Create(path)
+	encoder := gob.NewEncoder(file)
+
+	recorded := time.Date(2024, 5, 1, 10, 0, 0, 0, time.Local)
+	for _, offset := range []time.Duration{0, 50 * time.Millisecond} {
+		encoder.Encode(RawRequest{recorded.Add(offset).UnixNano(), []byte("GET / HTTP/1.1\r\n\r\n")})
+	}
+	file.Close()
+
+	start := time.Now().Add(100 * time.Millisecond)
+	input := NewFileInput(path, &FileInputConfig{startAt: start.Format(time.RFC3339Nano)})
+
+	var received []time.Time
+	output := NewTestOutput(func(data []byte) {
+		received = append(received, time.Now())
+		wg.Done()
+	})
+
+	Plugins.Inputs = []io.Reader{input}
+	Plugins.Outputs = []io.Writer{output}
+
+	wg.Add(2)
+	go Start(quit)
+
+	wg.Wait()
+	close(quit)
+
+	if received[0].Before(start) || received[1].Before(start.Add(50*time.Millisecond)) || received[1].After(start.Add(time.Second)) {
+		t.Error("Should emit requests at original offset from start time:", start, received)
+	}
+}
+
+func TestFileInputMerge(t *testing.T) {
+	wg := new(sync.WaitGroup)
+	quit := make(chan int)
+
+	start := time.Now()
+	for host, offsets := range map[string][]int{"a": {0, 3}, "b": {1, 2, 4}} {
+		path := "/tmp/test_merge_" + host + ".gor"
+		defer os.Remove(path)
+
+		file, _ := os.Create(path)
+		encoder := gob.NewEncoder(file)
+
+		for _, offset := range offsets {
+			encoder.Encode(RawRequest{start.Add(time.Duration(offset) * time.Millisecond).UnixNano(), []byte{byte('0' + offset)}})
+		}
+		file.Close()
+	}
+
+	input := NewFileInput("/tmp/test_merge_*.gor", &FileInputConfig{merge: true})
+
+	var order []byte
+	output := NewTestOutput(func(data []byte) {
+		order = append(order, data...)
+		wg.Done()
+	})
+
+	Plugins.Inputs = []io.Reader{input}
+	Plugins.Outputs = []io.Writer{output}
+
+	wg.Add(5)
+	go Start(quit)
+
+	wg.Wait()
+	close(quit)
+
+	if string(order) != "01234" {
+		t.Error("Should replay requests of all files ordered by time:", string(order))
+	}
+}
+
+// writeHourlyRequests writes requests recorded one hour apart, so replay with recorded pacing would not finish
+func writeHourlyRequests(path string, count int) {
+	file, _ := os.Create(path)
+	encoder := gob.NewEncoder(file)
+
+	recorded := time.Date(2024, 5, 1, 10, 0, 0, 0, time.Local)
+	for i := 0; i < count; i++ {
+		encoder.Encode(RawRequest{recorded.Add(time.Duration(i) * time.Hour).UnixNano(), []byte("GET / HTTP/1.1\r\n\r\n")})
+	}
+	file.Close()
+}
+
+func TestFileInputRate(t *testing.T) {
+	wg := new(sync.WaitGroup)
+	quit := make(chan int)
+
+	path := "/tmp/test_rate.gor"
+	defer os.Remove(path)
+	writeHourlyRequests(path, 11)
+
+	input := NewFileInput(path, &FileInputConfig{rate: 100})
+
+	output := NewTestOutput(func(data []byte) {
+		wg.Done()
+	})
+
+	Plugins.Inputs = []io.Reader{input}
+	Plugins.Outputs = []io.Writer{output}
+
+	start := time.Now()
+
+	wg.Add(11)
+	go Start(quit)
+
+	wg.Wait()
+	close(quit)
+
+	// First request emitted at once, rest spaced by 10ms
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond || elapsed > time.Second {
+		t.Error("Should emit requests at fixed rate:", elapsed)
+	}
+}
+
+// slowOutput completes each request after delay, and reports requests in flight
+type slowOutput struct {
+	mu          sync.Mutex
+	pending     int64
+	maxPending  int64
+	delay       time.Duration
+	onCompleted func()
+}
+
+func (o *slowOutput) Write(data []byte) (int, error) {
+	o.mu.Lock()
+	if o.pending++; o.pending > o.maxPending {
+		o.maxPending = o.pending
+	}
+	o.mu.Unlock()
+
+	time.AfterFunc(o.delay, func() {
+		o.mu.Lock()
+		o.pending--
+		o.mu.Unlock()
+
+		o.onCompleted()
+	})
+
+	return len(data), nil
+}
+
+func (o *slowOutput) Pending() int64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return o.pending
+}
+
+func TestFileInputClosedWorkload(t *testing.T) {
+	wg := new(sync.WaitGroup)
+	quit := make(chan int)
+
+	path := "/tmp/test_closed.gor"
+	defer os.Remove(path)
+	writeHourlyRequests(path, 8)
+
+	input := NewFileInput(path, &FileInputConfig{workload: workloadClosed, concurrency: 2})
+	output := &slowOutput{delay: 20 * time.Millisecond, onCompleted: wg.Done}
+
+	Plugins.Inputs = []io.Reader{input}
+	Plugins.Outputs = []io.Writer{output}
+
+	start := time.Now()
+
+	wg.Add(8)
+	go Start(quit)
+
+	wg.Wait()
+	close(quit)
+
+	// Request handed to emitter can be not yet written to output, so one more request can be in flight
+	if output.maxPending > 3 {
+		t.Error("Should keep limited number of requests in flight:", output.maxPending)
+	}
+
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond || elapsed > time.Second {
+		t.Error("Should emit next request when previous completed:", elapsed)
+	}
+}
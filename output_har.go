@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Requests without captured response are written after this period
+const harResponseTimeout = 5 * time.Second
+
+// Closing brackets of HAR file, overwritten by each new entry
+const harTrailer = "\n]}}\n"
+
+type harRequest struct {
+	request     []byte
+	requestTime int64
+	created     time.Time
+}
+
+// HAROutput writes requests and original responses as HTTP Archive file, which can be opened in browser devtools.
+// Responses included if captured with `--input-raw-track-response`.
+//
+// File is valid JSON after each write: entries are written in place of closing brackets, which are written again after entry.
+type HAROutput struct {
+	sync.Mutex
+
+	path string
+	file *os.File
+	// Position of closing brackets, where next entry is written
+	offset  int64
+	entries int
+
+	// Requests waiting for response, by payload id
+	pending map[string]*harRequest
+}
+
+// NewHAROutput constructor for HAROutput, accepts path of HAR file
+func NewHAROutput(path string) *HAROutput {
+	o := new(HAROutput)
+	o.path = path
+	o.pending = make(map[string]*harRequest)
+
+	var err error
+	if o.file, err = os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0660); err != nil {
+		log.Fatal("[HAR] Can't open file: ", err)
+	}
+
+	creator, _ := json.Marshal(HARCreator{Name: "Gor", Version: VERSION})
+	header := fmt.Sprintf(`{"log":{"version":"1.2","creator":%s,"entries":[`, creator)
+
+	if _, err = o.file.WriteString(header + harTrailer); err != nil {
+		log.Fatal("[HAR] Can't write file: ", err)
+	}
+	o.offset = int64(len(header))
+
+	go o.flushLoop()
+
+	return o
+}
+
+func (o *HAROutput) Write(data []byte) (int, error) {
+	o.Lock()
+	defer o.Unlock()
+
+	meta := payloadMeta(data)
+	body := payloadBody(data)
+
+	// Payloads without id can't be matched with response
+	if len(meta) < 3 {
+		o.writeEntry(body, nil, time.Now().UnixNano(), 0)
+		return len(data), nil
+	}
+
+	id := string(meta[1])
+	timestamp, _ := strconv.ParseInt(string(meta[2]), 10, 64)
+
+	switch data[0] {
+	case RequestPayload:
+		// Emitter reuses buffer, so data should be copied
+		o.pending[id] = &harRequest{
+			request:     append([]byte{}, body...),
+			requestTime: timestamp,
+			created:     time.Now(),
+		}
+	case ResponsePayload:
+		if r, ok := o.pending[id]; ok {
+			delete(o.pending, id)
+			o.writeEntry(r.request, body, r.requestTime, timestamp)
+		}
+	}
+
+	return len(data), nil
+}
+
+// writeEntry appends entry to the file. Should be called with lock held.
+func (o *HAROutput) writeEntry(request, response []byte, requestTime, responseTime int64) {
+	entry, err := newHAREntry(request, response, requestTime, responseTime)
+	if err != nil {
+		Debug("[HAR] Can't parse request:", err)
+		return
+	}
+
+	data, _ := json.Marshal(entry)
+
+	if o.entries > 0 {
+		data = append([]byte(",\n"), data...)
+	} else {
+		data = append([]byte("\n"), data...)
+	}
+
+	if _, err := o.file.WriteAt(append(data, harTrailer...), o.offset); err != nil {
+		log.Println("[HAR] Can't write entry:", err)
+		return
+	}
+
+	o.offset += int64(len(data))
+	o.entries++
+}
+
+// flushLoop writes requests which did not get response in time
+func (o *HAROutput) flushLoop() {
+	for range time.Tick(time.Second) {
+		o.Lock()
+		if o.file == nil {
+			o.Unlock()
+			return
+		}
+		o.flush(harResponseTimeout)
+		o.Unlock()
+	}
+}
+
+// flush writes requests waiting for response longer than timeout. Should be called with lock held.
+func (o *HAROutput) flush(timeout time.Duration) {
+	for id, r := range o.pending {
+		if time.Since(r.created) >= timeout {
+			delete(o.pending, id)
+			o.writeEntry(r.request, nil, r.requestTime, 0)
+		}
+	}
+}
+
+// Close writes requests still waiting for response, and closes file
+func (o *HAROutput) Close() error {
+	o.Lock()
+	defer o.Unlock()
+
+	if o.file == nil {
+		return nil
+	}
+
+	o.flush(0)
+
+	err := o.file.Close()
+	o.file = nil
+
+	return err
+}
+
+func (o *HAROutput) String() string {
+	return "HAR output: " + o.path
+}
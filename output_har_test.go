@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestHAROutput(t *testing.T) {
+	path := "/tmp/gor_test.har"
+	defer os.Remove(path)
+
+	output := NewHAROutput(path)
+
+	readHAR := func() (har HAR) {
+		data, _ := ioutil.ReadFile(path)
+		if err := json.Unmarshal(data, &har); err != nil {
+			t.Fatal("File should be valid JSON:", err, string(data))
+		}
+		return
+	}
+
+	if har := readHAR(); har.Log.Version != "1.2" || har.Log.Creator.Name != "Gor" || len(har.Log.Entries) != 0 {
+		t.Error("Should write empty archive:", har.Log)
+	}
+
+	start := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC).UnixNano()
+	id := uuid()
+
+	output.Write(append(payloadHeader(RequestPayload, id, start), "POST /login?next=%2F HTTP/1.1\r\nHost: example.com\r\nCookie: a=1\r\nContent-Length: 5\r\n\r\nuser="...))
+	output.Write(append(payloadHeader(ReplayedResponsePayload, id, 1), "HTTP/1.1 500 Internal Server Error\r\nContent-Length: 0\r\n\r\n"...))
+	output.Write(append(payloadHeader(ResponsePayload, id, start+int64(25*time.Millisecond)), "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nTransfer-Encoding: chunked\r\n\r\n2\r\nok\r\n0\r\n\r\n"...))
+
+	output.Write(append(payloadHeader(RequestPayload, uuid(), start), "GET /pending HTTP/1.1\r\nHost: example.com\r\n\r\n"...))
+
+	har := readHAR()
+	if len(har.Log.Entries) != 1 {
+		t.Fatal("Should write request with response:", len(har.Log.Entries))
+	}
+
+	entry := har.Log.Entries[0]
+
+	if entry.Request.Method != "POST" || entry.Request.URL != "http://example.com/login?next=%2F" || entry.Request.PostData.Text != "user=" {
+		t.Error("Should write request:", entry.Request)
+	}
+
+	if len(entry.Request.QueryString) != 1 || entry.Request.QueryString[0] != (HARNameValue{"next", "/"}) {
+		t.Error("Should write query params:", entry.Request.QueryString)
+	}
+
+	if len(entry.Request.Cookies) != 1 || entry.Request.Cookies[0] != (HARNameValue{"a", "1"}) {
+		t.Error("Should write cookies:", entry.Request.Cookies)
+	}
+
+	if entry.Response.Status != 200 || entry.Response.StatusText != "OK" || entry.Response.Content.Text != "ok" {
+		t.Error("Should write original response:", entry.Response)
+	}
+
+	if entry.Time != 25 || !entry.StartedDateTime.Equal(time.Unix(0, start)) {
+		t.Error("Should write timings:", entry.Time, entry.StartedDateTime)
+	}
+
+	output.Close()
+
+	har = readHAR()
+	if len(har.Log.Entries) != 2 || har.Log.Entries[1].Request.URL != "http://example.com/pending" || har.Log.Entries[1].Response.Status != 0 {
+		t.Error("Should write requests without response on close:", har.Log.Entries)
+	}
+}
@@ -3,8 +3,14 @@ package main
 import (
 	"io"
 	"log"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/buger/gor/proto"
 )
 
 const initialDynamicWorkers = 10
@@ -12,17 +18,81 @@ const initialDynamicWorkers = 10
 // HTTPOutputConfig struct for holding http output configuration
 type HTTPOutputConfig struct {
 	redirectLimit int
+	// Hosts which absolute redirects followed to, instead of sending them to replay target
+	redirectHosts MultiOption
+
+	stats bool
+	// Interval of response status reports, 0 disables them
+	statusStats time.Duration
+	// Interval of response time percentiles reports, 0 disables them
+	latencyStats time.Duration
 
-	stats   bool
 	workers int
+	// Upper limit of dynamic workers pool, 0 means unlimited
+	workersMax int
+
+	// Emit replayed responses, so they can be used by middleware or other outputs
+	trackResponses bool
+
+	// Send each request given number of times, copies delayed by random time up to jitter
+	multiply       int
+	multiplyJitter time.Duration
+
+	// Distribute requests among multiple http outputs instead of duplicating them: "round-robin" or "least-pending"
+	balance string
+	// Route requests of same session to same output, using cookie or header value: "cookie:<name>" or "header:<name>"
+	sticky string
 
 	elasticSearch string
 
+	tlsCert string
+	tlsKey  string
+
+	tlsCA         string
+	tlsSkipVerify bool
+
+	proxy  string
+	socks5 string
+
+	originalHost bool
+	basicAuth    string
+	// Header which gets IP of original client recorded by input, e.g. X-Forwarded-For
+	realIPHeader string
+
+	http3     bool
+	http30RTT bool
+
+	grpc bool
+
+	// Rules to find values in responses, which replace original values in later requests
+	chain TokenChainRules
+	// Session key of original requests, "cookie:<name>" or "header:<name>", used to keep cookies set by replayed server
+	cookieJar string
+	// Rules to find anti-CSRF token in replayed responses, and where to put it in following requests
+	csrf       TokenChainRules
+	csrfInject MultiOption
+
+	retry HTTPRetryConfig
+
+	// Add W3C trace context to replayed requests: "generate" or "propagate"
+	traceparent string
+
+	dialTimeout         time.Duration
+	tlsHandshakeTimeout time.Duration
+	timeout             time.Duration
+
+	disableKeepAlive bool
+	idleTimeout      time.Duration
+	// Maximum number of idle connections kept open, 0 means unlimited
+	maxIdleConns int
+	// Maximum number of connections shared by workers, 0 means unlimited
+	maxConns int
+
 	Debug bool
 }
 
 // HTTPOutput plugin manage pool of workers which send request to replayed server
-// By default workers pool is dynamic and starts with 10 workers
+// By default workers pool is dynamic and starts with 10 workers, it can be limited using `--output-http-workers-max`
 // You can specify fixed number of workers using `--output-http-workers`
 type HTTPOutput struct {
 	// Keep this as first element of struct because it guarantees 64bit
@@ -30,17 +100,42 @@ type HTTPOutput struct {
 	// aligned at 64bit. See https://github.com/golang/go/issues/599
 	activeWorkers int64
 
+	// Requests queued or being sent, used by load balancer
+	pending int64
+
 	address string
-	limit   int
-	queue   chan []byte
+	// Host header sent to this target, set by `host` address option
+	host string
+	// Share of balanced traffic sent to this target, set by `weight` address option. 0 if not set
+	weight int
+
+	limit int
+	queue *payloadQueue
+	// Connections shared by workers, nil for HTTP/3 which manages connections by itself
+	pool *httpConnPool
+
+	responses chan []byte
 
 	needWorker chan int
+	// Closed when output closed, e.g. removed on config reload, so workers exit
+	stop     chan struct{}
+	stopOnce sync.Once
 
 	config *HTTPOutputConfig
 
-	queueStats *GorStat
+	queueStats   *GorStat
+	statusStats  *httpStatusStats
+	latencyStats *httpLatencyStats
 
 	elasticSearch *ESPlugin
+
+	chain     *TokenChain
+	cookieJar *CookieJar
+	csrf      *CSRFTokens
+	retry     *httpRetry
+
+	// Used to report time requests spent in queue, if pipeline spans enabled
+	enqueued *enqueueTimes
 }
 
 // NewHTTPOutput constructor for HTTPOutput
@@ -49,15 +144,31 @@ func NewHTTPOutput(address string, config *HTTPOutputConfig) io.Writer {
 
 	o := new(HTTPOutput)
 
-	o.address = address
+	// Retry options can be set per output
+	retry := config.retry
+	o.address, o.host, o.weight = parseHTTPOutputOptions(address, &retry)
 	o.config = config
 
 	if o.config.stats {
 		o.queueStats = NewGorStat("output_http")
 	}
 
-	o.queue = make(chan []byte, 100)
+	if o.config.statusStats > 0 {
+		o.statusStats = newHTTPStatusStats(address, o.config.statusStats)
+	}
+
+	if o.config.latencyStats > 0 {
+		o.latencyStats = newHTTPLatencyStats(address, o.config.latencyStats)
+	}
+
+	o.queue = newPayloadQueue(&Settings.outputQueueConfig)
+
+	if !o.config.http3 {
+		o.pool = newHTTPConnPool(o.config.maxConns, o.config.maxIdleConns, o.config.idleTimeout)
+	}
+	o.responses = make(chan []byte, 100)
 	o.needWorker = make(chan int, 1)
+	o.stop = make(chan struct{})
 
 	// Initial workers count
 	if o.config.workers == 0 {
@@ -71,6 +182,28 @@ func NewHTTPOutput(address string, config *HTTPOutputConfig) io.Writer {
 		o.elasticSearch.Init(o.config.elasticSearch)
 	}
 
+	validTraceparentMode(o.config.traceparent)
+
+	if Settings.otlpEndpoint != "" && Settings.otlpConfig.pipelineSpans {
+		o.enqueued = newEnqueueTimes()
+	}
+
+	if len(o.config.chain) > 0 {
+		o.chain = NewTokenChain(o.config.chain)
+	}
+
+	if o.config.cookieJar != "" {
+		o.cookieJar = NewCookieJar(o.config.cookieJar)
+	}
+
+	if len(o.config.csrf) > 0 {
+		o.csrf = NewCSRFTokens(o.config.csrf, o.config.csrfInject)
+	}
+
+	if retry.attempts > 1 {
+		o.retry = newHTTPRetry(&retry)
+	}
+
 	go o.workerMaster()
 
 	return o
@@ -78,8 +211,23 @@ func NewHTTPOutput(address string, config *HTTPOutputConfig) io.Writer {
 
 func (o *HTTPOutput) workerMaster() {
 	for {
-		newWorkers := <-o.needWorker
+		var newWorkers int
+
+		select {
+		case newWorkers = <-o.needWorker:
+		case <-o.stop:
+			return
+		}
+
+		if o.config.workers == 0 && o.config.workersMax > 0 {
+			if free := o.config.workersMax - int(atomic.LoadInt64(&o.activeWorkers)); newWorkers > free {
+				newWorkers = free
+			}
+		}
+
+		// Counted before start, so next scaling request sees them
 		for i := 0; i < newWorkers; i++ {
+			atomic.AddInt64(&o.activeWorkers, 1)
 			go o.startWorker()
 		}
 
@@ -90,21 +238,95 @@ func (o *HTTPOutput) workerMaster() {
 	}
 }
 
+// parseHTTPOutputOptions extracts options from address, e.g. "10.0.0.5:80|host=api.staging.local,weight=10,retry=3".
+// Returns address without options, Host header sent to target, and its weight among balanced outputs.
+// Retry options override given retry config.
+func parseHTTPOutputOptions(address string, retry *HTTPRetryConfig) (addr, host string, weight int) {
+	split := strings.SplitN(address, "|", 2)
+	if len(split) == 1 {
+		return address, "", 0
+	}
+
+	for _, option := range strings.Split(split[1], ",") {
+		kv := strings.SplitN(option, "=", 2)
+		if len(kv) != 2 {
+			log.Fatal("[HTTP-OUTPUT] Unknown option, expected host, weight or retry options: ", option)
+		}
+
+		var err error
+
+		switch kv[0] {
+		case "host":
+			host = kv[1]
+		case "weight":
+			// Weights can be written as percents, e.g. weight=90%
+			if weight, err = strconv.Atoi(strings.TrimSuffix(kv[1], "%")); err != nil || weight <= 0 {
+				log.Fatal("[HTTP-OUTPUT] Weight should be positive number: ", option)
+			}
+		case "retry":
+			if retry.attempts, err = strconv.Atoi(kv[1]); err != nil || retry.attempts <= 0 {
+				log.Fatal("[HTTP-OUTPUT] Retry attempts should be positive number: ", option)
+			}
+		case "retry-backoff":
+			if retry.backoff, err = time.ParseDuration(kv[1]); err != nil {
+				log.Fatal("[HTTP-OUTPUT] Invalid retry backoff: ", option)
+			}
+		case "retry-status":
+			// Comma separates options, so status codes separated by semicolon
+			retry.status = strings.Replace(kv[1], ";", ",", -1)
+		case "retry-non-idempotent":
+			if retry.nonIdempotent, err = strconv.ParseBool(kv[1]); err != nil {
+				log.Fatal("[HTTP-OUTPUT] Invalid retry-non-idempotent value: ", option)
+			}
+		default:
+			log.Fatal("[HTTP-OUTPUT] Unknown option, expected host, weight or retry options: ", option)
+		}
+	}
+
+	return split[0], host, weight
+}
+
 func (o *HTTPOutput) startWorker() {
 	client := NewHTTPClient(o.address, &HTTPClientConfig{
-		FollowRedirects: o.config.redirectLimit,
-		Debug:           o.config.Debug,
+		FollowRedirects:    o.config.redirectLimit,
+		RedirectHosts:      o.config.redirectHosts,
+		Debug:              o.config.Debug,
+		ClientCertFile:     o.config.tlsCert,
+		ClientKeyFile:      o.config.tlsKey,
+		CAFile:             o.config.tlsCA,
+		InsecureSkipVerify: o.config.tlsSkipVerify,
+		Proxy:              o.config.proxy,
+		SOCKS5:             o.config.socks5,
+		OriginalHost:       o.config.originalHost,
+		Host:               o.host,
+		BasicAuth:          o.config.basicAuth,
+		HTTP3:              o.config.http3,
+		HTTP3Allow0RTT:     o.config.http30RTT,
+		GRPC:               o.config.grpc,
+
+		DialTimeout:         o.config.dialTimeout,
+		TLSHandshakeTimeout: o.config.tlsHandshakeTimeout,
+		Timeout:             o.config.timeout,
+
+		DisableKeepAlive: o.config.disableKeepAlive,
+		IdleTimeout:      o.config.idleTimeout,
+		Pool:             o.pool,
 	})
 
 	deathCount := 0
 
-	atomic.AddInt64(&o.activeWorkers, 1)
-
 	for {
 		select {
-		case data := <-o.queue:
-			o.sendRequest(client, data)
+		case p := <-o.queue.ch:
+			o.sendRequest(client, p.data)
+			p.release()
+			atomic.AddInt64(&o.pending, -1)
 			deathCount = 0
+		case <-o.stop:
+			atomic.AddInt64(&o.activeWorkers, -1)
+			client.Disconnect()
+
+			return
 		case <-time.After(time.Millisecond * 100):
 			// When dynamic scaling enabled workers die after 2s of inactivity
 			if o.config.workers == 0 {
@@ -119,6 +341,8 @@ func (o *HTTPOutput) startWorker() {
 				// At least 1 startWorker should be alive
 				if workersCount != 1 {
 					atomic.AddInt64(&o.activeWorkers, -1)
+					client.Disconnect()
+
 					return
 				}
 			}
@@ -126,34 +350,356 @@ func (o *HTTPOutput) startWorker() {
 	}
 }
 
+// replaySpan describes replayed request, using OpenTelemetry semantic conventions for HTTP client spans
+func (o *HTTPOutput) replaySpan(trace traceContext, parentID [8]byte, request, response []byte, err error, start, stop time.Time) *Span {
+	span := &Span{
+		trace:    trace,
+		parentID: parentID,
+		name:     endpoint(request),
+		kind:     spanKindClient,
+		start:    start,
+		end:      stop,
+		attributes: map[string]interface{}{
+			"http.request.method": string(proto.Method(request)),
+			"url.full":            o.address + string(proto.Path(request)),
+		},
+	}
+
+	if err != nil {
+		span.err = err.Error()
+	} else if len(response) > 0 {
+		status := string(proto.Status(response))
+
+		if code, err := strconv.Atoi(status); err == nil {
+			span.attributes["http.response.status_code"] = code
+
+			if code >= 500 {
+				span.err = status
+			}
+		}
+	}
+
+	return span
+}
+
 func (o *HTTPOutput) Write(data []byte) (n int, err error) {
-	buf := make([]byte, len(data))
-	copy(buf, data)
+	// Only requests can be replayed, captured responses are skipped
+	if !isRequestPayload(data) {
+		if o.chain != nil && data[0] == ResponsePayload {
+			o.chain.Original(payloadID(data), payloadBody(data))
+		}
+
+		return len(data), nil
+	}
+
+	// Emitter reuses its buffer, so payload copied
+	o.write(newPayloadBuffer(pooledCopy(data)))
+
+	return len(data), nil
+}
+
+// WritePayload queues payload handed over by emitter without copying it
+func (o *HTTPOutput) WritePayload(p *payloadBuffer) (int, error) {
+	if !isRequestPayload(p.data) {
+		return o.Write(p.data)
+	}
+
+	o.write(p.retain())
+
+	return len(p.data), nil
+}
 
-	o.queue <- buf
+// write queues request owned by output, and its copies if multiply enabled. Payload released by worker once request sent.
+func (o *HTTPOutput) write(p *payloadBuffer) {
+	// Copies made before payload queued, because it can be released by worker at any moment after that
+	copies := make([]*payloadBuffer, 0, o.config.multiply)
+	for i := 1; i < o.config.multiply; i++ {
+		copies = append(copies, newPayloadBuffer(multipliedPayload(p.data)))
+	}
+
+	o.enqueue(p)
+
+	for _, payload := range copies {
+		if o.config.multiplyJitter > 0 {
+			payload := payload
+
+			// Scheduled copies counted as pending, so shutdown waits for them
+			atomic.AddInt64(&o.pending, 1)
+			time.AfterFunc(time.Duration(rand.Int63n(int64(o.config.multiplyJitter))), func() {
+				select {
+				case <-o.stop:
+					payload.release()
+				default:
+					o.enqueue(payload)
+				}
+
+				atomic.AddInt64(&o.pending, -1)
+			})
+		} else {
+			o.enqueue(payload)
+		}
+	}
+}
+
+// multipliedPayload returns copy of request with new id, so its replayed response is not confused with response of original request
+func multipliedPayload(data []byte) []byte {
+	if !hasPayloadHeader(data) {
+		return pooledCopy(data)
+	}
+
+	var timestamp int64
+	if meta := payloadMeta(data); len(meta) > 2 {
+		timestamp, _ = strconv.ParseInt(string(meta[2]), 10, 64)
+	}
+
+	return pooledConcat(payloadHeaderIP(RequestPayload, uuid(), timestamp, payloadIP(data)), payloadBody(data))
+}
+
+// setRealIP adds IP of original client to given header, so replayed server sees original clients, e.g. for geo or rate-limit logic.
+// X-Forwarded-For can already contain list of proxies, so IP appended to it.
+func setRealIP(request []byte, header string, ip []byte) []byte {
+	if len(ip) == 0 {
+		return request
+	}
+
+	name := []byte(header)
+	value := ip
+
+	if strings.EqualFold(header, "X-Forwarded-For") {
+		if forwarded := proto.Header(request, name); len(forwarded) > 0 {
+			value = append(append(append([]byte{}, forwarded...), ", "...), ip...)
+		}
+	}
+
+	return proto.SetHeader(request, name, value)
+}
+
+// enqueue adds request to queue of workers, and starts new workers if needed
+func (o *HTTPOutput) enqueue(p *payloadBuffer) {
+	if o.enqueued != nil && hasPayloadHeader(p.data) {
+		o.enqueued.add(payloadID(p.data), time.Now())
+	}
+
+	atomic.AddInt64(&o.pending, 1)
+
+	if dropped := o.queue.Push(p); dropped > 0 {
+		atomic.AddInt64(&o.pending, -int64(dropped))
+		statsd.Incr("output_http.dropped", dropped)
+	}
+
+	statsd.Gauge("output_http.queue", o.queue.Len())
 
 	if o.config.stats {
-		o.queueStats.Write(len(o.queue))
+		o.queueStats.Write(o.queue.Len())
 	}
 
 	if o.config.workers == 0 {
 		workersCount := atomic.LoadInt64(&o.activeWorkers)
 
-		if len(o.queue) > int(workersCount) {
-			o.needWorker <- len(o.queue)
+		if o.queue.Len() > int(workersCount) {
+			select {
+			case o.needWorker <- o.queue.Len():
+			case <-o.stop:
+			}
 		}
 	}
+}
 
-	return len(data), nil
+// Close stops workers and closes connections kept open by them. Called on shutdown once queue drained, and
+// when output removed on config reload, then requests left in queue dropped.
+// Response times of requests replayed since last report reported on exit.
+func (o *HTTPOutput) Close() error {
+	o.stopOnce.Do(func() {
+		close(o.stop)
+
+		if dropped := o.dropQueued(); dropped > 0 {
+			log.Println("[HTTP-OUTPUT] Dropped", dropped, "queued requests of closed output", o.address)
+			statsd.Incr("output_http.dropped", dropped)
+		}
+	})
+
+	if o.latencyStats != nil {
+		o.latencyStats.report()
+	}
+
+	if o.pool != nil {
+		return o.pool.Close()
+	}
+
+	return nil
+}
+
+// dropQueued releases requests waiting in queue, and returns their number
+func (o *HTTPOutput) dropQueued() (dropped int) {
+	for {
+		select {
+		case p := <-o.queue.ch:
+			p.release()
+			atomic.AddInt64(&o.pending, -1)
+			dropped++
+		default:
+			return
+		}
+	}
+}
+
+// QueueLen returns number of requests waiting for free worker
+func (o *HTTPOutput) QueueLen() (int, int) {
+	return o.queue.Len(), o.queue.Cap()
 }
 
-func (o *HTTPOutput) sendRequest(client *HTTPClient, request []byte) {
+// Dropped returns number of requests dropped because queue was full
+func (o *HTTPOutput) Dropped() int64 {
+	return o.queue.Dropped()
+}
+
+// Pending returns number of requests queued or being sent
+func (o *HTTPOutput) Pending() int64 {
+	return atomic.LoadInt64(&o.pending)
+}
+
+// Read returns replayed responses, if `--output-http-track-response` turned on. Returns io.EOF once output closed.
+// Responses use id of the original request, and round trip time in nanoseconds instead of timestamp.
+func (o *HTTPOutput) Read(data []byte) (int, error) {
+	var resp []byte
+
+	select {
+	case resp = <-o.responses:
+	case <-o.stop:
+		return 0, io.EOF
+	}
+
+	n := copy(data, resp)
+	putBuffer(resp)
+
+	return n, nil
+}
+
+func (o *HTTPOutput) sendRequest(client *HTTPClient, payload []byte) {
+	request := payloadBody(payload)
+
+	// Payload can be shared with other outputs, so it copied before rewrites
+	if o.chain != nil || o.cookieJar != nil || o.csrf != nil || o.config.traceparent != "" || o.config.realIPHeader != "" {
+		request = pooledCopy(request)
+		defer putBuffer(request)
+	}
+
+	if o.config.realIPHeader != "" {
+		request = setRealIP(request, o.config.realIPHeader, payloadIP(payload))
+	}
+
+	var session string
+	if o.cookieJar != nil {
+		session = o.cookieJar.Session(request)
+	}
+
+	if o.chain != nil {
+		request = o.chain.Rewrite(session, request)
+	}
+
+	if o.cookieJar != nil {
+		request = o.cookieJar.Apply(session, request)
+	}
+
+	if o.csrf != nil {
+		request = o.csrf.Apply(session, request)
+	}
+
+	// Spans reported even if trace context not added, then they continue recorded traces
+	var trace traceContext
+	var parentID [8]byte
+	if o.config.traceparent != "" || tracer != nil {
+		trace, parentID = requestTrace(request, o.config.traceparent)
+	}
+
+	var pipeline *pipelineTrace
+	if tracer != nil && o.enqueued != nil {
+		pipeline = newPipelineTrace(trace, parentID, payload, o.enqueued.take(payloadID(payload)))
+	}
+
+	if o.config.traceparent != "" {
+		request = proto.SetHeader(request, []byte("traceparent"), []byte(trace.String()))
+	}
+
 	start := time.Now()
 	resp, err := client.Send(request)
+
+	for attempt := 1; o.retry != nil && o.retry.shouldRetry(attempt, request, resp, err); attempt++ {
+		Debug("[HTTP-RETRY] Retrying request, attempt:", attempt+1, "error:", err, "status:", string(proto.Status(resp)))
+		statsd.Incr("output_http.retries", 1)
+
+		// Connection can be broken, so next attempt reconnects
+		if err != nil {
+			client.Disconnect()
+		}
+
+		time.Sleep(o.retry.delay(attempt))
+
+		start = time.Now()
+		resp, err = client.Send(request)
+	}
+
 	stop := time.Now()
 
 	if err != nil {
 		log.Println("Request error:", err)
+		statsFor(o).add(0, err)
+		statsd.Incr("output_http.errors", 1)
+	} else {
+		statsd.Incr("output_http.requests", 1)
+		statsd.Timing("output_http.latency", stop.Sub(start))
+
+		if status := proto.Status(resp); len(status) > 0 {
+			statsd.Incr("output_http.status."+string(status), 1)
+		}
+	}
+
+	if o.statusStats != nil {
+		o.statusStats.add(request, resp)
+	}
+
+	if o.latencyStats != nil && err == nil {
+		o.latencyStats.add(request, stop.Sub(start))
+	}
+
+	if o.chain != nil && len(resp) > 0 {
+		o.chain.Replayed(payloadID(payload), session, resp)
+	}
+
+	if o.cookieJar != nil && len(resp) > 0 {
+		o.cookieJar.Update(session, resp)
+	}
+
+	if o.csrf != nil && len(resp) > 0 {
+		o.csrf.Update(session, resp)
+	}
+
+	// Without request id response can't be matched with request, so there is no reason to emit it
+	if o.config.trackResponses && len(resp) > 0 && hasPayloadHeader(payload) {
+		response := pooledPayload(ReplayedResponsePayload, payloadID(payload), stop.Sub(start).Nanoseconds(), resp)
+
+		// Responses of closed output are not read anymore
+		select {
+		case o.responses <- response:
+		case <-o.stop:
+			putBuffer(response)
+		}
+
+		if pipeline != nil {
+			pipeline.emitted = time.Now()
+		}
+	}
+
+	if tracer != nil {
+		span := o.replaySpan(trace, parentID, request, resp, err, start, stop)
+
+		if pipeline != nil {
+			for _, s := range pipeline.spans(span) {
+				tracer.Export(s)
+			}
+		} else {
+			tracer.Export(span)
+		}
 	}
 
 	if o.elasticSearch != nil {
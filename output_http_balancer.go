@@ -0,0 +1,288 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"math"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/buger/gor/proto"
+)
+
+// HTTPBalancer distributes requests among multiple http outputs, instead of duplicating them.
+// Useful when one capture node feeds a pool of replay servers.
+type HTTPBalancer struct {
+	strategy string
+	outputs  []io.Writer
+
+	// Output names used for consistent hashing, so session stays on same output when others added or removed
+	names []string
+
+	// Session key for sticky routing
+	sticky sessionKey
+
+	// Share of traffic of each output, set by `weight` option of http output
+	weights  []int
+	weighted bool
+
+	// Smooth weighted round-robin state, see pickWeighted
+	mu      sync.Mutex
+	current []int
+
+	next uint64
+}
+
+// NewHTTPBalancer constructor for HTTPBalancer.
+// Strategy can be "round-robin" or "least-pending". Sticky key has `cookie:<name>` or `header:<name>` format.
+// Round-robin takes into account weights of outputs, if any of them has it.
+func NewHTTPBalancer(strategy, sticky string, outputs []io.Writer) *HTTPBalancer {
+	if strategy == "" {
+		strategy = "round-robin"
+	}
+
+	if strategy != "round-robin" && strategy != "least-pending" {
+		log.Fatal("[BALANCER] Unknown strategy, should be 'round-robin' or 'least-pending': ", strategy)
+	}
+
+	b := &HTTPBalancer{strategy: strategy, outputs: outputs}
+
+	// Same address can be specified multiple times to give it more weight
+	seen := make(map[string]int)
+	for _, output := range outputs {
+		name := fmt.Sprint(output)
+		seen[name]++
+
+		b.names = append(b.names, fmt.Sprintf("%s#%d", name, seen[name]))
+
+		weight := outputWeight(output)
+		if weight == 0 {
+			weight = 1
+		} else {
+			b.weighted = true
+		}
+		b.weights = append(b.weights, weight)
+	}
+
+	b.current = make([]int, len(outputs))
+
+	if b.weighted && strategy != "round-robin" {
+		log.Fatal("[BALANCER] Output weights supported only by 'round-robin' strategy")
+	}
+
+	if sticky != "" {
+		var err error
+		if b.sticky, err = parseSessionKey(sticky); err != nil {
+			log.Fatal("[BALANCER] Sticky key should be 'cookie:<name>' or 'header:<name>': ", sticky)
+		}
+	}
+
+	return b
+}
+
+func (b *HTTPBalancer) Write(data []byte) (int, error) {
+	// Only requests are replayed, no need to spend turn on responses
+	if !isRequestPayload(data) {
+		return len(data), nil
+	}
+
+	if key := b.sticky.value(payloadBody(data)); len(key) > 0 {
+		return b.outputs[b.stickyIndex(key)].Write(data)
+	}
+
+	return b.pick().Write(data)
+}
+
+// WritePayload passes payload to picked output without copying
+func (b *HTTPBalancer) WritePayload(p *payloadBuffer) (int, error) {
+	if !isRequestPayload(p.data) {
+		return len(p.data), nil
+	}
+
+	if key := b.sticky.value(payloadBody(p.data)); len(key) > 0 {
+		return writePayload(b.outputs[b.stickyIndex(key)], p)
+	}
+
+	return writePayload(b.pick(), p)
+}
+
+// sessionKey identifies session of original client by cookie or header value
+type sessionKey struct {
+	cookie []byte
+	header []byte
+}
+
+// parseSessionKey parses `cookie:<name>` or `header:<name>`
+func parseSessionKey(key string) (k sessionKey, err error) {
+	split := strings.SplitN(key, ":", 2)
+
+	if len(split) != 2 || strings.TrimSpace(split[1]) == "" {
+		return k, fmt.Errorf("invalid session key %q", key)
+	}
+
+	name := []byte(strings.TrimSpace(split[1]))
+
+	switch strings.ToLower(strings.TrimSpace(split[0])) {
+	case "cookie":
+		k.cookie = name
+	case "header":
+		k.header = name
+	default:
+		return k, fmt.Errorf("invalid session key %q", key)
+	}
+
+	return
+}
+
+// value returns session key of request, or nil if request has no session
+func (k sessionKey) value(request []byte) []byte {
+	if k.cookie != nil {
+		return proto.Cookie(request, k.cookie)
+	}
+
+	if k.header != nil {
+		return proto.Header(request, k.header)
+	}
+
+	return nil
+}
+
+// stickyIndex uses rendezvous hashing: output with highest score of session key and output name wins.
+// Unlike modulo hashing, only sessions of added or removed output move to other outputs.
+//
+// Score is weight / -ln(hash), so output wins for share of sessions proportional to its weight.
+// With equal weights it is ordered the same way as hash itself.
+func (b *HTTPBalancer) stickyIndex(key []byte) (index int) {
+	var best float64
+
+	for i, name := range b.names {
+		hasher := fnv.New32a()
+		hasher.Write(key)
+		hasher.Write([]byte(name))
+
+		// Hash mapped to (0, 1) range
+		h := (float64(hasher.Sum32()) + 1) / (math.MaxUint32 + 2)
+
+		if score := float64(b.weights[i]) / -math.Log(h); i == 0 || score > best {
+			index, best = i, score
+		}
+	}
+
+	return
+}
+
+// pick selects output for requests without session key
+func (b *HTTPBalancer) pick() io.Writer {
+	// Start from next output, so outputs with equal load used in turns
+	start := int(atomic.AddUint64(&b.next, 1) % uint64(len(b.outputs)))
+
+	if b.weighted {
+		return b.pickWeighted()
+	}
+
+	if b.strategy == "round-robin" {
+		return b.outputs[start]
+	}
+
+	best := b.outputs[start]
+	bestPending := pendingRequests(best)
+
+	for i := 1; i < len(b.outputs); i++ {
+		output := b.outputs[(start+i)%len(b.outputs)]
+
+		if pending := pendingRequests(output); pending < bestPending {
+			best, bestPending = output, pending
+		}
+	}
+
+	return best
+}
+
+// pickWeighted uses smooth weighted round-robin, like nginx: requests of outputs interleaved,
+// instead of sending bursts of requests to output with bigger weight
+func (b *HTTPBalancer) pickWeighted() io.Writer {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	best, total := 0, 0
+
+	for i, weight := range b.weights {
+		b.current[i] += weight
+		total += weight
+
+		if b.current[i] > b.current[best] {
+			best = i
+		}
+	}
+
+	b.current[best] -= total
+
+	return b.outputs[best]
+}
+
+// outputWeight returns weight set by `weight` option of http output, or 0 if it is not set
+func outputWeight(output io.Writer) int {
+	if l, ok := output.(*Limiter); ok {
+		output = l.plugin.(io.Writer)
+	}
+
+	if o, ok := output.(*HTTPOutput); ok {
+		return o.weight
+	}
+
+	return 0
+}
+
+// hasWeightedOutputs checks if traffic should be split among outputs according to their weights
+func hasWeightedOutputs(outputs []io.Writer) bool {
+	for _, output := range outputs {
+		if outputWeight(output) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Pending returns number of requests queued or being sent by all outputs
+func (b *HTTPBalancer) Pending() (pending int64) {
+	for _, output := range b.outputs {
+		pending += pendingRequests(output)
+	}
+
+	return
+}
+
+// Close closes balanced outputs on shutdown
+func (b *HTTPBalancer) Close() error {
+	for _, output := range b.outputs {
+		if c, ok := unwrapPlugin(output).(io.Closer); ok {
+			c.Close()
+		}
+	}
+
+	return nil
+}
+
+func pendingRequests(output io.Writer) int64 {
+	if l, ok := output.(*Limiter); ok {
+		output = l.plugin.(io.Writer)
+	}
+
+	if o, ok := output.(*HTTPOutput); ok {
+		return o.Pending()
+	}
+
+	return 0
+}
+
+func (b *HTTPBalancer) String() string {
+	if b.weighted {
+		return "HTTP balancer (weighted " + b.strategy + "): " + fmt.Sprint(b.outputs, b.weights)
+	}
+
+	return "HTTP balancer (" + b.strategy + "): " + fmt.Sprint(b.outputs)
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/buger/gor/proto"
+)
+
+func TestHTTPBalancerRoundRobin(t *testing.T) {
+	counters := make([]int, 3)
+	var outputs []io.Writer
+
+	for i := range counters {
+		i := i
+		outputs = append(outputs, NewTestOutput(func(data []byte) {
+			counters[i]++
+		}))
+	}
+
+	balancer := NewHTTPBalancer("round-robin", "", outputs)
+
+	for i := 0; i < 30; i++ {
+		balancer.Write(append(payloadHeader(RequestPayload, uuid(), 1), []byte("GET / HTTP/1.1\r\n\r\n")...))
+	}
+
+	// Responses should not be replayed
+	balancer.Write(append(payloadHeader(ResponsePayload, uuid(), 1), []byte("HTTP/1.1 200 OK\r\n\r\n")...))
+
+	for i, c := range counters {
+		if c != 10 {
+			t.Errorf("Output %d should receive 10 requests, got %d", i, c)
+		}
+	}
+}
+
+func TestHTTPBalancerLeastPending(t *testing.T) {
+	busy := &HTTPOutput{pending: 10}
+	free := &HTTPOutput{pending: 1}
+	limited := NewLimiter(&HTTPOutput{pending: 5}, "10")
+
+	balancer := NewHTTPBalancer("least-pending", "", []io.Writer{busy, free, limited})
+
+	for i := 0; i < 3; i++ {
+		if output := balancer.pick(); output != free {
+			t.Error("Should pick output with fewest pending requests", output)
+		}
+	}
+
+	free.pending = 20
+
+	if output := balancer.pick(); output != limited {
+		t.Error("Should take into account outputs wrapped by limiter", output)
+	}
+}
+
+type namedTestOutput struct {
+	*TestOutput
+	name string
+}
+
+func (o *namedTestOutput) String() string {
+	return o.name
+}
+
+func TestHTTPBalancerSticky(t *testing.T) {
+	received := make(map[string]map[int]bool)
+	var outputs []io.Writer
+
+	for i := 0; i < 3; i++ {
+		i := i
+		outputs = append(outputs, &namedTestOutput{name: fmt.Sprint("replay", i), TestOutput: NewTestOutput(func(data []byte) {
+			session := string(proto.Cookie(payloadBody(data), []byte("session")))
+			if received[session] == nil {
+				received[session] = make(map[int]bool)
+			}
+			received[session][i] = true
+		})})
+	}
+
+	balancer := NewHTTPBalancer("", "cookie:session", outputs)
+
+	for i := 0; i < 100; i++ {
+		request := fmt.Sprintf("GET / HTTP/1.1\r\nCookie: a=1; session=user%d\r\n\r\n", i%10)
+		balancer.Write(append(payloadHeader(RequestPayload, uuid(), 1), []byte(request)...))
+	}
+
+	if len(received) != 10 {
+		t.Fatal("Should receive all sessions", len(received))
+	}
+
+	used := make(map[int]bool)
+	for session, targets := range received {
+		if len(targets) != 1 {
+			t.Error("Session should always go to same output", session, targets)
+		}
+
+		for i := range targets {
+			used[i] = true
+		}
+	}
+
+	if len(used) < 2 {
+		t.Error("Sessions should be spread among outputs", used)
+	}
+
+	// Removing one output should move only its sessions
+	index := balancer.stickyIndex([]byte("user1"))
+	fewer := NewHTTPBalancer("", "cookie:session", append(append([]io.Writer{}, outputs[:index]...), outputs[index+1:]...))
+
+	for i := 0; i < 10; i++ {
+		key := []byte(fmt.Sprintf("user%d", i))
+
+		if before := balancer.stickyIndex(key); before != index && fewer.outputs[fewer.stickyIndex(key)] != outputs[before] {
+			t.Error("Session of not removed output should stay on it", string(key))
+		}
+	}
+}
+
+func TestHTTPBalancerWeighted(t *testing.T) {
+	if address, _, weight := parseHTTPOutputOptions("staging-v2.local|weight=10%", &HTTPRetryConfig{}); address != "staging-v2.local" || weight != 10 {
+		t.Error("Should parse weight option:", address, weight)
+	}
+
+	v1 := &HTTPOutput{address: "staging-v1.local", weight: 90}
+	v2 := &HTTPOutput{address: "staging-v2.local", weight: 10}
+
+	if !hasWeightedOutputs([]io.Writer{v1, v2}) || hasWeightedOutputs([]io.Writer{&HTTPOutput{}}) {
+		t.Error("Should detect weighted outputs")
+	}
+
+	balancer := NewHTTPBalancer("", "", []io.Writer{v1, v2})
+
+	counts := make(map[io.Writer]int)
+	last := -1
+	for i := 0; i < 100; i++ {
+		output := balancer.pick()
+		counts[output]++
+
+		// Requests of smaller output should be spread evenly, not sent in one burst
+		if output == v2 {
+			if last != -1 && i-last != 10 {
+				t.Error("Weighted requests should be interleaved", last, i)
+			}
+			last = i
+		}
+	}
+
+	if counts[v1] != 90 || counts[v2] != 10 {
+		t.Error("Traffic should be split according to weights", counts[v1], counts[v2])
+	}
+
+	// Sessions split according to weights too
+	sessions := make(map[int]int)
+	for i := 0; i < 10000; i++ {
+		key := []byte(fmt.Sprintf("user%d", i))
+		index := balancer.stickyIndex(key)
+
+		if index != balancer.stickyIndex(key) {
+			t.Fatal("Session should always go to same output")
+		}
+
+		sessions[index]++
+	}
+
+	if sessions[1] < 800 || sessions[1] > 1200 {
+		t.Error("Sessions should be split according to weights", sessions)
+	}
+}
@@ -0,0 +1,540 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/buger/gor/byteutils"
+	"github.com/buger/gor/proto"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Handling of --output-http-chain option
+//
+// Each rule describes where value, like auth token, can be found in response:
+//
+//	json:access_token          value of JSON body field, nested fields separated by dot: json:data.tokens.0
+//	header:X-Auth-Token        response header
+//	cookie:session_id          cookie set by response
+//	regexp:token=(\w+)         first capture group of regexp matched against whole response
+type chainRule struct {
+	kind   string
+	name   string
+	regexp *regexp.Regexp
+}
+
+// TokenChainRules holds list of value extraction rules
+type TokenChainRules []chainRule
+
+func (r *TokenChainRules) String() string {
+	return fmt.Sprint(*r)
+}
+
+func (r *TokenChainRules) Set(value string) error {
+	valArr := strings.SplitN(value, ":", 2)
+	if len(valArr) < 2 || valArr[1] == "" {
+		return errors.New("need both rule type and name, colon-delimited (ex. json:access_token)")
+	}
+
+	rule := chainRule{kind: valArr[0], name: valArr[1]}
+
+	switch rule.kind {
+	case "json", "header", "cookie":
+	case "regexp":
+		re, err := regexp.Compile(rule.name)
+		if err != nil {
+			return err
+		}
+
+		if re.NumSubexp() == 0 {
+			return errors.New("regexp should have capture group, which matches value")
+		}
+
+		rule.regexp = re
+	default:
+		return fmt.Errorf("unknown rule type %q, expected json, header, cookie or regexp", rule.kind)
+	}
+
+	*r = append(*r, rule)
+
+	return nil
+}
+
+// extract returns values found in response, one per rule, or empty string if not found
+func (r TokenChainRules) extract(payload []byte) []string {
+	values := make([]string, len(r))
+
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(payload)), nil)
+	if err != nil {
+		return values
+	}
+
+	// Response can be truncated, so partial body is used as well
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	var doc interface{}
+	var docParsed bool
+
+	for i, rule := range r {
+		switch rule.kind {
+		case "json":
+			if !docParsed {
+				json.Unmarshal(body, &doc)
+				docParsed = true
+			}
+
+			values[i] = jsonPathValue(doc, strings.Split(rule.name, "."))
+		case "header":
+			values[i] = resp.Header.Get(rule.name)
+		case "cookie":
+			for _, c := range resp.Cookies() {
+				if c.Name == rule.name {
+					values[i] = c.Value
+				}
+			}
+		case "regexp":
+			if m := rule.regexp.FindSubmatch(payload); m != nil {
+				values[i] = string(m[1])
+			}
+		}
+	}
+
+	return values
+}
+
+// jsonPathValue returns string or number found by path, array items referenced by index
+func jsonPathValue(doc interface{}, path []string) string {
+	for _, key := range path {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			doc = node[key]
+		case []interface{}:
+			idx, err := strconv.Atoi(key)
+			if err != nil || idx < 0 || idx >= len(node) {
+				return ""
+			}
+
+			doc = node[idx]
+		default:
+			return ""
+		}
+	}
+
+	switch value := doc.(type) {
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+
+	return ""
+}
+
+// Values of request are kept until both original and replayed responses received
+const chainPendingTTL = time.Minute
+
+// Limit of replacements kept by chain, least recently used ones forgotten first
+var chainMaxReplacements = 100000
+
+type chainPending struct {
+	original []string
+	replayed []string
+	created  time.Time
+
+	// Session of replayed request
+	session string
+}
+
+type chainReplacement struct {
+	value string
+	used  time.Time
+}
+
+// TokenChain replaces values, like auth tokens, issued by original server with values issued by replayed server.
+//
+// Values are extracted from original response of a request and from its replayed response, using the same rules.
+// Once both known, later requests of the same session get original value replaced with replayed one, where request
+// sends the whole value: header value or its last word, like in `Bearer <token>`, cookie, URL path segment,
+// query or form param, or JSON body field. Sessions identified by cookie jar key, values learned by requests without
+// session are shared by all requests.
+type TokenChain struct {
+	rules TokenChainRules
+
+	mu           sync.Mutex
+	pending      map[string]*chainPending
+	replacements map[string]map[string]*chainReplacement
+	count        int
+	lastClean    time.Time
+}
+
+// NewTokenChain constructor for TokenChain
+func NewTokenChain(rules TokenChainRules) *TokenChain {
+	return &TokenChain{
+		rules:        rules,
+		pending:      make(map[string]*chainPending),
+		replacements: make(map[string]map[string]*chainReplacement),
+		lastClean:    time.Now(),
+	}
+}
+
+// Original extracts values from response captured on original server
+func (c *TokenChain) Original(id []byte, response []byte) {
+	c.add(id, "", c.rules.extract(response), true)
+}
+
+// Replayed extracts values from response of replayed server to request of given session
+func (c *TokenChain) Replayed(id []byte, session string, response []byte) {
+	c.add(id, session, c.rules.extract(response), false)
+}
+
+func (c *TokenChain) add(id []byte, session string, values []string, original bool) {
+	found := false
+	for _, v := range values {
+		found = found || v != ""
+	}
+
+	if !found || len(id) == 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p, ok := c.pending[string(id)]
+	if !ok {
+		p = &chainPending{created: time.Now()}
+		c.pending[string(id)] = p
+	}
+
+	if original {
+		p.original = values
+	} else {
+		p.replayed = values
+		p.session = session
+	}
+
+	if p.original != nil && p.replayed != nil {
+		delete(c.pending, string(id))
+
+		for i, value := range p.original {
+			if value != "" && p.replayed[i] != "" && value != p.replayed[i] {
+				Debug("[TokenChain] Replacing", value, "with", p.replayed[i])
+				c.set(p.session, value, p.replayed[i])
+			}
+		}
+	}
+
+	c.cleanup()
+}
+
+// set adds replacement of the session. Called with lock held.
+func (c *TokenChain) set(session, original, replayed string) {
+	if _, ok := c.replacements[session][original]; !ok {
+		if c.count >= chainMaxReplacements {
+			c.evict()
+		}
+		c.count++
+	}
+
+	values, ok := c.replacements[session]
+	if !ok {
+		values = make(map[string]*chainReplacement)
+		c.replacements[session] = values
+	}
+
+	values[original] = &chainReplacement{value: replayed, used: time.Now()}
+}
+
+// evict forgets tenth of replacements, least recently used first. Called with lock held.
+func (c *TokenChain) evict() {
+	used := make([]time.Time, 0, c.count)
+	for _, values := range c.replacements {
+		for _, r := range values {
+			used = append(used, r.used)
+		}
+	}
+
+	sort.Slice(used, func(i, j int) bool { return used[i].Before(used[j]) })
+	threshold := used[len(used)/10]
+
+	c.remove(func(r *chainReplacement) bool { return !r.used.After(threshold) })
+}
+
+// remove deletes replacements matched by fn. Called with lock held.
+func (c *TokenChain) remove(fn func(r *chainReplacement) bool) {
+	for session, values := range c.replacements {
+		for original, r := range values {
+			if fn(r) {
+				delete(values, original)
+				c.count--
+			}
+		}
+
+		if len(values) == 0 {
+			delete(c.replacements, session)
+		}
+	}
+}
+
+// cleanup removes values of requests which never got one of responses, and replacements of ended sessions,
+// same period as cookie jar
+func (c *TokenChain) cleanup() {
+	if time.Since(c.lastClean) < chainPendingTTL {
+		return
+	}
+
+	for id, p := range c.pending {
+		if time.Since(p.created) > chainPendingTTL {
+			delete(c.pending, id)
+		}
+	}
+
+	c.remove(func(r *chainReplacement) bool { return time.Since(r.used) > cookieJarSessionTTL })
+
+	c.lastClean = time.Now()
+}
+
+// lookup returns replayed value of the session or shared one. Called with lock held.
+func (c *TokenChain) lookup(session, original string) (string, bool) {
+	if original == "" {
+		return "", false
+	}
+
+	r, ok := c.replacements[session][original]
+	if !ok && session != "" {
+		r, ok = c.replacements[""][original]
+	}
+
+	if !ok {
+		return "", false
+	}
+
+	r.used = time.Now()
+
+	return r.value, true
+}
+
+// Rewrite replaces original values in request of given session with values issued by replayed server
+func (c *TokenChain) Rewrite(session string, request []byte) []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.replacements) == 0 {
+		return request
+	}
+
+	lookup := func(original string) (string, bool) {
+		return c.lookup(session, original)
+	}
+
+	request = rewriteChainHeaders(request, lookup)
+	request = rewriteChainURL(request, lookup)
+
+	request = rewriteChainForm(request, lookup)
+
+	return rewriteJSONBody(request, func(doc interface{}) (interface{}, bool) {
+		changed := false
+		doc = rewriteJSONValues(doc, lookup, &changed)
+
+		return doc, changed
+	})
+}
+
+// rewriteChainHeaders replaces header values, their last word, and cookie values
+func rewriteChainHeaders(request []byte, lookup func(string) (string, bool)) []byte {
+	start, end := proto.MIMEHeadersStartPos(request), proto.MIMEHeadersEndPos(request)
+	if end == -1 || start > end {
+		return request
+	}
+
+	lines := strings.Split(string(request[start:end]), "\r\n")
+	changed := false
+
+	for i, line := range lines {
+		colon := strings.IndexByte(line, ':')
+		if colon == -1 {
+			continue
+		}
+
+		name, value := line[:colon], strings.TrimSpace(line[colon+1:])
+
+		switch strings.ToLower(name) {
+		case "host", "content-length", "transfer-encoding":
+			continue
+		case "cookie":
+			pairs := strings.Split(value, ";")
+			replaced := false
+
+			for j, pair := range pairs {
+				kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+				if len(kv) != 2 {
+					continue
+				}
+
+				if v, ok := lookup(kv[1]); ok {
+					pairs[j] = kv[0] + "=" + v
+					replaced = true
+				} else {
+					pairs[j] = strings.TrimSpace(pair)
+				}
+			}
+
+			if replaced {
+				lines[i] = name + ": " + strings.Join(pairs, "; ")
+				changed = true
+			}
+
+			continue
+		}
+
+		if v, ok := lookup(value); ok {
+			lines[i] = name + ": " + v
+			changed = true
+		} else if sp := strings.LastIndexByte(value, ' '); sp != -1 {
+			if v, ok := lookup(value[sp+1:]); ok {
+				lines[i] = name + ": " + value[:sp+1] + v
+				changed = true
+			}
+		}
+	}
+
+	if !changed {
+		return request
+	}
+
+	return byteutils.Replace(request, start, end, []byte(strings.Join(lines, "\r\n")))
+}
+
+// rewriteChainURL replaces URL path segments and query params
+func rewriteChainURL(request []byte, lookup func(string) (string, bool)) []byte {
+	uri := string(proto.Path(request))
+	path, query := uri, ""
+
+	if i := strings.IndexByte(uri, '?'); i != -1 {
+		path, query = uri[:i], uri[i+1:]
+	}
+
+	changed := false
+
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if v, ok := lookup(segment); ok {
+			segments[i] = url.PathEscape(v)
+			changed = true
+		}
+	}
+
+	if params, ok := rewriteChainParams(query, lookup); ok {
+		query = params
+		changed = true
+	}
+
+	if !changed {
+		return request
+	}
+
+	uri = strings.Join(segments, "/")
+	if query != "" {
+		uri += "?" + query
+	}
+
+	return proto.SetPath(request, []byte(uri))
+}
+
+// rewriteChainParams replaces values of query or form params
+func rewriteChainParams(params string, lookup func(string) (string, bool)) (string, bool) {
+	if params == "" {
+		return params, false
+	}
+
+	pairs := strings.Split(params, "&")
+	changed := false
+
+	for i, pair := range pairs {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		value, err := url.QueryUnescape(kv[1])
+		if err != nil {
+			continue
+		}
+
+		if v, ok := lookup(value); ok {
+			pairs[i] = kv[0] + "=" + url.QueryEscape(v)
+			changed = true
+		}
+	}
+
+	return strings.Join(pairs, "&"), changed
+}
+
+// rewriteChainForm replaces params of `application/x-www-form-urlencoded` body
+func rewriteChainForm(request []byte, lookup func(string) (string, bool)) []byte {
+	if !bytes.Contains(proto.Header(request, []byte("Content-Type")), []byte("application/x-www-form-urlencoded")) {
+		return request
+	}
+
+	if len(proto.Header(request, []byte("Transfer-Encoding"))) > 0 {
+		return request
+	}
+
+	bodyStart := proto.MIMEHeadersEndPos(request)
+	if bodyStart == -1 {
+		return request
+	}
+	bodyStart += len(proto.EmptyLine)
+
+	params, ok := rewriteChainParams(string(request[bodyStart:]), lookup)
+	if !ok {
+		return request
+	}
+
+	request = append(request[:bodyStart:bodyStart], params...)
+
+	return proto.SetHeader(request, []byte("Content-Length"), []byte(strconv.Itoa(len(params))))
+}
+
+// rewriteJSONValues replaces string and number values of JSON document
+func rewriteJSONValues(node interface{}, lookup func(string) (string, bool), changed *bool) interface{} {
+	switch n := node.(type) {
+	case *jsonObject:
+		for _, k := range n.keys {
+			n.values[k] = rewriteJSONValues(n.values[k], lookup, changed)
+		}
+	case []interface{}:
+		for i, v := range n {
+			n[i] = rewriteJSONValues(v, lookup, changed)
+		}
+	case string:
+		if v, ok := lookup(n); ok {
+			*changed = true
+			return v
+		}
+	case json.Number:
+		if v, ok := lookup(string(n)); ok {
+			*changed = true
+
+			// Numeric id stays number
+			if _, err := strconv.ParseFloat(v, 64); err == nil {
+				return json.Number(v)
+			}
+
+			return v
+		}
+	}
+
+	return node
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+)
+
+func TestTokenChainRulesSet(t *testing.T) {
+	var rules TokenChainRules
+
+	for _, value := range []string{"json:data.token", "header:X-Auth-Token", "cookie:sid", `regexp:token=(\w+)`} {
+		if err := rules.Set(value); err != nil {
+			t.Error("Should accept rule:", value, err)
+		}
+	}
+
+	for _, value := range []string{"json", "json:", "body:token", `regexp:token=\w+`, "regexp:("} {
+		if err := rules.Set(value); err == nil {
+			t.Error("Should reject rule:", value)
+		}
+	}
+}
+
+func TestTokenChain(t *testing.T) {
+	var rules TokenChainRules
+	rules.Set("json:data.token")
+	rules.Set("cookie:sid")
+
+	chain := NewTokenChain(rules)
+
+	chain.Original([]byte("1"), []byte("HTTP/1.1 200 OK\r\nSet-Cookie: sid=orig-sid; Path=/\r\nContent-Length: 31\r\n\r\n{\"data\": {\"token\": \"orig-abc\"}}"))
+
+	request := []byte("POST /orders HTTP/1.1\r\nAuthorization: Bearer orig-abc\r\nCookie: sid=orig-sid\r\nContent-Type: application/json\r\nContent-Length: 20\r\n\r\n{\"token\":\"orig-abc\"}")
+
+	if !bytes.Equal(chain.Rewrite("", request), request) {
+		t.Error("Should not rewrite until replayed response received")
+	}
+
+	// Chunked response with different token
+	chain.Replayed([]byte("1"), "", []byte("HTTP/1.1 200 OK\r\nSet-Cookie: sid=new-sid\r\nTransfer-Encoding: chunked\r\n\r\n25\r\n{\"data\": {\"token\": \"replayed-12345\"}}\r\n0\r\n\r\n"))
+
+	expected := "POST /orders HTTP/1.1\r\nAuthorization: Bearer replayed-12345\r\nCookie: sid=new-sid\r\nContent-Type: application/json\r\nContent-Length: 26\r\n\r\n{\"token\":\"replayed-12345\"}"
+
+	if rewritten := chain.Rewrite("", request); string(rewritten) != expected {
+		t.Errorf("Should replace original values:\n%q\n%q", rewritten, expected)
+	}
+
+	// Responses without values are ignored
+	chain.Original([]byte("2"), []byte("HTTP/1.1 404 Not Found\r\nContent-Length: 0\r\n\r\n"))
+
+	if len(chain.pending) != 0 {
+		t.Error("Should not keep responses without values:", chain.pending)
+	}
+}
+
+func TestTokenChainLocations(t *testing.T) {
+	var rules TokenChainRules
+	rules.Set("json:id")
+
+	chain := NewTokenChain(rules)
+
+	chain.Original([]byte("1"), []byte("HTTP/1.1 200 OK\r\nContent-Length: 9\r\n\r\n{\"id\": 4}"))
+	chain.Replayed([]byte("1"), "", []byte("HTTP/1.1 200 OK\r\nContent-Length: 10\r\n\r\n{\"id\": 73}"))
+
+	// Only whole values replaced, other bytes containing value are not touched
+	request := "POST /users/4/orders?user=4&page=40 HTTP/1.1\r\nX-User: 4\r\nCookie: uid=4; v=14\r\nContent-Type: application/json\r\nContent-Length: 34\r\n\r\n{\"user\":4,\"qty\":14,\"note\":\"4 x\"}"
+	expected := "POST /users/73/orders?user=73&page=40 HTTP/1.1\r\nX-User: 73\r\nCookie: uid=73; v=14\r\nContent-Type: application/json\r\nContent-Length: 33\r\n\r\n{\"user\":73,\"qty\":14,\"note\":\"4 x\"}"
+
+	if rewritten := chain.Rewrite("", []byte(request)); string(rewritten) != expected {
+		t.Errorf("Should replace whole values only:\n%q\n%q", rewritten, expected)
+	}
+
+	request = "POST / HTTP/1.1\r\nContent-Type: application/x-www-form-urlencoded\r\nContent-Length: 12\r\n\r\nid=4&page=44"
+	expected = "POST / HTTP/1.1\r\nContent-Type: application/x-www-form-urlencoded\r\nContent-Length: 13\r\n\r\nid=73&page=44"
+
+	if rewritten := chain.Rewrite("", []byte(request)); string(rewritten) != expected {
+		t.Errorf("Should replace form params:\n%q\n%q", rewritten, expected)
+	}
+}
+
+func TestTokenChainSessions(t *testing.T) {
+	var rules TokenChainRules
+	rules.Set("header:X-Token")
+
+	chain := NewTokenChain(rules)
+
+	chain.Original([]byte("1"), []byte("HTTP/1.1 200 OK\r\nX-Token: a\r\n\r\n"))
+	chain.Replayed([]byte("1"), "alice", []byte("HTTP/1.1 200 OK\r\nX-Token: b\r\n\r\n"))
+
+	request := []byte("GET / HTTP/1.1\r\nAuthorization: Bearer a\r\n\r\n")
+
+	if rewritten := chain.Rewrite("alice", request); string(rewritten) != "GET / HTTP/1.1\r\nAuthorization: Bearer b\r\n\r\n" {
+		t.Errorf("Should replace value of the session: %q", rewritten)
+	}
+
+	if rewritten := chain.Rewrite("bob", request); string(rewritten) != string(request) {
+		t.Errorf("Should not replace value of other session: %q", rewritten)
+	}
+
+	// Least recently used replacements forgotten when limit reached
+	defer func(limit int) { chainMaxReplacements = limit }(chainMaxReplacements)
+	chainMaxReplacements = 10
+
+	for i := 0; i < 20; i++ {
+		id := []byte(strconv.Itoa(i + 2))
+		chain.Original(id, []byte("HTTP/1.1 200 OK\r\nX-Token: orig"+string(id)+"\r\n\r\n"))
+		chain.Replayed(id, "", []byte("HTTP/1.1 200 OK\r\nX-Token: new"+string(id)+"\r\n\r\n"))
+	}
+
+	if chain.count > 10 || len(chain.replacements[""]) != chain.count || chain.replacements["alice"] != nil {
+		t.Error("Should keep limited number of replacements:", chain.count, len(chain.replacements[""]))
+	}
+}
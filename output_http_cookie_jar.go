@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/buger/gor/proto"
+)
+
+// Sessions without requests during this period are forgotten
+const cookieJarSessionTTL = 30 * time.Minute
+
+type cookieJarSession struct {
+	cookies  map[string]string
+	lastUsed time.Time
+}
+
+// CookieJar keeps cookies set by replayed server for each session of original clients.
+// Recorded cookies are stale on replay: they were issued by original server, so cookies from the jar replace them.
+type CookieJar struct {
+	key sessionKey
+
+	mu        sync.Mutex
+	sessions  map[string]*cookieJarSession
+	lastClean time.Time
+}
+
+// NewCookieJar constructor for CookieJar. Session key has `cookie:<name>` or `header:<name>` format,
+// and is taken from original request.
+func NewCookieJar(key string) *CookieJar {
+	k, err := parseSessionKey(key)
+	if err != nil {
+		log.Fatal("[COOKIE-JAR] Session key should be 'cookie:<name>' or 'header:<name>': ", key)
+	}
+
+	return &CookieJar{
+		key:       k,
+		sessions:  make(map[string]*cookieJarSession),
+		lastClean: time.Now(),
+	}
+}
+
+// Session returns session key of original request, before it rewritten
+func (j *CookieJar) Session(request []byte) string {
+	return string(j.key.value(request))
+}
+
+// Apply adds cookies of the session to request, replacing recorded values
+func (j *CookieJar) Apply(session string, request []byte) []byte {
+	if session == "" {
+		return request
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	s, ok := j.sessions[session]
+	if !ok {
+		return request
+	}
+
+	s.lastUsed = time.Now()
+
+	if len(s.cookies) == 0 {
+		return request
+	}
+
+	return setCookies(request, s.cookies)
+}
+
+// Update stores cookies set or deleted by replayed response
+func (j *CookieJar) Update(session string, response []byte) {
+	if session == "" {
+		return
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(response)), nil)
+	if err != nil {
+		return
+	}
+	resp.Body.Close()
+
+	cookies := resp.Cookies()
+	if len(cookies) == 0 {
+		return
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	defer j.cleanup()
+
+	s, ok := j.sessions[session]
+	if !ok {
+		s = &cookieJarSession{cookies: make(map[string]string)}
+		j.sessions[session] = s
+	}
+
+	s.lastUsed = time.Now()
+
+	for _, c := range cookies {
+		if c.MaxAge < 0 || (!c.Expires.IsZero() && c.Expires.Before(time.Now())) {
+			delete(s.cookies, c.Name)
+		} else {
+			s.cookies[c.Name] = c.Value
+		}
+	}
+}
+
+func (j *CookieJar) cleanup() {
+	if time.Since(j.lastClean) < time.Minute {
+		return
+	}
+
+	for key, s := range j.sessions {
+		if time.Since(s.lastUsed) > cookieJarSessionTTL {
+			delete(j.sessions, key)
+		}
+	}
+
+	j.lastClean = time.Now()
+}
+
+// setCookies replaces values of cookies in Cookie header, adding missing ones
+func setCookies(request []byte, cookies map[string]string) []byte {
+	var pairs []string
+	seen := make(map[string]bool)
+
+	if header := proto.Header(request, []byte("Cookie")); len(header) > 0 {
+		for _, pair := range strings.Split(string(header), ";") {
+			pair = strings.TrimSpace(pair)
+			name := strings.SplitN(pair, "=", 2)[0]
+
+			if value, ok := cookies[name]; ok {
+				pair = name + "=" + value
+				seen[name] = true
+			}
+
+			pairs = append(pairs, pair)
+		}
+	}
+
+	var missing []string
+	for name := range cookies {
+		if !seen[name] {
+			missing = append(missing, name)
+		}
+	}
+
+	sort.Strings(missing)
+
+	for _, name := range missing {
+		pairs = append(pairs, name+"="+cookies[name])
+	}
+
+	return proto.SetHeader(request, []byte("Cookie"), []byte(strings.Join(pairs, "; ")))
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSetCookies(t *testing.T) {
+	request := []byte("GET / HTTP/1.1\r\nCookie: a=1; sid=recorded; b=2\r\n\r\n")
+	expected := "GET / HTTP/1.1\r\nCookie: a=1; sid=replayed; b=2; c=3\r\n\r\n"
+
+	if got := setCookies(request, map[string]string{"sid": "replayed", "c": "3"}); string(got) != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+
+	request = []byte("GET / HTTP/1.1\r\n\r\n")
+	expected = "GET / HTTP/1.1\r\nCookie: sid=replayed\r\n\r\n"
+
+	if got := setCookies(request, map[string]string{"sid": "replayed"}); string(got) != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
+
+func TestHTTPOutputCookieJar(t *testing.T) {
+	received := make(chan string, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "sid", Value: "replayed-" + r.Header.Get("X-Client")})
+		}
+
+		if r.URL.Path == "/logout" {
+			http.SetCookie(w, &http.Cookie{Name: "sid", MaxAge: -1})
+		}
+
+		cookie, _ := r.Cookie("sid")
+		if cookie != nil {
+			received <- cookie.Value
+		} else {
+			received <- ""
+		}
+	}))
+	defer server.Close()
+
+	output := NewHTTPOutput(server.URL, &HTTPOutputConfig{workers: 1, cookieJar: "header:X-Client"})
+
+	send := func(path, client string) string {
+		output.Write([]byte("GET " + path + " HTTP/1.1\r\nX-Client: " + client + "\r\nCookie: sid=recorded\r\n\r\n"))
+		return <-received
+	}
+
+	if sid := send("/login", "a"); sid != "recorded" {
+		t.Error("First request should use recorded cookie:", sid)
+	}
+
+	if sid := send("/orders", "a"); sid != "replayed-a" {
+		t.Error("Should use cookie set by replayed server:", sid)
+	}
+
+	if sid := send("/orders", "b"); sid != "recorded" {
+		t.Error("Other session should not get cookies of session a:", sid)
+	}
+
+	send("/logout", "a")
+
+	if sid := send("/orders", "a"); sid != "recorded" {
+		t.Error("Deleted cookie should not replace recorded one:", sid)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/buger/gor/proto"
+)
+
+// csrfTarget describes where token is sent in requests: header, form body param or URL query param
+type csrfTarget struct {
+	kind string
+	name []byte
+}
+
+type csrfToken struct {
+	value string
+	// Last time token issued or used
+	updated time.Time
+}
+
+// CSRFTokens extracts anti-CSRF tokens from replayed responses, and substitutes them into following requests of the same session.
+// Recorded tokens were issued by original server, so replayed server rejects them.
+//
+// Token replaced only in requests which already send it, e.g. form posts, other requests are not changed.
+type CSRFTokens struct {
+	extract TokenChainRules
+	targets []csrfTarget
+
+	mu        sync.Mutex
+	tokens    map[string]*csrfToken
+	lastClean time.Time
+}
+
+// NewCSRFTokens constructor for CSRFTokens. Targets have `header:<name>`, `param:<name>` (form body) or `query:<name>` format.
+func NewCSRFTokens(extract TokenChainRules, targets []string) *CSRFTokens {
+	c := &CSRFTokens{
+		extract:   extract,
+		tokens:    make(map[string]*csrfToken),
+		lastClean: time.Now(),
+	}
+
+	if len(targets) == 0 {
+		log.Fatal("[CSRF] Specify where token is sent using --output-http-csrf-inject")
+	}
+
+	for _, target := range targets {
+		split := strings.SplitN(target, ":", 2)
+
+		if len(split) != 2 || split[1] == "" || (split[0] != "header" && split[0] != "param" && split[0] != "query") {
+			log.Fatal("[CSRF] Target should be 'header:<name>', 'param:<name>' or 'query:<name>': ", target)
+		}
+
+		c.targets = append(c.targets, csrfTarget{kind: split[0], name: []byte(split[1])})
+	}
+
+	return c
+}
+
+// Update remembers token found in replayed response. Session can be empty, then token shared by all requests.
+func (c *CSRFTokens) Update(session string, response []byte) {
+	var value string
+
+	for _, v := range c.extract.extract(response) {
+		if v != "" {
+			value = v
+			break
+		}
+	}
+
+	if value == "" {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.tokens[session] = &csrfToken{value: value, updated: time.Now()}
+
+	c.cleanup()
+}
+
+// Apply replaces recorded token in request with the last token issued to the session
+func (c *CSRFTokens) Apply(session string, request []byte) []byte {
+	c.mu.Lock()
+	token, ok := c.tokens[session]
+	if ok {
+		token.updated = time.Now()
+	}
+	c.mu.Unlock()
+
+	if !ok {
+		return request
+	}
+
+	for _, target := range c.targets {
+		switch target.kind {
+		case "header":
+			if len(proto.Header(request, target.name)) > 0 {
+				request = proto.SetHeader(request, target.name, []byte(token.value))
+			}
+		case "param":
+			if _, found := proto.BodyParam(request, target.name); found {
+				request = proto.SetBodyParam(request, target.name, []byte(url.QueryEscape(token.value)))
+			}
+		case "query":
+			if _, vs, _ := proto.PathParam(request, target.name); vs != -1 {
+				request = proto.SetPathParam(request, target.name, []byte(url.QueryEscape(token.value)))
+			}
+		}
+	}
+
+	return request
+}
+
+// cleanup removes tokens of sessions which ended, same period as cookie jar
+func (c *CSRFTokens) cleanup() {
+	if time.Since(c.lastClean) < time.Minute {
+		return
+	}
+
+	for session, token := range c.tokens {
+		if time.Since(token.updated) > cookieJarSessionTTL {
+			delete(c.tokens, session)
+		}
+	}
+
+	c.lastClean = time.Now()
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPOutputCSRF(t *testing.T) {
+	received := make(chan string, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			w.Write([]byte(`<form><input type="hidden" name="csrf_token" value="replayed+` + r.Header.Get("X-Client") + `"></form>`))
+			received <- ""
+			return
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		received <- r.Header.Get("X-CSRF-Token") + " " + string(body)
+	}))
+	defer server.Close()
+
+	var extract TokenChainRules
+	extract.Set(`regexp:name="csrf_token" value="([^"]+)"`)
+
+	output := NewHTTPOutput(server.URL, &HTTPOutputConfig{
+		workers:    1,
+		cookieJar:  "header:X-Client",
+		csrf:       extract,
+		csrfInject: MultiOption{"param:csrf_token", "header:X-CSRF-Token"},
+	})
+
+	post := func(client string) string {
+		output.Write([]byte("POST /form HTTP/1.1\r\nX-Client: " + client + "\r\nX-CSRF-Token: recorded\r\nContent-Type: application/x-www-form-urlencoded\r\nContent-Length: 27\r\n\r\ncsrf_token=recorded&name=me"))
+		return <-received
+	}
+
+	if got := post("a"); got != "recorded csrf_token=recorded&name=me" {
+		t.Error("Should send recorded token before replayed server issued one:", got)
+	}
+
+	output.Write([]byte("GET /form HTTP/1.1\r\nX-Client: a\r\n\r\n"))
+	<-received
+
+	if got := post("a"); got != "replayed+a csrf_token=replayed%2Ba&name=me" {
+		t.Error("Should substitute token issued by replayed server:", got)
+	}
+
+	if got := post("b"); got != "recorded csrf_token=recorded&name=me" {
+		t.Error("Other session should not get token of session a:", got)
+	}
+}
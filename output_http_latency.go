@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"math/bits"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Latency histogram keeps values in microseconds. Values below 2*latencySubBuckets counted exactly, bigger ones
+// in buckets with 1/latencySubBuckets relative width, like HDR histogram with 2 significant digits.
+// So percentiles are precise at any rate, unlike sampling. Only buckets with values are stored, response times of
+// an endpoint usually fall into few dozens of them.
+const (
+	latencySubBucketBits = 7
+	latencySubBuckets    = 1 << latencySubBucketBits
+
+	// Longer requests counted as taking 1 hour
+	latencyMaxValue = int64(time.Hour / time.Microsecond)
+)
+
+// Requests of new endpoints counted as "other" when this number of endpoints reached, so arbitrary paths
+// do not use unlimited memory
+const latencyMaxEndpoints = 100
+
+// latencyBucketIndex returns index of bucket holding value
+func latencyBucketIndex(v int64) int {
+	if v < 2*latencySubBuckets {
+		return int(v)
+	}
+
+	shift := bits.Len64(uint64(v)) - latencySubBucketBits - 1
+
+	return (shift+1)*latencySubBuckets + int(v>>uint(shift)) - latencySubBuckets
+}
+
+// latencyBucketValue returns middle of bucket range
+func latencyBucketValue(index int) int64 {
+	if index < 2*latencySubBuckets {
+		return int64(index)
+	}
+
+	shift := uint(index/latencySubBuckets - 1)
+	lowest := int64(index%latencySubBuckets+latencySubBuckets) << shift
+
+	return lowest + int64(1)<<shift/2
+}
+
+// latencyHistogram counts replayed requests by response time, counts keyed by bucket index
+type latencyHistogram struct {
+	counts map[int]int64
+	total  int64
+	max    int64
+}
+
+func newLatencyHistogram() *latencyHistogram {
+	return &latencyHistogram{counts: make(map[int]int64)}
+}
+
+func (h *latencyHistogram) record(d time.Duration) {
+	v := int64(d / time.Microsecond)
+
+	if v < 0 {
+		v = 0
+	} else if v > latencyMaxValue {
+		v = latencyMaxValue
+	}
+
+	h.counts[latencyBucketIndex(v)]++
+	h.total++
+
+	if v > h.max {
+		h.max = v
+	}
+}
+
+// merge adds values counted by other histogram
+func (h *latencyHistogram) merge(other *latencyHistogram) {
+	for i, n := range other.counts {
+		h.counts[i] += n
+	}
+
+	h.total += other.total
+
+	if other.max > h.max {
+		h.max = other.max
+	}
+}
+
+// percentile returns value below which given percent of values fall
+func (h *latencyHistogram) percentile(p float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+
+	rank := int64(p/100*float64(h.total) + 0.5)
+	if rank < 1 {
+		rank = 1
+	}
+
+	buckets := make([]int, 0, len(h.counts))
+	for i := range h.counts {
+		buckets = append(buckets, i)
+	}
+	sort.Ints(buckets)
+
+	last := latencyBucketIndex(h.max)
+
+	var seen int64
+	for _, i := range buckets {
+		if seen += h.counts[i]; seen >= rank && i < last {
+			return time.Duration(latencyBucketValue(i)) * time.Microsecond
+		}
+	}
+
+	return time.Duration(h.max) * time.Microsecond
+}
+
+// httpLatencyStats tracks response times of replayed server per endpoint, and periodically logs their percentiles.
+// Histograms reset after each report, and the last report written on exit.
+type httpLatencyStats struct {
+	sync.Mutex
+
+	address   string
+	endpoints map[string]*latencyHistogram
+}
+
+func newHTTPLatencyStats(address string, interval time.Duration) *httpLatencyStats {
+	s := &httpLatencyStats{address: address, endpoints: make(map[string]*latencyHistogram)}
+
+	go s.reportLoop(interval)
+
+	return s
+}
+
+// add records response time of replayed request
+func (s *httpLatencyStats) add(request []byte, d time.Duration) {
+	key := endpoint(request)
+
+	s.Lock()
+	defer s.Unlock()
+
+	h, ok := s.endpoints[key]
+	if !ok {
+		if len(s.endpoints) >= latencyMaxEndpoints {
+			key = "other"
+			h = s.endpoints[key]
+		}
+
+		if h == nil {
+			h = newLatencyHistogram()
+			s.endpoints[key] = h
+		}
+	}
+
+	h.record(d)
+}
+
+func (s *httpLatencyStats) reportLoop(interval time.Duration) {
+	for range time.Tick(interval) {
+		s.report()
+	}
+}
+
+// report logs percentiles of requests replayed since previous report
+func (s *httpLatencyStats) report() {
+	s.Lock()
+	endpoints := s.endpoints
+	s.endpoints = make(map[string]*latencyHistogram)
+	s.Unlock()
+
+	if len(endpoints) > 0 {
+		log.Print(string(latencyStatsReport(s.address, endpoints)))
+	}
+}
+
+// latencyStatsReport formats table with latency percentiles, histogram of all endpoints goes first
+func latencyStatsReport(address string, endpoints map[string]*latencyHistogram) []byte {
+	keys := make([]string, 0, len(endpoints))
+	all := newLatencyHistogram()
+
+	for key, h := range endpoints {
+		keys = append(keys, key)
+		all.merge(h)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "[HTTP-LATENCY] Response time of %s\n", address)
+
+	write := func(key string, h *latencyHistogram) {
+		fmt.Fprintf(&buf, "%-40s count=%d  p50=%v  p90=%v  p99=%v  p999=%v  max=%v\n", key, h.total,
+			roundLatency(h.percentile(50)), roundLatency(h.percentile(90)), roundLatency(h.percentile(99)), roundLatency(h.percentile(99.9)),
+			roundLatency(time.Duration(h.max)*time.Microsecond))
+	}
+
+	write("all", all)
+	for _, key := range keys {
+		write(key, endpoints[key])
+	}
+
+	return buf.Bytes()
+}
+
+// roundLatency keeps 3 significant digits, which is precision of histogram
+func roundLatency(d time.Duration) time.Duration {
+	unit := time.Microsecond
+	for unit*1000 <= d {
+		unit *= 10
+	}
+
+	return d.Round(unit)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/buger/gor/proto"
+)
+
+// Delay between retries doubled after each attempt, up to this value
+const maxRetryBackoff = 10 * time.Second
+
+// HTTPRetryConfig holds retry options of http output
+type HTTPRetryConfig struct {
+	// Maximum number of attempts, including first one. 1 disables retries
+	attempts int
+	// Delay before first retry
+	backoff time.Duration
+	// Comma separated status codes, responses with which retried, e.g. "502,503,504"
+	status string
+	// Retry connection errors of requests with methods like POST. Server could apply them before error
+	nonIdempotent bool
+}
+
+// httpRetry decides if failed replay request should be sent again, and how long to wait before it.
+// Connection errors retried for idempotent requests, and responses only with configured status codes.
+type httpRetry struct {
+	config *HTTPRetryConfig
+	status map[string]bool
+}
+
+func newHTTPRetry(config *HTTPRetryConfig) *httpRetry {
+	r := &httpRetry{config: config, status: make(map[string]bool)}
+
+	for _, code := range strings.Split(config.status, ",") {
+		code = strings.TrimSpace(code)
+		if code == "" {
+			continue
+		}
+
+		if n, err := strconv.Atoi(code); err != nil || n < 100 || n > 599 {
+			log.Fatal("[HTTP-RETRY] Invalid status code: ", code)
+		}
+
+		r.status[code] = true
+	}
+
+	return r
+}
+
+// Methods which can be applied many times with the same result, RFC 7231 section 4.2.2
+var idempotentMethods = map[string]bool{"GET": true, "HEAD": true, "OPTIONS": true, "TRACE": true, "PUT": true, "DELETE": true}
+
+// shouldRetry returns true if request failed and can be sent again. Attempt starts from 1.
+func (r *httpRetry) shouldRetry(attempt int, request, response []byte, err error) bool {
+	if attempt >= r.config.attempts {
+		return false
+	}
+
+	if err != nil || len(response) == 0 {
+		return r.config.nonIdempotent || idempotentMethods[string(proto.Method(request))]
+	}
+
+	return r.status[string(proto.Status(response))]
+}
+
+// delay returns time to wait before next attempt
+func (r *httpRetry) delay(attempt int) time.Duration {
+	if r.config.backoff <= 0 {
+		return 0
+	}
+
+	delay := r.config.backoff
+	for i := 1; i < attempt && delay < maxRetryBackoff; i++ {
+		delay *= 2
+	}
+
+	if delay > maxRetryBackoff {
+		return maxRetryBackoff
+	}
+
+	return delay
+}
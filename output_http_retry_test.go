@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/buger/gor/proto"
+)
+
+func TestHTTPRetry(t *testing.T) {
+	r := newHTTPRetry(&HTTPRetryConfig{attempts: 3, backoff: 100 * time.Millisecond, status: "502, 503"})
+	get := []byte("GET / HTTP/1.1\r\n\r\n")
+	post := []byte("POST / HTTP/1.1\r\n\r\n")
+
+	if !r.shouldRetry(1, get, nil, errors.New("connection reset")) {
+		t.Error("Should retry connection errors")
+	}
+
+	if r.shouldRetry(1, post, nil, errors.New("connection reset")) {
+		t.Error("Should not retry connection errors of non-idempotent requests")
+	}
+
+	if !r.shouldRetry(2, post, []byte("HTTP/1.1 503 Service Unavailable\r\n\r\n"), nil) {
+		t.Error("Should retry configured status")
+	}
+
+	if r.shouldRetry(1, get, []byte("HTTP/1.1 500 Internal Server Error\r\n\r\n"), nil) {
+		t.Error("Should not retry other status")
+	}
+
+	if r.shouldRetry(3, get, nil, errors.New("connection reset")) {
+		t.Error("Should stop after max attempts")
+	}
+
+	if r := newHTTPRetry(&HTTPRetryConfig{attempts: 3, nonIdempotent: true}); !r.shouldRetry(1, post, nil, errors.New("connection reset")) {
+		t.Error("Should retry non-idempotent requests if allowed")
+	}
+
+	for attempt, expected := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 4: 800 * time.Millisecond, 100: maxRetryBackoff} {
+		if delay := r.delay(attempt); delay != expected {
+			t.Error("Wrong delay of attempt", attempt, delay)
+		}
+	}
+}
+
+func TestHTTPOutputRetry(t *testing.T) {
+	var requests int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	output := NewHTTPOutput(server.URL, &HTTPOutputConfig{
+		trackResponses: true,
+		retry:          HTTPRetryConfig{attempts: 3, backoff: time.Millisecond, status: "502"},
+	}).(*HTTPOutput)
+
+	output.Write(append(payloadHeader(RequestPayload, uuid(), 1), "GET / HTTP/1.1\r\n\r\n"...))
+
+	buf := make([]byte, 1000)
+	n, _ := output.Read(buf)
+
+	if status := proto.Status(payloadBody(buf[:n])); string(status) != "200" {
+		t.Error("Should return response of successful attempt:", string(buf[:n]))
+	}
+
+	if atomic.LoadInt32(&requests) != 3 {
+		t.Error("Should retry failed requests:", requests)
+	}
+}
+
+func TestHTTPOutputRetryOptions(t *testing.T) {
+	global := HTTPRetryConfig{attempts: 2, backoff: time.Second, status: "502"}
+	retry := global
+
+	if address, _, _ := parseHTTPOutputOptions("staging.com|retry=5,retry-status=503;504,retry-non-idempotent=true", &retry); address != "staging.com" {
+		t.Error("Wrong address:", address)
+	}
+
+	if retry.attempts != 5 || retry.backoff != time.Second || retry.status != "503,504" || !retry.nonIdempotent {
+		t.Error("Should override retry options of output:", retry)
+	}
+
+	if global.attempts != 2 || global.status != "502" {
+		t.Error("Should not change options of other outputs:", global)
+	}
+}
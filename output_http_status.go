@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/buger/gor/proto"
+)
+
+// statusCounts holds number of replayed responses per status class, index is first digit of status code.
+// Requests failed without response counted at index 0.
+type statusCounts [6]int
+
+func (c *statusCounts) total() (total int) {
+	for _, n := range c {
+		total += n
+	}
+
+	return
+}
+
+// httpStatusStats counts responses of replayed server by status class per endpoint, and periodically logs them.
+// Replay which gets only 404 or 5xx responses otherwise looks same as successful one.
+type httpStatusStats struct {
+	sync.Mutex
+
+	address   string
+	endpoints map[string]*statusCounts
+}
+
+func newHTTPStatusStats(address string, interval time.Duration) *httpStatusStats {
+	s := &httpStatusStats{address: address, endpoints: make(map[string]*statusCounts)}
+
+	go s.reportLoop(interval)
+
+	return s
+}
+
+// add counts response of replayed request, response is empty if request failed
+func (s *httpStatusStats) add(request, response []byte) {
+	class := 0
+	if len(response) > 0 {
+		if code, err := strconv.Atoi(string(proto.Status(response))); err == nil && code >= 100 && code < 600 {
+			class = code / 100
+		}
+	}
+
+	key := endpoint(request)
+
+	s.Lock()
+	defer s.Unlock()
+
+	c, ok := s.endpoints[key]
+	if !ok {
+		c = new(statusCounts)
+		s.endpoints[key] = c
+	}
+
+	c[class]++
+}
+
+func (s *httpStatusStats) reportLoop(interval time.Duration) {
+	for range time.Tick(interval) {
+		s.Lock()
+		endpoints := s.endpoints
+		s.endpoints = make(map[string]*statusCounts)
+		s.Unlock()
+
+		if len(endpoints) > 0 {
+			log.Print(string(statusReport(s.address, endpoints)))
+		}
+	}
+}
+
+// statusReport formats table with number of responses per status class, total for all endpoints goes first
+func statusReport(address string, endpoints map[string]*statusCounts) []byte {
+	keys := make([]string, 0, len(endpoints))
+	all := new(statusCounts)
+
+	for key, c := range endpoints {
+		keys = append(keys, key)
+
+		for i, n := range c {
+			all[i] += n
+		}
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "[HTTP-STATUS] Responses of %s\n", address)
+
+	write := func(key string, c *statusCounts) {
+		fmt.Fprintf(&buf, "%-40s count=%d  2xx=%d  3xx=%d  4xx=%d  5xx=%d  errors=%d\n", key, c.total(), c[2], c[3], c[4], c[5], c[0])
+	}
+
+	write("all", all)
+	for _, key := range keys {
+		write(key, endpoints[key])
+	}
+
+	return buf.Bytes()
+}
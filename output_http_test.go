@@ -1,13 +1,17 @@
 package main
 
 import (
+	"bytes"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	_ "net/http/httputil"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -76,6 +80,82 @@ func TestHTTPOutput(t *testing.T) {
 	Settings.modifierConfig = HTTPModifierConfig{}
 }
 
+func TestHTTPOutputHost(t *testing.T) {
+	wg := new(sync.WaitGroup)
+	quit := make(chan int)
+
+	input := NewTestInput()
+
+	hosts := make(map[string]int)
+	mu := new(sync.Mutex)
+
+	listener := startHTTP(func(req *http.Request) {
+		mu.Lock()
+		hosts[req.Host]++
+		mu.Unlock()
+
+		wg.Done()
+	})
+
+	if address, host, _ := parseHTTPOutputOptions("10.0.0.5:80|host=api.staging.local", &HTTPRetryConfig{}); address != "10.0.0.5:80" || host != "api.staging.local" {
+		t.Error("Should parse host option:", address, host)
+	}
+
+	Plugins.Inputs = []io.Reader{input}
+	Plugins.Outputs = []io.Writer{
+		NewHTTPOutput(listener.Addr().String()+"|host=api.staging.local", &HTTPOutputConfig{}),
+		NewHTTPOutput(listener.Addr().String()+"|host=web.staging.local:8080", &HTTPOutputConfig{}),
+	}
+
+	go Start(quit)
+
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		input.EmitGET()
+	}
+
+	wg.Wait()
+
+	if hosts["api.staging.local"] != 10 || hosts["web.staging.local:8080"] != 10 {
+		t.Error("Each target should get its Host header:", hosts)
+	}
+
+	close(quit)
+}
+
+func TestHTTPOutputMultiply(t *testing.T) {
+	wg := new(sync.WaitGroup)
+
+	paths := make(map[string]int)
+	mu := new(sync.Mutex)
+
+	listener := startHTTP(func(req *http.Request) {
+		mu.Lock()
+		paths[req.URL.Path]++
+		mu.Unlock()
+
+		wg.Done()
+	})
+	defer listener.Close()
+
+	output := NewHTTPOutput(listener.Addr().String(), &HTTPOutputConfig{multiply: 3, multiplyJitter: 10 * time.Millisecond})
+
+	wg.Add(6)
+	output.Write([]byte("GET /a HTTP/1.1\r\n\r\n"))
+	output.Write(append(payloadHeader(RequestPayload, []byte("8ab3d30a1ad8e7d8f1b8c2f3"), 1), []byte("GET /b HTTP/1.1\r\n\r\n")...))
+
+	wg.Wait()
+
+	if paths["/a"] != 3 || paths["/b"] != 3 {
+		t.Error("Each request should be sent 3 times:", paths)
+	}
+
+	payload := append(payloadHeader(RequestPayload, []byte("8ab3d30a1ad8e7d8f1b8c2f3"), 1), []byte("GET /b HTTP/1.1\r\n\r\n")...)
+	if copied := multipliedPayload(payload); string(payloadID(copied)) == "8ab3d30a1ad8e7d8f1b8c2f3" || string(payloadBody(copied)) != "GET /b HTTP/1.1\r\n\r\n" || string(payloadMeta(copied)[2]) != "1" {
+		t.Errorf("Copy should get new id: %q", copied)
+	}
+}
+
 func TestOutputHTTPSSL(t *testing.T) {
 	wg := new(sync.WaitGroup)
 	quit := make(chan int)
@@ -86,7 +166,7 @@ func TestOutputHTTPSSL(t *testing.T) {
 	}))
 
 	input := NewTestInput()
-	output := NewHTTPOutput(server.URL, &HTTPOutputConfig{})
+	output := NewHTTPOutput(server.URL, &HTTPOutputConfig{tlsSkipVerify: true})
 
 	Plugins.Inputs = []io.Reader{input}
 	Plugins.Outputs = []io.Writer{output}
@@ -102,6 +182,67 @@ func TestOutputHTTPSSL(t *testing.T) {
 	close(quit)
 }
 
+func TestHTTPOutputTLSVerify(t *testing.T) {
+	requests := make(chan string, 1)
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- r.URL.Path
+	}))
+	defer server.Close()
+
+	certFile, keyFile := writeServerCert(server)
+
+	settings, _, err := buildSettings([]string{"--output-http-tls-ca", certFile}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if settings.outputHTTPConfig.tlsSkipVerify {
+		t.Error("CA should enable verification")
+	}
+
+	output := NewHTTPOutput(server.URL, &settings.outputHTTPConfig)
+	output.Write([]byte("GET /verified HTTP/1.1\r\n\r\n"))
+
+	if path := <-requests; path != "/verified" {
+		t.Error("Should verify certificate using given CA:", path)
+	}
+
+	if settings, _, _ = buildSettings(nil, map[string][]string{"output-http-tls-cert": {certFile}, "output-http-tls-key": {keyFile}}, nil); settings.outputHTTPConfig.tlsSkipVerify {
+		t.Error("Client certificate should enable verification")
+	}
+
+	// Client certificate presented to target with self-signed certificate
+	if settings, _, _ = buildSettings([]string{"--output-http-tls-cert", certFile, "--output-http-tls-skip-verify"}, nil, nil); !settings.outputHTTPConfig.tlsSkipVerify {
+		t.Error("Explicit option should not be overridden")
+	}
+
+	if settings, _, _ = buildSettings(nil, nil, nil); !settings.outputHTTPConfig.tlsSkipVerify {
+		t.Error("Should skip verification by default")
+	}
+}
+
+func TestHTTPOutputTrackResponse(t *testing.T) {
+	listener := startHTTP(func(req *http.Request) {})
+
+	output := NewHTTPOutput(listener.Addr().String(), &HTTPOutputConfig{trackResponses: true}).(*HTTPOutput)
+
+	id := uuid()
+	output.Write(append(payloadHeader(RequestPayload, id, 1), "GET / HTTP/1.1\r\n\r\n"...))
+
+	buf := make([]byte, 1024)
+	n, _ := output.Read(buf)
+	resp := buf[:n]
+
+	if resp[0] != ReplayedResponsePayload || !bytes.Equal(payloadID(resp), id) {
+		t.Error("Should emit replayed response with request id:", string(resp))
+	}
+
+	if !bytes.HasPrefix(payloadBody(resp), []byte("HTTP/1.1 200")) {
+		t.Error("Should contain response:", string(resp))
+	}
+}
+
 func BenchmarkHTTPOutput(b *testing.B) {
 	wg := new(sync.WaitGroup)
 	quit := make(chan int)
@@ -128,3 +269,182 @@ func BenchmarkHTTPOutput(b *testing.B) {
 
 	close(quit)
 }
+
+func TestHTTPOutputWorkersMax(t *testing.T) {
+	release := make(chan bool)
+	var mu sync.Mutex
+	concurrent, maxConcurrent := 0, 0
+
+	listener := startHTTP(func(req *http.Request) {
+		mu.Lock()
+		concurrent++
+		if concurrent > maxConcurrent {
+			maxConcurrent = concurrent
+		}
+		mu.Unlock()
+
+		<-release
+
+		mu.Lock()
+		concurrent--
+		mu.Unlock()
+	})
+	defer listener.Close()
+
+	output := NewHTTPOutput(listener.Addr().String(), &HTTPOutputConfig{workersMax: 3}).(*HTTPOutput)
+
+	for i := 0; i < 20; i++ {
+		output.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+	}
+
+	time.Sleep(200 * time.Millisecond)
+
+	mu.Lock()
+	if maxConcurrent != 3 {
+		t.Error("Should send requests using limited number of workers:", maxConcurrent)
+	}
+	mu.Unlock()
+
+	if workers := atomic.LoadInt64(&output.activeWorkers); workers != 3 {
+		t.Error("Should not start more workers than limit:", workers)
+	}
+
+	close(release)
+}
+
+func TestHTTPStatusStats(t *testing.T) {
+	stats := &httpStatusStats{endpoints: make(map[string]*statusCounts)}
+
+	stats.add([]byte("GET /users/1 HTTP/1.1\r\n\r\n"), []byte("HTTP/1.1 404 Not Found\r\n\r\n"))
+	stats.add([]byte("GET /users/2 HTTP/1.1\r\n\r\n"), []byte("HTTP/1.1 200 OK\r\n\r\n"))
+	stats.add([]byte("GET /users/3 HTTP/1.1\r\n\r\n"), nil)
+	stats.add([]byte("POST / HTTP/1.1\r\n\r\n"), []byte("HTTP/1.1 503 Service Unavailable\r\n\r\n"))
+
+	if c := stats.endpoints["GET /users/:id"]; c == nil || c.total() != 3 || c[2] != 1 || c[4] != 1 || c[0] != 1 {
+		t.Fatal("Should count responses per status class:", stats.endpoints)
+	}
+
+	report := string(statusReport("staging.com", stats.endpoints))
+	lines := strings.Split(strings.TrimSpace(report), "\n")
+
+	if len(lines) != 4 || !strings.Contains(lines[1], "count=4  2xx=1  3xx=0  4xx=1  5xx=1  errors=1") || !strings.HasPrefix(lines[2], "GET /users/:id ") {
+		t.Error("Should report totals and endpoints:\n", report)
+	}
+}
+
+func TestLatencyHistogram(t *testing.T) {
+	h := newLatencyHistogram()
+
+	for i := 1; i <= 1000; i++ {
+		h.record(time.Duration(i) * time.Millisecond)
+	}
+
+	for p, expected := range map[float64]time.Duration{50: 500 * time.Millisecond, 90: 900 * time.Millisecond, 99: 990 * time.Millisecond, 99.9: 999 * time.Millisecond} {
+		if v := h.percentile(p); v < expected*99/100 || v > expected*101/100 {
+			t.Errorf("p%v should be %v with 1%% precision: %v", p, expected, v)
+		}
+	}
+
+	if h.percentile(100) != time.Second || h.max != int64(time.Second/time.Microsecond) {
+		t.Error("Should keep max value:", h.percentile(100))
+	}
+
+	h.record(2 * time.Hour)
+	if h.percentile(100) != time.Hour {
+		t.Error("Should limit huge values:", h.percentile(100))
+	}
+
+	// Small values counted exactly
+	h = newLatencyHistogram()
+	h.record(150 * time.Microsecond)
+
+	if h.percentile(50) != 150*time.Microsecond {
+		t.Error("Wrong percentile of small values:", h.percentile(50))
+	}
+}
+
+func TestHTTPLatencyStats(t *testing.T) {
+	stats := &httpLatencyStats{endpoints: make(map[string]*latencyHistogram)}
+
+	stats.add([]byte("GET /users/1 HTTP/1.1\r\n\r\n"), 10*time.Millisecond)
+	stats.add([]byte("GET /users/2 HTTP/1.1\r\n\r\n"), 30*time.Millisecond)
+	stats.add([]byte("POST / HTTP/1.1\r\n\r\n"), 100*time.Millisecond)
+
+	report := string(latencyStatsReport("staging.com", stats.endpoints))
+	lines := strings.Split(strings.TrimSpace(report), "\n")
+
+	if len(lines) != 4 || !strings.Contains(lines[1], "count=3  p50=30ms") || !strings.Contains(lines[1], "max=100ms") ||
+		!strings.HasPrefix(lines[2], "GET /users/:id ") || !strings.Contains(lines[2], "count=2  p50=10ms") {
+		t.Error("Should report percentiles of all requests and of endpoints:\n", report)
+	}
+	for i := 0; i < latencyMaxEndpoints*2; i++ {
+		stats.add([]byte(fmt.Sprintf("GET /page%d HTTP/1.1\r\n\r\n", i)), time.Millisecond)
+	}
+
+	if len(stats.endpoints) != latencyMaxEndpoints+1 || stats.endpoints["other"].total == 0 {
+		t.Error("Should count requests of new endpoints as other:", len(stats.endpoints))
+	}
+}
+
+func TestHTTPOutputTraceparent(t *testing.T) {
+	headers := make(chan string, 2)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header.Get("Traceparent")
+	}))
+	defer server.Close()
+
+	output := NewHTTPOutput(server.URL, &HTTPOutputConfig{traceparent: traceparentPropagate})
+
+	output.Write([]byte("GET / HTTP/1.1\r\nTraceparent: 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01\r\n\r\n"))
+
+	if header := <-headers; !strings.HasPrefix(header, "00-4bf92f3577b34da6a3ce929d0e0e4736-") || strings.Contains(header, "00f067aa0ba902b7") {
+		t.Error("Should continue recorded trace:", header)
+	}
+
+	output.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+
+	if _, ok := parseTraceparent([]byte(<-headers)); !ok {
+		t.Error("Should start new trace")
+	}
+}
+
+func TestHTTPOutputRealIP(t *testing.T) {
+	headers := make(chan string, 2)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header.Get("X-Forwarded-For")
+	}))
+	defer server.Close()
+
+	output := NewHTTPOutput(server.URL, &HTTPOutputConfig{realIPHeader: "X-Forwarded-For"})
+
+	output.Write([]byte("1 8ab3d30a1ad8e7d8f1b8c2f3 1 10.0.0.1\nGET / HTTP/1.1\r\nX-Forwarded-For: 192.168.0.1\r\n\r\n"))
+
+	if header := <-headers; header != "192.168.0.1, 10.0.0.1" {
+		t.Error("Should append recorded IP to forwarded list:", header)
+	}
+
+	output.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+
+	if header := <-headers; header != "" {
+		t.Error("Should not add header without recorded IP:", header)
+	}
+}
+
+func TestSetRealIP(t *testing.T) {
+	ip := []byte("10.0.0.1")
+
+	if data := setRealIP([]byte("GET / HTTP/1.1\r\n\r\n"), "X-Forwarded-For", ip); string(data) != "GET / HTTP/1.1\r\nX-Forwarded-For: 10.0.0.1\r\n\r\n" {
+		t.Error("Should add forwarded header:", string(data))
+	}
+
+	if data := setRealIP([]byte("GET / HTTP/1.1\r\nX-Real-IP: 1.1.1.1\r\n\r\n"), "X-Real-IP", ip); string(data) != "GET / HTTP/1.1\r\nX-Real-IP: 10.0.0.1\r\n\r\n" {
+		t.Error("Should replace real IP header:", string(data))
+	}
+
+	payload := []byte("1 8ab3d30a1ad8e7d8f1b8c2f3 1 10.0.0.1\nGET / HTTP/1.1\r\n\r\n")
+	if copied := multipliedPayload(payload); string(payloadIP(copied)) != "10.0.0.1" {
+		t.Error("Multiplied request should keep recorded IP:", string(copied))
+	}
+}
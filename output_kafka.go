@@ -0,0 +1,108 @@
+package main
+
+import (
+	"io"
+	"log"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// KafkaOutputConfig holds configuration for Kafka output
+type KafkaOutputConfig struct {
+	// hash, random or roundrobin
+	partitioner string
+	// none, gzip or snappy
+	compression string
+}
+
+// KafkaOutput publishes each request to Kafka topic.
+// Message value is typed payload (see protocol.go), so it keeps request id and timestamp,
+// and message key is request id, so request and its responses land to the same partition.
+type KafkaOutput struct {
+	address  string
+	topic    string
+	producer sarama.AsyncProducer
+	config   *KafkaOutputConfig
+}
+
+// NewKafkaOutput constructor for KafkaOutput, accepts address in `broker1:9092,broker2:9092/topic` format
+func NewKafkaOutput(address string, config *KafkaOutputConfig) io.Writer {
+	o := new(KafkaOutput)
+	o.address = address
+	o.config = config
+
+	brokers, topic, err := parseKafkaAddress(address)
+	if err != nil {
+		log.Fatal("[KAFKA-OUTPUT] ", err)
+	}
+	o.topic = topic
+
+	c := sarama.NewConfig()
+	c.ClientID = "gor"
+
+	switch config.partitioner {
+	case "", "hash":
+		c.Producer.Partitioner = sarama.NewHashPartitioner
+	case "random":
+		c.Producer.Partitioner = sarama.NewRandomPartitioner
+	case "roundrobin":
+		c.Producer.Partitioner = sarama.NewRoundRobinPartitioner
+	default:
+		log.Fatal("[KAFKA-OUTPUT] Unknown partitioner: ", config.partitioner)
+	}
+
+	switch config.compression {
+	case "", "none":
+		c.Producer.Compression = sarama.CompressionNone
+	case "gzip":
+		c.Producer.Compression = sarama.CompressionGZIP
+	case "snappy":
+		c.Producer.Compression = sarama.CompressionSnappy
+	default:
+		log.Fatal("[KAFKA-OUTPUT] Unknown compression: ", config.compression)
+	}
+
+	if o.producer, err = sarama.NewAsyncProducer(brokers, c); err != nil {
+		log.Fatal("[KAFKA-OUTPUT] Can't connect to Kafka: ", err)
+	}
+
+	go o.handleErrors()
+
+	return o
+}
+
+func (o *KafkaOutput) handleErrors() {
+	for err := range o.producer.Errors() {
+		log.Println("[KAFKA-OUTPUT] Failed to publish message:", err.Err)
+	}
+}
+
+func (o *KafkaOutput) Write(data []byte) (n int, err error) {
+	var value []byte
+
+	// Payloads without meta line get it, so consumers always receive id and timestamp
+	if hasPayloadHeader(data) {
+		value = make([]byte, len(data))
+		copy(value, data)
+	} else {
+		value = append(payloadHeader(RequestPayload, uuid(), time.Now().UnixNano()), data...)
+	}
+
+	o.producer.Input() <- &sarama.ProducerMessage{
+		Topic: o.topic,
+		Key:   sarama.ByteEncoder(payloadID(value)),
+		Value: sarama.ByteEncoder(value),
+	}
+
+	return len(data), nil
+}
+
+// Close flushes buffered messages
+func (o *KafkaOutput) Close() error {
+	return o.producer.Close()
+}
+
+func (o *KafkaOutput) String() string {
+	return "Kafka output: " + o.address
+}
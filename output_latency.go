@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/buger/gor/proto"
+)
+
+// Maximum number of samples kept per endpoint during report interval
+const latencySamplesLimit = 10000
+
+// LatencyOutputConfig holds options of latency comparison
+type LatencyOutputConfig struct {
+	interval time.Duration
+}
+
+// endpointLatency holds latency samples of original and replayed responses for single endpoint
+type endpointLatency struct {
+	original []time.Duration
+	replayed []time.Duration
+}
+
+// LatencyOutput compares latency of origin and replayed server, and periodically reports percentiles per endpoint.
+// Requires both `--input-raw-track-response` and `--output-http-track-response`.
+//
+// Original latency is time between captured request and response, replayed latency is round trip time measured by HTTP output.
+type LatencyOutput struct {
+	sync.Mutex
+
+	path   string
+	config *LatencyOutputConfig
+	writer io.Writer
+
+	matcher   *responseMatcher
+	endpoints map[string]*endpointLatency
+}
+
+// NewLatencyOutput constructor for LatencyOutput. Reports written to file at given path, or to stdout if path is "-"
+func NewLatencyOutput(path string, config *LatencyOutputConfig) *LatencyOutput {
+	o := new(LatencyOutput)
+	o.path = path
+	o.config = config
+	o.matcher = newResponseMatcher()
+	o.endpoints = make(map[string]*endpointLatency)
+
+	var err error
+	if o.writer, err = openReport(path); err != nil {
+		log.Fatal("[LATENCY] Can't open report file: ", err)
+	}
+
+	if o.config.interval == 0 {
+		o.config.interval = 10 * time.Second
+	}
+
+	go o.reportLoop()
+
+	return o
+}
+
+func (o *LatencyOutput) Write(data []byte) (int, error) {
+	o.Lock()
+	defer o.Unlock()
+
+	record := o.matcher.add(data)
+
+	// Original latency can't be calculated without request timestamp
+	if record == nil || record.request == nil {
+		return len(data), nil
+	}
+
+	key := endpoint(record.request)
+
+	e, ok := o.endpoints[key]
+	if !ok {
+		e = new(endpointLatency)
+		o.endpoints[key] = e
+	}
+
+	if len(e.original) < latencySamplesLimit {
+		e.original = append(e.original, time.Duration(record.originalTime-record.requestTime))
+		e.replayed = append(e.replayed, time.Duration(record.replayedRTT))
+	}
+
+	return len(data), nil
+}
+
+func (o *LatencyOutput) reportLoop() {
+	for range time.Tick(o.config.interval) {
+		o.Lock()
+		endpoints := o.endpoints
+		o.endpoints = make(map[string]*endpointLatency)
+		o.Unlock()
+
+		if len(endpoints) > 0 {
+			o.writer.Write(latencyReport(endpoints))
+		}
+	}
+}
+
+func (o *LatencyOutput) String() string {
+	return "Latency output: " + o.path
+}
+
+// latencyReport formats table with latency percentiles of original and replayed responses, and difference between them
+func latencyReport(endpoints map[string]*endpointLatency) []byte {
+	keys := make([]string, 0, len(endpoints))
+	for key := range endpoints {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "%s Latency: original / replayed (delta)\n", time.Now().Format("2006/01/02 15:04:05"))
+
+	for _, key := range keys {
+		e := endpoints[key]
+		fmt.Fprintf(&buf, "%-40s count=%d", key, len(e.original))
+
+		for _, p := range []int{50, 90, 99} {
+			original, replayed := percentile(e.original, p), percentile(e.replayed, p)
+
+			sign := ""
+			if replayed >= original {
+				sign = "+"
+			}
+
+			fmt.Fprintf(&buf, "  p%d=%v / %v (%s%v)", p, original, replayed, sign, replayed-original)
+		}
+
+		buf.WriteByte('\n')
+	}
+
+	return buf.Bytes()
+}
+
+// percentile returns p-th percentile of samples, rounded to milliseconds
+func percentile(samples []time.Duration, p int) time.Duration {
+	if len(samples) == 0 {
+		return 0
+	}
+
+	sorted := append([]time.Duration{}, samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	index := (len(sorted)*p+99)/100 - 1
+	if index < 0 {
+		index = 0
+	}
+
+	return sorted[index].Round(time.Millisecond)
+}
+
+// endpoint returns method and path without query. Numeric path segments replaced with `:id`, so resources grouped together
+func endpoint(request []byte) string {
+	path := string(proto.Path(request))
+
+	if i := strings.IndexByte(path, '?'); i != -1 {
+		path = path[:i]
+	}
+
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if segment != "" && strings.Trim(segment, "0123456789") == "" {
+			segments[i] = ":id"
+		}
+	}
+
+	return string(proto.Method(request)) + " " + strings.Join(segments, "/")
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestLatencyEndpoint(t *testing.T) {
+	if e := endpoint([]byte("GET /users/123/posts?page=2 HTTP/1.1\r\n\r\n")); e != "GET /users/:id/posts" {
+		t.Error("Should group numeric ids and strip query:", e)
+	}
+}
+
+func TestLatencyPercentile(t *testing.T) {
+	samples := []time.Duration{}
+	for i := 100; i > 0; i-- {
+		samples = append(samples, time.Duration(i)*time.Millisecond)
+	}
+
+	if p := percentile(samples, 50); p != 50*time.Millisecond {
+		t.Error("Wrong p50:", p)
+	}
+
+	if p := percentile(samples, 99); p != 99*time.Millisecond {
+		t.Error("Wrong p99:", p)
+	}
+}
+
+func TestLatencyOutput(t *testing.T) {
+	output := NewLatencyOutput("/dev/null", &LatencyOutputConfig{interval: time.Hour})
+
+	id := uuid()
+	output.Write(append(payloadHeader(RequestPayload, id, int64(time.Second)), "GET /users/1 HTTP/1.1\r\n\r\n"...))
+	output.Write(append(payloadHeader(ResponsePayload, id, int64(time.Second+10*time.Millisecond)), "HTTP/1.1 200 OK\r\n\r\n"...))
+	output.Write(append(payloadHeader(ReplayedResponsePayload, id, int64(25*time.Millisecond)), "HTTP/1.1 200 OK\r\n\r\n"...))
+
+	report := latencyReport(output.endpoints)
+
+	if !bytes.Contains(report, []byte("GET /users/:id")) || !bytes.Contains(report, []byte("p50=10ms / 25ms (+15ms)")) {
+		t.Error("Should report latency delta:", string(report))
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"sync/atomic"
+)
+
+// NullOutput discards all incoming payloads, only counting them. Used for benchmarking capture and parsing
+// independently of replay target: throughput reported by `--stats`, and by StatsD as `output_null.payloads` and `output_null.bytes`.
+type NullOutput struct {
+	payloads int64
+	bytes    int64
+}
+
+// NewNullOutput constructor for NullOutput
+func NewNullOutput(options string) *NullOutput {
+	return new(NullOutput)
+}
+
+func (o *NullOutput) Write(data []byte) (int, error) {
+	atomic.AddInt64(&o.payloads, 1)
+	atomic.AddInt64(&o.bytes, int64(len(data)))
+
+	statsd.Incr("output_null.payloads", 1)
+	statsd.Incr("output_null.bytes", len(data))
+
+	return len(data), nil
+}
+
+// Stats returns number of discarded payloads and bytes since start
+func (o *NullOutput) Stats() (payloads, bytes int64) {
+	return atomic.LoadInt64(&o.payloads), atomic.LoadInt64(&o.bytes)
+}
+
+func (o *NullOutput) String() string {
+	return "Null output"
+}
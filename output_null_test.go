@@ -0,0 +1,16 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestNullOutput(t *testing.T) {
+	output := NewNullOutput("")
+
+	output.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+	output.Write([]byte("GET /a HTTP/1.1\r\n\r\n"))
+
+	if payloads, bytes := output.Stats(); payloads != 2 || bytes != 37 {
+		t.Error("Should count discarded payloads:", payloads, bytes)
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/binary"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Pcap file constants, see https://wiki.wireshark.org/Development/LibpcapFileFormat
+const (
+	pcapMagic = 0xa1b2c3d4
+	// Packets start with IPv4 header, without link layer
+	pcapLinkTypeRaw = 101
+	pcapSnapLength  = 65535
+	// Payloads split into segments of this size, like on ethernet network
+	pcapSegmentSize = 1460
+)
+
+// Traffic written with synthetic addresses, because payloads do not have original ones
+var (
+	pcapClientIP = net.IPv4(10, 0, 0, 1).To4()
+	pcapServerIP = net.IPv4(10, 0, 0, 2).To4()
+)
+
+// PcapOutputConfig holds configuration for pcap output
+type PcapOutputConfig struct {
+	// Server port in written packets, Wireshark detects protocol by port
+	port int
+}
+
+// pcapConnection holds state of synthetic TCP connection of request, so response continues it
+type pcapConnection struct {
+	clientPort uint16
+	// Next sequence numbers of client and server
+	clientSeq uint32
+	serverSeq uint32
+
+	created time.Time
+}
+
+// PcapOutput writes requests and original responses as pcap file, so they can be inspected in Wireshark.
+// Each request written as separate TCP connection between synthetic client and server addresses, and its response continues the connection.
+type PcapOutput struct {
+	sync.Mutex
+
+	path   string
+	file   *os.File
+	config *PcapOutputConfig
+
+	lastPort uint16
+	// Connections waiting for response, by payload id
+	connections map[string]*pcapConnection
+	lastClean   time.Time
+}
+
+// NewPcapOutput constructor for PcapOutput, accepts path of pcap file
+func NewPcapOutput(path string, config *PcapOutputConfig) *PcapOutput {
+	o := new(PcapOutput)
+	o.path = path
+	o.config = config
+	o.connections = make(map[string]*pcapConnection)
+	o.lastClean = time.Now()
+
+	var err error
+	if o.file, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0660); err != nil {
+		log.Fatal("[PCAP] Can't open file: ", err)
+	}
+
+	header := make([]byte, 24)
+	binary.LittleEndian.PutUint32(header[0:4], pcapMagic)
+	binary.LittleEndian.PutUint16(header[4:6], 2)
+	binary.LittleEndian.PutUint16(header[6:8], 4)
+	binary.LittleEndian.PutUint32(header[16:20], pcapSnapLength)
+	binary.LittleEndian.PutUint32(header[20:24], pcapLinkTypeRaw)
+
+	if _, err = o.file.Write(header); err != nil {
+		log.Fatal("[PCAP] Can't write file: ", err)
+	}
+
+	return o
+}
+
+func (o *PcapOutput) Write(data []byte) (int, error) {
+	o.Lock()
+	defer o.Unlock()
+
+	defer o.cleanup()
+
+	meta := payloadMeta(data)
+	body := payloadBody(data)
+
+	// Payloads without id are requests, which response is not captured
+	if len(meta) < 3 {
+		o.writeSegments(o.newConnection(), body, time.Now(), true)
+		return len(data), nil
+	}
+
+	id := string(meta[1])
+	timestamp, _ := strconv.ParseInt(string(meta[2]), 10, 64)
+
+	switch data[0] {
+	case RequestPayload:
+		conn := o.newConnection()
+		o.connections[id] = conn
+		o.writeSegments(conn, body, time.Unix(0, timestamp), true)
+	case ResponsePayload:
+		conn, ok := o.connections[id]
+		if !ok {
+			// Request was not seen, e.g. it was filtered
+			conn = o.newConnection()
+		}
+		delete(o.connections, id)
+
+		o.writeSegments(conn, body, time.Unix(0, timestamp), false)
+	}
+
+	return len(data), nil
+}
+
+func (o *PcapOutput) newConnection() *pcapConnection {
+	// Ephemeral ports range, reused after it exhausted
+	if o.lastPort < 32768 || o.lastPort == 65535 {
+		o.lastPort = 32768
+	} else {
+		o.lastPort++
+	}
+
+	return &pcapConnection{clientPort: o.lastPort, clientSeq: 1, serverSeq: 1, created: time.Now()}
+}
+
+// writeSegments writes payload as TCP segments sent by client or server
+func (o *PcapOutput) writeSegments(conn *pcapConnection, payload []byte, timestamp time.Time, fromClient bool) {
+	for len(payload) > 0 {
+		size := len(payload)
+		if size > pcapSegmentSize {
+			size = pcapSegmentSize
+		}
+
+		var packet []byte
+		if fromClient {
+			packet = pcapTCPPacket(pcapClientIP, pcapServerIP, conn.clientPort, uint16(o.config.port), conn.clientSeq, conn.serverSeq, payload[:size])
+			conn.clientSeq += uint32(size)
+		} else {
+			packet = pcapTCPPacket(pcapServerIP, pcapClientIP, uint16(o.config.port), conn.clientPort, conn.serverSeq, conn.clientSeq, payload[:size])
+			conn.serverSeq += uint32(size)
+		}
+
+		record := make([]byte, 16, 16+len(packet))
+		binary.LittleEndian.PutUint32(record[0:4], uint32(timestamp.Unix()))
+		binary.LittleEndian.PutUint32(record[4:8], uint32(timestamp.Nanosecond()/1000))
+		binary.LittleEndian.PutUint32(record[8:12], uint32(len(packet)))
+		binary.LittleEndian.PutUint32(record[12:16], uint32(len(packet)))
+
+		if _, err := o.file.Write(append(record, packet...)); err != nil {
+			log.Println("[PCAP] Can't write packet:", err)
+			return
+		}
+
+		payload = payload[size:]
+	}
+}
+
+// cleanup removes connections which never got response
+func (o *PcapOutput) cleanup() {
+	if time.Since(o.lastClean) < time.Minute {
+		return
+	}
+
+	for id, conn := range o.connections {
+		if time.Since(conn.created) > time.Minute {
+			delete(o.connections, id)
+		}
+	}
+
+	o.lastClean = time.Now()
+}
+
+// Close closes pcap file
+func (o *PcapOutput) Close() error {
+	o.Lock()
+	defer o.Unlock()
+
+	return o.file.Close()
+}
+
+func (o *PcapOutput) String() string {
+	return "Pcap output: " + o.path
+}
+
+// pcapTCPPacket builds IPv4 packet with TCP segment, which has PSH and ACK flags set
+func pcapTCPPacket(src, dst net.IP, srcPort, dstPort uint16, seq, ack uint32, data []byte) []byte {
+	packet := make([]byte, 40+len(data))
+
+	ip := packet[:20]
+	ip[0] = 0x45 // IPv4, header of 5 words
+	binary.BigEndian.PutUint16(ip[2:4], uint16(len(packet)))
+	binary.BigEndian.PutUint16(ip[6:8], 0x4000) // Don't fragment
+	ip[8] = 64                                  // TTL
+	ip[9] = 6                                   // TCP
+	copy(ip[12:16], src)
+	copy(ip[16:20], dst)
+	binary.BigEndian.PutUint16(ip[10:12], internetChecksum(ip, 0))
+
+	tcp := packet[20:]
+	binary.BigEndian.PutUint16(tcp[0:2], srcPort)
+	binary.BigEndian.PutUint16(tcp[2:4], dstPort)
+	binary.BigEndian.PutUint32(tcp[4:8], seq)
+	binary.BigEndian.PutUint32(tcp[8:12], ack)
+	tcp[12] = 5 << 4 // Header of 5 words
+	tcp[13] = 0x18   // PSH, ACK
+	binary.BigEndian.PutUint16(tcp[14:16], 65535)
+	copy(tcp[20:], data)
+
+	// Checksum includes pseudo header: addresses, protocol and TCP length
+	pseudo := uint32(6) + uint32(len(tcp))
+	for i := 12; i < 20; i += 2 {
+		pseudo += uint32(binary.BigEndian.Uint16(ip[i : i+2]))
+	}
+	binary.BigEndian.PutUint16(tcp[16:18], internetChecksum(tcp, pseudo))
+
+	return packet
+}
+
+// internetChecksum calculates checksum used by IP and TCP headers, see RFC 1071
+func internetChecksum(data []byte, sum uint32) uint16 {
+	for i := 0; i+1 < len(data); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(data[i : i+2]))
+	}
+
+	if len(data)%2 == 1 {
+		sum += uint32(data[len(data)-1]) << 8
+	}
+
+	for sum > 0xffff {
+		sum = (sum >> 16) + (sum & 0xffff)
+	}
+
+	return ^uint16(sum)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	raw "github.com/buger/gor/raw_socket_listener"
+)
+
+func TestPcapOutput(t *testing.T) {
+	path := "/tmp/gor_test.pcap"
+	defer os.Remove(path)
+
+	output := NewPcapOutput(path, &PcapOutputConfig{port: 80})
+
+	request := "POST / HTTP/1.1\r\nContent-Length: 3000\r\n\r\n" + strings.Repeat("a", 3000)
+	response := "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok"
+	start := time.Unix(100, 0)
+
+	id := uuid()
+	output.Write(append(payloadHeader(RequestPayload, id, start.UnixNano()), request...))
+	output.Write(append(payloadHeader(ReplayedResponsePayload, id, 1), "HTTP/1.1 500 Internal Server Error\r\n\r\n"...))
+	output.Write(append(payloadHeader(ResponsePayload, id, start.Add(time.Millisecond).UnixNano()), response...))
+	output.Close()
+
+	data, _ := ioutil.ReadFile(path)
+
+	if binary.LittleEndian.Uint32(data[0:4]) != pcapMagic || binary.LittleEndian.Uint32(data[20:24]) != pcapLinkTypeRaw {
+		t.Fatal("Should write pcap header")
+	}
+
+	// Written packets reassembled same way as packets of captured files
+	assembler := raw.NewTCPAssembler(80)
+	packets := 0
+
+	for data = data[24:]; len(data) > 0; packets++ {
+		ts := time.Unix(int64(binary.LittleEndian.Uint32(data[0:4])), int64(binary.LittleEndian.Uint32(data[4:8]))*1000)
+		size := binary.LittleEndian.Uint32(data[8:12])
+		packet := data[16 : 16+size]
+		data = data[16+size:]
+
+		if internetChecksum(packet[:20], 0) != 0 {
+			t.Error("Should have valid IP checksum")
+		}
+
+		if len(packet) > 40+pcapSegmentSize {
+			t.Error("Should split payload into segments:", len(packet))
+		}
+
+		assembler.AddPacket(&net.IPAddr{IP: net.IP(packet[12:16])}, packet[20:], ts)
+	}
+
+	if packets != 4 {
+		t.Error("Should write request and original response:", packets)
+	}
+
+	assembler.Flush()
+
+	req, resp := assembler.Next(), assembler.Next()
+
+	if req == nil || !bytes.Equal(req.Bytes(), []byte(request)) || !req.Start.Equal(start) {
+		t.Fatal("Should write request:", req)
+	}
+
+	if resp == nil || !bytes.Equal(resp.Bytes(), []byte(response)) || !bytes.Equal(req.UUID(), resp.UUID()) {
+		t.Error("Response should continue connection of request:", resp)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"log"
+	"sync/atomic"
+)
+
+// Policies applied when output queue is full
+const (
+	// Emitter waits until queue has free space, so slow output slows down all outputs and inputs
+	queuePolicyBlock = "block"
+	// Oldest queued payload dropped to free space, so replay keeps up with live traffic
+	queuePolicyDropOldest = "drop-oldest"
+	// New payload dropped, queued payloads replayed as usual
+	queuePolicyDropNewest = "drop-newest"
+)
+
+const defaultQueueSize = 100
+
+// QueueConfig holds size of output queues, and what to do when they are full
+type QueueConfig struct {
+	size   int
+	policy string
+}
+
+// payloadQueue is bounded queue between emitter and output workers.
+// Workers read payloads from `ch`, and emitter adds them using Push. Workers release payloads once done with them.
+type payloadQueue struct {
+	// Keep this as first element of struct because it guarantees 64bit alignment, required by atomic
+	dropped int64
+
+	ch     chan *payloadBuffer
+	policy string
+}
+
+func newPayloadQueue(config *QueueConfig) *payloadQueue {
+	q := &payloadQueue{policy: config.policy}
+
+	size := config.size
+	if size <= 0 {
+		size = defaultQueueSize
+	}
+
+	switch q.policy {
+	case "":
+		q.policy = queuePolicyBlock
+	case queuePolicyBlock, queuePolicyDropOldest, queuePolicyDropNewest:
+	default:
+		log.Fatal("[QUEUE] Policy should be 'block', 'drop-oldest' or 'drop-newest': ", config.policy)
+	}
+
+	q.ch = make(chan *payloadBuffer, size)
+
+	return q
+}
+
+// Push adds payload to the queue, returns number of payloads dropped because queue was full:
+// new payload itself, or oldest queued payloads. Dropped payloads released.
+func (q *payloadQueue) Push(p *payloadBuffer) (dropped int) {
+	defer func() {
+		atomic.AddInt64(&q.dropped, int64(dropped))
+	}()
+
+	switch q.policy {
+	case queuePolicyDropNewest:
+		select {
+		case q.ch <- p:
+		default:
+			p.release()
+			dropped++
+		}
+
+		return
+	case queuePolicyDropOldest:
+		for {
+			select {
+			case q.ch <- p:
+				return
+			default:
+			}
+
+			// Queue can be emptied by workers meanwhile, then nothing dropped
+			select {
+			case oldest := <-q.ch:
+				oldest.release()
+				dropped++
+			default:
+			}
+		}
+	}
+
+	q.ch <- p
+
+	return
+}
+
+// Len returns number of queued payloads
+func (q *payloadQueue) Len() int {
+	return len(q.ch)
+}
+
+// Cap returns maximum number of queued payloads
+func (q *payloadQueue) Cap() int {
+	return cap(q.ch)
+}
+
+// Dropped returns number of payloads dropped since start
+func (q *payloadQueue) Dropped() int64 {
+	return atomic.LoadInt64(&q.dropped)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPayloadQueue(t *testing.T) {
+	fill := func(policy string) *payloadQueue {
+		q := newPayloadQueue(&QueueConfig{size: 2, policy: policy})
+		q.Push(newPayloadBuffer([]byte("1")))
+		q.Push(newPayloadBuffer([]byte("2")))
+
+		return q
+	}
+
+	q := fill(queuePolicyDropNewest)
+	if dropped := q.Push(newPayloadBuffer([]byte("3"))); dropped != 1 || string((<-q.ch).data) != "1" || string((<-q.ch).data) != "2" {
+		t.Error("Should drop new payload:", dropped)
+	}
+
+	q = fill(queuePolicyDropOldest)
+	if dropped := q.Push(newPayloadBuffer([]byte("3"))); dropped != 1 || string((<-q.ch).data) != "2" || string((<-q.ch).data) != "3" {
+		t.Error("Should drop oldest payload:", dropped)
+	}
+
+	if q.Dropped() != 1 {
+		t.Error("Should count dropped payloads:", q.Dropped())
+	}
+
+	q = fill(queuePolicyBlock)
+	pushed := make(chan int)
+
+	go func() {
+		pushed <- q.Push(newPayloadBuffer([]byte("3")))
+	}()
+
+	select {
+	case <-pushed:
+		t.Error("Should block while queue is full")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	<-q.ch
+
+	if dropped := <-pushed; dropped != 0 || q.Len() != 2 || q.Dropped() != 0 {
+		t.Error("Should add payload when queue has free space:", dropped, q.Len())
+	}
+
+	if q := newPayloadQueue(&QueueConfig{}); q.Cap() != defaultQueueSize || q.policy != queuePolicyBlock {
+		t.Error("Should use defaults:", q.Cap(), q.policy)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// S3OutputConfig holds configuration for S3 output
+type S3OutputConfig struct {
+	region string
+	// Size of uploaded chunk in megabytes
+	chunkSize int
+}
+
+// S3Output buffers requests in compressed local files, and uploads each file to S3 when it reaches chunk size.
+// Address should look like: s3://bucket/path/prefix
+type S3Output struct {
+	address string
+	bucket  string
+	prefix  string
+
+	buffer   *FileOutput
+	uploader *s3manager.Uploader
+	config   *S3OutputConfig
+}
+
+// NewS3Output constructor for S3Output, accepts s3 address
+func NewS3Output(address string, config *S3OutputConfig) io.Writer {
+	var err error
+
+	o := new(S3Output)
+	o.address = address
+	o.config = config
+
+	if o.bucket, o.prefix, err = parseS3Url(address); err != nil {
+		log.Fatal("[S3-OUTPUT] ", err)
+	}
+
+	sess, err := awsSession(config.region)
+	if err != nil {
+		log.Fatal("[S3-OUTPUT] Can't create AWS session: ", err)
+	}
+	o.uploader = s3manager.NewUploader(sess)
+
+	dir, err := ioutil.TempDir("", "gor_s3_")
+	if err != nil {
+		log.Fatal("[S3-OUTPUT] Can't create buffer directory: ", err)
+	}
+
+	// Start time in file name ensures that chunks uploaded by different runs do not overwrite each other
+	name := o.prefix[strings.LastIndex(o.prefix, "/")+1:]
+	if name == "" {
+		name = "requests"
+	}
+	name += "_" + time.Now().Format("20060102150405") + ".gor.gz"
+
+	chunkSize := config.chunkSize
+	if chunkSize == 0 {
+		chunkSize = 32
+	}
+
+	o.buffer = NewFileOutput(filepath.Join(dir, name), &FileOutputConfig{
+		compress: true,
+		maxSize:  chunkSize,
+		onClose:  o.upload,
+	}).(*FileOutput)
+
+	return o
+}
+
+func (o *S3Output) Write(data []byte) (n int, err error) {
+	return o.buffer.Write(data)
+}
+
+// upload sends closed chunk to S3 and removes local file
+func (o *S3Output) upload(path string) {
+	file, err := os.Open(path)
+	if err != nil {
+		log.Println("[S3-OUTPUT] Can't open chunk:", err)
+		return
+	}
+	defer os.Remove(path)
+	defer file.Close()
+
+	// Chunk name already contains last part of the prefix
+	key := o.prefix[:strings.LastIndex(o.prefix, "/")+1] + filepath.Base(path)
+
+	_, err = o.uploader.Upload(&s3manager.UploadInput{
+		Bucket: aws.String(o.bucket),
+		Key:    aws.String(key),
+		Body:   file,
+	})
+
+	if err != nil {
+		log.Println("[S3-OUTPUT] Upload error:", err, key)
+		return
+	}
+
+	Debug("[S3-OUTPUT] Uploaded chunk:", "s3://"+o.bucket+"/"+key)
+}
+
+// Close uploads last chunk, and waits until all chunks uploaded
+func (o *S3Output) Close() error {
+	return o.buffer.Close()
+}
+
+func (o *S3Output) String() string {
+	return "S3 output: " + o.address
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Formats of stdout output
+const (
+	stdoutFormatRaw    = "raw"
+	stdoutFormatJSON   = "json"
+	stdoutFormatPretty = "pretty"
+)
+
+// StdoutOutputConfig output-stdout options
+type StdoutOutputConfig struct {
+	format string
+}
+
+// StdoutMessage is request or response written by stdout output in JSON formats, and read by stdin input
+type StdoutMessage struct {
+	Type      string     `json:"type"`
+	ID        string     `json:"id,omitempty"`
+	Timestamp *time.Time `json:"timestamp,omitempty"`
+
+	Method string `json:"method,omitempty"`
+	URL    string `json:"url,omitempty"`
+	Status int    `json:"status,omitempty"`
+
+	Headers http.Header `json:"headers,omitempty"`
+	Body    string      `json:"body"`
+	// "base64" if body is not valid UTF-8
+	BodyEncoding string `json:"body_encoding,omitempty"`
+}
+
+// StdoutOutput prints all incoming requests and responses to stdout, as is or as JSON objects
+type StdoutOutput struct {
+	sync.Mutex
+
+	config *StdoutOutputConfig
+	writer io.Writer
+}
+
+// NewStdoutOutput constructor for StdoutOutput
+func NewStdoutOutput(options string, config *StdoutOutputConfig) *StdoutOutput {
+	if !validStdoutFormat(config.format) {
+		log.Fatal("Unknown stdout format: ", config.format)
+	}
+
+	return &StdoutOutput{config: config, writer: os.Stdout}
+}
+
+func validStdoutFormat(format string) bool {
+	return format == "" || format == stdoutFormatRaw || format == stdoutFormatJSON || format == stdoutFormatPretty
+}
+
+func (o *StdoutOutput) Write(data []byte) (int, error) {
+	var line []byte
+
+	switch o.config.format {
+	case stdoutFormatJSON:
+		line, _ = json.Marshal(newStdoutMessage(data))
+	case stdoutFormatPretty:
+		line, _ = json.MarshalIndent(newStdoutMessage(data), "", "  ")
+	default:
+		line = data
+	}
+
+	// Outputs are written concurrently, lock keeps lines from mixing
+	o.Lock()
+	defer o.Unlock()
+
+	o.writer.Write(append(line, '\n'))
+
+	return len(data), nil
+}
+
+func (o *StdoutOutput) String() string {
+	return "Stdout output"
+}
+
+// newStdoutMessage parses payload into StdoutMessage. Payloads which are not HTTP messages
+// written with body only.
+func newStdoutMessage(payload []byte) *StdoutMessage {
+	msg := &StdoutMessage{Type: "request"}
+
+	if meta := payloadMeta(payload); len(meta) > 2 {
+		switch meta[0][0] {
+		case ResponsePayload:
+			msg.Type = "response"
+		case ReplayedResponsePayload:
+			msg.Type = "replayed_response"
+		}
+
+		msg.ID = string(meta[1])
+
+		if ts, err := strconv.ParseInt(string(meta[2]), 10, 64); err == nil {
+			t := time.Unix(0, ts)
+			msg.Timestamp = &t
+		}
+	}
+
+	data := payloadBody(payload)
+	body := data
+
+	if msg.Type == "request" {
+		if req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(data))); err == nil {
+			msg.Method = req.Method
+			msg.URL = req.RequestURI
+			msg.Headers = req.Header
+
+			if req.Host != "" {
+				msg.URL = "http://" + req.Host + req.RequestURI
+				// ReadRequest moves Host header out of header map
+				msg.Headers.Set("Host", req.Host)
+			}
+
+			body, _ = ioutil.ReadAll(req.Body)
+		}
+	} else {
+		if resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(data)), nil); err == nil {
+			msg.Status = resp.StatusCode
+			msg.Headers = resp.Header
+
+			body, _ = ioutil.ReadAll(resp.Body)
+		}
+	}
+
+	if utf8.Valid(body) {
+		msg.Body = string(body)
+	} else {
+		msg.Body = base64.StdEncoding.EncodeToString(body)
+		msg.BodyEncoding = "base64"
+	}
+
+	return msg
+}
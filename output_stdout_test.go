@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestStdoutOutputJSON(t *testing.T) {
+	buf := new(bytes.Buffer)
+	output := NewStdoutOutput("", &StdoutOutputConfig{format: "json"})
+	output.writer = buf
+
+	output.Write([]byte("1 a 1500000000000000000\nPOST /api?q=1 HTTP/1.1\r\nHost: example.com\r\nContent-Length: 4\r\n\r\nbody"))
+	output.Write([]byte("2 a 1500000000000000000\nHTTP/1.1 404 Not Found\r\nContent-Length: 2\r\n\r\n\xff\xfe"))
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatal("Should print JSON object per line:", buf.String())
+	}
+
+	var req, resp StdoutMessage
+	json.Unmarshal(lines[0], &req)
+	json.Unmarshal(lines[1], &resp)
+
+	if req.Type != "request" || req.ID != "a" || req.Method != "POST" || req.URL != "http://example.com/api?q=1" || req.Body != "body" {
+		t.Error("Should parse request:", string(lines[0]))
+	}
+
+	if req.Headers.Get("Host") != "example.com" || req.Timestamp == nil || req.Timestamp.UnixNano() != 1500000000000000000 {
+		t.Error("Should keep headers and timestamp:", string(lines[0]))
+	}
+
+	if resp.Type != "response" || resp.Status != 404 || resp.Body != "//4=" || resp.BodyEncoding != "base64" {
+		t.Error("Should parse response and encode binary body:", string(lines[1]))
+	}
+}
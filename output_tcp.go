@@ -1,32 +1,75 @@
 package main
 
 import (
+	"crypto/tls"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net"
+	"sync"
 	"time"
 )
 
+// TCPOutputConfig struct for holding tcp output configuration
+type TCPOutputConfig struct {
+	secure bool
+
+	// CA used to verify certificate of tcp input, system CAs used by default
+	tlsCA         string
+	tlsSkipVerify bool
+
+	// Client certificate, if tcp input requires it
+	tlsCert string
+	tlsKey  string
+
+	// Sent to tcp input on connect, if it requires authentication
+	secret string
+
+	// Replay payloads as is to any TCP server, instead of other Gor instance
+	raw bool
+}
+
 // TCPOutput used for sending raw tcp payloads
 // Currently used for internal communication between listener and replay server
 // Can be used for transfering binary payloads like protocol buffers
 type TCPOutput struct {
-	address  string
-	limit    int
-	buf      chan []byte
-	bufStats *GorStat
+	address   string
+	limit     int
+	buf       *payloadQueue
+	bufStats  *GorStat
+	config    *TCPOutputConfig
+	tlsConfig *tls.Config
+
+	// Replay connections in raw mode, by id of captured connection
+	mu    sync.Mutex
+	conns map[string]*rawTCPConn
+	// Payloads dropped by closed connections
+	closedDropped int64
+	// Slot taken by each payload queued by raw connections, so their total size limited by output queue size
+	rawSlots     chan struct{}
+	rawConnQueue QueueConfig
 }
 
 // NewTCPOutput constructor for TCPOutput
 // Initialize 10 workers which hold keep-alive connection
-func NewTCPOutput(address string) io.Writer {
+func NewTCPOutput(address string, config *TCPOutputConfig) io.Writer {
 	o := new(TCPOutput)
 
 	o.address = address
+	o.config = config
 
-	o.buf = make(chan []byte, 100)
+	if config.secure {
+		o.tlsConfig = o.newTLSConfig()
+	}
+
+	if config.raw {
+		o.initRaw(Settings.outputQueueConfig)
+		return o
+	}
+
+	o.buf = newPayloadQueue(&Settings.outputQueueConfig)
 	if Settings.outputTCPStats {
 		o.bufStats = NewGorStat("output_tcp")
 	}
@@ -47,7 +90,10 @@ func (o *TCPOutput) worker() {
 	defer conn.Close()
 
 	for {
-		_, err := conn.Write(<-o.buf)
+		p := <-o.buf.ch
+		_, err := conn.Write(p.data)
+		p.release()
+
 		if err != nil {
 			log.Println("Worker failed on write, exitings and starting new worker")
 			go o.worker()
@@ -57,20 +103,80 @@ func (o *TCPOutput) worker() {
 }
 
 func (o *TCPOutput) Write(data []byte) (n int, err error) {
-	// Hex encoding always 2x number of bytes
-	encoded := make([]byte, len(data)*2+1)
+	if o.config.raw {
+		return o.writeRaw(data)
+	}
+
+	// Hex encoding always 2x number of bytes. Buffer returned to pool by worker once written.
+	encoded := getBuffer(len(data)*2 + 1)
 	hex.Encode(encoded, data)
-	o.buf <- append(encoded, '\n')
+	encoded[len(encoded)-1] = '\n'
+
+	if dropped := o.buf.Push(newPayloadBuffer(encoded)); dropped > 0 {
+		statsd.Incr("output_tcp.dropped", dropped)
+	}
 
 	if Settings.outputTCPStats {
-		o.bufStats.Write(len(o.buf))
+		o.bufStats.Write(o.buf.Len())
 	}
 
 	return len(data), nil
 }
 
+func (o *TCPOutput) newTLSConfig() *tls.Config {
+	config := &tls.Config{InsecureSkipVerify: o.config.tlsSkipVerify}
+
+	if host, _, err := net.SplitHostPort(o.address); err == nil {
+		config.ServerName = host
+	}
+
+	if o.config.tlsCA != "" {
+		config.RootCAs = loadCertPool(o.config.tlsCA)
+	}
+
+	if o.config.tlsCert != "" || o.config.tlsKey != "" {
+		cert, err := tls.LoadX509KeyPair(o.config.tlsCert, o.config.tlsKey)
+
+		if err != nil {
+			log.Fatal("[TCP] Can't load client certificate: ", err)
+		}
+
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config
+}
+
+// QueueLen returns number of payloads waiting for free connection
+func (o *TCPOutput) QueueLen() (length int, capacity int) {
+	if o.config.raw {
+		return o.rawQueueLen()
+	}
+
+	return o.buf.Len(), o.buf.Cap()
+}
+
+// Dropped returns number of payloads dropped because queue was full
+func (o *TCPOutput) Dropped() int64 {
+	if o.config.raw {
+		return o.rawDropped()
+	}
+
+	return o.buf.Dropped()
+}
+
 func (o *TCPOutput) connect(address string) (conn net.Conn, err error) {
-	conn, err = net.Dial("tcp", address)
+	if o.tlsConfig != nil {
+		conn, err = tls.Dial("tcp", address, o.tlsConfig)
+	} else {
+		conn, err = net.Dial("tcp", address)
+	}
+
+	if err == nil && o.config.secret != "" {
+		if err = o.authenticate(conn); err != nil {
+			conn.Close()
+		}
+	}
 
 	if err != nil {
 		log.Println("Connection error ", err, o.address)
@@ -79,6 +185,22 @@ func (o *TCPOutput) connect(address string) (conn net.Conn, err error) {
 	return
 }
 
+func (o *TCPOutput) authenticate(conn net.Conn) error {
+	if _, err := conn.Write([]byte(tcpAuthPrefix + o.config.secret + "\n")); err != nil {
+		return err
+	}
+
+	conn.SetReadDeadline(time.Now().Add(tcpAuthTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	reply := make([]byte, len(tcpAuthOK))
+	if _, err := io.ReadFull(conn, reply); err != nil || string(reply) != tcpAuthOK {
+		return errors.New("authentication failed, check --output-tcp-secret")
+	}
+
+	return nil
+}
+
 func (o *TCPOutput) String() string {
 	return fmt.Sprintf("TCP output %s, limit: %d", o.address, o.limit)
 }
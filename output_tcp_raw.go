@@ -0,0 +1,177 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// Replay connection closed if captured connection sent nothing during this period
+const rawTCPIdleTimeout = time.Minute
+
+// Maximum size of queue of single replay connection. Queues of all connections share output queue size.
+const rawTCPConnQueueSize = 100
+
+// rawTCPConn replays payloads of single captured connection, in order they were captured
+type rawTCPConn struct {
+	id  string
+	buf *payloadQueue
+	// Number of payloads being pushed to the queue, connection is not closed until they queued
+	pending int
+}
+
+// initRaw prepares output for replaying each captured connection over separate connection
+func (o *TCPOutput) initRaw(config QueueConfig) {
+	size := config.size
+	if size <= 0 {
+		size = defaultQueueSize
+	}
+
+	o.conns = make(map[string]*rawTCPConn)
+	o.rawSlots = make(chan struct{}, size)
+
+	o.rawConnQueue = config
+	if o.rawConnQueue.size = size; size > rawTCPConnQueueSize {
+		o.rawConnQueue.size = rawTCPConnQueueSize
+	}
+}
+
+// writeRaw sends payload body to connection which replays captured connection with the same id.
+// Payloads without meta line replayed over single shared connection.
+func (o *TCPOutput) writeRaw(data []byte) (int, error) {
+	id := string(payloadID(data))
+
+	o.mu.Lock()
+	c, ok := o.conns[id]
+	if !ok {
+		c = &rawTCPConn{id: id, buf: newPayloadQueue(&o.rawConnQueue)}
+		o.conns[id] = c
+
+		go o.rawWorker(c)
+	}
+	c.pending++
+	o.mu.Unlock()
+
+	// Push can block, so other connections are not held by lock meanwhile
+	if dropped := o.pushRaw(c, newPayloadBuffer(pooledCopy(payloadBody(data)))); dropped > 0 {
+		statsd.Incr("output_tcp.dropped", dropped)
+	}
+
+	o.mu.Lock()
+	c.pending--
+	o.mu.Unlock()
+
+	return len(data), nil
+}
+
+// pushRaw queues payload of connection once free slot of output queue taken. If all slots taken, policy of
+// output queue applied: wait for free slot, drop new payload, or drop oldest payload of the same connection.
+func (o *TCPOutput) pushRaw(c *rawTCPConn, p *payloadBuffer) (dropped int) {
+	select {
+	case o.rawSlots <- struct{}{}:
+	default:
+		if c.buf.policy == queuePolicyBlock {
+			o.rawSlots <- struct{}{}
+			break
+		}
+
+		atomic.AddInt64(&c.buf.dropped, 1)
+
+		// Slot of oldest payload of the connection used by new one, if it has any
+		var oldest *payloadBuffer
+		if c.buf.policy == queuePolicyDropOldest {
+			select {
+			case oldest = <-c.buf.ch:
+			default:
+			}
+		}
+
+		if oldest == nil {
+			p.release()
+			return 1
+		}
+
+		oldest.release()
+		dropped++
+	}
+
+	// Payloads dropped by queue of connection free their slots
+	n := c.buf.Push(p)
+	for i := 0; i < n; i++ {
+		<-o.rawSlots
+	}
+
+	return dropped + n
+}
+
+func (o *TCPOutput) rawWorker(c *rawTCPConn) {
+	var conn net.Conn
+
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+
+	for {
+		select {
+		case p := <-c.buf.ch:
+			<-o.rawSlots
+
+			if conn == nil {
+				var err error
+				if conn, err = o.connect(o.address); err != nil {
+					p.release()
+					continue
+				}
+
+				// Responses are not used, but should be read, otherwise server can block on write
+				go io.Copy(ioutil.Discard, conn)
+			}
+
+			_, err := conn.Write(p.data)
+			p.release()
+
+			if err != nil {
+				log.Println("[TCP] Raw replay write error:", err)
+				conn.Close()
+				conn = nil
+			}
+		case <-time.After(rawTCPIdleTimeout):
+			o.mu.Lock()
+
+			// Payload could be queued while we were waiting for lock
+			if c.buf.Len() > 0 || c.pending > 0 {
+				o.mu.Unlock()
+				continue
+			}
+
+			delete(o.conns, c.id)
+			o.closedDropped += c.buf.Dropped()
+			o.mu.Unlock()
+
+			return
+		}
+	}
+}
+
+// rawQueueLen returns number of payloads waiting to be replayed by all connections
+func (o *TCPOutput) rawQueueLen() (length int, capacity int) {
+	return len(o.rawSlots), cap(o.rawSlots)
+}
+
+// rawDropped returns number of payloads dropped by all connections, including closed ones
+func (o *TCPOutput) rawDropped() int64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	dropped := o.closedDropped
+	for _, c := range o.conns {
+		dropped += c.buf.Dropped()
+	}
+
+	return dropped
+}
@@ -4,10 +4,12 @@ import (
 	"bufio"
 	"encoding/hex"
 	"io"
+	"io/ioutil"
 	"log"
 	"net"
 	"sync"
 	"testing"
+	"time"
 )
 
 func TestTCPOutput(t *testing.T) {
@@ -18,7 +20,7 @@ func TestTCPOutput(t *testing.T) {
 		wg.Done()
 	})
 	input := NewTestInput()
-	output := NewTCPOutput(listener.Addr().String())
+	output := NewTCPOutput(listener.Addr().String(), &TCPOutputConfig{})
 
 	Plugins.Inputs = []io.Reader{input}
 	Plugins.Outputs = []io.Writer{output}
@@ -35,6 +37,77 @@ func TestTCPOutput(t *testing.T) {
 	close(quit)
 }
 
+func TestTCPOutputRaw(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	received := make(chan string)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				// Connection stays open, so read until all payloads received
+				conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+				data, _ := ioutil.ReadAll(conn)
+				received <- string(data)
+			}()
+		}
+	}()
+
+	output := NewTCPOutput(listener.Addr().String(), &TCPOutputConfig{raw: true})
+
+	// Payloads of 2 captured connections, interleaved
+	output.Write(append(payloadHeader(RequestPayload, []byte("a"), 1), "SELECT 1\r\n"...))
+	output.Write(append(payloadHeader(RequestPayload, []byte("b"), 2), "AUTH secret\r\n"...))
+	output.Write(append(payloadHeader(RequestPayload, []byte("a"), 3), "GET key\r\n"...))
+	output.Write(append(payloadHeader(RequestPayload, []byte("b"), 4), "PING\r\n"...))
+
+	got := map[string]bool{<-received: true, <-received: true}
+
+	if !got["SELECT 1\r\nGET key\r\n"] || !got["AUTH secret\r\nPING\r\n"] {
+		t.Error("Each connection should be replayed separately, in order:", got)
+	}
+}
+
+func TestTCPOutputRawQueue(t *testing.T) {
+	o := &TCPOutput{config: &TCPOutputConfig{raw: true}}
+	o.initRaw(QueueConfig{size: 3, policy: queuePolicyDropOldest})
+
+	if o.rawConnQueue.size != 3 {
+		t.Error("Queue of connection should not be bigger than output queue:", o.rawConnQueue.size)
+	}
+
+	// Workers not started, so payloads stay queued
+	a := &rawTCPConn{id: "a", buf: newPayloadQueue(&o.rawConnQueue)}
+	b := &rawTCPConn{id: "b", buf: newPayloadQueue(&o.rawConnQueue)}
+	o.conns = map[string]*rawTCPConn{"a": a, "b": b}
+
+	for _, data := range []string{"a1", "a2", "a3"} {
+		o.pushRaw(a, newPayloadBuffer(pooledCopy([]byte(data))))
+	}
+
+	// Connection without queued payloads can't free slot
+	if dropped := o.pushRaw(b, newPayloadBuffer(pooledCopy([]byte("b1")))); dropped != 1 || b.buf.Len() != 0 {
+		t.Error("Should drop payload when all slots taken:", dropped)
+	}
+
+	if dropped := o.pushRaw(a, newPayloadBuffer(pooledCopy([]byte("a4")))); dropped != 1 || string((<-a.buf.ch).data) != "a2" {
+		t.Error("Should drop oldest payload of the connection:", dropped)
+	}
+
+	if length, capacity := o.QueueLen(); length != 3 || capacity != 3 || o.Dropped() != 2 {
+		t.Error("Queue size should be shared by connections:", length, capacity, o.Dropped())
+	}
+}
+
 func startTCP(cb func([]byte)) net.Listener {
 	listener, err := net.Listen("tcp", ":0")
 
@@ -73,7 +146,7 @@ func BenchmarkTCPOutput(b *testing.B) {
 		wg.Done()
 	})
 	input := NewTestInput()
-	output := NewTCPOutput(listener.Addr().String())
+	output := NewTCPOutput(listener.Addr().String(), &TCPOutputConfig{})
 
 	Plugins.Inputs = []io.Reader{input}
 	Plugins.Outputs = []io.Writer{output}
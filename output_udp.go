@@ -0,0 +1,48 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net"
+)
+
+// UDPOutput replays payloads as UDP datagrams, e.g. captured by `--input-raw-protocol udp`
+type UDPOutput struct {
+	address string
+	conn    net.Conn
+}
+
+// NewUDPOutput constructor for UDPOutput
+func NewUDPOutput(address string) io.Writer {
+	o := new(UDPOutput)
+	o.address = address
+
+	conn, err := net.Dial("udp", address)
+
+	if err != nil {
+		log.Fatal("[UDP] Can't connect to ", address, ": ", err)
+	}
+
+	o.conn = conn
+
+	return o
+}
+
+func (o *UDPOutput) Write(data []byte) (int, error) {
+	// Only requests can be replayed, captured responses are skipped
+	if !isRequestPayload(data) {
+		return len(data), nil
+	}
+
+	// Each payload sent as separate datagram, so it should be written at once
+	if _, err := o.conn.Write(payloadBody(data)); err != nil {
+		Debug("[UDP] Failed to send datagram:", err)
+		return 0, err
+	}
+
+	return len(data), nil
+}
+
+func (o *UDPOutput) String() string {
+	return "UDP output: " + o.address
+}
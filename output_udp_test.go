@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestUDPOutput(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	output := NewUDPOutput(conn.LocalAddr().String())
+
+	output.Write([]byte("datagram"))
+	output.Write(append(payloadHeader(ResponsePayload, uuid(), 1), []byte("response")...))
+	output.Write(append(payloadHeader(RequestPayload, uuid(), 1), []byte("request")...))
+
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+
+	for _, expected := range []string{"datagram", "request"} {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(buf[:n]) != expected {
+			t.Errorf("Expected %q, got %q", expected, buf[:n])
+		}
+	}
+}
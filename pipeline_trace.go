@@ -0,0 +1,122 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Span kind of pipeline stages, which are not remote calls
+const spanKindInternal = 1
+
+// Payloads replayed from files keep original timestamps, so capture stage reported only for recently captured requests
+const captureSpanMaxAge = time.Minute
+
+// enqueueTimes remembers when requests were added to output queue, to report time they waited for free worker
+type enqueueTimes struct {
+	sync.Mutex
+
+	times     map[string]time.Time
+	lastClean time.Time
+}
+
+func newEnqueueTimes() *enqueueTimes {
+	return &enqueueTimes{times: make(map[string]time.Time), lastClean: time.Now()}
+}
+
+func (q *enqueueTimes) add(id []byte, t time.Time) {
+	q.Lock()
+	defer q.Unlock()
+
+	q.times[string(id)] = t
+
+	// Requests can be dropped from full queue, so periodically remove stale ids
+	if time.Since(q.lastClean) > time.Minute {
+		for id, t := range q.times {
+			if time.Since(t) > time.Minute {
+				delete(q.times, id)
+			}
+		}
+
+		q.lastClean = time.Now()
+	}
+}
+
+func (q *enqueueTimes) take(id []byte) (t time.Time) {
+	q.Lock()
+	defer q.Unlock()
+
+	t = q.times[string(id)]
+	delete(q.times, string(id))
+
+	return
+}
+
+// pipelineTrace holds timestamps of replayed request passing through Gor: captured by input, added to output queue,
+// taken by worker, and replayed response emitted. Zero timestamps mean stage is unknown, and it is not reported.
+type pipelineTrace struct {
+	root     traceContext
+	parentID [8]byte
+
+	requestID []byte
+	captured  time.Time
+	enqueued  time.Time
+	dequeued  time.Time
+	emitted   time.Time
+}
+
+// newPipelineTrace starts root span in the trace of replayed request, request span becomes its child
+func newPipelineTrace(trace traceContext, parentID [8]byte, payload []byte, enqueued time.Time) *pipelineTrace {
+	p := &pipelineTrace{root: trace.child(), parentID: parentID, requestID: payloadID(payload), enqueued: enqueued, dequeued: time.Now()}
+
+	if meta := payloadMeta(payload); len(meta) > 2 {
+		if ts, err := strconv.ParseInt(string(meta[2]), 10, 64); err == nil && ts > 0 {
+			if captured := time.Unix(0, ts); time.Since(captured) < captureSpanMaxAge && captured.Before(p.dequeued) {
+				p.captured = captured
+			}
+		}
+	}
+
+	return p
+}
+
+// spans returns root span covering whole pipeline, and span of each known stage.
+// Request span is replay itself, and it becomes child of root span.
+func (p *pipelineTrace) spans(request *Span) []*Span {
+	request.parentID = p.root.spanID
+
+	root := &Span{
+		trace:      p.root,
+		parentID:   p.parentID,
+		name:       "gor " + request.name,
+		kind:       spanKindInternal,
+		start:      p.dequeued,
+		end:        request.end,
+		attributes: map[string]interface{}{"gor.request_id": string(p.requestID)},
+		err:        request.err,
+	}
+
+	spans := []*Span{root}
+
+	stage := func(name string, start, end time.Time) {
+		if start.IsZero() || end.IsZero() {
+			return
+		}
+
+		if start.Before(root.start) {
+			root.start = start
+		}
+		if end.After(root.end) {
+			root.end = end
+		}
+
+		spans = append(spans, &Span{trace: p.root.child(), parentID: p.root.spanID, name: name, kind: spanKindInternal, start: start, end: end})
+	}
+
+	// Includes waiting for the rest of the message and processing by emitter, modifier and middleware
+	stage("capture", p.captured, p.enqueued)
+	stage("queue", p.enqueued, p.dequeued)
+	stage("response", request.end, p.emitted)
+
+	return append(spans, request)
+}
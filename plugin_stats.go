@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// pluginStats holds throughput counters of input or output plugin, reset on each report
+type pluginStats struct {
+	payloads int64
+	bytes    int64
+	errors   int64
+
+	// Counters since start, not reset by reports
+	totalPayloads int64
+	totalBytes    int64
+	totalErrors   int64
+
+	// Dropped payloads reported by output on previous report
+	lastDropped int64
+}
+
+// queuedPlugin implemented by plugins with internal queue, like HTTP and TCP outputs
+type queuedPlugin interface {
+	QueueLen() (length, capacity int)
+}
+
+// droppingPlugin implemented by plugins which drop payloads when queue is full, see `--output-queue-policy`
+type droppingPlugin interface {
+	Dropped() int64
+}
+
+var (
+	pluginStatsMu  sync.Mutex
+	pluginStatsMap = make(map[interface{}]*pluginStats)
+)
+
+// statsFor returns counters of given plugin, creating them on first use
+func statsFor(plugin interface{}) *pluginStats {
+	pluginStatsMu.Lock()
+	defer pluginStatsMu.Unlock()
+
+	s, ok := pluginStatsMap[plugin]
+	if !ok {
+		s = new(pluginStats)
+		pluginStatsMap[plugin] = s
+	}
+
+	return s
+}
+
+func (s *pluginStats) add(n int, err error) {
+	if n > 0 {
+		atomic.AddInt64(&s.payloads, 1)
+		atomic.AddInt64(&s.bytes, int64(n))
+		atomic.AddInt64(&s.totalPayloads, 1)
+		atomic.AddInt64(&s.totalBytes, int64(n))
+	}
+
+	if err != nil && err != io.EOF {
+		atomic.AddInt64(&s.errors, 1)
+		atomic.AddInt64(&s.totalErrors, 1)
+	}
+}
+
+// report returns stats line and resets counters
+func (s *pluginStats) report(plugin interface{}, interval time.Duration) string {
+	payloads := atomic.SwapInt64(&s.payloads, 0)
+	bytes := atomic.SwapInt64(&s.bytes, 0)
+	errors := atomic.SwapInt64(&s.errors, 0)
+
+	name := fmt.Sprint(plugin)
+
+	// Limiter wraps actual plugin, which holds the queue and reports its own errors
+	if l, ok := plugin.(*Limiter); ok {
+		plugin = l.plugin
+		errors += atomic.SwapInt64(&statsFor(plugin).errors, 0)
+	}
+
+	line := fmt.Sprintf("%s: %d payloads (%.1f/s), %d bytes, %d errors", name, payloads, float64(payloads)/interval.Seconds(), bytes, errors)
+
+	if q, ok := plugin.(queuedPlugin); ok {
+		length, capacity := q.QueueLen()
+		line += fmt.Sprintf(", queue %d/%d", length, capacity)
+
+		if length == capacity {
+			line += " (full, replay falls behind)"
+		}
+	}
+
+	if d, ok := plugin.(droppingPlugin); ok {
+		dropped := d.Dropped()
+
+		if dropped > s.lastDropped {
+			line += fmt.Sprintf(", %d dropped", dropped-s.lastDropped)
+		}
+
+		s.lastDropped = dropped
+	}
+
+	return line
+}
+
+// reportPluginStats periodically logs throughput of all plugins
+func reportPluginStats(interval time.Duration, stop chan int) {
+	for {
+		select {
+		case <-stop:
+			return
+		case <-time.After(interval):
+		}
+
+		reloadMu.RLock()
+		for _, in := range Plugins.Inputs {
+			log.Println("[STATS]", statsFor(in).report(in, interval))
+		}
+
+		for _, out := range Plugins.Outputs {
+			log.Println("[STATS]", statsFor(out).report(out, interval))
+		}
+		reloadMu.RUnlock()
+	}
+}
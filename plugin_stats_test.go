@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+type testQueuedOutput struct {
+	queue chan []byte
+}
+
+func (o *testQueuedOutput) Write(data []byte) (int, error) {
+	return len(data), nil
+}
+
+func (o *testQueuedOutput) QueueLen() (int, int) {
+	return len(o.queue), cap(o.queue)
+}
+
+func (o *testQueuedOutput) String() string {
+	return "Queued output"
+}
+
+func TestPluginStats(t *testing.T) {
+	output := &testQueuedOutput{queue: make(chan []byte, 2)}
+	output.queue <- []byte("1")
+
+	stats := statsFor(output)
+	if statsFor(output) != stats {
+		t.Error("Should return same stats for same plugin")
+	}
+
+	stats.add(10, nil)
+	stats.add(20, nil)
+	stats.add(0, errors.New("write error"))
+	stats.add(0, io.EOF)
+
+	expected := "Queued output: 2 payloads (1.0/s), 30 bytes, 1 errors, queue 1/2"
+	if line := stats.report(output, 2*time.Second); line != expected {
+		t.Errorf("Expected %q, got %q", expected, line)
+	}
+
+	output.queue <- []byte("2")
+
+	expected = "Queued output: 0 payloads (0.0/s), 0 bytes, 0 errors, queue 2/2 (full, replay falls behind)"
+	if line := stats.report(output, 2*time.Second); line != expected {
+		t.Errorf("Counters should be reset after report, expected %q, got %q", expected, line)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"io"
 	"reflect"
 	"strings"
@@ -10,21 +11,40 @@ import (
 type InOutPlugins struct {
 	Inputs  []io.Reader
 	Outputs []io.Writer
+
+	// Plugins by constructor and address, so they can be reused on config reload
+	registered map[string]interface{}
 }
 
 // Plugins holds all the plugin objects
 var Plugins *InOutPlugins = new(InOutPlugins)
 
 // extractLimitOptions detects if plugin get called with limiter support
-// Returns address and limit
+// Returns address and limit. Comma separated `key=value` options are plugin specific and kept in address,
+// e.g. "requests.gor|200%,from=2024-05-01T10:00" gives "requests.gor|from=2024-05-01T10:00" and "200%"
 func extractLimitOptions(options string) (string, string) {
 	split := strings.Split(options, "|")
 
-	if len(split) > 1 {
-		return split[0], split[1]
+	if len(split) == 1 {
+		return split[0], ""
+	}
+
+	var limit string
+	var pluginOptions []string
+
+	for _, option := range strings.Split(split[1], ",") {
+		if strings.Contains(option, "=") {
+			pluginOptions = append(pluginOptions, option)
+		} else {
+			limit = option
+		}
 	}
 
-	return split[0], ""
+	if len(pluginOptions) > 0 {
+		return split[0] + "|" + strings.Join(pluginOptions, ","), limit
+	}
+
+	return split[0], limit
 }
 
 // Automatically detects type of plugin and initialize it
@@ -45,8 +65,24 @@ func registerPlugin(constructor interface{}, options ...interface{}) {
 	// Writing value back without limiter "|" options
 	vo[0] = reflect.ValueOf(path)
 
-	// Calling our constructor with list of given options
-	plugin := vc.Call(vo)[0].Interface()
+	// Plugin is reused only if its config not changed as well
+	key := fmt.Sprintf("%x %s", vc.Pointer(), path)
+	for _, config := range vo[1:] {
+		key += fmt.Sprintf(" %+v", reflect.Indirect(config).Interface())
+	}
+
+	// On config reload plugins with same options are kept, so they don't lose their state and connections
+	plugin, ok := reusablePlugins[key]
+	if !ok {
+		// Calling our constructor with list of given options
+		plugin = vc.Call(vo)[0].Interface()
+	}
+
+	if Plugins.registered == nil {
+		Plugins.registered = make(map[string]interface{})
+	}
+	Plugins.registered[key] = plugin
+
 	pluginWrapper := plugin
 
 	if limit != "" {
@@ -55,7 +91,12 @@ func registerPlugin(constructor interface{}, options ...interface{}) {
 		pluginWrapper = plugin
 	}
 
-	if _, ok := plugin.(io.Reader); ok {
+	if o, ok := plugin.(*HTTPOutput); ok {
+		// HTTP output emits replayed responses only if asked. Limiter is not applied to them.
+		if o.config.trackResponses {
+			Plugins.Inputs = append(Plugins.Inputs, o)
+		}
+	} else if _, ok := plugin.(io.Reader); ok {
 		Plugins.Inputs = append(Plugins.Inputs, pluginWrapper.(io.Reader))
 	}
 
@@ -67,38 +108,117 @@ func registerPlugin(constructor interface{}, options ...interface{}) {
 // InitPlugins specify and initialize all available plugins
 func InitPlugins() {
 	for _, options := range Settings.inputDummy {
-		registerPlugin(NewDummyInput, options)
+		registerPlugin(NewDummyInput, options, &Settings.inputDummyConfig)
 	}
 
 	for _, options := range Settings.outputDummy {
 		registerPlugin(NewDummyOutput, options)
 	}
 
+	if Settings.inputStdin {
+		registerPlugin(NewStdinInput, "", &Settings.inputStdinConfig)
+	}
+
+	if Settings.outputNull {
+		registerPlugin(NewNullOutput, "")
+	}
+
 	for _, options := range Settings.inputRAW {
-		registerPlugin(NewRAWInput, options)
+		registerPlugin(NewRAWInput, options, &Settings.inputRAWConfig)
 	}
 
 	for _, options := range Settings.inputTCP {
-		registerPlugin(NewTCPInput, options)
+		registerPlugin(NewTCPInput, options, &Settings.inputTCPConfig)
+	}
+
+	// Outputs which store traffic or send it outside, personal data anonymized before they get it
+	storageOutputsStart := len(Plugins.Outputs)
+
+	if Settings.outputStdout {
+		registerPlugin(NewStdoutOutput, "", &Settings.outputStdoutConfig)
 	}
 
 	for _, options := range Settings.outputTCP {
-		registerPlugin(NewTCPOutput, options)
+		registerPlugin(NewTCPOutput, options, &Settings.outputTCPConfig)
 	}
 
 	for _, options := range Settings.inputFile {
-		registerPlugin(NewFileInput, options)
+		registerPlugin(NewFileInput, options, &Settings.inputFileConfig)
 	}
 
 	for _, options := range Settings.outputFile {
-		registerPlugin(NewFileOutput, options)
+		registerPlugin(NewFileOutput, options, &Settings.outputFileConfig)
+	}
+
+	for _, options := range Settings.inputPcap {
+		registerPlugin(NewPcapInput, options, &Settings.inputPcapConfig)
+	}
+
+	for _, options := range Settings.inputHAR {
+		registerPlugin(NewHARInput, options)
+	}
+
+	for _, options := range Settings.outputHAR {
+		registerPlugin(NewHAROutput, options)
+	}
+
+	for _, options := range Settings.outputPcap {
+		registerPlugin(NewPcapOutput, options, &Settings.outputPcapConfig)
+	}
+
+	for _, options := range Settings.inputS3 {
+		registerPlugin(NewS3Input, options, &Settings.inputS3Config)
+	}
+
+	for _, options := range Settings.outputS3 {
+		registerPlugin(NewS3Output, options, &Settings.outputS3Config)
+	}
+
+	for _, options := range Settings.inputKafka {
+		registerPlugin(NewKafkaInput, options, &Settings.inputKafkaConfig)
+	}
+
+	for _, options := range Settings.outputKafka {
+		registerPlugin(NewKafkaOutput, options, &Settings.outputKafkaConfig)
+	}
+
+	if !Settings.anonymizerConfig.isEmpty() {
+		for i := storageOutputsStart; i < len(Plugins.Outputs); i++ {
+			Plugins.Outputs[i] = NewAnonymizer(Plugins.Outputs[i], &Settings.anonymizerConfig)
+		}
+	}
+
+	for _, options := range Settings.outputUDP {
+		registerPlugin(NewUDPOutput, options)
 	}
 
 	for _, options := range Settings.inputHTTP {
 		registerPlugin(NewHTTPInput, options)
 	}
 
+	for _, options := range Settings.inputProxy {
+		registerPlugin(NewProxyInput, options, &Settings.inputProxyConfig)
+	}
+
+	httpOutputsStart := len(Plugins.Outputs)
+
 	for _, options := range Settings.outputHTTP {
 		registerPlugin(NewHTTPOutput, options, &Settings.outputHTTPConfig)
 	}
+
+	// Balancer replaces http outputs, so other outputs still get copy of each request
+	httpOutputs := append([]io.Writer{}, Plugins.Outputs[httpOutputsStart:]...)
+	if (Settings.outputHTTPConfig.balance != "" || Settings.outputHTTPConfig.sticky != "" || hasWeightedOutputs(httpOutputs)) && len(httpOutputs) > 1 {
+		balancer := NewHTTPBalancer(Settings.outputHTTPConfig.balance, Settings.outputHTTPConfig.sticky, httpOutputs)
+
+		Plugins.Outputs = append(Plugins.Outputs[:httpOutputsStart], balancer)
+	}
+
+	for _, options := range Settings.outputDiff {
+		registerPlugin(NewDiffOutput, options, &Settings.outputDiffConfig)
+	}
+
+	for _, options := range Settings.outputLatency {
+		registerPlugin(NewLatencyOutput, options, &Settings.outputLatencyConfig)
+	}
 }
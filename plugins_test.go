@@ -45,3 +45,64 @@ func TestPluginsRegistration(t *testing.T) {
 	}
 
 }
+
+func TestPluginsRegistrationBalancer(t *testing.T) {
+	previousSettings := Settings
+	defer func() { Settings = previousSettings }()
+
+	Plugins = new(InOutPlugins)
+	Settings = AppSettings{}
+
+	Settings.outputDummy = MultiOption{"[]"}
+	Settings.outputHTTP = MultiOption{"replay1.local", "replay2.local|10"}
+	Settings.outputHTTPConfig.balance = "least-pending"
+
+	InitPlugins()
+
+	if len(Plugins.Outputs) != 2 {
+		t.Fatalf("Should be 2 outputs %d", len(Plugins.Outputs))
+	}
+
+	if b, ok := Plugins.Outputs[1].(*HTTPBalancer); !ok || len(b.outputs) != 2 {
+		t.Error("HTTP outputs should be replaced by balancer", Plugins.Outputs[1])
+	}
+}
+
+func TestPluginsRegistrationAnonymizer(t *testing.T) {
+	previousSettings := Settings
+	defer func() { Settings = previousSettings }()
+
+	Plugins = new(InOutPlugins)
+	Settings = AppSettings{}
+
+	Settings.outputStdout = true
+	Settings.outputHTTP = MultiOption{"replay.local"}
+	Settings.anonymizerConfig = AnonymizerConfig{headers: MultiOption{"Authorization"}, mode: "mask"}
+
+	InitPlugins()
+
+	if len(Plugins.Outputs) != 2 {
+		t.Fatalf("Should be 2 outputs %d", len(Plugins.Outputs))
+	}
+
+	if _, ok := Plugins.Outputs[0].(*Anonymizer); !ok {
+		t.Error("Stdout output should be anonymized", Plugins.Outputs[0])
+	}
+
+	if _, ok := Plugins.Outputs[1].(*HTTPOutput); !ok {
+		t.Error("HTTP output should not be anonymized", Plugins.Outputs[1])
+	}
+}
+
+func TestExtractLimitOptions(t *testing.T) {
+	for options, expected := range map[string][2]string{
+		"requests.gor":                          {"requests.gor", ""},
+		"requests.gor|200%":                     {"requests.gor", "200%"},
+		"requests.gor|from=2024-05-01T10:00":    {"requests.gor|from=2024-05-01T10:00", ""},
+		"requests.gor|200%,to=2024-05-01T11:00": {"requests.gor|to=2024-05-01T11:00", "200%"},
+	} {
+		if path, limit := extractLimitOptions(options); path != expected[0] || limit != expected[1] {
+			t.Error("Wrong options of", options, path, limit)
+		}
+	}
+}
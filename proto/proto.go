@@ -19,6 +19,7 @@ package proto
 import (
 	"bytes"
 	"github.com/buger/gor/byteutils"
+	"strconv"
 )
 
 // In HTTP newline defined by 2 bytes (for both windows and *nix support)
@@ -43,20 +44,47 @@ func MIMEHeadersStartPos(payload []byte) int {
 
 // header return value and positions of header/value start/end.
 // If not found, value will be blank, and headerStart will be -1
+// Header name matched case-insensitively, and only within headers section, so
+// "Accept" won't match "Accept-Language" and body content is never touched.
 // Do not support multi-line headers.
 func header(payload []byte, name []byte) (value []byte, headerStart, valueStart, headerEnd int) {
-	headerStart = bytes.Index(payload, name)
+	headerStart = -1
 
-	if headerStart == -1 {
+	lineStart := bytes.IndexByte(payload, '\n') + 1 // Skip request or status line
+	if lineStart == 0 {
 		return
 	}
 
-	valueStart = headerStart + len(name) + 1 // Skip ":" after header name
-	if payload[valueStart] == ' ' {          // Ignore empty space after ':'
-		valueStart++
+	for lineStart < len(payload) {
+		lineEnd := bytes.IndexByte(payload[lineStart:], '\n')
+		if lineEnd == -1 {
+			lineEnd = len(payload)
+		} else {
+			lineEnd += lineStart
+		}
+
+		line := bytes.TrimSuffix(payload[lineStart:lineEnd], []byte("\r"))
+
+		// Empty line marks end of headers
+		if len(line) == 0 {
+			return
+		}
+
+		if len(line) > len(name) && line[len(name)] == ':' && bytes.EqualFold(line[:len(name)], name) {
+			headerStart = lineStart
+			headerEnd = lineStart + len(line)
+
+			valueStart = lineStart + len(name) + 1                    // Skip ":" after header name
+			if valueStart < headerEnd && payload[valueStart] == ' ' { // Ignore empty space after ':'
+				valueStart++
+			}
+			value = payload[valueStart:headerEnd]
+
+			return
+		}
+
+		lineStart = lineEnd + 1
 	}
-	headerEnd = valueStart + bytes.IndexByte(payload[valueStart:], '\r')
-	value = payload[valueStart:headerEnd]
 
 	return
 }
@@ -68,6 +96,29 @@ func Header(payload, name []byte) []byte {
 	return val
 }
 
+// Cookie returns value of cookie from `Cookie` header, if cookie not found, value will be blank
+func Cookie(payload, name []byte) []byte {
+	cookies := Header(payload, []byte("Cookie"))
+
+	for len(cookies) > 0 {
+		var pair []byte
+
+		if end := bytes.IndexByte(cookies, ';'); end != -1 {
+			pair, cookies = cookies[:end], cookies[end+1:]
+		} else {
+			pair, cookies = cookies, nil
+		}
+
+		pair = bytes.TrimSpace(pair)
+
+		if len(pair) > len(name) && pair[len(name)] == '=' && bytes.Equal(pair[:len(name)], name) {
+			return pair[len(name)+1:]
+		}
+	}
+
+	return nil
+}
+
 // SetHeader sets header value. If header not found it creates new one.
 // Returns modified request payload
 func SetHeader(payload, name, value []byte) []byte {
@@ -81,6 +132,25 @@ func SetHeader(payload, name, value []byte) []byte {
 	return AddHeader(payload, name, value)
 }
 
+// DeleteHeader removes header. If header not found, payload returned as is.
+// Returns modified request payload
+func DeleteHeader(payload, name []byte) []byte {
+	_, hs, _, he := header(payload, name)
+
+	if hs == -1 {
+		return payload
+	}
+
+	// Remove line ending as well
+	if end := bytes.IndexByte(payload[he:], '\n'); end != -1 {
+		he += end + 1
+	} else {
+		he = len(payload)
+	}
+
+	return byteutils.Cut(payload, hs, he)
+}
+
 // AddHeader takes http payload and appends new header to the start of headers section
 // Returns modified request payload
 func AddHeader(payload, name, value []byte) []byte {
@@ -170,6 +240,155 @@ func SetPathParam(payload, name, value []byte) []byte {
 	return SetPath(payload, newPath)
 }
 
+// removeParam removes all `name=value` pairs from url-encoded string, like query or form body
+func removeParam(query, name []byte) []byte {
+	prefix := append(append([]byte{}, name...), '=')
+	result := make([]byte, 0, len(query))
+
+	for _, pair := range bytes.Split(query, []byte("&")) {
+		if bytes.Equal(pair, name) || bytes.HasPrefix(pair, prefix) {
+			continue
+		}
+
+		if len(result) > 0 {
+			result = append(result, '&')
+		}
+		result = append(result, pair...)
+	}
+
+	return result
+}
+
+// DeletePathParam removes URL query param with given name, if param not found payload returned as is
+// Returns modified payload
+func DeletePathParam(payload, name []byte) []byte {
+	path := Path(payload)
+	queryStart := bytes.IndexByte(path, '?')
+
+	if queryStart == -1 {
+		return payload
+	}
+
+	query := removeParam(path[queryStart+1:], name)
+
+	if len(query) == len(path)-queryStart-1 {
+		return payload
+	}
+
+	newPath := make([]byte, 0, len(path))
+	newPath = append(newPath, path[:queryStart]...)
+
+	if len(query) > 0 {
+		newPath = append(newPath, '?')
+		newPath = append(newPath, query...)
+	}
+
+	return SetPath(payload, newPath)
+}
+
+// DeleteBodyParam removes param from `application/x-www-form-urlencoded` body and updates Content-Length.
+// Chunked bodies are not supported and returned as is.
+// Returns modified payload
+func DeleteBodyParam(payload, name []byte) []byte {
+	body, bodyStart := formBody(payload)
+	if bodyStart == -1 {
+		return payload
+	}
+
+	body = removeParam(body, name)
+
+	if len(body) == len(payload)-bodyStart {
+		return payload
+	}
+
+	// Limit capacity, so append makes copy instead of overwriting original body
+	payload = append(payload[:bodyStart:bodyStart], body...)
+
+	return SetHeader(payload, []byte("Content-Length"), []byte(strconv.Itoa(len(body))))
+}
+
+// formBody returns body of `application/x-www-form-urlencoded` request and its start position, or -1 if request has no such body.
+// Chunked bodies are not supported.
+func formBody(payload []byte) (body []byte, bodyStart int) {
+	if !bytes.Contains(Header(payload, []byte("Content-Type")), []byte("application/x-www-form-urlencoded")) {
+		return nil, -1
+	}
+
+	if len(Header(payload, []byte("Transfer-Encoding"))) > 0 {
+		return nil, -1
+	}
+
+	bodyStart = MIMEHeadersEndPos(payload)
+	if bodyStart == -1 {
+		return nil, -1
+	}
+	bodyStart += len(EmptyLine)
+
+	return payload[bodyStart:], bodyStart
+}
+
+// BodyParam returns value of `application/x-www-form-urlencoded` body param, value is not unescaped.
+// If not found, found is false
+func BodyParam(payload, name []byte) (value []byte, found bool) {
+	body, _ := formBody(payload)
+	prefix := append(append([]byte{}, name...), '=')
+
+	for _, pair := range bytes.Split(body, []byte("&")) {
+		if bytes.HasPrefix(pair, prefix) {
+			return pair[len(prefix):], true
+		}
+	}
+
+	return nil, false
+}
+
+// SetBodyParam sets value of `application/x-www-form-urlencoded` body param and updates Content-Length.
+// If param not found, it will append new. Value should be already escaped.
+// Chunked bodies are not supported and returned as is.
+// Returns modified payload
+func SetBodyParam(payload, name, value []byte) []byte {
+	body, bodyStart := formBody(payload)
+	if bodyStart == -1 {
+		return payload
+	}
+
+	param := append(append(append([]byte{}, name...), '='), value...)
+	newBody := make([]byte, 0, len(body)+len(param)+1)
+	found := false
+
+	for _, pair := range bytes.Split(body, []byte("&")) {
+		if len(pair) == 0 {
+			continue
+		}
+
+		if bytes.HasPrefix(pair, param[:len(name)+1]) {
+			if found {
+				continue
+			}
+
+			pair = param
+			found = true
+		}
+
+		if len(newBody) > 0 {
+			newBody = append(newBody, '&')
+		}
+		newBody = append(newBody, pair...)
+	}
+
+	if !found {
+		if len(newBody) > 0 {
+			newBody = append(newBody, '&')
+		}
+		newBody = append(newBody, param...)
+	}
+
+	// Limit capacity, so append makes copy instead of overwriting original body
+	payload = append(payload[:bodyStart:bodyStart], newBody...)
+
+	return SetHeader(payload, []byte("Content-Length"), []byte(strconv.Itoa(len(newBody))))
+}
+
 // SetHost updates Host header for HTTP/1.1 or updates host in path for HTTP/1.0 or Proxy requests
 // Returns modified payload
 func SetHost(payload, url, host []byte) []byte {
@@ -202,3 +421,86 @@ func Method(payload []byte) []byte {
 func Status(payload []byte) []byte {
 	return Path(payload)
 }
+
+// MessageLength returns length of first HTTP message in payload, based on Content-Length or chunked encoding.
+// Returns -1 if message is not complete. Response without length read until connection closed, so whole payload returned.
+func MessageLength(payload []byte) int {
+	headersEnd := MIMEHeadersEndPos(payload)
+	if headersEnd == -1 {
+		return -1
+	}
+	bodyStart := headersEnd + len(EmptyLine)
+
+	isResponse := bytes.HasPrefix(payload, []byte("HTTP/"))
+
+	if isResponse {
+		// 1xx, 204 and 304 responses never have body. Status read by position, reason phrase can be missing.
+		if sp := bytes.IndexByte(payload, ' '); sp != -1 && len(payload) >= sp+4 {
+			status := payload[sp+1 : sp+4]
+			if status[0] == '1' || string(status) == "204" || string(status) == "304" {
+				return bodyStart
+			}
+		}
+	}
+
+	if bytes.EqualFold(Header(payload, []byte("Transfer-Encoding")), []byte("chunked")) {
+		return chunkedLength(payload, bodyStart)
+	}
+
+	if length := Header(payload, []byte("Content-Length")); len(length) > 0 {
+		n, err := strconv.Atoi(string(length))
+		if err != nil || n < 0 || bodyStart+n > len(payload) {
+			return -1
+		}
+
+		return bodyStart + n
+	}
+
+	if isResponse {
+		return len(payload)
+	}
+
+	return bodyStart
+}
+
+// chunkedLength returns end position of chunked body started at pos, or -1 if body is not complete
+func chunkedLength(payload []byte, pos int) int {
+	for {
+		lineEnd := bytes.Index(payload[pos:], CLRF)
+		if lineEnd == -1 {
+			return -1
+		}
+
+		sizeLine := payload[pos : pos+lineEnd]
+		// Chunk extensions ignored
+		if i := bytes.IndexByte(sizeLine, ';'); i != -1 {
+			sizeLine = sizeLine[:i]
+		}
+
+		size, err := strconv.ParseInt(string(bytes.TrimSpace(sizeLine)), 16, 64)
+		if err != nil || size < 0 {
+			return -1
+		}
+
+		pos += lineEnd + len(CLRF)
+
+		// Last chunk followed by optional trailers and empty line
+		if size == 0 {
+			if bytes.HasPrefix(payload[pos:], CLRF) {
+				return pos + len(CLRF)
+			}
+
+			trailersEnd := bytes.Index(payload[pos:], EmptyLine)
+			if trailersEnd == -1 {
+				return -1
+			}
+
+			return pos + trailersEnd + len(EmptyLine)
+		}
+
+		pos += int(size) + len(CLRF)
+		if pos > len(payload) {
+			return -1
+		}
+	}
+}
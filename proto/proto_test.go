@@ -24,6 +24,45 @@ func TestHeader(t *testing.T) {
 	if _, headerStart, _, _ = header(payload, []byte("Not-Found")); headerStart != -1 {
 		t.Error("Should not found header")
 	}
+
+	if val = Header(payload, []byte("content-length")); !bytes.Equal(val, []byte("7")) {
+		t.Error("Should find header case-insensitively")
+	}
+
+	payload = []byte("GET /Host HTTP/1.1\r\nAccept-Language: en\r\nAccept: */*\r\n\r\nHost: body")
+
+	if val = Header(payload, []byte("Accept")); !bytes.Equal(val, []byte("*/*")) {
+		t.Error("Should match whole header name", string(val))
+	}
+
+	if _, headerStart, _, _ = header(payload, []byte("Host")); headerStart != -1 {
+		t.Error("Should not search outside of headers section")
+	}
+}
+
+func TestCookie(t *testing.T) {
+	payload := []byte("GET / HTTP/1.1\r\nCookie: session_id=123; user=1\r\nHost: www.w3.org\r\n\r\n")
+
+	if val := Cookie(payload, []byte("session_id")); !bytes.Equal(val, []byte("123")) {
+		t.Error("Should find first cookie", string(val))
+	}
+
+	if val := Cookie(payload, []byte("user")); !bytes.Equal(val, []byte("1")) {
+		t.Error("Should find last cookie", string(val))
+	}
+
+	if val := Cookie(payload, []byte("session")); len(val) != 0 {
+		t.Error("Should match whole cookie name", string(val))
+	}
+}
+
+func TestSetHeaderBody(t *testing.T) {
+	payload := []byte("POST /post HTTP/1.1\r\nContent-Length: 12\r\n\r\nX-Shadow: 0")
+	payloadAfter := []byte("POST /post HTTP/1.1\r\nX-Shadow: 1\r\nContent-Length: 12\r\n\r\nX-Shadow: 0")
+
+	if payload = SetHeader(payload, []byte("X-Shadow"), []byte("1")); !bytes.Equal(payload, payloadAfter) {
+		t.Error("Should add header instead of modifying body", string(payload))
+	}
 }
 
 func TestMIMEHeadersEndPos(t *testing.T) {
@@ -67,6 +106,18 @@ func TestSetHeader(t *testing.T) {
 	}
 }
 
+func TestDeleteHeader(t *testing.T) {
+	payload := []byte("POST /post HTTP/1.1\r\nContent-Encoding: gzip\r\nHost: www.w3.org\r\n\r\nContent-Encoding: body")
+
+	if payload = DeleteHeader(payload, []byte("Content-Encoding")); string(payload) != "POST /post HTTP/1.1\r\nHost: www.w3.org\r\n\r\nContent-Encoding: body" {
+		t.Error("Should delete header", string(payload))
+	}
+
+	if payload = DeleteHeader(payload, []byte("Content-Encoding")); string(payload) != "POST /post HTTP/1.1\r\nHost: www.w3.org\r\n\r\nContent-Encoding: body" {
+		t.Error("Should not change payload if header not found", string(payload))
+	}
+}
+
 func TestPath(t *testing.T) {
 	var path, payload []byte
 
@@ -134,6 +185,61 @@ func TestSetPathParam(t *testing.T) {
 	}
 }
 
+func TestDeletePathParam(t *testing.T) {
+	payload := []byte("GET /post?utm_source=mail&user_id=1&utm_source=x HTTP/1.1\r\n\r\n")
+
+	if payload = DeletePathParam(payload, []byte("utm_source")); !bytes.Equal(Path(payload), []byte("/post?user_id=1")) {
+		t.Error("Should remove all occurrences of param", string(payload))
+	}
+
+	if payload = DeletePathParam(payload, []byte("user")); !bytes.Equal(Path(payload), []byte("/post?user_id=1")) {
+		t.Error("Should match whole param name", string(payload))
+	}
+
+	if payload = DeletePathParam(payload, []byte("user_id")); !bytes.Equal(Path(payload), []byte("/post")) {
+		t.Error("Should remove '?' if no params left", string(payload))
+	}
+}
+
+func TestDeleteBodyParam(t *testing.T) {
+	payload := []byte("POST /post HTTP/1.1\r\nContent-Type: application/x-www-form-urlencoded\r\nContent-Length: 18\r\n\r\na=1&token=secret&b")
+	payloadAfter := []byte("POST /post HTTP/1.1\r\nContent-Type: application/x-www-form-urlencoded\r\nContent-Length: 5\r\n\r\na=1&b")
+
+	if payload = DeleteBodyParam(payload, []byte("token")); !bytes.Equal(payload, payloadAfter) {
+		t.Error("Should remove body param and update Content-Length", string(payload))
+	}
+
+	payload = []byte("POST /post HTTP/1.1\r\nContent-Type: application/json\r\nContent-Length: 9\r\n\r\ntoken=123")
+
+	if payloadAfter = DeleteBodyParam(payload, []byte("token")); !bytes.Equal(payload, payloadAfter) {
+		t.Error("Should ignore non-form bodies", string(payloadAfter))
+	}
+}
+
+func TestSetBodyParam(t *testing.T) {
+	payload := []byte("POST /post HTTP/1.1\r\nContent-Type: application/x-www-form-urlencoded\r\nContent-Length: 18\r\n\r\na=1&token=secret&b")
+	payloadAfter := []byte("POST /post HTTP/1.1\r\nContent-Type: application/x-www-form-urlencoded\r\nContent-Length: 15\r\n\r\na=1&token=new&b")
+
+	if value, found := BodyParam(payload, []byte("token")); !found || string(value) != "secret" {
+		t.Error("Should find body param", string(value))
+	}
+
+	if payload = SetBodyParam(payload, []byte("token"), []byte("new")); !bytes.Equal(payload, payloadAfter) {
+		t.Error("Should replace body param and update Content-Length", string(payload))
+	}
+
+	payload = []byte("POST /post HTTP/1.1\r\nContent-Type: application/x-www-form-urlencoded\r\nContent-Length: 3\r\n\r\na=1")
+	payloadAfter = []byte("POST /post HTTP/1.1\r\nContent-Type: application/x-www-form-urlencoded\r\nContent-Length: 13\r\n\r\na=1&token=new")
+
+	if _, found := BodyParam(payload, []byte("token")); found {
+		t.Error("Should not find missing param")
+	}
+
+	if payload = SetBodyParam(payload, []byte("token"), []byte("new")); !bytes.Equal(payload, payloadAfter) {
+		t.Error("Should append body param", string(payload))
+	}
+}
+
 func TestSetHostHTTP10(t *testing.T) {
 	var payload, payloadAfter []byte
 
@@ -144,3 +250,26 @@ func TestSetHostHTTP10(t *testing.T) {
 		t.Error("Should replace host", string(payload))
 	}
 }
+
+func TestMessageLength(t *testing.T) {
+	cases := []struct {
+		payload string
+		length  int
+	}{
+		{"GET / HTTP/1.1\r\nHost: a\r\n\r\nGET /b HTTP/1.1\r\n\r\n", 27},
+		{"POST / HTTP/1.1\r\nContent-Length: 3\r\n\r\nabcGET / HTTP/1.1\r\n\r\n", 41},
+		{"POST / HTTP/1.1\r\nContent-Length: 5\r\n\r\nabc", -1},
+		{"GET / HTTP/1.1\r\nHost: a\r\n", -1},
+		{"POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n3;ext=1\r\nabc\r\n0\r\n\r\nGET /", 66},
+		{"POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nabc\r\n0\r\nX-Sum: 1\r\n\r\nGET /", 70},
+		{"POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nabc\r\n", -1},
+		{"HTTP/1.1 204\r\nContent-Length: 10\r\n\r\nHTTP/1.1 200 OK\r\n", 36},
+		{"HTTP/1.1 200 OK\r\n\r\nbody until close", 35},
+	}
+
+	for _, c := range cases {
+		if l := MessageLength([]byte(c.payload)); l != c.length {
+			t.Errorf("Expected length %d, got %d: %q", c.length, l, c.payload)
+		}
+	}
+}
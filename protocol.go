@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+)
+
+// Payload types, first byte of payload header
+const (
+	// RequestPayload is request captured from origin or generated by input
+	RequestPayload = '1'
+	// ResponsePayload is response to the original request, captured from origin
+	ResponsePayload = '2'
+	// ReplayedResponsePayload is response received from replayed server
+	ReplayedResponsePayload = '3'
+)
+
+var payloadSeparator = []byte{'\n'}
+
+// uuid generates random 24 character request identifier
+func uuid() []byte {
+	b := make([]byte, 12)
+	rand.Read(b)
+
+	uuid := make([]byte, 24)
+	hex.Encode(uuid, b)
+
+	return uuid
+}
+
+// payloadHeader builds payload meta line. Typed payload looks like:
+//
+//	1 8ab3d30a1ad8e7d8f1b8c2f3 1439818124373040000\n
+//	GET / HTTP/1.1\r\n
+//	\r\n
+//
+// Where first byte is payload type, second is id shared between request and its responses, and third is timestamp in nanoseconds.
+// Inputs can add client IP as optional fourth field, see payloadHeaderIP.
+func payloadHeader(payloadType byte, uuid []byte, timing int64) (header []byte) {
+	header = make([]byte, 0, len(uuid)+24)
+	header = append(header, payloadType, ' ')
+	header = append(header, uuid...)
+	header = append(header, ' ')
+	header = strconv.AppendInt(header, timing, 10)
+	header = append(header, payloadSeparator...)
+
+	return header
+}
+
+// payloadHeaderIP builds meta line with IP of original client, so outputs can pass it to replayed server
+func payloadHeaderIP(payloadType byte, uuid []byte, timing int64, ip []byte) []byte {
+	header := payloadHeader(payloadType, uuid, timing)
+	if len(ip) == 0 {
+		return header
+	}
+
+	header = append(header[:len(header)-1], ' ')
+	header = append(header, ip...)
+
+	return append(header, payloadSeparator...)
+}
+
+// hasPayloadHeader checks if payload starts with meta line. HTTP payloads start with method or protocol name, so they can't be confused with typed payload.
+func hasPayloadHeader(payload []byte) bool {
+	return len(payload) > 2 && payload[1] == ' ' &&
+		(payload[0] == RequestPayload || payload[0] == ResponsePayload || payload[0] == ReplayedResponsePayload)
+}
+
+// payloadHeaderSize returns length of meta line including separator
+func payloadHeaderSize(payload []byte) int {
+	if !hasPayloadHeader(payload) {
+		return 0
+	}
+
+	return bytes.Index(payload, payloadSeparator) + 1
+}
+
+// payloadBody returns payload without meta line
+func payloadBody(payload []byte) []byte {
+	return payload[payloadHeaderSize(payload):]
+}
+
+// payloadMeta returns list of meta fields: type, id, timestamp and optional client IP
+func payloadMeta(payload []byte) [][]byte {
+	size := payloadHeaderSize(payload)
+
+	if size == 0 {
+		return nil
+	}
+
+	return bytes.Split(payload[:size-1], []byte{' '})
+}
+
+// payloadID returns id shared between request and its responses
+func payloadID(payload []byte) []byte {
+	if meta := payloadMeta(payload); len(meta) > 1 {
+		return meta[1]
+	}
+
+	return nil
+}
+
+// payloadIP returns IP of original client, if input recorded it
+func payloadIP(payload []byte) []byte {
+	if meta := payloadMeta(payload); len(meta) > 3 {
+		return meta[3]
+	}
+
+	return nil
+}
+
+// isOriginPayload returns true for payloads captured from origin: requests and original responses
+func isOriginPayload(payload []byte) bool {
+	return payload[0] == RequestPayload || payload[0] == ResponsePayload
+}
+
+// isRequestPayload returns true for requests. Payloads without meta line are always requests.
+func isRequestPayload(payload []byte) bool {
+	return !hasPayloadHeader(payload) || payload[0] == RequestPayload
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPayloadHeader(t *testing.T) {
+	request := []byte("GET / HTTP/1.1\r\n\r\n")
+	payload := append(payloadHeader(RequestPayload, []byte("abc"), 1), request...)
+
+	if string(payload) != "1 abc 1\nGET / HTTP/1.1\r\n\r\n" {
+		t.Error("Wrong payload:", string(payload))
+	}
+
+	if !hasPayloadHeader(payload) {
+		t.Error("Should detect payload header")
+	}
+
+	if hasPayloadHeader(request) {
+		t.Error("Plain request should not have header")
+	}
+
+	if !bytes.Equal(payloadBody(payload), request) {
+		t.Error("Wrong payload body:", string(payloadBody(payload)))
+	}
+
+	if !bytes.Equal(payloadBody(request), request) {
+		t.Error("Body of plain request should be request itself")
+	}
+
+	if meta := payloadMeta(payload); len(meta) != 3 || string(meta[1]) != "abc" || string(meta[2]) != "1" {
+		t.Error("Wrong meta:", meta)
+	}
+}
+
+func TestPayloadTypes(t *testing.T) {
+	request := append(payloadHeader(RequestPayload, uuid(), 1), []byte("GET / HTTP/1.1\r\n\r\n")...)
+	response := append(payloadHeader(ResponsePayload, uuid(), 1), []byte("HTTP/1.1 200 OK\r\n\r\n")...)
+	replayed := append(payloadHeader(ReplayedResponsePayload, uuid(), 1), []byte("HTTP/1.1 200 OK\r\n\r\n")...)
+
+	if !isRequestPayload(request) || isRequestPayload(response) || isRequestPayload(replayed) {
+		t.Error("Only request should be detected as request")
+	}
+
+	if !isRequestPayload([]byte("GET / HTTP/1.1\r\n\r\n")) {
+		t.Error("Payload without header should be treated as request")
+	}
+
+	if !isOriginPayload(request) || !isOriginPayload(response) || isOriginPayload(replayed) {
+		t.Error("Replayed response should not be origin payload")
+	}
+}
@@ -0,0 +1,144 @@
+package rawSocket
+
+import (
+	"encoding/binary"
+	"net"
+
+	"github.com/google/gopacket/layers"
+)
+
+// EtherTypes of frames handled by AF_PACKET engine
+const (
+	etherTypeIPv4 = 0x0800
+	etherTypeIPv6 = 0x86DD
+	etherTypeVLAN = 0x8100
+	etherTypeQinQ = 0x88A8
+
+	// Payload type of GRE tunnels carrying Ethernet frames (transparent Ethernet bridging)
+	greProtocolEthernet = 0x6558
+)
+
+// IP protocols of tunnels decoded by AF_PACKET engine
+const (
+	ipProtocolUDP = 17
+	ipProtocolGRE = 47
+)
+
+// AF_PACKET ring is made of blocks, each holding multiple frames. Kernel returns block to user space
+// when it is full or when block timeout expires.
+const (
+	afPacketBlockSize    = 1 << 20
+	afPacketBlockCount   = 64
+	afPacketFrameSize    = 1 << 11
+	afPacketBlockTimeout = 10 // milliseconds
+)
+
+// ethernetPayload parses Ethernet frame and returns source address, protocol and payload of IP layer.
+// 802.1Q and 802.1ad VLAN tags skipped. Payload is nil if frame is not IPv4 or IPv6 packet.
+func ethernetPayload(frame []byte) (src net.IP, protocol uint8, payload []byte) {
+	if len(frame) < 14 {
+		return
+	}
+
+	etherType := binary.BigEndian.Uint16(frame[12:14])
+	frame = frame[14:]
+
+	for (etherType == etherTypeVLAN || etherType == etherTypeQinQ) && len(frame) >= 4 {
+		etherType = binary.BigEndian.Uint16(frame[2:4])
+		frame = frame[4:]
+	}
+
+	if etherType != etherTypeIPv4 && etherType != etherTypeIPv6 {
+		return
+	}
+
+	return ipPayload(frame)
+}
+
+// tunnelPayload returns source address, protocol and payload of innermost IP layer of packets encapsulated into
+// VXLAN or GRE tunnels, other packets returned as is. Payload is nil if tunnel does not carry IP packet.
+func tunnelPayload(src net.IP, protocol uint8, payload []byte) (net.IP, uint8, []byte) {
+	// Depth limited, so crafted packets can't make parser loop for long
+	for depth := 0; depth < 4; depth++ {
+		switch {
+		case protocol == ipProtocolUDP && len(payload) >= 16 && binary.BigEndian.Uint16(payload[2:4]) == VXLANPort:
+			// UDP header followed by 8 byte VXLAN header and Ethernet frame
+			src, protocol, payload = ethernetPayload(payload[16:])
+		case protocol == ipProtocolGRE && len(payload) >= 4:
+			flags := binary.BigEndian.Uint16(payload[0:2])
+			etherType := binary.BigEndian.Uint16(payload[2:4])
+
+			// Checksum, key and sequence number fields present if their flags set
+			size := 4
+			for _, flag := range []uint16{0x8000, 0x2000, 0x1000} {
+				if flags&flag != 0 {
+					size += 4
+				}
+			}
+
+			if len(payload) < size {
+				return nil, 0, nil
+			}
+
+			switch etherType {
+			case etherTypeIPv4, etherTypeIPv6:
+				src, protocol, payload = ipPayload(payload[size:])
+			case greProtocolEthernet:
+				src, protocol, payload = ethernetPayload(payload[size:])
+			default:
+				return nil, 0, nil
+			}
+		default:
+			return src, protocol, payload
+		}
+	}
+
+	return src, protocol, payload
+}
+
+// ipPayload parses IPv4 or IPv6 packet and returns source address, protocol and payload
+func ipPayload(packet []byte) (src net.IP, protocol uint8, payload []byte) {
+	if len(packet) == 0 {
+		return
+	}
+
+	switch packet[0] >> 4 {
+	case 4:
+		if len(packet) < 20 {
+			return
+		}
+
+		headerSize := int(packet[0]&0x0F) * 4
+		// Total length used to cut Ethernet padding of short frames
+		size := int(binary.BigEndian.Uint16(packet[2:4]))
+		if headerSize < 20 || size < headerSize || size > len(packet) {
+			return
+		}
+
+		return net.IP(packet[12:16]), packet[9], packet[headerSize:size]
+	case 6:
+		if len(packet) < 40 {
+			return
+		}
+
+		// Extension headers are not supported, packets with them have other next header than TCP or UDP
+		size := 40 + int(binary.BigEndian.Uint16(packet[4:6]))
+		if size > len(packet) {
+			return
+		}
+
+		return net.IP(packet[8:24]), packet[6], packet[40:size]
+	}
+
+	return
+}
+
+// isCapturedPayload checks that IP payload is of captured protocol, and long enough to hold TCP or UDP header
+func (t *Listener) isCapturedPayload(protocol uint8, payload []byte) bool {
+	headerSize := 20
+	if t.config.Protocol == ProtocolUDP {
+		headerSize = 8
+	}
+
+	return len(payload) >= headerSize && layers.IPProtocol(protocol) == t.ipProtocol()
+}
@@ -0,0 +1,314 @@
+package rawSocket
+
+import (
+	"log"
+	"net"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+)
+
+// TPACKET_V3 constants, see linux/if_packet.h
+const (
+	packetVersion  = 10
+	packetRxRing   = 5
+	tpacketV3      = 2
+	tpStatusKernel = 0
+	tpStatusUser   = 1
+	packetOutgoing = 4
+	pollIn         = 0x1
+
+	// Size of tpacket3_hdr aligned to 16 bytes, followed by sockaddr_ll of packet
+	tpacket3HdrLen = 48
+)
+
+type tpacketReq3 struct {
+	blockSize      uint32
+	blockNr        uint32
+	frameSize      uint32
+	frameNr        uint32
+	retireBlkTov   uint32
+	sizeofPriv     uint32
+	featureReqWord uint32
+}
+
+type packetMreq struct {
+	ifindex int32
+	mrType  uint16
+	alen    uint16
+	address [8]byte
+}
+
+type pollFd struct {
+	fd      int32
+	events  int16
+	revents int16
+}
+
+// afPacketRing is AF_PACKET socket with memory mapped ring buffer shared with kernel,
+// so packets are read without syscall per packet
+type afPacketRing struct {
+	fd   int
+	data []byte
+}
+
+// readAFPacket starts AF_PACKET capture on each interface matching listener address
+func (t *Listener) readAFPacket() {
+	indexes, err := t.afPacketInterfaces()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	loopback := loopbackInterfaces()
+
+	for _, index := range indexes {
+		// Filtering in kernel, so only packets of captured ports copied to ring
+		filter, err := pcap.CompileBPFFilter(afPacketLinkType(index), t.config.SnapLength, t.bpfFilter())
+		if err != nil {
+			log.Fatal("AF_PACKET BPF filter error: ", err)
+		}
+
+		ring, err := newAFPacketRing(index, t.config.Promiscuous, filter)
+		if err != nil {
+			log.Fatal("AF_PACKET error: ", err)
+		}
+
+		go t.readAFPacketRing(ring, loopback)
+	}
+}
+
+// afPacketInterfaces returns indexes of interfaces to capture on, same as for pcap engine.
+// Index 0 captures on all interfaces at once.
+func (t *Listener) afPacketInterfaces() (indexes []int, err error) {
+	switch {
+	case t.config.Interface == "any":
+		return []int{0}, nil
+	case t.config.Interface != "":
+		iface, err := net.InterfaceByName(t.config.Interface)
+		if err != nil {
+			return nil, err
+		}
+
+		return []int{iface.Index}, nil
+	}
+
+	ip := net.ParseIP(t.addr)
+	if ip == nil || ip.IsUnspecified() {
+		return []int{0}, nil
+	}
+
+	ifaces, err := interfacesWithAddr(t.addr)
+	for _, iface := range ifaces {
+		indexes = append(indexes, iface.Index)
+	}
+
+	return
+}
+
+// afPacketLinkType returns link type of frames captured on interface, used to compile BPF filter. Interfaces without
+// link layer, like tunnels, deliver IP packets. Capture on all interfaces assumes Ethernet frames, which loopback
+// interface uses as well.
+func afPacketLinkType(ifindex int) layers.LinkType {
+	if ifindex == 0 {
+		return layers.LinkTypeEthernet
+	}
+
+	iface, err := net.InterfaceByIndex(ifindex)
+	if err == nil && len(iface.HardwareAddr) == 0 && iface.Flags&net.FlagLoopback == 0 {
+		return layers.LinkTypeRaw
+	}
+
+	return layers.LinkTypeEthernet
+}
+
+// loopbackInterfaces returns indexes of loopback interfaces. Packets sent over loopback seen twice, as outgoing and incoming.
+func loopbackInterfaces() map[int]bool {
+	loopback := make(map[int]bool)
+
+	ifaces, _ := net.Interfaces()
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 {
+			loopback[iface.Index] = true
+		}
+	}
+
+	return loopback
+}
+
+func newAFPacketRing(ifindex int, promiscuous bool, filter []pcap.BPFInstruction) (ring *afPacketRing, err error) {
+	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_RAW, int(htons(syscall.ETH_P_ALL)))
+	if err != nil {
+		return
+	}
+
+	ring = &afPacketRing{fd: fd}
+
+	defer func() {
+		if err != nil {
+			ring.Close()
+			ring = nil
+		}
+	}()
+
+	// Filter attached before socket bound to interface, so ring never gets packets it does not match
+	if len(filter) > 0 {
+		program := make([]syscall.SockFilter, len(filter))
+		for i, ins := range filter {
+			program[i] = syscall.SockFilter{Code: ins.Code, Jt: ins.Jt, Jf: ins.Jf, K: ins.K}
+		}
+
+		if err = syscall.AttachLsf(fd, program); err != nil {
+			return
+		}
+	}
+
+	if err = syscall.SetsockoptInt(fd, syscall.SOL_PACKET, packetVersion, tpacketV3); err != nil {
+		return
+	}
+
+	req := tpacketReq3{
+		blockSize:    afPacketBlockSize,
+		blockNr:      afPacketBlockCount,
+		frameSize:    afPacketFrameSize,
+		frameNr:      afPacketBlockSize / afPacketFrameSize * afPacketBlockCount,
+		retireBlkTov: afPacketBlockTimeout,
+	}
+	if err = setsockopt(fd, packetRxRing, unsafe.Pointer(&req), unsafe.Sizeof(req)); err != nil {
+		return
+	}
+
+	if ring.data, err = syscall.Mmap(fd, 0, afPacketBlockSize*afPacketBlockCount, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED); err != nil {
+		return
+	}
+
+	if err = syscall.Bind(fd, &syscall.SockaddrLinklayer{Protocol: htons(syscall.ETH_P_ALL), Ifindex: ifindex}); err != nil {
+		return
+	}
+
+	// Promiscuous mode can be enabled only for specific interface
+	if promiscuous && ifindex != 0 {
+		mreq := packetMreq{ifindex: int32(ifindex), mrType: syscall.PACKET_MR_PROMISC}
+		err = setsockopt(fd, syscall.PACKET_ADD_MEMBERSHIP, unsafe.Pointer(&mreq), unsafe.Sizeof(mreq))
+	}
+
+	return
+}
+
+// Close unmaps ring and closes socket
+func (r *afPacketRing) Close() error {
+	if r.data != nil {
+		syscall.Munmap(r.data)
+		r.data = nil
+	}
+
+	return syscall.Close(r.fd)
+}
+
+// wait blocks until kernel returns block to user space
+func (r *afPacketRing) wait() error {
+	pfd := pollFd{fd: int32(r.fd), events: pollIn}
+
+	_, _, errno := syscall.Syscall6(syscall.SYS_PPOLL, uintptr(unsafe.Pointer(&pfd)), 1, 0, 0, 0, 0)
+	if errno != 0 && errno != syscall.EINTR {
+		return errno
+	}
+
+	return nil
+}
+
+// readAFPacketRing reads blocks of ring in order, and returns each of them to kernel once its frames processed
+func (t *Listener) readAFPacketRing(ring *afPacketRing, loopback map[int]bool) {
+	defer ring.Close()
+
+	var backoff readBackoff
+
+	for block := 0; ; block = (block + 1) % afPacketBlockCount {
+		desc := ring.data[block*afPacketBlockSize : (block+1)*afPacketBlockSize]
+
+		// tpacket_block_desc: block_status at offset 8, num_pkts at 12, offset_to_first_pkt at 16
+		for atomic.LoadUint32(word(desc, 8))&tpStatusUser == 0 {
+			if err := ring.wait(); err != nil {
+				if !backoff.wait("AF_PACKET", err) {
+					return
+				}
+				continue
+			}
+			backoff.reset()
+		}
+
+		count := *word(desc, 12)
+		offset := *word(desc, 16)
+
+		for i := uint32(0); i < count; i++ {
+			frame := desc[offset:]
+			t.processAFPacketFrame(frame, loopback)
+
+			// tp_next_offset
+			offset += *word(frame, 0)
+		}
+
+		atomic.StoreUint32(word(desc, 8), tpStatusKernel)
+	}
+}
+
+// processAFPacketFrame parses tpacket3_hdr and link layer of frame, and passes IP payload to parser
+func (t *Listener) processAFPacketFrame(frame []byte, loopback map[int]bool) {
+	snapLen := *word(frame, 12)
+	mac := *(*uint16)(unsafe.Pointer(&frame[24]))
+	network := *(*uint16)(unsafe.Pointer(&frame[26]))
+
+	// sockaddr_ll: sll_ifindex at offset 4, sll_pkttype at 10
+	ifindex := int(*(*int32)(unsafe.Pointer(&frame[tpacket3HdrLen+4])))
+	pktType := frame[tpacket3HdrLen+10]
+
+	if pktType == packetOutgoing && loopback[ifindex] {
+		return
+	}
+
+	var src net.IP
+	var protocol uint8
+	var payload []byte
+
+	// Interfaces without link layer, like tunnels, have no Ethernet header
+	if mac == network {
+		src, protocol, payload = ipPayload(frame[network : uint32(network)+snapLen])
+	} else {
+		src, protocol, payload = ethernetPayload(frame[mac : uint32(mac)+snapLen])
+	}
+
+	if t.config.Decapsulate {
+		src, protocol, payload = tunnelPayload(src, protocol, payload)
+	}
+
+	if !t.isCapturedPayload(protocol, payload) {
+		return
+	}
+
+	// Ring memory reused by kernel once block returned, so data copied
+	data := make([]byte, len(payload))
+	copy(data, payload)
+
+	go t.parsePacket(&net.IPAddr{IP: append(net.IP(nil), src...)}, data)
+}
+
+func setsockopt(fd, name int, value unsafe.Pointer, size uintptr) error {
+	_, _, errno := syscall.Syscall6(syscall.SYS_SETSOCKOPT, uintptr(fd), syscall.SOL_PACKET, uintptr(name), uintptr(value), size, 0)
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
+
+func word(data []byte, offset uint32) *uint32 {
+	return (*uint32)(unsafe.Pointer(&data[offset]))
+}
+
+// htons converts value to network byte order
+func htons(v uint16) uint16 {
+	b := [2]byte{byte(v >> 8), byte(v)}
+	return *(*uint16)(unsafe.Pointer(&b[0]))
+}
@@ -0,0 +1,68 @@
+package rawSocket
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/pcap"
+)
+
+func TestListenerAFPacket(t *testing.T) {
+	// Needs CAP_NET_RAW
+	ring, err := newAFPacketRing(0, false, nil)
+	if err != nil {
+		t.Skip("AF_PACKET is not available:", err)
+	}
+	ring.Close()
+
+	// Filter which drops all packets: ret #0
+	ring, err = newAFPacketRing(0, false, []pcap.BPFInstruction{{Code: 0x06, K: 0}})
+	if err != nil {
+		t.Fatal("Should attach BPF filter:", err)
+	}
+	ring.Close()
+
+	server, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	go http.Serve(server, http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	_, port, _ := net.SplitHostPort(server.Addr().String())
+
+	listener := NewListener("127.0.0.1", port, &ListenerConfig{Engine: EngineAFPacket, Interface: "lo", TrackResponse: true})
+
+	go http.Get("http://" + server.Addr().String() + "/af_packet")
+
+	var request, response *TCPMessage
+	timeout := time.After(5 * time.Second)
+
+	for request == nil || response == nil {
+		select {
+		case m := <-listener.messagesChan:
+			if m.IsIncoming {
+				request = m
+			} else {
+				response = m
+			}
+		case <-timeout:
+			t.Fatal("Should capture request and response")
+		}
+	}
+
+	if !strings.HasPrefix(string(request.Bytes()), "GET /af_packet HTTP/1.1\r\n") {
+		t.Errorf("Wrong request: %q", request.Bytes())
+	}
+
+	if !strings.HasPrefix(string(response.Bytes()), "HTTP/1.1 200 OK\r\n") {
+		t.Errorf("Wrong response: %q", response.Bytes())
+	}
+
+	if string(request.UUID()) != string(response.UUID()) {
+		t.Error("Request and response should have same id")
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package rawSocket
+
+import (
+	"log"
+)
+
+func (t *Listener) readAFPacket() {
+	log.Fatal("AF_PACKET capture engine is supported only on Linux")
+}
@@ -0,0 +1,73 @@
+package rawSocket
+
+import (
+	"net"
+	"testing"
+)
+
+func TestEthernetPayload(t *testing.T) {
+	ip := []byte{
+		0x45, 0, 0, 24, 0, 0, 0, 0, 64, 6, 0, 0,
+		10, 0, 0, 1, 10, 0, 0, 2,
+		'd', 'a', 't', 'a',
+	}
+
+	frame := append(make([]byte, 12), 0x08, 0x00)
+	frame = append(frame, ip...)
+	// Ethernet padding
+	frame = append(frame, 0, 0)
+
+	src, protocol, payload := ethernetPayload(frame)
+	if src.String() != "10.0.0.1" || protocol != 6 || string(payload) != "data" {
+		t.Error("Should parse IPv4 frame:", src, protocol, string(payload))
+	}
+
+	tagged := append(make([]byte, 12), 0x81, 0x00, 0, 10, 0x08, 0x00)
+	tagged = append(tagged, ip...)
+
+	if _, _, payload = ethernetPayload(tagged); string(payload) != "data" {
+		t.Error("Should skip VLAN tag:", string(payload))
+	}
+
+	arp := append(make([]byte, 12), 0x08, 0x06)
+	if _, _, payload = ethernetPayload(append(arp, ip...)); payload != nil {
+		t.Error("Should skip non IP frames")
+	}
+
+	ip6 := make([]byte, 40)
+	ip6[0], ip6[5], ip6[6], ip6[23] = 0x60, 4, 17, 1
+	if src, protocol, payload = ipPayload(append(ip6, "data"...)); src.String() != "::1" || protocol != 17 || string(payload) != "data" {
+		t.Error("Should parse IPv6 packet:", src, protocol, string(payload))
+	}
+}
+
+func TestTunnelPayload(t *testing.T) {
+	inner := []byte{
+		0x45, 0, 0, 24, 0, 0, 0, 0, 64, 6, 0, 0,
+		10, 0, 0, 1, 10, 0, 0, 2,
+		'd', 'a', 't', 'a',
+	}
+
+	// UDP header to VXLAN port, VXLAN header and Ethernet frame
+	vxlan := []byte{0, 1, 0x12, 0xb5, 0, 0, 0, 0, 8, 0, 0, 0, 0, 0, 1, 0}
+	vxlan = append(vxlan, append(make([]byte, 12), 0x08, 0x00)...)
+	vxlan = append(vxlan, inner...)
+
+	if src, protocol, payload := tunnelPayload(net.IP{192, 168, 0, 1}, 17, vxlan); src.String() != "10.0.0.1" || protocol != 6 || string(payload) != "data" {
+		t.Error("Should decode VXLAN packet:", src, protocol, string(payload))
+	}
+
+	// GRE header with key
+	gre := append([]byte{0x20, 0, 0x08, 0x00, 0, 0, 0, 1}, inner...)
+	if src, _, payload := tunnelPayload(net.IP{192, 168, 0, 1}, 47, gre); src.String() != "10.0.0.1" || string(payload) != "data" {
+		t.Error("Should decode GRE packet:", src, string(payload))
+	}
+
+	if _, _, payload := tunnelPayload(nil, 47, []byte{0, 0, 0x88, 0xbe, 0}); payload != nil {
+		t.Error("Should skip GRE packets without IP payload")
+	}
+
+	if src, protocol, payload := tunnelPayload(net.IP{10, 0, 0, 1}, 6, []byte("data")); src.String() != "10.0.0.1" || protocol != 6 || string(payload) != "data" {
+		t.Error("Should return packets without tunnel as is")
+	}
+}
@@ -1,25 +1,103 @@
 /*
-Package rawSocket provides traffic sniffier using RAW sockets.
+Package rawSocket provides traffic sniffier using RAW sockets or libpcap.
 
 Capture traffic from socket using RAW_SOCKET's
 http://en.wikipedia.org/wiki/Raw_socket
 
 RAW_SOCKET allow you listen for traffic on any port (e.g. sniffing) because they operate on IP level.
 
+Alternatively traffic can be captured using libpcap (EnginePcap), which works on link level,
+and allows kernel side filtering, promiscuous mode and works reliably under high load.
+
+On Linux AF_PACKET engine (EngineAFPacket) reads packets from ring buffer shared with kernel (TPACKET_V3),
+without syscall per packet, which needs far less CPU at high packet rates. See afpacket_linux.go
+
+Dedicated capture appliances can use PF_RING (EnginePFRing), including zero copy PF_RING ZC devices.
+It needs PF_RING library, so it compiled only with `pfring` build tag, see pfring.go
+
 Ports is TCP feature, same as flow control, reliable transmission and etc.
 
 This package implements own TCP layer: TCP packets is parsed using tcp_packet.go, and flow control is managed by tcp_message.go
+
+UDP traffic can be captured as well (ProtocolUDP). Datagrams do not need reassembly, so they emitted as is, see udp_datagram.go
+
+Existing capture files can be read using PcapFile, which reassembles messages using capture timestamps, see pcap_file.go
 */
 package rawSocket
 
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net"
 	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+)
+
+// Capture engines
+const (
+	// EngineRawSocket captures traffic using RAW_SOCKET's, do not see outgoing traffic on some systems
+	EngineRawSocket = iota
+	// EnginePcap captures traffic using libpcap
+	EnginePcap
+	// EngineAFPacket captures traffic using memory mapped AF_PACKET ring, Linux only
+	EngineAFPacket
+	// EnginePFRing captures traffic using PF_RING, available if built with `pfring` tag
+	EnginePFRing
+)
+
+// Captured protocols
+const (
+	ProtocolTCP = "tcp"
+	ProtocolUDP = "udp"
 )
 
+// DefaultSnapLength is the maximum number of bytes captured for each packet
+const DefaultSnapLength = 64 * 1024
+
+// ListenerConfig holds capture engine options
+type ListenerConfig struct {
+	Engine int
+
+	// Protocol is ProtocolTCP (default) or ProtocolUDP
+	Protocol string
+
+	// libpcap and PF_RING options, Promiscuous used by AF_PACKET engine too
+	SnapLength  int
+	Promiscuous bool
+	// BPFFilter is additional filter expression, combined with port filter
+	BPFFilter string
+
+	// TrackResponse enables capturing of outgoing responses
+	TrackResponse bool
+
+	// RawPayloads disables HTTP specific processing, like merging of `Expect: 100-continue` requests
+	RawPayloads bool
+
+	// MaxMessageSize limits memory used by each message, see TCPMessage.MaxSize
+	MaxMessageSize int
+
+	// Interface is name of network interface to capture on, or "any" for all interfaces.
+	// By default interfaces which have listener address assigned are used.
+	Interface string
+
+	// Decapsulate enables capture of packets with 802.1Q VLAN tags, or encapsulated into VXLAN or GRE tunnels,
+	// e.g. mirrored in virtualized networks. Used only by pcap engine.
+	Decapsulate bool
+}
+
+// VXLANPort is UDP port of VXLAN tunnels, decoded by gopacket
+const VXLANPort = 4789
+
 // Listener handle traffic capture
 type Listener struct {
 	// buffer of TCPMessages waiting to be send
@@ -27,12 +105,12 @@ type Listener struct {
 
 	// Expect: 100-continue request is send in 2 tcp messages
 	// We store ACK aliases to merge this packets together
-	ackAliases   map[uint32]uint32
+	ackAliases map[uint32]uint32
 	// To get ACK of second message we need to compute its Seq and wait for them message
 	seqWithData map[uint32]uint32
 
 	// Messages ready to be send to client
-	packetsChan  chan *TCPPacket
+	packetsChan chan *TCPPacket
 
 	// Messages ready to be send to client
 	messagesChan chan *TCPMessage
@@ -40,27 +118,92 @@ type Listener struct {
 	// Used for notifications about completed or expired messages
 	messageDelChan chan *TCPMessage
 
-	addr string // IP to listen
-	port int    // Port to listen
+	// Captured UDP datagrams
+	datagramsChan chan *UDPDatagram
+
+	addr  string      // IP to listen
+	ports []PortRange // Ports to listen
+
+	config *ListenerConfig
+}
+
+// PortRange is inclusive range of captured ports, single port has equal From and To
+type PortRange struct {
+	From, To int
 }
 
-// NewListener creates and initializes new Listener object
-func NewListener(addr string, port string) (rawListener *Listener) {
+// ParsePorts parses comma separated list of ports and port ranges, e.g. "80,8080,3000-3010"
+func ParsePorts(value string) (ports []PortRange, err error) {
+	for _, part := range strings.Split(value, ",") {
+		bounds := strings.SplitN(strings.TrimSpace(part), "-", 2)
+
+		var r PortRange
+		if r.From, err = strconv.Atoi(bounds[0]); err != nil {
+			return nil, fmt.Errorf("invalid port: %s", part)
+		}
+
+		r.To = r.From
+		if len(bounds) == 2 {
+			if r.To, err = strconv.Atoi(bounds[1]); err != nil {
+				return nil, fmt.Errorf("invalid port range: %s", part)
+			}
+		}
+
+		if r.From < 0 || r.To > 65535 || r.From > r.To {
+			return nil, fmt.Errorf("invalid port range: %s", part)
+		}
+
+		ports = append(ports, r)
+	}
+
+	return
+}
+
+// NewListener creates and initializes new Listener object.
+// Port can be list of ports and port ranges, see ParsePorts.
+func NewListener(addr string, port string, config *ListenerConfig) (rawListener *Listener) {
 	rawListener = &Listener{}
 
 	rawListener.packetsChan = make(chan *TCPPacket, 10000)
 	rawListener.messagesChan = make(chan *TCPMessage, 10000)
 	rawListener.messageDelChan = make(chan *TCPMessage, 10000)
+	rawListener.datagramsChan = make(chan *UDPDatagram, 10000)
 
 	rawListener.messages = make(map[string]*TCPMessage)
 	rawListener.ackAliases = make(map[uint32]uint32)
 	rawListener.seqWithData = make(map[uint32]uint32)
 
 	rawListener.addr = addr
-	rawListener.port, _ = strconv.Atoi(port)
+	ports, err := ParsePorts(port)
+	if err != nil {
+		log.Fatal(err)
+	}
+	rawListener.ports = ports
+	rawListener.config = config
+
+	if rawListener.config.SnapLength == 0 {
+		rawListener.config.SnapLength = DefaultSnapLength
+	}
 
-	go rawListener.listen()
-	go rawListener.readRAWSocket()
+	if rawListener.config.Protocol == "" {
+		rawListener.config.Protocol = ProtocolTCP
+	}
+
+	// UDP datagrams do not need reassembly
+	if rawListener.config.Protocol == ProtocolTCP {
+		go rawListener.listen()
+	}
+
+	switch config.Engine {
+	case EnginePcap:
+		rawListener.readPcap()
+	case EngineAFPacket:
+		rawListener.readAFPacket()
+	case EnginePFRing:
+		rawListener.readPFRing()
+	default:
+		rawListener.readRAWSocket()
+	}
 
 	return
 }
@@ -80,24 +223,69 @@ func (t *Listener) listen() {
 		}
 	}
 }
+
+// readRAWSocket captures packets using RAW sockets. IPv4 and IPv6 captured by separate sockets:
+// for unspecified address both are opened, and missing IPv6 support of host is not fatal.
 func (t *Listener) readRAWSocket() {
-	conn, e := net.ListenPacket("ip4:tcp", t.addr)
+	addr := t.addr
+
+	// RAW socket can't be bound to interface, so it bound to interface address
+	switch t.config.Interface {
+	case "":
+	case "any":
+		addr = ""
+	default:
+		var err error
+		if addr, err = interfaceAddr(t.config.Interface); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	ip := net.ParseIP(addr)
+
+	switch {
+	case ip == nil || ip.IsUnspecified():
+		t.openRAWSocket("ip4", "", true)
+		t.openRAWSocket("ip6", "", false)
+	case ip.To4() != nil:
+		t.openRAWSocket("ip4", addr, true)
+	default:
+		t.openRAWSocket("ip6", addr, true)
+	}
+}
+
+func (t *Listener) openRAWSocket(network, addr string, required bool) {
+	conn, e := net.ListenPacket(network+":"+t.config.Protocol, addr)
 
 	if e != nil {
-		log.Fatal(e)
+		if required {
+			log.Fatal(e)
+		}
+
+		log.Println("Can't capture", network, "traffic:", e)
+		return
 	}
 
+	go t.readRAWSocketConn(conn)
+}
+
+func (t *Listener) readRAWSocketConn(conn net.PacketConn) {
 	defer conn.Close()
 
+	var backoff readBackoff
+
 	for {
 		buf := make([]byte, 64*1024) // 64kb
 		// Note: ReadFrom receive messages without IP header
 		n, addr, err := conn.ReadFrom(buf)
 
 		if err != nil {
-			log.Println("Error:", err)
+			if !backoff.wait("RAW socket", err) {
+				return
+			}
 			continue
 		}
+		backoff.reset()
 
 		if n > 0 {
 			go t.parsePacket(addr, buf[:n])
@@ -105,19 +293,340 @@ func (t *Listener) readRAWSocket() {
 	}
 }
 
+// Delays between reads after capture errors, so persistent error does not make capture loop spin and flood log
+const (
+	readErrorMinDelay = 10 * time.Millisecond
+	readErrorMaxDelay = time.Second
+)
+
+// readBackoff delays capture loop after read errors, doubling delay while errors repeat
+type readBackoff struct {
+	delay time.Duration
+}
+
+// wait logs read error and sleeps before next read. Returns false if capture can't continue, because capture
+// handle closed or device gone, then capture loop should exit.
+func (b *readBackoff) wait(engine string, err error) bool {
+	if isFatalReadError(err) {
+		log.Println(engine, "capture stopped:", err)
+		return false
+	}
+
+	if b.delay *= 2; b.delay < readErrorMinDelay {
+		b.delay = readErrorMinDelay
+	} else if b.delay > readErrorMaxDelay {
+		b.delay = readErrorMaxDelay
+	}
+
+	log.Println(engine, "read error:", err, "retrying in", b.delay)
+	time.Sleep(b.delay)
+
+	return true
+}
+
+// reset is called after successful read
+func (b *readBackoff) reset() {
+	b.delay = 0
+}
+
+// isFatalReadError returns true for errors after which reads can't succeed
+func isFatalReadError(err error) bool {
+	return err == io.EOF || errors.Is(err, net.ErrClosed) || errors.Is(err, syscall.EBADF) || errors.Is(err, syscall.ENODEV)
+}
+
+// interfaceAddr returns IPv4 address of network interface
+func interfaceAddr(name string) (string, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return "", err
+	}
+
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return "", err
+	}
+
+	for _, addr := range addrs {
+		if ip, ok := addr.(*net.IPNet); ok && ip.IP.To4() != nil {
+			return ip.IP.String(), nil
+		}
+	}
+
+	return "", fmt.Errorf("Interface %s has no IPv4 address", name)
+}
+
+// interfacesWithAddr returns network interfaces which have given address assigned.
+// If address is empty or unspecified, all interfaces which are up returned.
+func interfacesWithAddr(addr string) (matched []net.Interface, err error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return
+	}
+
+	ip := net.ParseIP(addr)
+
+	for _, iface := range ifaces {
+		if ip == nil || ip.IsUnspecified() {
+			if iface.Flags&net.FlagUp != 0 {
+				matched = append(matched, iface)
+			}
+			continue
+		}
+
+		addrs, _ := iface.Addrs()
+
+		for _, a := range addrs {
+			if ipNet, ok := a.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+				matched = append(matched, iface)
+				break
+			}
+		}
+	}
+
+	if len(matched) == 0 {
+		err = fmt.Errorf("Can't find interfaces with addr: %s", addr)
+	}
+
+	return
+}
+
+// pcapDevices returns list of network interfaces which have given address assigned.
+// If address is empty or 0.0.0.0, all interfaces returned. Interface specified in config takes precedence over address,
+// "any" is pseudo-device capturing on all interfaces at once.
+func (t *Listener) pcapDevices() (devices []pcap.Interface, err error) {
+	if t.config.Interface == "any" {
+		return []pcap.Interface{{Name: "any"}}, nil
+	}
+
+	ifaces, err := pcap.FindAllDevs()
+
+	if err != nil {
+		return
+	}
+
+	for _, iface := range ifaces {
+		if t.config.Interface != "" {
+			if iface.Name == t.config.Interface {
+				devices = append(devices, iface)
+			}
+			continue
+		}
+
+		if t.addr == "" || t.addr == "0.0.0.0" || t.addr == "::" {
+			devices = append(devices, iface)
+			continue
+		}
+
+		for _, addr := range iface.Addresses {
+			if addr.IP.String() == t.addr {
+				devices = append(devices, iface)
+				break
+			}
+		}
+	}
+
+	if len(devices) == 0 && t.config.Interface != "" {
+		err = fmt.Errorf("Can't find interface: %s", t.config.Interface)
+	} else if len(devices) == 0 {
+		err = fmt.Errorf("Can't find interfaces with addr: %s", t.addr)
+	}
+
+	return
+}
+
+// readPcap starts libpcap capture on each device matching listener address
+func (t *Listener) readPcap() {
+	devices, err := t.pcapDevices()
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, device := range devices {
+		handle, err := t.openPcap(device.Name)
+
+		if err != nil {
+			log.Fatal("PCAP Activate error:", err, device.Name)
+		}
+
+		go t.readPcapHandle(handle)
+	}
+}
+
+func (t *Listener) openPcap(device string) (handle *pcap.Handle, err error) {
+	inactive, err := pcap.NewInactiveHandle(device)
+
+	if err != nil {
+		return
+	}
+
+	defer inactive.CleanUp()
+
+	inactive.SetSnapLen(t.config.SnapLength)
+	inactive.SetPromisc(t.config.Promiscuous)
+	inactive.SetTimeout(pcap.BlockForever)
+
+	if handle, err = inactive.Activate(); err != nil {
+		return
+	}
+
+	// Filtering in kernel, so we receive only packets for our port
+	if err = handle.SetBPFFilter(t.bpfFilter()); err != nil {
+		handle.Close()
+		return nil, err
+	}
+
+	return
+}
+
+// bpfFilter returns filter expression for captured ports, combined with user defined filter
+func (t *Listener) bpfFilter() string {
+	direction := "dst "
+	if t.config.TrackResponse {
+		direction = ""
+	}
+
+	var ports []string
+	for _, r := range t.ports {
+		if r.From == r.To {
+			ports = append(ports, fmt.Sprintf("%sport %d", direction, r.From))
+		} else {
+			ports = append(ports, fmt.Sprintf("%sportrange %d-%d", direction, r.From, r.To))
+		}
+	}
+
+	filter := t.config.Protocol + " " + ports[0]
+	if len(ports) > 1 {
+		filter = t.config.Protocol + " and (" + strings.Join(ports, " or ") + ")"
+	}
+
+	if t.config.BPFFilter != "" {
+		filter = "(" + filter + ") and (" + t.config.BPFFilter + ")"
+	}
+
+	// Ports of tunneled packets can't be checked in kernel, they are filtered after decoding.
+	// "vlan" shifts offsets for the rest of expression, so VLAN clause goes last.
+	if t.config.Decapsulate {
+		filter = "(" + filter + ") or (udp port " + strconv.Itoa(VXLANPort) + ") or (ip proto gre) or (ip6 proto gre) or (vlan and (" + filter + "))"
+	}
+
+	return filter
+}
+
+func (t *Listener) readPcapHandle(handle *pcap.Handle) {
+	defer handle.Close()
+
+	linkType := handle.LinkType()
+
+	var backoff readBackoff
+
+	for {
+		data, _, err := handle.ReadPacketData()
+
+		// Timeout only means there were no packets
+		if err == pcap.NextErrorTimeoutExpired {
+			continue
+		}
+
+		if err != nil {
+			if !backoff.wait("PCAP", err) {
+				return
+			}
+			continue
+		}
+		backoff.reset()
+
+		// ReadPacketData returns fresh buffer for each packet, so it safe to not copy data
+		src, payload := t.packetPayload(gopacket.NewPacket(data, linkType, gopacket.NoCopy))
+		if payload == nil {
+			continue
+		}
+
+		go t.parsePacket(&net.IPAddr{IP: src}, payload)
+	}
+}
+
+// packetPayload returns source address and IP payload of decoded packet, it contains TCP or UDP header and data,
+// same as RAW_SOCKET output. Returns nil payload for packets of other protocols, and truncated ones, e.g. by small
+// snapshot length, so they are not parsed.
+func (t *Listener) packetPayload(packet gopacket.Packet) (net.IP, []byte) {
+	src, protocol, payload := networkLayer(packet)
+	if !t.isCapturedPayload(uint8(protocol), payload) {
+		return nil, nil
+	}
+
+	return src, payload
+}
+
+// networkLayer returns source address, protocol and payload of innermost IP layer.
+// Packets encapsulated into VXLAN or GRE tunnels have multiple IP layers, and captured traffic is in the last one.
+// 802.1Q VLAN tags decoded by gopacket as part of link layer.
+func networkLayer(packet gopacket.Packet) (src net.IP, protocol layers.IPProtocol, payload []byte) {
+	for _, layer := range packet.Layers() {
+		switch ip := layer.(type) {
+		case *layers.IPv4:
+			src, protocol, payload = ip.SrcIP, ip.Protocol, ip.Payload
+		case *layers.IPv6:
+			src, protocol, payload = ip.SrcIP, ip.NextHeader, ip.Payload
+		}
+	}
+
+	return
+}
+
+func (t *Listener) ipProtocol() layers.IPProtocol {
+	if t.config.Protocol == ProtocolUDP {
+		return layers.IPProtocolUDP
+	}
+
+	return layers.IPProtocolTCP
+}
+
 func (t *Listener) parsePacket(addr net.Addr, buf []byte) {
-	if t.isIncomingDataPacket(buf) {
+	if t.config.Protocol == ProtocolUDP {
+		if t.isValidDatagram(buf) {
+			t.datagramsChan <- ParseUDPDatagram(addr, buf)
+		}
+		return
+	}
+
+	if t.isValidDataPacket(buf) {
 		t.packetsChan <- ParseTCPPacket(addr, buf)
 	}
 }
 
-func (t *Listener) isIncomingDataPacket(buf []byte) bool {
+func (t *Listener) isValidDatagram(buf []byte) bool {
+	// UDP header is 8 bytes, empty datagrams are skipped
+	if len(buf) <= 8 {
+		return false
+	}
+
+	srcPort := binary.BigEndian.Uint16(buf[0:2])
+	destPort := binary.BigEndian.Uint16(buf[2:4])
+
+	return t.hasPort(destPort) || (t.config.TrackResponse && t.hasPort(srcPort))
+}
+
+// hasPort checks if port is captured
+func (t *Listener) hasPort(port uint16) bool {
+	for _, r := range t.ports {
+		if int(port) >= r.From && int(port) <= r.To {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (t *Listener) isValidDataPacket(buf []byte) bool {
 	// To avoid full packet parsing every time, we manually parsing values needed for packet filtering
 	// http://en.wikipedia.org/wiki/Transmission_Control_Protocol
+	srcPort := binary.BigEndian.Uint16(buf[0:2])
 	destPort := binary.BigEndian.Uint16(buf[2:4])
 
 	// Because RAW_SOCKET can't be bound to port, we have to control it by ourself
-	if int(destPort) == t.port {
+	// Outgoing packets (responses) have our port as source
+	if t.hasPort(destPort) || (t.config.TrackResponse && t.hasPort(srcPort)) {
 		// Get the 'data offset' (size of the TCP header in 32-bit words)
 		dataOffset := (buf[12] & 0xF0) >> 4
 
@@ -141,6 +650,11 @@ var bPOST = []byte("POST")
 func (t *Listener) processTCPPacket(packet *TCPPacket) {
 	defer func() { recover() }()
 
+	if !t.hasPort(packet.DestPort) {
+		t.processResponsePacket(packet)
+		return
+	}
+
 	var message *TCPMessage
 
 	if parentAck, ok := t.seqWithData[packet.Seq]; ok {
@@ -157,11 +671,12 @@ func (t *Listener) processTCPPacket(packet *TCPPacket) {
 
 	if !ok {
 		// We sending messageDelChan channel, so message object can communicate with Listener and notify it if message completed
-		message = NewTCPMessage(mID, t.messageDelChan, packet.Ack)
+		message = NewTCPMessage(mID, t.messageDelChan, packet.Ack, true)
+		message.MaxSize = t.config.MaxMessageSize
 		t.messages[mID] = message
 	}
 
-	if bytes.Equal(packet.Data[0:4], bPOST) {
+	if !t.config.RawPayloads && bytes.Equal(packet.Data[0:4], bPOST) {
 		if bytes.Equal(packet.Data[len(packet.Data)-24:len(packet.Data)-4], bExpect100ContinueCheck) {
 			t.seqWithData[packet.Seq+uint32(len(packet.Data))] = packet.Ack
 
@@ -174,7 +689,27 @@ func (t *Listener) processTCPPacket(packet *TCPPacket) {
 	message.packetsChan <- packet
 }
 
+// Response packets do not need Expect: 100-continue handling.
+// Response to different clients distinguished by destination port.
+func (t *Listener) processResponsePacket(packet *TCPPacket) {
+	mID := packet.Addr.String() + strconv.Itoa(int(packet.DestPort)) + strconv.Itoa(int(packet.Ack))
+	message, ok := t.messages[mID]
+
+	if !ok {
+		message = NewTCPMessage(mID, t.messageDelChan, packet.Ack, false)
+		message.MaxSize = t.config.MaxMessageSize
+		t.messages[mID] = message
+	}
+
+	message.packetsChan <- packet
+}
+
 // Receive TCP messages from the listener channel
 func (t *Listener) Receive() *TCPMessage {
 	return <-t.messagesChan
 }
+
+// ReceiveDatagram returns captured UDP datagrams, if listener created with ProtocolUDP
+func (t *Listener) ReceiveDatagram() *UDPDatagram {
+	return <-t.datagramsChan
+}
@@ -0,0 +1,199 @@
+package rawSocket
+
+import (
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+)
+
+func TestParsePorts(t *testing.T) {
+	ports, err := ParsePorts("80, 8080,3000-3010")
+	if err != nil || !reflect.DeepEqual(ports, []PortRange{{80, 80}, {8080, 8080}, {3000, 3010}}) {
+		t.Error("Should parse ports and ranges:", ports, err)
+	}
+
+	for _, value := range []string{"", "abc", "3010-3000", "80-", "70000"} {
+		if _, err := ParsePorts(value); err == nil {
+			t.Error("Should reject invalid ports:", value)
+		}
+	}
+}
+
+func TestListenerPorts(t *testing.T) {
+	l := &Listener{ports: []PortRange{{80, 80}, {3000, 3010}}, config: &ListenerConfig{Protocol: ProtocolTCP}}
+
+	for port, expected := range map[uint16]bool{80: true, 81: false, 2999: false, 3000: true, 3005: true, 3010: true, 3011: false} {
+		if l.hasPort(port) != expected {
+			t.Error("Wrong port match:", port)
+		}
+	}
+
+	if f := l.bpfFilter(); f != "tcp and (dst port 80 or dst portrange 3000-3010)" {
+		t.Error("Wrong filter:", f)
+	}
+
+	l.config.TrackResponse = true
+	l.ports = l.ports[:1]
+	if f := l.bpfFilter(); f != "tcp port 80" {
+		t.Error("Wrong filter:", f)
+	}
+}
+
+func TestListenerInterface(t *testing.T) {
+	l := &Listener{config: &ListenerConfig{Interface: "any"}}
+
+	if devices, err := l.pcapDevices(); err != nil || len(devices) != 1 || devices[0].Name != "any" {
+		t.Error("Should capture on 'any' pseudo-device:", devices, err)
+	}
+
+	// Loopback interface named differently on some systems
+	if _, err := net.InterfaceByName("lo"); err == nil {
+		if addr, err := interfaceAddr("lo"); err != nil || addr != "127.0.0.1" {
+			t.Error("Should find address of loopback interface:", addr, err)
+		}
+	}
+
+	if _, err := interfaceAddr("gor-missing0"); err == nil {
+		t.Error("Should fail on unknown interface")
+	}
+}
+
+// testPacket is decoded packet with given layers
+type testPacket struct {
+	gopacket.Packet
+	layers []gopacket.Layer
+}
+
+func (p *testPacket) Layers() []gopacket.Layer {
+	return p.layers
+}
+
+func TestListenerDecapsulate(t *testing.T) {
+	outer := &layers.IPv4{SrcIP: net.IPv4(10, 0, 0, 1), Protocol: layers.IPProtocolUDP}
+	outer.Payload = []byte("vxlan")
+	inner := &layers.IPv4{SrcIP: net.IPv4(192, 168, 0, 1), Protocol: layers.IPProtocolTCP}
+	inner.Payload = []byte("tcp")
+
+	src, protocol, payload := networkLayer(&testPacket{layers: []gopacket.Layer{&layers.Ethernet{}, outer, &layers.UDP{}, &layers.Ethernet{}, inner}})
+	if !src.Equal(inner.SrcIP) || protocol != layers.IPProtocolTCP || string(payload) != "tcp" {
+		t.Error("Should return innermost IP layer:", src, protocol, string(payload))
+	}
+
+	l := &Listener{ports: []PortRange{{80, 80}}, config: &ListenerConfig{Protocol: ProtocolTCP, Decapsulate: true}}
+	if f := l.bpfFilter(); f != "(tcp dst port 80) or (udp port 4789) or (ip proto gre) or (ip6 proto gre) or (vlan and (tcp dst port 80))" {
+		t.Error("Wrong filter:", f)
+	}
+}
+
+func TestListenerPacketPayload(t *testing.T) {
+	l := &Listener{ports: []PortRange{{80, 80}}, config: &ListenerConfig{Protocol: ProtocolTCP}}
+
+	ip := &layers.IPv4{SrcIP: net.IPv4(10, 0, 0, 1), Protocol: layers.IPProtocolTCP}
+	ip.Payload = make([]byte, 20)
+
+	if src, payload := l.packetPayload(&testPacket{layers: []gopacket.Layer{&layers.Ethernet{}, ip}}); !src.Equal(ip.SrcIP) || len(payload) != 20 {
+		t.Error("Should return TCP segment:", src, payload)
+	}
+
+	// Segment truncated by snapshot length, or fragment of tunneled packet
+	ip.Payload = []byte{0, 80, 0, 80}
+	if _, payload := l.packetPayload(&testPacket{layers: []gopacket.Layer{&layers.Ethernet{}, ip}}); payload != nil {
+		t.Error("Should skip segment shorter than TCP header")
+	}
+
+	ip.Protocol, ip.Payload = layers.IPProtocolUDP, make([]byte, 20)
+	if _, payload := l.packetPayload(&testPacket{layers: []gopacket.Layer{&layers.Ethernet{}, ip}}); payload != nil {
+		t.Error("Should skip packets of other protocols")
+	}
+
+	if _, payload := l.packetPayload(&testPacket{layers: []gopacket.Layer{&layers.Ethernet{}}}); payload != nil {
+		t.Error("Should skip packets without IP layer")
+	}
+}
+
+func TestListenerDecapsulateFilter(t *testing.T) {
+	l := &Listener{ports: []PortRange{{80, 80}}, config: &ListenerConfig{Protocol: ProtocolTCP, Decapsulate: true}}
+
+	bpf, err := pcap.NewBPF(layers.LinkTypeEthernet, 65535, l.bpfFilter())
+	if err != nil {
+		t.Skip("Can't compile filter:", err)
+	}
+
+	ethernet := append(make([]byte, 12), 0x08, 0x00)
+	ip := func(protocol byte) []byte {
+		return []byte{0x45, 0, 0, 0, 0, 0, 0, 0, 64, protocol, 0, 0, 10, 0, 0, 1, 10, 0, 0, 2}
+	}
+
+	packets := map[string][]byte{
+		// UDP header to VXLAN port, VXLAN header and inner Ethernet frame
+		"VXLAN": append(append(append([]byte{}, ethernet...), ip(17)...), 0, 1, 0x12, 0xb5, 0, 0, 0, 0, 8, 0, 0, 0, 0, 0, 1, 0),
+		"GRE":   append(append(append([]byte{}, ethernet...), ip(47)...), 0, 0, 0x08, 0x00),
+	}
+
+	for name, data := range packets {
+		if !bpf.Matches(gopacket.CaptureInfo{CaptureLength: len(data), Length: len(data)}, data) {
+			t.Error("Should match untagged", name, "packet")
+		}
+	}
+}
+
+func TestInterfacesWithAddr(t *testing.T) {
+	ifaces, err := interfacesWithAddr("127.0.0.1")
+	if err != nil {
+		t.Skip("Loopback interface is not available:", err)
+	}
+
+	if len(ifaces) != 1 || ifaces[0].Flags&net.FlagLoopback == 0 {
+		t.Error("Should find loopback interface:", ifaces)
+	}
+
+	if _, err := interfacesWithAddr("192.0.2.1"); err == nil {
+		t.Error("Should not find interface with unassigned address")
+	}
+}
+
+func TestReadBackoff(t *testing.T) {
+	var backoff readBackoff
+
+	for i := 0; i < 3; i++ {
+		if !backoff.wait("test", errors.New("temporary")) {
+			t.Fatal("Should retry after temporary error")
+		}
+	}
+
+	if backoff.delay != 4*readErrorMinDelay {
+		t.Error("Delay should double while errors repeat:", backoff.delay)
+	}
+
+	backoff.reset()
+	if backoff.wait("test", io.EOF) || backoff.delay != 0 {
+		t.Error("Should stop after fatal error")
+	}
+
+	// Capture loop exits once socket closed
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan bool)
+	go func() {
+		(&Listener{}).readRAWSocketConn(conn)
+		close(done)
+	}()
+
+	conn.Close()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("Should stop reading closed socket")
+	}
+}
@@ -0,0 +1,201 @@
+package rawSocket
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+)
+
+// PcapFile reads TCP messages of given port from capture file, written by tcpdump or wireshark.
+// Both requests and responses are returned.
+type PcapFile struct {
+	handle    *pcap.Handle
+	assembler *TCPAssembler
+	eof       bool
+}
+
+// OpenPcapFile opens capture file, filter is optional BPF expression combined with port filter
+func OpenPcapFile(path string, port int, filter string) (*PcapFile, error) {
+	handle, err := pcap.OpenOffline(path)
+	if err != nil {
+		return nil, err
+	}
+
+	expr := "tcp port " + strconv.Itoa(port)
+	if filter != "" {
+		expr = "(" + expr + ") and (" + filter + ")"
+	}
+
+	if err = handle.SetBPFFilter(expr); err != nil {
+		handle.Close()
+		return nil, err
+	}
+
+	return &PcapFile{handle: handle, assembler: NewTCPAssembler(port)}, nil
+}
+
+// Next returns next message in order of start, or io.EOF when file ended
+func (f *PcapFile) Next() (*TCPMessage, error) {
+	for {
+		if m := f.assembler.Next(); m != nil {
+			return m, nil
+		}
+
+		if f.eof {
+			return nil, io.EOF
+		}
+
+		data, ci, err := f.handle.ReadPacketData()
+
+		if err == io.EOF {
+			f.eof = true
+			f.assembler.Flush()
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		packet := gopacket.NewPacket(data, f.handle.LinkType(), gopacket.NoCopy)
+
+		if ipLayer := packet.Layer(layers.LayerTypeIPv4); ipLayer != nil {
+			ip := ipLayer.(*layers.IPv4)
+			f.assembler.AddPacket(&net.IPAddr{IP: ip.SrcIP}, ip.Payload, ci.Timestamp)
+		} else if ipLayer := packet.Layer(layers.LayerTypeIPv6); ipLayer != nil {
+			ip := ipLayer.(*layers.IPv6)
+			f.assembler.AddPacket(&net.IPAddr{IP: ip.SrcIP}, ip.Payload, ci.Timestamp)
+		}
+	}
+}
+
+// Close closes capture file
+func (f *PcapFile) Close() {
+	f.handle.Close()
+}
+
+// assembledMessage is message which still receives packets
+type assembledMessage struct {
+	*TCPMessage
+	// Capture time of last packet
+	last time.Time
+}
+
+// TCPAssembler reassembles TCP messages from packets of capture file.
+//
+// Unlike live Listener, it uses capture time instead of wall clock: message finished if no packets received
+// for MsgExpire according to packet timestamps, or when next message started in the same direction of connection.
+// Finished messages returned in order of their start.
+type TCPAssembler struct {
+	port int
+
+	// Messages receiving packets, by direction of connection
+	open map[string]*assembledMessage
+	// Finished messages, waiting until all earlier started messages finished too
+	done []*TCPMessage
+
+	now time.Time
+}
+
+// NewTCPAssembler creates assembler for given server port
+func NewTCPAssembler(port int) *TCPAssembler {
+	return &TCPAssembler{
+		port: port,
+		open: make(map[string]*assembledMessage),
+	}
+}
+
+// AddPacket adds TCP packet captured at given time, buf contains TCP header and data
+func (a *TCPAssembler) AddPacket(addr net.Addr, buf []byte, timestamp time.Time) {
+	if len(buf) < 20 {
+		return
+	}
+
+	srcPort := binary.BigEndian.Uint16(buf[0:2])
+	destPort := binary.BigEndian.Uint16(buf[2:4])
+
+	// Only packets with data are needed
+	if len(buf) <= int((buf[12]&0xF0)>>4)*4 {
+		return
+	}
+
+	if int(srcPort) != a.port && int(destPort) != a.port {
+		return
+	}
+
+	packet := ParseTCPPacket(addr, buf)
+	isIncoming := int(destPort) == a.port
+
+	a.now = timestamp
+	a.expire()
+
+	// Requests and responses of the same connection are distinguished by client port
+	key := addr.String() + ":" + strconv.Itoa(int(srcPort)) + ":" + strconv.Itoa(int(destPort))
+
+	m, ok := a.open[key]
+	if ok && m.Ack != packet.Ack {
+		a.finish(key)
+		ok = false
+	}
+
+	if !ok {
+		m = &assembledMessage{
+			TCPMessage: &TCPMessage{ID: key, Ack: packet.Ack, IsIncoming: isIncoming, Start: timestamp},
+		}
+		a.open[key] = m
+	}
+
+	m.AddPacket(packet)
+	m.last = timestamp
+}
+
+// Flush finishes all messages, should be called when file ended
+func (a *TCPAssembler) Flush() {
+	for key := range a.open {
+		a.finish(key)
+	}
+}
+
+// Next returns finished message, if all messages started before it are finished too
+func (a *TCPAssembler) Next() *TCPMessage {
+	if len(a.done) == 0 {
+		return nil
+	}
+
+	m := a.done[0]
+
+	for _, o := range a.open {
+		if o.Start.Before(m.Start) {
+			return nil
+		}
+	}
+
+	a.done = a.done[1:]
+
+	return m
+}
+
+// expire finishes messages which did not receive packets during MsgExpire
+func (a *TCPAssembler) expire() {
+	for key, m := range a.open {
+		if a.now.Sub(m.last) > MsgExpire {
+			a.finish(key)
+		}
+	}
+}
+
+func (a *TCPAssembler) finish(key string) {
+	a.done = append(a.done, a.open[key].TCPMessage)
+	delete(a.open, key)
+
+	sort.SliceStable(a.done, func(i, j int) bool {
+		return a.done[i].Start.Before(a.done[j].Start)
+	})
+}
@@ -0,0 +1,85 @@
+package rawSocket
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+func tcpSegment(srcPort, destPort uint16, seq, ack uint32, data string) []byte {
+	buf := make([]byte, 20+len(data))
+	binary.BigEndian.PutUint16(buf[0:2], srcPort)
+	binary.BigEndian.PutUint16(buf[2:4], destPort)
+	binary.BigEndian.PutUint32(buf[4:8], seq)
+	binary.BigEndian.PutUint32(buf[8:12], ack)
+	buf[12] = 5 << 4
+	copy(buf[20:], data)
+
+	return buf
+}
+
+func TestTCPAssembler(t *testing.T) {
+	a := NewTCPAssembler(80)
+	client := &net.IPAddr{IP: net.ParseIP("10.0.0.1")}
+	server := &net.IPAddr{IP: net.ParseIP("10.0.0.2")}
+	start := time.Unix(100, 0)
+
+	at := func(ms int) time.Time {
+		return start.Add(time.Duration(ms) * time.Millisecond)
+	}
+
+	// Packets of first request received out of order
+	a.AddPacket(client, tcpSegment(5000, 80, 17, 1000, "Host: a\r\n\r\n"), at(0))
+	a.AddPacket(client, tcpSegment(5000, 80, 1, 1000, "GET / HTTP/1.1\r\n"), at(1))
+	a.AddPacket(client, tcpSegment(6000, 80, 1, 2000, "GET /b HTTP/1.1\r\n\r\n"), at(2))
+	// Packet without data and packet of other port are skipped
+	a.AddPacket(server, tcpSegment(80, 5000, 1000, 27, ""), at(3))
+	a.AddPacket(client, tcpSegment(5000, 8080, 1, 1, "GET /other HTTP/1.1\r\n\r\n"), at(3))
+
+	if m := a.Next(); m != nil {
+		t.Error("Messages should be open:", string(m.Bytes()))
+	}
+
+	a.AddPacket(server, tcpSegment(80, 5000, 1000, 27, "HTTP/1.1 200 OK\r\n\r\n"), at(10))
+
+	// Response started, so first request finished, but second request still open
+	a.AddPacket(client, tcpSegment(5000, 80, 27, 1019, "GET /c HTTP/1.1\r\n\r\n"), at(20))
+
+	first := a.Next()
+	if first == nil || string(first.Bytes()) != "GET / HTTP/1.1\r\nHost: a\r\n\r\n" || !first.IsIncoming || !first.Start.Equal(at(0)) {
+		t.Fatal("Should reassemble first request:", first)
+	}
+
+	if m := a.Next(); m != nil {
+		t.Error("Should wait until earlier messages finished:", string(m.Bytes()))
+	}
+
+	// Second request finished by capture time
+	a.AddPacket(server, tcpSegment(80, 5000, 1019, 46, "HTTP/1.1 404 Not Found\r\n\r\n"), at(2100))
+
+	if m := a.Next(); m == nil || string(m.Bytes()) != "GET /b HTTP/1.1\r\n\r\n" {
+		t.Error("Should finish messages without packets during MsgExpire:", m)
+	}
+
+	response := a.Next()
+	if response == nil || string(response.Bytes()) != "HTTP/1.1 200 OK\r\n\r\n" || response.IsIncoming {
+		t.Fatal("Should reassemble response:", response)
+	}
+
+	if string(response.UUID()) != string(first.UUID()) {
+		t.Error("Request and response should have same id")
+	}
+
+	a.Flush()
+
+	for _, expected := range []string{"GET /c HTTP/1.1\r\n\r\n", "HTTP/1.1 404 Not Found\r\n\r\n"} {
+		if m := a.Next(); m == nil || string(m.Bytes()) != expected {
+			t.Error("Should return messages in order of start:", expected, m)
+		}
+	}
+
+	if m := a.Next(); m != nil {
+		t.Error("Should not have more messages:", string(m.Bytes()))
+	}
+}
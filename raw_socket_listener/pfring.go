@@ -0,0 +1,97 @@
+//go:build pfring
+// +build pfring
+
+package rawSocket
+
+import (
+	"log"
+	"net"
+
+	"github.com/google/gopacket/pfring"
+)
+
+// readPFRing starts PF_RING capture on each device matching listener address.
+// Requires PF_RING kernel module and library, and Gor built with `-tags pfring`.
+func (t *Listener) readPFRing() {
+	devices, err := t.pfringDevices()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, device := range devices {
+		ring, err := t.openPFRing(device)
+		if err != nil {
+			log.Fatal("PF_RING error: ", err, " ", device)
+		}
+
+		go t.readPFRingHandle(ring)
+	}
+}
+
+// pfringDevices returns interface specified in config as is, so PF_RING ZC devices like "zc:eth0" can be used,
+// otherwise interfaces which have listener address assigned
+func (t *Listener) pfringDevices() (devices []string, err error) {
+	if t.config.Interface != "" {
+		return []string{t.config.Interface}, nil
+	}
+
+	ifaces, err := interfacesWithAddr(t.addr)
+	for _, iface := range ifaces {
+		devices = append(devices, iface.Name)
+	}
+
+	return
+}
+
+func (t *Listener) openPFRing(device string) (ring *pfring.Ring, err error) {
+	var flags pfring.Flag
+	if t.config.Promiscuous {
+		flags |= pfring.FlagPromisc
+	}
+
+	if ring, err = pfring.NewRing(device, uint32(t.config.SnapLength), flags); err != nil {
+		return
+	}
+
+	if err = ring.SetSocketMode(pfring.ReadOnly); err == nil {
+		// Filtering in kernel, same as with libpcap
+		err = ring.SetBPFFilter(t.bpfFilter())
+	}
+
+	if err == nil {
+		err = ring.Enable()
+	}
+
+	if err != nil {
+		ring.Close()
+		return nil, err
+	}
+
+	return
+}
+
+func (t *Listener) readPFRingHandle(ring *pfring.Ring) {
+	defer ring.Close()
+
+	var backoff readBackoff
+
+	for {
+		data, _, err := ring.ReadPacketData()
+
+		if err != nil {
+			if !backoff.wait("PF_RING", err) {
+				return
+			}
+			continue
+		}
+		backoff.reset()
+
+		// ReadPacketData returns fresh buffer for each packet, so it safe to not copy data
+		src, protocol, payload := ethernetPayload(data)
+		if !t.isCapturedPayload(protocol, payload) {
+			continue
+		}
+
+		go t.parsePacket(&net.IPAddr{IP: src}, payload)
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !pfring
+// +build !pfring
+
+package rawSocket
+
+import (
+	"log"
+)
+
+func (t *Listener) readPFRing() {
+	log.Fatal("Gor is built without PF_RING support, rebuild it with `go build -tags pfring`")
+}
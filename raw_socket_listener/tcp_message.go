@@ -1,8 +1,11 @@
 package rawSocket
 
 import (
-	"log"
+	"crypto/sha1"
+	"encoding/hex"
+	"net"
 	"sort"
+	"strconv"
 	"time"
 )
 
@@ -20,6 +23,17 @@ type TCPMessage struct {
 	Ack     uint32
 	packets []*TCPPacket
 
+	// IsIncoming is true for requests, and false for responses
+	IsIncoming bool
+	// Start is time when first packet of message was received
+	Start time.Time
+
+	// MaxSize limits size of stored data, rest of packets dropped. 0 means unlimited
+	MaxSize int
+	// Truncated is true if some data was dropped because of MaxSize
+	Truncated bool
+	size      int
+
 	timer *time.Timer // Used for expire check
 
 	packetsChan chan *TCPPacket
@@ -28,8 +42,8 @@ type TCPMessage struct {
 }
 
 // NewTCPMessage pointer created from a Acknowledgment number and a channel of messages readuy to be deleted
-func NewTCPMessage(ID string, delChan chan *TCPMessage, Ack uint32) (msg *TCPMessage) {
-	msg = &TCPMessage{ID: ID, Ack: Ack}
+func NewTCPMessage(ID string, delChan chan *TCPMessage, Ack uint32, IsIncoming bool) (msg *TCPMessage) {
+	msg = &TCPMessage{ID: ID, Ack: Ack, IsIncoming: IsIncoming, Start: time.Now()}
 
 	msg.packetsChan = make(chan *TCPPacket)
 	msg.delChan = delChan // used for notifying that message completed or expired
@@ -73,35 +87,143 @@ func (t *TCPMessage) Timeout() {
 	}
 }
 
-// Bytes sorts packets in right orders and return message content
-func (t *TCPMessage) Bytes() (output []byte) {
+// Bytes sorts packets in right orders and return message content.
+// Retransmitted segments can overlap already received data, overlapping bytes are skipped.
+func (t *TCPMessage) Bytes() []byte {
+	return t.AppendBytes(make([]byte, 0, t.Size()))
+}
+
+// AppendBytes appends message content to dst, so message can be read into reused buffer
+func (t *TCPMessage) AppendBytes(dst []byte) []byte {
 	sort.Sort(sortBySeq(t.packets))
 
+	var next uint32
+
+	for i, v := range t.packets {
+		data := v.Data
+
+		if i > 0 {
+			// Sequence numbers wrap around, so compared by difference
+			overlap := int32(next - v.Seq)
+			if overlap >= int32(len(data)) {
+				continue
+			}
+			if overlap > 0 {
+				data = data[overlap:]
+			}
+		}
+
+		dst = append(dst, data...)
+		next = v.Seq + uint32(len(v.Data))
+	}
+
+	return dst
+}
+
+// Size returns total size of packets data. Retransmitted packets make it bigger than size of message content.
+func (t *TCPMessage) Size() (size int) {
 	for _, v := range t.packets {
-		output = append(output, v.Data...)
+		size += len(v.Data)
+	}
+
+	return
+}
+
+// UUID returns identifier which is same for request and its response.
+//
+// Acknowledgment number of request is equal to the sequence number of first response packet,
+// and client port is source port for request and destination port for response.
+func (t *TCPMessage) UUID() []byte {
+	var key []byte
+
+	if t.IsIncoming {
+		key = strconv.AppendUint(key, uint64(t.Ack), 10)
+		key = strconv.AppendUint(append(key, ':'), uint64(t.packets[0].SrcPort), 10)
+	} else {
+		sort.Sort(sortBySeq(t.packets))
+
+		key = strconv.AppendUint(key, uint64(t.packets[0].Seq), 10)
+		key = strconv.AppendUint(append(key, ':'), uint64(t.packets[0].DestPort), 10)
 	}
 
-	return output
+	sum := sha1.Sum(key)
+	uuid := make([]byte, 24)
+	hex.Encode(uuid, sum[:12])
+
+	return uuid
+}
+
+// ConnectionID returns identifier shared by all requests sent over the same client connection
+func (t *TCPMessage) ConnectionID() []byte {
+	key := t.packets[0].Addr.String() + ":" + strconv.Itoa(int(t.packets[0].SrcPort))
+
+	sum := sha1.Sum([]byte(key))
+	id := make([]byte, 24)
+	hex.Encode(id, sum[:12])
+
+	return id
+}
+
+// Seq returns sequence number of first byte of message
+func (t *TCPMessage) Seq() uint32 {
+	sort.Sort(sortBySeq(t.packets))
+
+	return t.packets[0].Seq
+}
+
+// ClientPort returns port of client side of connection: source port for requests and destination port for responses
+func (t *TCPMessage) ClientPort() uint16 {
+	if t.IsIncoming {
+		return t.packets[0].SrcPort
+	}
+
+	return t.packets[0].DestPort
+}
+
+// SourceIP returns address of host which sent the message: client for requests, and server for responses
+func (t *TCPMessage) SourceIP() net.IP {
+	if addr, ok := t.packets[0].Addr.(*net.IPAddr); ok {
+		return addr.IP
+	}
+
+	return nil
 }
 
 // AddPacket to the message and ensure packet uniqueness
-// TCP allows that packet can be re-send multiple times
+// TCP allows that packet can be re-send multiple times, and retransmitted packet can contain more data than original
 func (t *TCPMessage) AddPacket(packet *TCPPacket) {
 	packetFound := false
 
-	for _, pkt := range t.packets {
+	for i, pkt := range t.packets {
 		if packet.Seq == pkt.Seq {
 			packetFound = true
+
+			if len(packet.Data) > len(pkt.Data) && (t.MaxSize == 0 || t.size+len(packet.Data)-len(pkt.Data) <= t.MaxSize) {
+				t.size += len(packet.Data) - len(pkt.Data)
+				t.packets[i] = packet
+			}
 			break
 		}
 	}
 
 	if packetFound {
-		log.Println("Received packet with same sequence")
+		// Retransmission, already stored
+	} else if t.MaxSize > 0 && t.size+len(packet.Data) > t.MaxSize {
+		// Keep first bytes up to the limit, packets received out of order can leave gaps
+		if keep := t.MaxSize - t.size; keep > 0 {
+			packet.Data = packet.Data[:keep]
+			t.packets = append(t.packets, packet)
+			t.size += keep
+		}
+
+		t.Truncated = true
 	} else {
 		t.packets = append(t.packets, packet)
+		t.size += len(packet.Data)
 	}
 
-	// Reset message timeout timer
-	t.timer.Reset(MsgExpire)
+	// Reset message timeout timer. Messages read from capture files completed by TCPAssembler, and have no timer.
+	if t.timer != nil {
+		t.timer.Reset(MsgExpire)
+	}
 }
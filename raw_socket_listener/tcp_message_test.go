@@ -0,0 +1,53 @@
+package rawSocket
+
+import (
+	"net"
+	"testing"
+)
+
+func TestTCPMessageMaxSize(t *testing.T) {
+	m := &TCPMessage{MaxSize: 20}
+
+	m.AddPacket(&TCPPacket{Seq: 1, Data: []byte("POST / HTTP/1.1\r\n")})
+	m.AddPacket(&TCPPacket{Seq: 18, Data: []byte("\r\nabc")})
+	m.AddPacket(&TCPPacket{Seq: 23, Data: []byte("def")})
+
+	if string(m.Bytes()) != "POST / HTTP/1.1\r\n\r\na" || !m.Truncated {
+		t.Error("Should keep data up to max size:", string(m.Bytes()), m.Truncated)
+	}
+}
+
+func TestTCPMessageReassembly(t *testing.T) {
+	m := &TCPMessage{}
+
+	// Out of order, retransmitted with more data, and overlapping segments
+	m.AddPacket(&TCPPacket{Seq: 19, Data: []byte("st: ")})
+	m.AddPacket(&TCPPacket{Seq: 1, Data: []byte("GET / HTTP/1.1\r\n")})
+	m.AddPacket(&TCPPacket{Seq: 1, Data: []byte("GET / HTTP/1.1\r\nHo")})
+	m.AddPacket(&TCPPacket{Seq: 20, Data: []byte("t: a\r\n\r\n")})
+	m.AddPacket(&TCPPacket{Seq: 23, Data: []byte("a\r\n")})
+
+	if string(m.Bytes()) != "GET / HTTP/1.1\r\nHost: a\r\n\r\n" {
+		t.Errorf("Wrong message: %q", m.Bytes())
+	}
+}
+
+func TestTCPMessageSeqWraparound(t *testing.T) {
+	m := &TCPMessage{}
+
+	m.AddPacket(&TCPPacket{Seq: 2, Data: []byte("def")})
+	m.AddPacket(&TCPPacket{Seq: 4294967295, Data: []byte("abc")})
+
+	if string(m.Bytes()) != "abcdef" {
+		t.Errorf("Wrong message: %q", m.Bytes())
+	}
+}
+
+func TestTCPMessageSourceIP(t *testing.T) {
+	m := &TCPMessage{}
+	m.AddPacket(&TCPPacket{Addr: &net.IPAddr{IP: net.ParseIP("10.0.0.1")}, Seq: 1, Data: []byte("GET / HTTP/1.1\r\n\r\n")})
+
+	if ip := m.SourceIP(); ip.String() != "10.0.0.1" {
+		t.Error("Should return address of first packet:", ip)
+	}
+}
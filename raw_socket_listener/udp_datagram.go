@@ -0,0 +1,31 @@
+package rawSocket
+
+import (
+	"encoding/binary"
+	"net"
+	"time"
+)
+
+// UDPDatagram holds captured UDP payload.
+// Unlike TCP, each datagram is self-contained message, so no reassembly needed.
+// Header structure: https://en.wikipedia.org/wiki/User_Datagram_Protocol
+type UDPDatagram struct {
+	SrcPort  uint16
+	DestPort uint16
+
+	Data []byte
+
+	Addr  net.Addr
+	Start time.Time
+}
+
+// ParseUDPDatagram takes address and udp packet (header and data) and returns parsed UDPDatagram
+func ParseUDPDatagram(addr net.Addr, b []byte) *UDPDatagram {
+	return &UDPDatagram{
+		SrcPort:  binary.BigEndian.Uint16(b[0:2]),
+		DestPort: binary.BigEndian.Uint16(b[2:4]),
+		Data:     b[8:],
+		Addr:     addr,
+		Start:    time.Now(),
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"syscall"
+)
+
+var (
+	// Held by emitter while payload processed, so reload never changes settings and plugins in use
+	reloadMu sync.RWMutex
+
+	// Increased on each reload, so emitter knows when to pick up new outputs and modifiers
+	reloadVersion int64
+
+	// Plugins of previous configuration, reused by registerPlugin if their options not changed
+	reusablePlugins map[string]interface{}
+)
+
+// watchReload reloads config file on SIGHUP
+func watchReload(path string) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+
+	for range c {
+		log.Println("[RELOAD] Reloading config:", path)
+
+		if err := reloadConfig(os.Args[1:], path); err != nil {
+			log.Println("[RELOAD] Keeping current config:", err)
+		}
+	}
+}
+
+var (
+	// Held while new settings built, so reload and options changed by API don't override each other
+	settingsMu sync.Mutex
+
+	// Flags of current settings, they tell which options set by user
+	settingsFlags = flag.CommandLine
+	// Options of command line and config file, and ones changed by API since last reload
+	settingsArgs  = os.Args[1:]
+	configOptions map[string][]string
+	apiOptions    = make(map[string][]string)
+)
+
+// reloadConfig re-applies command line and config file options, and re-initializes plugins.
+// Options changed by API are replaced by ones of config file.
+//
+// Plugins which options not changed are kept as is, so capture is not interrupted.
+// New outputs, limiters and rewrite rules picked up by emitter, and removed outputs closed. New inputs
+// started, but removed inputs continue to work until restart, since plugins can't be stopped.
+func reloadConfig(args []string, path string) error {
+	values, err := readConfig(path)
+	if err != nil {
+		return err
+	}
+
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+
+	next, fs, err := buildSettings(args, values, nil)
+	if err != nil {
+		return err
+	}
+
+	settingsArgs, configOptions = args, values
+	apiOptions = make(map[string][]string)
+
+	applySettings(next, fs)
+
+	log.Printf("[RELOAD] Config reloaded: %d inputs, %d outputs", len(Plugins.Inputs), len(Plugins.Outputs))
+
+	return nil
+}
+
+// buildSettings parses command line and config file options into new settings, options
+// changed by API override both of them. Current settings are not changed.
+func buildSettings(args []string, config map[string][]string, options map[string][]string) (*AppSettings, *flag.FlagSet, error) {
+	next := new(AppSettings)
+
+	fs := flag.NewFlagSet(flag.CommandLine.Name(), flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	defineFlags(fs, next)
+
+	// Flags not stored in settings, like --config, used only on start
+	flag.CommandLine.VisitAll(func(f *flag.Flag) {
+		if fs.Lookup(f.Name) == nil {
+			fs.Var(ignoredFlag{f.Value}, f.Name, f.Usage)
+		}
+	})
+
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	if err := applyConfig(fs, config); err != nil {
+		return nil, nil, err
+	}
+
+	for name, list := range options {
+		f := fs.Lookup(name)
+		if f == nil {
+			return nil, nil, fmt.Errorf("unknown option %q", name)
+		}
+
+		resetFlag(f)
+
+		for _, value := range list {
+			if err := fs.Set(name, value); err != nil {
+				return nil, nil, fmt.Errorf("invalid value %q for option %q: %v", value, name, err)
+			}
+		}
+	}
+
+	resolveDefaults(fs, next)
+
+	return next, fs, nil
+}
+
+// applySettings replaces current settings by new ones and re-initializes plugins.
+// Emitter holds reloadMu while payload processed, so it never sees partially changed settings.
+func applySettings(next *AppSettings, fs *flag.FlagSet) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	Settings = *next
+	settingsFlags = fs
+
+	reinitPlugins()
+}
+
+// reinitPlugins creates plugins according to current settings, reusing existing ones, closes
+// outputs which are not used anymore, and notifies emitter. Should be called with reloadMu locked.
+func reinitPlugins() {
+	previous := Plugins
+
+	reusablePlugins = previous.registered
+	Plugins = new(InOutPlugins)
+	InitPlugins()
+	reusablePlugins = nil
+
+	atomic.AddInt64(&reloadVersion, 1)
+
+	kept := make(map[interface{}]bool)
+	for _, plugin := range Plugins.registered {
+		kept[plugin] = true
+	}
+
+	for _, plugin := range previous.registered {
+		if _, ok := plugin.(io.Writer); !ok || kept[plugin] {
+			continue
+		}
+
+		if c, ok := plugin.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				log.Println("[RELOAD] Can't close", plugin, ":", err)
+			}
+		}
+	}
+}
+
+// ignoredFlag accepts values of flag, without changing it
+type ignoredFlag struct {
+	value flag.Value
+}
+
+func (f ignoredFlag) String() string {
+	if f.value == nil {
+		return ""
+	}
+
+	return f.value.String()
+}
+
+func (f ignoredFlag) Set(string) error {
+	return nil
+}
+
+func (f ignoredFlag) IsBoolFlag() bool {
+	b, ok := f.value.(interface {
+		IsBoolFlag() bool
+	})
+
+	return ok && b.IsBoolFlag()
+}
+
+// resetFlag sets default value of flag. Options which can be repeated are collected into slices,
+// and setting them appends values, so they are cleared instead.
+func resetFlag(f *flag.Flag) {
+	v := reflect.ValueOf(f.Value)
+
+	if v.Kind() == reflect.Ptr && v.Elem().Kind() == reflect.Slice {
+		v.Elem().Set(reflect.Zero(v.Elem().Type()))
+	} else {
+		f.Value.Set(f.DefValue)
+	}
+}
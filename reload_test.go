@@ -0,0 +1,185 @@
+package main
+
+import (
+	"compress/gzip"
+	"flag"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReloadConfig(t *testing.T) {
+	previousSettings, previousPlugins := Settings, Plugins
+	defer func() {
+		Settings, Plugins = previousSettings, previousPlugins
+		settingsFlags = flag.CommandLine
+	}()
+
+	Settings = AppSettings{}
+	Plugins = new(InOutPlugins)
+
+	file, _ := ioutil.TempFile("", "gor_config.yml")
+	defer os.Remove(file.Name())
+
+	ioutil.WriteFile(file.Name(), []byte("output-dummy: [first]\nhttp-allow-method: GET"), 0644)
+
+	if err := reloadConfig([]string{"--split-output"}, file.Name()); err != nil {
+		t.Fatal(err)
+	}
+
+	first := Plugins.Outputs[0]
+	version := reloadVersion
+
+	ioutil.WriteFile(file.Name(), []byte("output-dummy: [first, second]"), 0644)
+
+	if err := reloadConfig([]string{"--split-output"}, file.Name()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(Plugins.Outputs) != 2 {
+		t.Fatal("Should add new output", Plugins.Outputs)
+	}
+
+	if Plugins.Outputs[0] != first {
+		t.Error("Should reuse output which options not changed")
+	}
+
+	if len(Settings.modifierConfig.methods) != 0 {
+		t.Error("Options removed from config should be reset", Settings.modifierConfig.methods)
+	}
+
+	if !Settings.splitOutput {
+		t.Error("Command line options should be kept")
+	}
+
+	if reloadVersion != version+1 {
+		t.Error("Should increase reload version")
+	}
+
+	ioutil.WriteFile(file.Name(), []byte("output-dummy: [third]\noutput-htp: staging.com"), 0644)
+
+	if err := reloadConfig([]string{"--split-output"}, file.Name()); err == nil {
+		t.Error("Should fail on unknown option")
+	}
+
+	if !reflect.DeepEqual(Settings.outputDummy, MultiOption{"first", "second"}) {
+		t.Error("Should keep previous settings if config invalid", Settings.outputDummy)
+	}
+}
+
+func TestReloadConfigOutputs(t *testing.T) {
+	previousSettings, previousPlugins := Settings, Plugins
+	defer func() {
+		Settings, Plugins = previousSettings, previousPlugins
+		settingsFlags = flag.CommandLine
+	}()
+
+	Settings = AppSettings{}
+	Plugins = new(InOutPlugins)
+
+	dir, _ := ioutil.TempDir("", "gor_reload")
+	defer os.RemoveAll(dir)
+
+	config := filepath.Join(dir, "gor.yml")
+	output := filepath.Join(dir, "requests.gor.gz")
+
+	ioutil.WriteFile(config, []byte("output-file: "+output), 0644)
+	if err := reloadConfig(nil, config); err != nil {
+		t.Fatal(err)
+	}
+
+	file := Plugins.Outputs[0]
+
+	// Output re-created when its options changed
+	ioutil.WriteFile(config, []byte("output-file: "+output+"\noutput-file-max-size: 100"), 0644)
+	if err := reloadConfig(nil, config); err != nil {
+		t.Fatal(err)
+	}
+
+	if Plugins.Outputs[0] == file {
+		t.Fatal("Should create new output when its options changed")
+	}
+
+	Plugins.Outputs[0].Write([]byte("1 1 1\nGET / HTTP/1.1\r\n\r\n"))
+
+	// Removed output closed, so compressed file is complete
+	ioutil.WriteFile(config, []byte("output-dummy: [first]"), 0644)
+	if err := reloadConfig(nil, config); err != nil {
+		t.Fatal(err)
+	}
+
+	// Options changed, so output writes to file with index
+	f, err := os.Open(filepath.Join(dir, "requests_0001.gor.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if data, err := ioutil.ReadAll(gz); err != nil || !strings.Contains(string(data), "GET / HTTP/1.1") {
+		t.Error("Removed output should be closed:", err, string(data))
+	}
+}
+
+func TestReloadConfigStopsHTTPOutput(t *testing.T) {
+	previousSettings, previousPlugins := Settings, Plugins
+	defer func() {
+		Settings, Plugins = previousSettings, previousPlugins
+		settingsFlags = flag.CommandLine
+	}()
+
+	Settings = AppSettings{}
+	Plugins = new(InOutPlugins)
+
+	server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer server.Close()
+
+	file, _ := ioutil.TempFile("", "gor_config.yml")
+	defer os.Remove(file.Name())
+
+	ioutil.WriteFile(file.Name(), []byte("output-http: "+server.URL+"\noutput-http-workers: 2"), 0644)
+	if err := reloadConfig(nil, file.Name()); err != nil {
+		t.Fatal(err)
+	}
+	defer Plugins.Outputs[0].(io.Closer).Close()
+
+	output := Plugins.Outputs[0].(*HTTPOutput)
+
+	for atomic.LoadInt64(&output.activeWorkers) != 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Output re-created with new number of workers, so workers of previous one should exit
+	ioutil.WriteFile(file.Name(), []byte("output-http: "+server.URL+"\noutput-http-workers: 3"), 0644)
+	if err := reloadConfig(nil, file.Name()); err != nil {
+		t.Fatal(err)
+	}
+
+	if Plugins.Outputs[0] == io.Writer(output) {
+		t.Fatal("Should create new output when its options changed")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt64(&output.activeWorkers) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Workers of removed output should exit:", atomic.LoadInt64(&output.activeWorkers))
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := output.Read(make([]byte, 100)); err != io.EOF {
+		t.Error("Closed output should not emit responses:", err)
+	}
+}
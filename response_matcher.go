@@ -0,0 +1,91 @@
+package main
+
+import (
+	"strconv"
+	"time"
+)
+
+// matchedResponses holds request with its original and replayed responses
+type matchedResponses struct {
+	request  []byte
+	original []byte
+	replayed []byte
+
+	// Timestamps of request and original response, and round trip time of replayed request, in nanoseconds
+	requestTime  int64
+	originalTime int64
+	replayedRTT  int64
+
+	created time.Time
+}
+
+// responseMatcher groups typed payloads by id, until both original and replayed responses received.
+// It is not thread safe.
+type responseMatcher struct {
+	pending       map[string]*matchedResponses
+	lastCleanTime time.Time
+}
+
+func newResponseMatcher() *responseMatcher {
+	return &responseMatcher{
+		pending:       make(map[string]*matchedResponses),
+		lastCleanTime: time.Now(),
+	}
+}
+
+// add stores payload, and returns matched responses once both of them received
+func (m *responseMatcher) add(data []byte) *matchedResponses {
+	defer m.cleanup()
+
+	// Payloads without id can't be matched
+	meta := payloadMeta(data)
+	if len(meta) < 3 {
+		return nil
+	}
+
+	id := string(meta[1])
+	timing, _ := strconv.ParseInt(string(meta[2]), 10, 64)
+	body := payloadBody(data)
+
+	record, ok := m.pending[id]
+	if !ok {
+		record = &matchedResponses{created: time.Now()}
+		m.pending[id] = record
+	}
+
+	// Emitter reuses buffer, so data should be copied
+	switch data[0] {
+	case RequestPayload:
+		record.request = append([]byte{}, body...)
+		record.requestTime = timing
+	case ResponsePayload:
+		record.original = append([]byte{}, body...)
+		record.originalTime = timing
+	case ReplayedResponsePayload:
+		record.replayed = append([]byte{}, body...)
+		record.replayedRTT = timing
+	}
+
+	if record.original == nil || record.replayed == nil {
+		return nil
+	}
+
+	delete(m.pending, id)
+
+	return record
+}
+
+// cleanup removes records which never got both responses
+func (m *responseMatcher) cleanup() {
+	if time.Since(m.lastCleanTime) < time.Minute {
+		return
+	}
+
+	for id, record := range m.pending {
+		if time.Since(record.created) > time.Minute {
+			delete(m.pending, id)
+		}
+	}
+
+	m.lastCleanTime = time.Now()
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// parseS3Url splits s3://bucket/prefix address into bucket and key prefix
+func parseS3Url(path string) (bucket, prefix string, err error) {
+	if !strings.HasPrefix(path, "s3://") {
+		return "", "", errors.New("S3 path should start with s3://, got: " + path)
+	}
+
+	path = strings.TrimPrefix(path, "s3://")
+	parts := strings.SplitN(path, "/", 2)
+
+	bucket = parts[0]
+	if len(parts) > 1 {
+		prefix = parts[1]
+	}
+
+	if bucket == "" {
+		return "", "", errors.New("S3 bucket name is empty")
+	}
+
+	return
+}
+
+// awsSession creates session using standard AWS credentials chain: environment variables, shared credentials file or instance role.
+// Region taken from AWS_REGION environment variable if not specified.
+func awsSession(region string) (*session.Session, error) {
+	config := aws.NewConfig()
+
+	if region != "" {
+		config = config.WithRegion(region)
+	}
+
+	return session.NewSession(config)
+}
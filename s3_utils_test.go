@@ -0,0 +1,25 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseS3Url(t *testing.T) {
+	bucket, prefix, err := parseS3Url("s3://bucket/path/requests")
+	if err != nil || bucket != "bucket" || prefix != "path/requests" {
+		t.Error("Wrong parsing:", bucket, prefix, err)
+	}
+
+	bucket, prefix, err = parseS3Url("s3://bucket")
+	if err != nil || bucket != "bucket" || prefix != "" {
+		t.Error("Prefix should be optional:", bucket, prefix, err)
+	}
+
+	if _, _, err = parseS3Url("bucket/path"); err == nil {
+		t.Error("Should require s3:// scheme")
+	}
+
+	if _, _, err = parseS3Url("s3:///path"); err == nil {
+		t.Error("Should require bucket name")
+	}
+}
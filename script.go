@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/buger/gor/proto"
+)
+
+// scriptRewriter is implemented by embedded scripting engines.
+// Like HTTPModifier, it returns empty payload if request should be dropped.
+type scriptRewriter interface {
+	Rewrite(payload []byte) []byte
+}
+
+// scriptResponseRewriter is implemented by scripts which can modify or drop responses as well.
+// Unlike requests, responses passed with payload header.
+type scriptResponseRewriter interface {
+	RewriteResponse(payload []byte) []byte
+}
+
+// newScriptRewriters initializes scripts specified in settings. Scripts are not thread safe, so each emitter loop creates its own.
+func newScriptRewriters() (scripts []scriptRewriter) {
+	if Settings.script != "" {
+		scripts = append(scripts, NewLuaScript(Settings.script))
+	}
+
+	if Settings.scriptJS != "" {
+		scripts = append(scripts, NewJSScript(Settings.scriptJS))
+	}
+
+	if Settings.pluginWASM != "" {
+		scripts = append(scripts, NewWASMPlugin(Settings.pluginWASM))
+	}
+
+	return
+}
+
+// scriptRequest is request representation exposed to scripts, so they don't need to deal with raw payload.
+// Repeated headers are collapsed into single one.
+type scriptRequest struct {
+	Method  string
+	URL     string
+	Proto   string
+	Headers map[string]string
+	Body    string
+
+	headerOrder  []string
+	originalBody string
+}
+
+func parseScriptRequest(payload []byte) *scriptRequest {
+	r := &scriptRequest{Headers: make(map[string]string)}
+
+	head := payload
+	if end := proto.MIMEHeadersEndPos(payload); end != -1 {
+		head = payload[:end]
+		r.Body = string(payload[end+len(proto.EmptyLine):])
+	}
+	r.originalBody = r.Body
+
+	lines := strings.Split(string(head), "\n")
+
+	requestLine := strings.SplitN(strings.TrimSuffix(lines[0], "\r"), " ", 3)
+	for len(requestLine) < 3 {
+		requestLine = append(requestLine, "")
+	}
+	r.Method, r.URL, r.Proto = requestLine[0], requestLine[1], requestLine[2]
+
+	for _, line := range lines[1:] {
+		header := strings.SplitN(strings.TrimSuffix(line, "\r"), ":", 2)
+		if len(header) < 2 {
+			continue
+		}
+
+		name := strings.TrimSpace(header[0])
+		if _, ok := r.Headers[name]; !ok {
+			r.headerOrder = append(r.headerOrder, name)
+		}
+		r.Headers[name] = strings.TrimSpace(header[1])
+	}
+
+	return r
+}
+
+// header returns actual name of header, since scripts may use different case
+func (r *scriptRequest) headerName(name string) string {
+	for n := range r.Headers {
+		if strings.EqualFold(n, name) {
+			return n
+		}
+	}
+
+	return name
+}
+
+// Bytes serializes request back to payload. Original header order is kept, new headers added at the end.
+// If body changed, Content-Length updated (unless body is chunked).
+func (r *scriptRequest) Bytes() []byte {
+	if r.Body != r.originalBody && r.Headers[r.headerName("Transfer-Encoding")] == "" {
+		r.Headers[r.headerName("Content-Length")] = strconv.Itoa(len(r.Body))
+	}
+
+	var buf bytes.Buffer
+
+	buf.WriteString(r.Method + " " + r.URL + " " + r.Proto + "\r\n")
+
+	written := make(map[string]bool)
+	writeHeader := func(name string) {
+		if value, ok := r.Headers[name]; ok && !written[name] {
+			buf.WriteString(name + ": " + value + "\r\n")
+			written[name] = true
+		}
+	}
+
+	for _, name := range r.headerOrder {
+		writeHeader(name)
+	}
+
+	added := make([]string, 0)
+	for name := range r.Headers {
+		if !written[name] {
+			added = append(added, name)
+		}
+	}
+	sort.Strings(added)
+
+	for _, name := range added {
+		writeHeader(name)
+	}
+
+	buf.WriteString("\r\n")
+	buf.WriteString(r.Body)
+
+	return buf.Bytes()
+}
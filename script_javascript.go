@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+
+	"github.com/dop251/goja"
+)
+
+// JSScript runs requests, and optionally responses, through JavaScript functions inside gor process.
+// Script should define `rewrite(req)` function, which gets object with `method`, `url`, `headers` and `body` fields,
+// and returns modified object, or null to drop request. Optional `rewriteResponse(resp)` gets object with
+// `id`, `replayed`, `status`, `headers` and `body` fields, and works the same way:
+//
+//	function rewrite(req) {
+//	    req.headers["X-Shadow"] = "1"
+//	    return req
+//	}
+type JSScript struct {
+	path string
+	vm   *goja.Runtime
+
+	rewrite         goja.Callable
+	rewriteResponse goja.Callable
+}
+
+// NewJSScript loads script from file
+func NewJSScript(path string) *JSScript {
+	s := &JSScript{path: path, vm: goja.New()}
+
+	source, err := ioutil.ReadFile(path)
+	if err != nil {
+		log.Fatal("[JS] Can't read script: ", err)
+	}
+
+	if _, err = s.vm.RunScript(path, string(source)); err != nil {
+		log.Fatal("[JS] Can't load script: ", err)
+	}
+
+	var ok bool
+	if s.rewrite, ok = goja.AssertFunction(s.vm.Get("rewrite")); !ok {
+		log.Fatal("[JS] Script should define `rewrite(req)` function: ", path)
+	}
+
+	s.rewriteResponse, _ = goja.AssertFunction(s.vm.Get("rewriteResponse"))
+
+	return s
+}
+
+// Rewrite calls `rewrite` function for request payload. If script fails, request passed as is.
+func (s *JSScript) Rewrite(payload []byte) []byte {
+	req := parseScriptRequest(payload)
+
+	ret, err := s.rewrite(goja.Undefined(), s.vm.ToValue(map[string]interface{}{
+		"method":  req.Method,
+		"url":     req.URL,
+		"headers": exportHeaders(req.Headers),
+		"body":    req.Body,
+	}))
+
+	if err != nil {
+		log.Println("[JS] Script error:", err)
+		return payload
+	}
+
+	obj, ok := exportObject(ret)
+	if !ok {
+		return nil
+	}
+
+	req.Method = fmt.Sprint(obj["method"])
+	req.URL = fmt.Sprint(obj["url"])
+	req.Body = fmt.Sprint(obj["body"])
+	req.Headers = importHeaders(obj["headers"])
+
+	return req.Bytes()
+}
+
+// RewriteResponse calls `rewriteResponse` function for typed response payload, if script defines it.
+// Payload header is kept as is.
+func (s *JSScript) RewriteResponse(payload []byte) []byte {
+	if s.rewriteResponse == nil {
+		return payload
+	}
+
+	headSize := payloadHeaderSize(payload)
+	// Status line parsed same way as request line: protocol, status code and reason
+	resp := parseScriptRequest(payload[headSize:])
+
+	ret, err := s.rewriteResponse(goja.Undefined(), s.vm.ToValue(map[string]interface{}{
+		"id":       string(payloadID(payload)),
+		"replayed": payload[0] == ReplayedResponsePayload,
+		"status":   resp.URL,
+		"headers":  exportHeaders(resp.Headers),
+		"body":     resp.Body,
+	}))
+
+	if err != nil {
+		log.Println("[JS] Script error:", err)
+		return payload
+	}
+
+	obj, ok := exportObject(ret)
+	if !ok {
+		return nil
+	}
+
+	resp.URL = fmt.Sprint(obj["status"])
+	resp.Body = fmt.Sprint(obj["body"])
+	resp.Headers = importHeaders(obj["headers"])
+
+	return append(append([]byte{}, payload[:headSize]...), resp.Bytes()...)
+}
+
+func (s *JSScript) String() string {
+	return "JavaScript: " + s.path
+}
+
+// exportObject converts value returned by script to map, returns false if script returned null or undefined
+func exportObject(v goja.Value) (map[string]interface{}, bool) {
+	if v == nil || goja.IsUndefined(v) || goja.IsNull(v) {
+		return nil, false
+	}
+
+	obj, ok := v.Export().(map[string]interface{})
+
+	return obj, ok
+}
+
+func exportHeaders(headers map[string]string) map[string]interface{} {
+	exported := make(map[string]interface{}, len(headers))
+	for name, value := range headers {
+		exported[name] = value
+	}
+
+	return exported
+}
+
+func importHeaders(v interface{}) map[string]string {
+	headers := make(map[string]string)
+
+	if exported, ok := v.(map[string]interface{}); ok {
+		for name, value := range exported {
+			// Headers set to null or undefined are removed
+			if value != nil {
+				headers[name] = fmt.Sprint(value)
+			}
+		}
+	}
+
+	return headers
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"log"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// LuaScript runs request through Lua script. Script should define `rewrite(req)` function,
+// which gets table with `method`, `url`, `headers` and `body` fields, and returns modified table, or nil to drop request:
+//
+//	function rewrite(req)
+//	    req.headers["X-Shadow"] = "1"
+//	    return req
+//	end
+type LuaScript struct {
+	path  string
+	state *lua.LState
+	fn    lua.LValue
+}
+
+// NewLuaScript loads script from file
+func NewLuaScript(path string) *LuaScript {
+	s := &LuaScript{path: path, state: lua.NewState()}
+
+	if err := s.state.DoFile(path); err != nil {
+		log.Fatal("[LUA] Can't load script: ", err)
+	}
+
+	s.fn = s.state.GetGlobal("rewrite")
+
+	if s.fn.Type() != lua.LTFunction {
+		log.Fatal("[LUA] Script should define `rewrite(req)` function: ", path)
+	}
+
+	return s
+}
+
+// Rewrite calls script for request payload. If script fails, request passed as is.
+func (s *LuaScript) Rewrite(payload []byte) []byte {
+	req := parseScriptRequest(payload)
+
+	if err := s.state.CallByParam(lua.P{Fn: s.fn, NRet: 1, Protect: true}, s.toTable(req)); err != nil {
+		log.Println("[LUA] Script error:", err)
+		return payload
+	}
+
+	ret := s.state.Get(-1)
+	s.state.Pop(1)
+
+	table, ok := ret.(*lua.LTable)
+	if !ok {
+		return nil
+	}
+
+	s.fromTable(req, table)
+
+	return req.Bytes()
+}
+
+func (s *LuaScript) toTable(req *scriptRequest) *lua.LTable {
+	table := s.state.NewTable()
+	table.RawSetString("method", lua.LString(req.Method))
+	table.RawSetString("url", lua.LString(req.URL))
+	table.RawSetString("body", lua.LString(req.Body))
+
+	headers := s.state.NewTable()
+	for name, value := range req.Headers {
+		headers.RawSetString(name, lua.LString(value))
+	}
+	table.RawSetString("headers", headers)
+
+	return table
+}
+
+func (s *LuaScript) fromTable(req *scriptRequest, table *lua.LTable) {
+	req.Method = lua.LVAsString(table.RawGetString("method"))
+	req.URL = lua.LVAsString(table.RawGetString("url"))
+	req.Body = lua.LVAsString(table.RawGetString("body"))
+
+	req.Headers = make(map[string]string)
+	if headers, ok := table.RawGetString("headers").(*lua.LTable); ok {
+		headers.ForEach(func(name, value lua.LValue) {
+			req.Headers[name.String()] = lua.LVAsString(value)
+		})
+	}
+}
+
+func (s *LuaScript) String() string {
+	return "Lua script: " + s.path
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestScriptRequest(t *testing.T) {
+	payload := []byte("POST /post HTTP/1.1\r\nHost: www.w3.org\r\nContent-Length: 7\r\n\r\na=1&b=2")
+
+	req := parseScriptRequest(payload)
+
+	if req.Method != "POST" || req.URL != "/post" || req.Headers["Host"] != "www.w3.org" || req.Body != "a=1&b=2" {
+		t.Error("Should parse request:", req)
+	}
+
+	if !bytes.Equal(req.Bytes(), payload) {
+		t.Error("Should serialize unmodified request as is:", string(req.Bytes()))
+	}
+
+	req.URL = "/v2/post"
+	req.Body = "a=1"
+	req.Headers["X-Shadow"] = "1"
+	delete(req.Headers, "Host")
+
+	expected := []byte("POST /v2/post HTTP/1.1\r\nContent-Length: 3\r\nX-Shadow: 1\r\n\r\na=1")
+
+	if !bytes.Equal(req.Bytes(), expected) {
+		t.Error("Should update Content-Length and keep header order:", string(req.Bytes()))
+	}
+}
+
+func TestScriptImportHeaders(t *testing.T) {
+	headers := importHeaders(map[string]interface{}{"Host": "www.w3.org", "Cookie": nil, "X-Retry": int64(1)})
+
+	if len(headers) != 2 || headers["Host"] != "www.w3.org" || headers["X-Retry"] != "1" {
+		t.Error("Should convert header values and drop null ones:", headers)
+	}
+}
+
+func TestWASMUnpackPtrLen(t *testing.T) {
+	if ptr, length := unpackPtrLen(1024<<32 | 18); ptr != 1024 || length != 18 {
+		t.Error("Should unpack pointer and length:", ptr, length)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Set on shutdown, emitter drops all new payloads so outputs can drain their queues
+var stopping int32
+
+// pendingPlugin implemented by outputs which know number of payloads queued or being sent
+type pendingPlugin interface {
+	Pending() int64
+}
+
+// watchShutdown closes stop channel on SIGTERM or SIGINT, so emitter stops and queues drained by shutdown.
+// Second signal exits immediately.
+func watchShutdown(stop chan int) {
+	c := make(chan os.Signal, 2)
+	signal.Notify(c, syscall.SIGTERM, syscall.SIGINT)
+
+	sig := <-c
+	log.Println("[SHUTDOWN] Received", sig, "draining queues, send signal again to exit immediately")
+	close(stop)
+
+	<-c
+	log.Println("[SHUTDOWN] Exiting without draining queues")
+	os.Exit(1)
+}
+
+// shutdown stops passing payloads to outputs, waits until their queues drained or timeout reached,
+// and closes outputs, so buffered data flushed and files not truncated
+func shutdown(timeout time.Duration) {
+	atomic.StoreInt32(&stopping, 1)
+
+	// Wait for payloads being processed by emitter
+	reloadMu.Lock()
+	outputs := Plugins.Outputs
+	reloadMu.Unlock()
+
+	deadline := time.Now().Add(timeout)
+
+	for {
+		pending := pendingPayloads(outputs)
+		if pending == 0 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			log.Println("[SHUTDOWN] Drain timeout reached,", pending, "payloads lost")
+			break
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	for _, out := range outputs {
+		if c, ok := unwrapPlugin(out).(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				log.Println("[SHUTDOWN] Can't close", out, ":", err)
+			}
+		}
+	}
+
+	statsd.Flush()
+	tracer.Flush()
+}
+
+// pendingPayloads returns total number of payloads queued or being sent by outputs
+func pendingPayloads(outputs []io.Writer) (pending int64) {
+	for _, out := range outputs {
+		plugin := unwrapPlugin(out)
+
+		if p, ok := plugin.(pendingPlugin); ok {
+			pending += p.Pending()
+		} else if q, ok := plugin.(queuedPlugin); ok {
+			length, _ := q.QueueLen()
+			pending += int64(length)
+		}
+	}
+
+	return
+}
+
+// unwrapPlugin returns plugin wrapped by limiter or anonymizer, they can wrap each other
+func unwrapPlugin(plugin interface{}) interface{} {
+	for {
+		switch p := plugin.(type) {
+		case *Limiter:
+			plugin = p.plugin
+		case *Anonymizer:
+			plugin = p.plugin
+		default:
+			return plugin
+		}
+	}
+}
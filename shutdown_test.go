@@ -0,0 +1,95 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestShutdownDrainsQueues(t *testing.T) {
+	var received int32
+	listener := startHTTP(func(req *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		atomic.AddInt32(&received, 1)
+	})
+	defer listener.Close()
+
+	output := NewHTTPOutput(listener.Addr().String(), &HTTPOutputConfig{workers: 1})
+	file := NewFileOutput("/tmp/test_shutdown.gor", &FileOutputConfig{})
+	defer os.Remove("/tmp/test_shutdown.gor")
+
+	Plugins.Outputs = []io.Writer{output, file}
+	defer atomic.StoreInt32(&stopping, 0)
+
+	for i := 0; i < 5; i++ {
+		output.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+		file.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+	}
+
+	shutdown(2 * time.Second)
+
+	if r := atomic.LoadInt32(&received); r != 5 {
+		t.Error("Should send all queued requests:", r)
+	}
+
+	if info, err := os.Stat("/tmp/test_shutdown.gor"); err != nil || info.Size() == 0 {
+		t.Error("Should flush file on close:", err)
+	}
+}
+
+func TestShutdownMultiplyJitter(t *testing.T) {
+	var received int32
+	listener := startHTTP(func(req *http.Request) {
+		atomic.AddInt32(&received, 1)
+	})
+	defer listener.Close()
+
+	output := NewHTTPOutput(listener.Addr().String(), &HTTPOutputConfig{workers: 1, multiply: 3, multiplyJitter: 200 * time.Millisecond})
+
+	Plugins.Outputs = []io.Writer{output}
+	defer atomic.StoreInt32(&stopping, 0)
+
+	output.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+
+	// Copies are scheduled, not queued yet, but shutdown should wait for them
+	shutdown(2 * time.Second)
+
+	if r := atomic.LoadInt32(&received); r != 3 {
+		t.Error("Should send delayed copies before closing output:", r)
+	}
+}
+
+func TestShutdownAnonymizedOutput(t *testing.T) {
+	file := NewFileOutput("/tmp/test_shutdown_anonymized.gor.gz", &FileOutputConfig{})
+	defer os.Remove("/tmp/test_shutdown_anonymized.gor.gz")
+
+	output := NewAnonymizer(NewLimiter(file, "100%"), &AnonymizerConfig{headers: MultiOption{"Authorization"}, mode: "mask"})
+
+	Plugins.Outputs = []io.Writer{output}
+	defer atomic.StoreInt32(&stopping, 0)
+
+	output.Write([]byte("1 1 1\nGET / HTTP/1.1\r\nAuthorization: secret\r\n\r\n"))
+
+	shutdown(time.Second)
+
+	f, err := os.Open("/tmp/test_shutdown_anonymized.gor.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal("Should write gzip header:", err)
+	}
+
+	// Truncated gzip stream fails with unexpected EOF
+	if data, err := ioutil.ReadAll(gz); err != nil || len(data) == 0 {
+		t.Error("Should close file wrapped by anonymizer:", err, string(data))
+	}
+}
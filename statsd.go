@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Keep packets below typical MTU, so they are not fragmented
+const statsdPacketSize = 1432
+
+// StatsdConfig struct for holding statsd metrics configuration
+type StatsdConfig struct {
+	prefix        string
+	tags          MultiOption
+	flushInterval time.Duration
+}
+
+// StatsdClient pushes counters and timings to statsd server over UDP.
+// Metrics buffered and sent in batches, either when packet is full or every flush interval.
+// If tags specified, they are added using DogStatsD format: `name:1|c|#env:prod`
+//
+// All methods are safe to call on nil client, so metrics can be reported unconditionally.
+type StatsdClient struct {
+	sync.Mutex
+
+	address string
+	conn    net.Conn
+	config  *StatsdConfig
+
+	tags string
+	buf  bytes.Buffer
+}
+
+// statsd is global metrics sink, initialized if `--statsd` specified
+var statsd *StatsdClient
+
+// NewStatsdClient constructor for StatsdClient
+func NewStatsdClient(address string, config *StatsdConfig) *StatsdClient {
+	conn, err := net.Dial("udp", address)
+
+	if err != nil {
+		log.Fatal("[STATSD] Can't connect to statsd server:", err)
+	}
+
+	s := &StatsdClient{address: address, conn: conn, config: config}
+
+	if len(config.tags) > 0 {
+		s.tags = "|#" + strings.Join(config.tags, ",")
+	}
+
+	if config.flushInterval == 0 {
+		config.flushInterval = time.Second
+	}
+
+	go s.flushLoop()
+
+	return s
+}
+
+// Incr increments counter by given value
+func (s *StatsdClient) Incr(name string, value int) {
+	s.send(name, strconv.Itoa(value), "c")
+}
+
+// Gauge sets gauge to given value
+func (s *StatsdClient) Gauge(name string, value int) {
+	s.send(name, strconv.Itoa(value), "g")
+}
+
+// Timing records duration in milliseconds
+func (s *StatsdClient) Timing(name string, d time.Duration) {
+	s.send(name, strconv.FormatFloat(d.Seconds()*1000, 'f', -1, 64), "ms")
+}
+
+func (s *StatsdClient) send(name, value, metricType string) {
+	if s == nil {
+		return
+	}
+
+	metric := s.config.prefix + name + ":" + value + "|" + metricType + s.tags
+
+	s.Lock()
+	defer s.Unlock()
+
+	if s.buf.Len() > 0 && s.buf.Len()+len(metric)+1 > statsdPacketSize {
+		s.flush()
+	}
+
+	if s.buf.Len() > 0 {
+		s.buf.WriteByte('\n')
+	}
+	s.buf.WriteString(metric)
+}
+
+// Flush sends buffered metrics immediately
+func (s *StatsdClient) Flush() {
+	if s == nil {
+		return
+	}
+
+	s.Lock()
+	s.flush()
+	s.Unlock()
+}
+
+func (s *StatsdClient) flush() {
+	if s.buf.Len() == 0 {
+		return
+	}
+
+	if _, err := s.conn.Write(s.buf.Bytes()); err != nil {
+		Debug("[STATSD] Failed to send metrics:", err)
+	}
+
+	s.buf.Reset()
+}
+
+func (s *StatsdClient) flushLoop() {
+	for {
+		time.Sleep(s.config.flushInterval)
+		s.Flush()
+	}
+}
+
+func (s *StatsdClient) String() string {
+	return "Statsd metrics: " + s.address
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestStatsdClient(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	client := NewStatsdClient(conn.LocalAddr().String(), &StatsdConfig{
+		prefix: "gor.",
+		tags:   MultiOption{"env:test", "team:api"},
+	})
+
+	client.Incr("input.requests", 1)
+	client.Timing("output_http.latency", 1500*time.Microsecond)
+	client.Flush()
+
+	buf := make([]byte, statsdPacketSize)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "gor.input.requests:1|c|#env:test,team:api\ngor.output_http.latency:1.5|ms|#env:test,team:api"
+	if string(buf[:n]) != expected {
+		t.Errorf("Expected %q, got %q", expected, buf[:n])
+	}
+}
+
+func TestStatsdClientNil(t *testing.T) {
+	var client *StatsdClient
+
+	// Should not panic
+	client.Incr("input.requests", 1)
+	client.Flush()
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"crypto/x509"
+	"io/ioutil"
+	"log"
+)
+
+// loadCertPool reads PEM encoded CA bundle
+func loadCertPool(path string) *x509.CertPool {
+	bundle, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		log.Fatal("Can't read CA file: ", err)
+	}
+
+	pool := x509.NewCertPool()
+
+	if !pool.AppendCertsFromPEM(bundle) {
+		log.Fatal("No certificates found in CA file: ", path)
+	}
+
+	return pool
+}
@@ -0,0 +1,511 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"hash"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// TLS record and handshake types, see https://tools.ietf.org/html/rfc8446#appendix-B
+const (
+	tlsRecordChangeCipherSpec = 20
+	tlsRecordAlert            = 21
+	tlsRecordHandshake        = 22
+	tlsRecordApplicationData  = 23
+
+	tlsHandshakeClientHello = 1
+	tlsHandshakeServerHello = 2
+	tlsHandshakeFinished    = 20
+	tlsHandshakeKeyUpdate   = 24
+
+	tlsExtensionSupportedVersions = 43
+
+	tlsVersion13 = 0x0304
+
+	tlsRecordHeaderSize = 5
+)
+
+// ServerHello with this random is HelloRetryRequest, and real ServerHello follows it
+var tlsHelloRetryRandom, _ = hex.DecodeString("cf21ad74e59a6111be1d8c021e65b891c2a211167abb8c5e079e09e2c8a8339c")
+
+// tlsSuite describes AEAD cipher suite: key length and hash used for key derivation.
+// ChaCha20-Poly1305 suites are not supported.
+type tlsSuite struct {
+	keyLen int
+	hash   func() hash.Hash
+}
+
+var tlsSuites = map[uint16]tlsSuite{
+	// TLS 1.3
+	0x1301: {16, sha256.New},
+	0x1302: {32, sha512.New384},
+	// TLS 1.2 AES-GCM
+	0xc02b: {16, sha256.New},
+	0xc02f: {16, sha256.New},
+	0xc02c: {32, sha512.New384},
+	0xc030: {32, sha512.New384},
+	0x009c: {16, sha256.New},
+	0x009d: {32, sha512.New384},
+}
+
+// tlsKeyLog reads secrets which TLS libraries write to SSLKEYLOGFILE, in NSS key log format:
+//
+//	CLIENT_RANDOM <client random> <master secret>
+//	CLIENT_TRAFFIC_SECRET_0 <client random> <secret>
+//
+// Services append new secrets as they accept connections, so file re-read if secret is not found.
+type tlsKeyLog struct {
+	sync.Mutex
+
+	path    string
+	offset  int64
+	secrets map[string][]byte
+}
+
+func newTLSKeyLog(path string) *tlsKeyLog {
+	return &tlsKeyLog{path: path, secrets: make(map[string][]byte)}
+}
+
+// secret returns secret with given label for connection identified by client random
+func (k *tlsKeyLog) secret(label string, clientRandom []byte) []byte {
+	k.Lock()
+	defer k.Unlock()
+
+	key := label + " " + hex.EncodeToString(clientRandom)
+
+	if secret, ok := k.secrets[key]; ok {
+		return secret
+	}
+
+	k.load()
+
+	return k.secrets[key]
+}
+
+// load reads lines added since last read
+func (k *tlsKeyLog) load() {
+	f, err := os.Open(k.path)
+	if err != nil {
+		Debug("[TLS] Can't read key log:", err)
+		return
+	}
+	defer f.Close()
+
+	if _, err = f.Seek(k.offset, io.SeekStart); err != nil {
+		return
+	}
+
+	reader := bufio.NewReader(f)
+
+	for {
+		line, err := reader.ReadString('\n')
+		// Line is still being written
+		if err != nil {
+			return
+		}
+
+		k.offset += int64(len(line))
+
+		fields := strings.Fields(line)
+		if len(fields) != 3 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		if secret, err := hex.DecodeString(fields[2]); err == nil {
+			k.secrets[fields[0]+" "+strings.ToLower(fields[1])] = secret
+		}
+	}
+}
+
+// tlsHalf is state of one direction of TLS connection
+type tlsHalf struct {
+	buf []byte
+	// Handshake messages can be split between records
+	handshake []byte
+
+	aead cipher.AEAD
+	iv   []byte
+	seq  uint64
+	// TLS 1.3 traffic secret, used to derive keys after KeyUpdate
+	secret []byte
+
+	encrypted bool
+
+	// Decrypted application data
+	plain []byte
+}
+
+// tlsConnection decrypts both directions of captured TLS connection using secrets from key log.
+// TLS 1.3 and TLS 1.2 connections using AES-GCM cipher suites supported.
+type tlsConnection struct {
+	keyLog *tlsKeyLog
+
+	clientRandom []byte
+	serverRandom []byte
+	version      uint16
+	suite        tlsSuite
+
+	client, server tlsHalf
+
+	// Set if connection started before capture, secrets are missing, or cipher suite is not supported
+	broken bool
+}
+
+func newTLSConnection(keyLog *tlsKeyLog) *tlsConnection {
+	return &tlsConnection{keyLog: keyLog}
+}
+
+// isTLSClientHello checks if data starts with handshake record containing ClientHello
+func isTLSClientHello(data []byte) bool {
+	return len(data) > tlsRecordHeaderSize && data[0] == tlsRecordHandshake && data[1] == 3 && data[5] == tlsHandshakeClientHello
+}
+
+// Write adds captured data of client or server side, decrypted application data accumulated in `plain` of each side
+func (c *tlsConnection) Write(data []byte, fromClient bool) {
+	if c.broken {
+		return
+	}
+
+	half := &c.server
+	if fromClient {
+		half = &c.client
+	}
+
+	half.buf = append(half.buf, data...)
+
+	// Client records after ClientHello can't be decrypted until ServerHello processed, and vice versa
+	for c.process(true) || c.process(false) {
+	}
+}
+
+// process handles complete records of one side, returns true if any record processed
+func (c *tlsConnection) process(fromClient bool) (progress bool) {
+	half := &c.server
+	if fromClient {
+		half = &c.client
+	}
+
+	// Server message can be received before ClientHello
+	if !fromClient && c.clientRandom == nil {
+		return
+	}
+
+	for !c.broken && len(half.buf) >= tlsRecordHeaderSize {
+		recordType := half.buf[0]
+		length := int(binary.BigEndian.Uint16(half.buf[3:5]))
+
+		if len(half.buf) < tlsRecordHeaderSize+length {
+			return
+		}
+
+		// Anything except plain text handshake needs negotiated version and keys
+		if (recordType != tlsRecordHandshake || half.encrypted) && c.serverRandom == nil {
+			return
+		}
+
+		record := half.buf[:tlsRecordHeaderSize+length]
+		half.buf = half.buf[tlsRecordHeaderSize+length:]
+		progress = true
+
+		c.record(half, fromClient, record)
+	}
+
+	return
+}
+
+func (c *tlsConnection) fail(err string) {
+	c.broken = true
+	c.client = tlsHalf{}
+	c.server = tlsHalf{}
+
+	Debug("[TLS] Can't decrypt connection:", err)
+}
+
+func (c *tlsConnection) record(half *tlsHalf, fromClient bool, record []byte) {
+	recordType, payload := record[0], record[tlsRecordHeaderSize:]
+
+	// TLS 1.3 sends ChangeCipherSpec only for compatibility with middleboxes
+	if recordType == tlsRecordChangeCipherSpec {
+		if c.version != tlsVersion13 {
+			half.encrypted = true
+			c.setupTLS12Keys()
+		}
+		return
+	}
+
+	if half.encrypted {
+		var err error
+		if recordType, payload, err = c.decrypt(half, record); err != nil {
+			c.fail("invalid record: " + err.Error())
+			return
+		}
+	}
+
+	switch recordType {
+	case tlsRecordHandshake:
+		half.handshake = append(half.handshake, payload...)
+		c.handshake(half, fromClient)
+	case tlsRecordApplicationData:
+		half.plain = append(half.plain, payload...)
+	}
+}
+
+// handshake parses complete handshake messages
+func (c *tlsConnection) handshake(half *tlsHalf, fromClient bool) {
+	for len(half.handshake) >= 4 {
+		msgType := half.handshake[0]
+		length := int(half.handshake[1])<<16 | int(half.handshake[2])<<8 | int(half.handshake[3])
+
+		if len(half.handshake) < 4+length {
+			return
+		}
+
+		body := half.handshake[4 : 4+length]
+		half.handshake = half.handshake[4+length:]
+
+		switch msgType {
+		case tlsHandshakeClientHello:
+			if len(body) >= 34 {
+				c.clientRandom = append([]byte{}, body[2:34]...)
+			}
+		case tlsHandshakeServerHello:
+			c.serverHello(body)
+		case tlsHandshakeFinished:
+			// TLS 1.3 switches from handshake to application keys after Finished
+			if c.version == tlsVersion13 {
+				label := "SERVER_TRAFFIC_SECRET_0"
+				if fromClient {
+					label = "CLIENT_TRAFFIC_SECRET_0"
+				}
+				c.setupTLS13Keys(half, label)
+			}
+		case tlsHandshakeKeyUpdate:
+			if c.version == tlsVersion13 && half.secret != nil {
+				c.setTLS13Secret(half, hkdfExpandLabel(c.suite.hash, half.secret, "traffic upd", nil, c.suite.hash().Size()))
+			}
+		}
+
+		if c.broken {
+			return
+		}
+	}
+}
+
+func (c *tlsConnection) serverHello(body []byte) {
+	if len(body) < 35 {
+		c.fail("invalid ServerHello")
+		return
+	}
+
+	random := body[2:34]
+	if bytes.Equal(random, tlsHelloRetryRandom) {
+		return
+	}
+
+	c.version = binary.BigEndian.Uint16(body[0:2])
+
+	pos := 35 + int(body[34])
+	if len(body) < pos+3 {
+		c.fail("invalid ServerHello")
+		return
+	}
+
+	suiteID := binary.BigEndian.Uint16(body[pos : pos+2])
+	pos += 3
+
+	// Extensions
+	if len(body) >= pos+2 {
+		exts := body[pos+2:]
+
+		for len(exts) >= 4 {
+			extType := binary.BigEndian.Uint16(exts[0:2])
+			extLen := int(binary.BigEndian.Uint16(exts[2:4]))
+			if len(exts) < 4+extLen {
+				break
+			}
+
+			if extType == tlsExtensionSupportedVersions && extLen == 2 {
+				c.version = binary.BigEndian.Uint16(exts[4:6])
+			}
+
+			exts = exts[4+extLen:]
+		}
+	}
+
+	suite, ok := tlsSuites[suiteID]
+	if !ok {
+		c.fail("unsupported cipher suite 0x" + hex.EncodeToString(body[pos-3:pos-1]))
+		return
+	}
+
+	c.suite = suite
+	c.serverRandom = append([]byte{}, random...)
+
+	// Everything after ServerHello encrypted using handshake keys
+	if c.version == tlsVersion13 {
+		c.client.encrypted = true
+		c.server.encrypted = true
+
+		c.setupTLS13Keys(&c.client, "CLIENT_HANDSHAKE_TRAFFIC_SECRET")
+		c.setupTLS13Keys(&c.server, "SERVER_HANDSHAKE_TRAFFIC_SECRET")
+	}
+}
+
+func (c *tlsConnection) setupTLS13Keys(half *tlsHalf, label string) {
+	secret := c.keyLog.secret(label, c.clientRandom)
+	if secret == nil {
+		c.fail(label + " not found in key log")
+		return
+	}
+
+	c.setTLS13Secret(half, secret)
+}
+
+// setTLS13Secret derives key and IV from traffic secret, see https://tools.ietf.org/html/rfc8446#section-7.3
+func (c *tlsConnection) setTLS13Secret(half *tlsHalf, secret []byte) {
+	key := hkdfExpandLabel(c.suite.hash, secret, "key", nil, c.suite.keyLen)
+
+	half.secret = secret
+	half.iv = hkdfExpandLabel(c.suite.hash, secret, "iv", nil, 12)
+	half.aead = newGCM(key)
+	half.seq = 0
+}
+
+// setupTLS12Keys derives keys of both sides from master secret, see https://tools.ietf.org/html/rfc5246#section-6.3
+func (c *tlsConnection) setupTLS12Keys() {
+	if c.client.aead != nil {
+		return
+	}
+
+	master := c.keyLog.secret("CLIENT_RANDOM", c.clientRandom)
+	if master == nil {
+		c.fail("CLIENT_RANDOM not found in key log")
+		return
+	}
+
+	keyLen := c.suite.keyLen
+	seed := append(append([]byte{}, c.serverRandom...), c.clientRandom...)
+	keys := tls12PRF(c.suite.hash, master, "key expansion", seed, 2*keyLen+8)
+
+	c.client.aead = newGCM(keys[:keyLen])
+	c.server.aead = newGCM(keys[keyLen : 2*keyLen])
+	c.client.iv = keys[2*keyLen : 2*keyLen+4]
+	c.server.iv = keys[2*keyLen+4 : 2*keyLen+8]
+}
+
+// decrypt opens encrypted record, and returns its real type and content
+func (c *tlsConnection) decrypt(half *tlsHalf, record []byte) (recordType byte, content []byte, err error) {
+	header, payload := record[:tlsRecordHeaderSize], record[tlsRecordHeaderSize:]
+
+	var seq [8]byte
+	binary.BigEndian.PutUint64(seq[:], half.seq)
+	half.seq++
+
+	if c.version == tlsVersion13 {
+		nonce := append([]byte{}, half.iv...)
+		for i := 0; i < 8; i++ {
+			nonce[4+i] ^= seq[i]
+		}
+
+		if content, err = half.aead.Open(nil, nonce, payload, header); err != nil {
+			return
+		}
+
+		// Inner plain text is content, real type and padding zeros
+		end := len(content) - 1
+		for end >= 0 && content[end] == 0 {
+			end--
+		}
+		if end < 0 {
+			return 0, nil, errTLSRecord
+		}
+
+		return content[end], content[:end], nil
+	}
+
+	// TLS 1.2 GCM record starts with explicit part of nonce
+	overhead := 8 + half.aead.Overhead()
+	if len(payload) < overhead {
+		return 0, nil, errTLSRecord
+	}
+
+	nonce := append(append([]byte{}, half.iv...), payload[:8]...)
+
+	aad := make([]byte, 13)
+	copy(aad, seq[:])
+	copy(aad[8:], header[:3])
+	binary.BigEndian.PutUint16(aad[11:], uint16(len(payload)-overhead))
+
+	content, err = half.aead.Open(nil, nonce, payload[8:], aad)
+
+	return header[0], content, err
+}
+
+type tlsError string
+
+func (e tlsError) Error() string { return string(e) }
+
+const errTLSRecord = tlsError("malformed record")
+
+func newGCM(key []byte) cipher.AEAD {
+	block, _ := aes.NewCipher(key)
+	aead, _ := cipher.NewGCM(block)
+
+	return aead
+}
+
+// hkdfExpandLabel implements HKDF-Expand-Label of TLS 1.3
+func hkdfExpandLabel(h func() hash.Hash, secret []byte, label string, context []byte, length int) []byte {
+	label = "tls13 " + label
+
+	info := make([]byte, 0, 4+len(label)+len(context))
+	info = append(info, byte(length>>8), byte(length), byte(len(label)))
+	info = append(info, label...)
+	info = append(info, byte(len(context)))
+	info = append(info, context...)
+
+	// HKDF-Expand, see https://tools.ietf.org/html/rfc5869#section-2.3
+	var out, t []byte
+	for i := byte(1); len(out) < length; i++ {
+		mac := hmac.New(h, secret)
+		mac.Write(t)
+		mac.Write(info)
+		mac.Write([]byte{i})
+		t = mac.Sum(nil)
+		out = append(out, t...)
+	}
+
+	return out[:length]
+}
+
+// tls12PRF implements TLS 1.2 pseudo random function using P_hash
+func tls12PRF(h func() hash.Hash, secret []byte, label string, seed []byte, length int) []byte {
+	seed = append([]byte(label), seed...)
+
+	var out []byte
+	a := seed
+
+	for len(out) < length {
+		mac := hmac.New(h, secret)
+		mac.Write(a)
+		a = mac.Sum(nil)
+
+		mac = hmac.New(h, secret)
+		mac.Write(a)
+		mac.Write(seed)
+		out = append(out, mac.Sum(nil)...)
+	}
+
+	return out[:length]
+}
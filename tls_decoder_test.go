@@ -0,0 +1,206 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestTLSKeyDerivation(t *testing.T) {
+	// Derive-Secret(early secret, "derived", "") from RFC 8448, section 3
+	secret, _ := hex.DecodeString("33ad0a1c607ec03b09e6cd9893680ce210adf300aa1f2660e1b22e10f170f92a")
+	empty := sha256.Sum256(nil)
+
+	derived := hkdfExpandLabel(sha256.New, secret, "derived", empty[:], 32)
+	if hex.EncodeToString(derived) != "6f2615a108c702c5678f54fc9dbab69716c076189c48250cebeac3576c3611ba" {
+		t.Error("Wrong HKDF-Expand-Label result:", hex.EncodeToString(derived))
+	}
+
+	// P_SHA256 output is prefix of longer output
+	long := tls12PRF(sha256.New, secret, "key expansion", []byte("seed"), 72)
+	if short := tls12PRF(sha256.New, secret, "key expansion", []byte("seed"), 40); hex.EncodeToString(short) != hex.EncodeToString(long[:40]) {
+		t.Error("PRF output should not depend on length")
+	}
+}
+
+func TestRAWInputTLSKeyLog(t *testing.T) {
+	t.Run("TLS1.2", func(t *testing.T) { testRAWInputTLSKeyLog(t, tls.VersionTLS12) })
+	t.Run("TLS1.3", func(t *testing.T) { testRAWInputTLSKeyLog(t, tls.VersionTLS13) })
+}
+
+func testRAWInputTLSKeyLog(t *testing.T, version uint16) {
+	wg := new(sync.WaitGroup)
+	quit := make(chan int)
+
+	keyLog, err := ioutil.TempFile("", "gor_keylog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(keyLog.Name())
+	defer keyLog.Close()
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write(append([]byte("echo:"), body...))
+	}))
+	server.TLS = &tls.Config{KeyLogWriter: keyLog}
+	server.StartTLS()
+	defer server.Close()
+
+	input := NewRAWInput(server.Listener.Addr().String(), &RAWInputConfig{trackResponse: true, tlsKeyLog: keyLog.Name()})
+
+	payloads := make(map[string][]string)
+	mu := new(sync.Mutex)
+
+	output := NewTestOutput(func(data []byte) {
+		mu.Lock()
+		id := string(payloadID(data))
+		payloads[id] = append(payloads[id], string(data[0])+" "+string(payloadBody(data)))
+		mu.Unlock()
+
+		wg.Done()
+	})
+
+	Plugins.Inputs = []io.Reader{input}
+	Plugins.Outputs = []io.Writer{output}
+
+	go Start(quit)
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		InsecureSkipVerify: true,
+		MaxVersion:         version,
+		// Only TLS 1.2 suites can be configured
+		CipherSuites: []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256},
+	}}}
+
+	// Requests sent over the same connection
+	for n := 0; n < 3; n++ {
+		wg.Add(2)
+
+		resp, err := client.Post(server.URL+"/upload", "text/plain", strings.NewReader("hello"+strconv.Itoa(n)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+
+	wg.Wait()
+
+	if len(payloads) != 3 {
+		t.Fatal("Each request and its response should share id:", payloads)
+	}
+
+	for _, p := range payloads {
+		if !strings.HasPrefix(p[0], "1 POST /upload HTTP/1.1\r\n") || !strings.HasSuffix(p[0], "\r\n\r\nhello"+p[0][len(p[0])-1:]) {
+			t.Errorf("Wrong request: %q", p[0])
+		}
+
+		if !strings.HasPrefix(p[1], "2 HTTP/1.1 200 OK\r\n") || !strings.HasSuffix(p[1], "echo:hello"+p[0][len(p[0])-1:]) {
+			t.Errorf("Wrong response: %q", p[1])
+		}
+	}
+
+	close(quit)
+}
+
+func TestRAWInputTLSKeyLogClients(t *testing.T) {
+	wg := new(sync.WaitGroup)
+	quit := make(chan int)
+
+	keyLog, err := ioutil.TempFile("", "gor_keylog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(keyLog.Name())
+	defer keyLog.Close()
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write(append([]byte("echo:"), body...))
+	}))
+	server.TLS = &tls.Config{KeyLogWriter: keyLog}
+	server.StartTLS()
+	defer server.Close()
+
+	// Responses sent to other client address captured only by socket bound to all addresses
+	_, serverPort, _ := net.SplitHostPort(server.Listener.Addr().String())
+	input := NewRAWInput(":"+serverPort, &RAWInputConfig{trackResponse: true, tlsKeyLog: keyLog.Name()})
+
+	payloads := make(map[string][]string)
+	mu := new(sync.Mutex)
+
+	output := NewTestOutput(func(data []byte) {
+		mu.Lock()
+		id := string(payloadID(data))
+		payloads[id] = append(payloads[id], string(payloadBody(data)))
+		mu.Unlock()
+
+		wg.Done()
+	})
+
+	Plugins.Inputs = []io.Reader{input}
+	Plugins.Outputs = []io.Writer{output}
+
+	go Start(quit)
+
+	// Free port, used by clients on different hosts
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	newClient := func(ip string) *http.Client {
+		dialer := &net.Dialer{LocalAddr: &net.TCPAddr{IP: net.ParseIP(ip), Port: port}}
+
+		return &http.Client{Transport: &http.Transport{
+			DialContext:     dialer.DialContext,
+			MaxConnsPerHost: 1,
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		}}
+	}
+
+	clients := []*http.Client{newClient("127.0.0.1"), newClient("127.0.0.2")}
+
+	// Connections of both clients are kept open between requests
+	for n, client := range []*http.Client{clients[0], clients[1], clients[0]} {
+		wg.Add(2)
+
+		resp, err := client.Post(server.URL, "text/plain", strings.NewReader("hello"+strconv.Itoa(n)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+
+	wg.Wait()
+
+	if len(payloads) != 3 {
+		t.Fatal("Each request and its response should share id:", payloads)
+	}
+
+	for _, p := range payloads {
+		n := p[0][len(p[0])-1:]
+
+		if !strings.HasSuffix(p[0], "\r\n\r\nhello"+n) || !strings.HasSuffix(p[1], "echo:hello"+n) {
+			t.Errorf("Wrong request or response: %q", p)
+		}
+	}
+
+	close(quit)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+
+	"github.com/buger/gor/proto"
+)
+
+// Modes of `--output-http-traceparent`
+const (
+	// New trace started for each replayed request, recorded trace context ignored
+	traceparentGenerate = "generate"
+	// Replayed request continues recorded trace as child span, new trace started if request has no trace context
+	traceparentPropagate = "propagate"
+)
+
+// Sampled flag of trace context, set for generated traces so tracing backend keeps them
+const traceSampled = 1
+
+// traceContext is W3C trace context, sent in `traceparent` header as `00-<trace-id>-<parent-id>-<flags>`.
+// See https://www.w3.org/TR/trace-context/
+type traceContext struct {
+	traceID [16]byte
+	spanID  [8]byte
+	flags   byte
+}
+
+// newTraceContext starts new sampled trace
+func newTraceContext() (tc traceContext) {
+	rand.Read(tc.traceID[:])
+	rand.Read(tc.spanID[:])
+	tc.flags = traceSampled
+
+	return
+}
+
+// parseTraceparent parses value of `traceparent` header, returns false if it is invalid
+func parseTraceparent(value []byte) (tc traceContext, ok bool) {
+	parts := bytes.Split(bytes.TrimSpace(value), []byte("-"))
+
+	// Future versions can have more fields, but first 4 have same format
+	if len(parts) < 4 || len(parts[0]) != 2 || string(parts[0]) == "ff" || (string(parts[0]) == "00" && len(parts) != 4) {
+		return tc, false
+	}
+
+	var flags [1]byte
+	if !decodeHex(tc.traceID[:], parts[1]) || !decodeHex(tc.spanID[:], parts[2]) || !decodeHex(flags[:], parts[3]) {
+		return tc, false
+	}
+	tc.flags = flags[0]
+
+	// All zero trace and span ids are invalid
+	if tc.traceID == [16]byte{} || tc.spanID == [8]byte{} {
+		return tc, false
+	}
+
+	return tc, true
+}
+
+// decodeHex decodes lowercase hex string, which should fill dst exactly
+func decodeHex(dst, src []byte) bool {
+	if hex.EncodedLen(len(dst)) != len(src) || !bytes.Equal(bytes.ToLower(src), src) {
+		return false
+	}
+
+	_, err := hex.Decode(dst, src)
+
+	return err == nil
+}
+
+// child returns context of new span in the same trace
+func (tc traceContext) child() traceContext {
+	rand.Read(tc.spanID[:])
+
+	return tc
+}
+
+func (tc traceContext) String() string {
+	return "00-" + hex.EncodeToString(tc.traceID[:]) + "-" + hex.EncodeToString(tc.spanID[:]) + "-" + hex.EncodeToString([]byte{tc.flags})
+}
+
+// requestTrace returns trace context of replayed request, and id of parent span if request continues recorded trace
+func requestTrace(request []byte, mode string) (tc traceContext, parentID [8]byte) {
+	if mode != traceparentGenerate {
+		if recorded, ok := parseTraceparent(proto.Header(request, []byte("traceparent"))); ok {
+			return recorded.child(), recorded.spanID
+		}
+	}
+
+	return newTraceContext(), parentID
+}
+
+func validTraceparentMode(mode string) {
+	switch mode {
+	case "", traceparentGenerate, traceparentPropagate:
+	default:
+		log.Fatal("[TRACE] Traceparent mode should be 'generate' or 'propagate': ", mode)
+	}
+}
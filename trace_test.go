@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestTraceparent(t *testing.T) {
+	value := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	tc, ok := parseTraceparent([]byte(value))
+	if !ok || tc.String() != value {
+		t.Error("Should parse traceparent:", tc)
+	}
+
+	for _, invalid := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	} {
+		if _, ok := parseTraceparent([]byte(invalid)); ok {
+			t.Error("Should not parse invalid traceparent:", invalid)
+		}
+	}
+
+	request := []byte("GET / HTTP/1.1\r\nTraceparent: " + value + "\r\n\r\n")
+
+	child, parentID := requestTrace(request, traceparentPropagate)
+	if child.traceID != tc.traceID || parentID != tc.spanID || child.spanID == tc.spanID || child.flags != tc.flags {
+		t.Error("Should continue recorded trace:", child, parentID)
+	}
+
+	generated, parentID := requestTrace(request, traceparentGenerate)
+	if generated.traceID == tc.traceID || parentID != [8]byte{} || generated.flags != traceSampled {
+		t.Error("Should start new trace:", generated, parentID)
+	}
+
+	if _, ok := parseTraceparent([]byte(generated.String())); !ok {
+		t.Error("Generated traceparent should be valid:", generated)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// WASMPlugin transforms requests using WebAssembly module, so plugins can be written in any language compiling to WASM.
+// Module runs in sandbox: it has no access to file system, network or environment.
+//
+// Module ABI:
+//
+//	memory                          exported linear memory
+//	alloc(size i32) -> i32          allocates buffer for request, returns pointer
+//	transform(ptr i32, len i32) -> i64
+//	                                transforms request, returns pointer to result in high 32 bits and its length in low 32 bits.
+//	                                Zero length means request should be dropped.
+//	dealloc(ptr i32, size i32)      optional, frees buffers allocated for request and result
+type WASMPlugin struct {
+	path string
+	ctx  context.Context
+
+	runtime wazero.Runtime
+	module  api.Module
+
+	alloc     api.Function
+	transform api.Function
+	dealloc   api.Function
+}
+
+// NewWASMPlugin compiles and instantiates module from file
+func NewWASMPlugin(path string) *WASMPlugin {
+	p := &WASMPlugin{path: path, ctx: context.Background()}
+
+	source, err := ioutil.ReadFile(path)
+	if err != nil {
+		log.Fatal("[WASM] Can't read plugin: ", err)
+	}
+
+	p.runtime = wazero.NewRuntime(p.ctx)
+
+	// Modules compiled by Go, Rust or AssemblyScript toolchains usually depend on WASI. No directories or env variables exposed.
+	wasi_snapshot_preview1.MustInstantiate(p.ctx, p.runtime)
+
+	if p.module, err = p.runtime.Instantiate(p.ctx, source); err != nil {
+		log.Fatal("[WASM] Can't instantiate plugin: ", err)
+	}
+
+	p.alloc = p.module.ExportedFunction("alloc")
+	p.transform = p.module.ExportedFunction("transform")
+	p.dealloc = p.module.ExportedFunction("dealloc")
+
+	if p.alloc == nil || p.transform == nil || p.module.Memory() == nil {
+		log.Fatal("[WASM] Plugin should export `memory`, `alloc` and `transform`: ", path)
+	}
+
+	return p
+}
+
+// Rewrite passes request to module. If module fails, request passed as is.
+func (p *WASMPlugin) Rewrite(payload []byte) []byte {
+	results, err := p.alloc.Call(p.ctx, uint64(len(payload)))
+	if err != nil {
+		log.Println("[WASM] alloc failed:", err)
+		return payload
+	}
+
+	ptr := uint32(results[0])
+	defer p.free(ptr, uint32(len(payload)))
+
+	if !p.module.Memory().Write(ptr, payload) {
+		log.Println("[WASM] alloc returned buffer out of memory range")
+		return payload
+	}
+
+	if results, err = p.transform.Call(p.ctx, uint64(ptr), uint64(len(payload))); err != nil {
+		log.Println("[WASM] transform failed:", err)
+		return payload
+	}
+
+	resultPtr, resultLen := unpackPtrLen(results[0])
+	if resultLen == 0 {
+		return nil
+	}
+	defer p.free(resultPtr, resultLen)
+
+	result, ok := p.module.Memory().Read(resultPtr, resultLen)
+	if !ok {
+		log.Println("[WASM] transform returned buffer out of memory range")
+		return payload
+	}
+
+	// Memory view is invalidated by next call, so result should be copied
+	return append([]byte{}, result...)
+}
+
+func (p *WASMPlugin) free(ptr, size uint32) {
+	if p.dealloc != nil {
+		p.dealloc.Call(p.ctx, uint64(ptr), uint64(size))
+	}
+}
+
+func (p *WASMPlugin) String() string {
+	return "WASM plugin: " + p.path
+}
+
+// unpackPtrLen splits i64 returned by `transform` into pointer (high 32 bits) and length (low 32 bits)
+func unpackPtrLen(v uint64) (ptr, length uint32) {
+	return uint32(v >> 32), uint32(v)
+}